@@ -0,0 +1,99 @@
+package bigcache
+
+import (
+	"context"
+	"runtime/metrics"
+)
+
+// adaptiveSteps is the number of steps between bounds of adaptive sizing, the cache grows by one step
+// and shrinks by two, so it backs off quickly under pressure
+const adaptiveSteps = 10
+
+// runtimeStats are readings of runtime/metrics the adaptive sizing is based on
+type runtimeStats struct {
+	heapGoal uint64
+	// memoryLimit is 0 when it is not set
+	memoryLimit uint64
+	gcCPU       float64
+	totalCPU    float64
+}
+
+// readRuntimeStats reads the heap goal, the runtime memory limit and cumulative CPU seconds,
+// metrics unknown to the Go version are left 0
+func readRuntimeStats() runtimeStats {
+	samples := []metrics.Sample{
+		{Name: "/gc/heap/goal:bytes"},
+		{Name: "/gc/gomemlimit:bytes"},
+		{Name: "/cpu/classes/gc/total:cpu-seconds"},
+		{Name: "/cpu/classes/total:cpu-seconds"},
+	}
+	metrics.Read(samples)
+	var stats runtimeStats
+	if samples[0].Value.Kind() == metrics.KindUint64 {
+		stats.heapGoal = samples[0].Value.Uint64()
+	}
+	// math.MaxInt64 means no limit
+	if samples[1].Value.Kind() == metrics.KindUint64 && samples[1].Value.Uint64() < 1<<63-1 {
+		stats.memoryLimit = samples[1].Value.Uint64()
+	}
+	if samples[2].Value.Kind() == metrics.KindFloat64 && samples[3].Value.Kind() == metrics.KindFloat64 {
+		stats.gcCPU = samples[2].Value.Float64()
+		stats.totalCPU = samples[3].Value.Float64()
+	}
+	return stats
+}
+
+// adaptiveMonitor adjusts HardMaxCacheSize within bounds to the GC CPU fraction and the heap goal
+type adaptiveMonitor struct {
+	cache      *BigCache
+	minSize    int
+	maxSize    int
+	step       int
+	gcFraction float64
+	read       func() runtimeStats
+	last       runtimeStats
+}
+
+func newAdaptiveMonitor(cache *BigCache) *adaptiveMonitor {
+	m := &adaptiveMonitor{
+		cache:      cache,
+		minSize:    cache.config.AdaptiveMinCacheSize,
+		maxSize:    cache.config.AdaptiveMaxCacheSize,
+		step:       max((cache.config.AdaptiveMaxCacheSize-cache.config.AdaptiveMinCacheSize)/adaptiveSteps, 1),
+		gcFraction: cache.config.adaptiveGCFraction(),
+		read:       readRuntimeStats,
+	}
+	m.last = m.read()
+	return m
+}
+
+// check compares runtime stats with the previous reading and resizes the cache, it returns the new size in MB
+func (m *adaptiveMonitor) check() int {
+	stats := m.read()
+	fraction := 0.0
+	if stats.totalCPU > m.last.totalCPU {
+		fraction = (stats.gcCPU - m.last.gcCPU) / (stats.totalCPU - m.last.totalCPU)
+	}
+	m.last = stats
+
+	// the heap goal has to leave room for the cache to grow into
+	limit := uint64(float64(stats.memoryLimit) * runtimeMemoryLimitRatio)
+	growth := uint64(convertMBToBytes(m.step))
+
+	size := m.cache.HardMaxCacheSize()
+	newSize := size
+	switch {
+	case fraction > m.gcFraction || (limit > 0 && stats.heapGoal > limit):
+		newSize = max(size-2*m.step, m.minSize)
+	case fraction < m.gcFraction/2 && (limit == 0 || stats.heapGoal+growth <= limit):
+		newSize = min(size+m.step, m.maxSize)
+	}
+	if newSize == size {
+		return size
+	}
+	m.cache.SetHardMaxCacheSizeContext(WithAuditInfo(context.Background(), "bigcache", "adaptive sizing"), newSize)
+	if m.cache.isVerbose() {
+		newLogger(m.cache.config.Logger).Printf("GC CPU fraction %.3f and heap goal %d bytes, resized cache from %d MB to %d MB", fraction, stats.heapGoal, size, newSize)
+	}
+	return newSize
+}
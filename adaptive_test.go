@@ -0,0 +1,175 @@
+package bigcache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSetHardMaxCacheSizeShrinksCache(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		HardMaxCacheSize:   2,
+	})
+	for i := 0; i < 10000; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), blob('a', 200))
+	}
+
+	// when
+	err := cache.SetHardMaxCacheSize(1)
+
+	// then
+	noError(t, err)
+	assertEqual(t, 1, cache.HardMaxCacheSize())
+	if cache.Capacity() > 1024*1024 {
+		t.Errorf("Expected capacity of at most 1 MB, got %d", cache.Capacity())
+	}
+	_, err = cache.Get("key0")
+	assertEqual(t, ErrEntryNotFound, err)
+	value, err := cache.Get("key9999")
+	noError(t, err)
+	assertEqual(t, blob('a', 200), value)
+	assertEqual(t, 0, len(cache.Verify()))
+
+	// when
+	for i := 10000; i < 20000; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), blob('a', 200))
+	}
+
+	// then
+	if cache.Capacity() > 1024*1024 {
+		t.Errorf("Expected capacity of at most 1 MB, got %d", cache.Capacity())
+	}
+}
+
+func TestSetHardMaxCacheSizeGrowsCache(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		HardMaxCacheSize:   1,
+	})
+
+	// when
+	cache.SetHardMaxCacheSize(2)
+	for i := 0; i < 8000; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), blob('a', 200))
+	}
+
+	// then
+	if cache.Capacity() <= 1024*1024 {
+		t.Errorf("Expected capacity above 1 MB, got %d", cache.Capacity())
+	}
+	_, err := cache.Get("key0")
+	noError(t, err)
+	assertEqual(t, ErrInvalidCacheSize, cache.SetHardMaxCacheSize(-1))
+	assertEqual(t, ErrCacheSizeTooBig, cache.SetHardMaxCacheSize(maximumCacheSize()+1))
+}
+
+func TestAdaptiveSizingStartsWithinBounds(t *testing.T) {
+	t.Parallel()
+
+	// when
+	cache, _ := New(context.Background(), Config{
+		Shards:               1,
+		LifeWindow:           time.Minute,
+		AdaptiveMinCacheSize: 2,
+		AdaptiveMaxCacheSize: 10,
+	})
+
+	// then
+	assertEqual(t, 2, cache.HardMaxCacheSize())
+}
+
+func TestAdaptiveMonitorResizesCache(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:               1,
+		LifeWindow:           time.Minute,
+		AdaptiveMinCacheSize: 10,
+		AdaptiveMaxCacheSize: 20,
+		HardMaxCacheSize:     15,
+	})
+	stats := runtimeStats{}
+	monitor := newAdaptiveMonitor(cache)
+	monitor.read = func() runtimeStats { return stats }
+	monitor.last = stats
+
+	// when GC is idle
+	stats.gcCPU, stats.totalCPU = 0.01, 1
+
+	// then
+	assertEqual(t, 16, monitor.check())
+
+	// when GC takes too much CPU
+	stats.gcCPU, stats.totalCPU = 0.21, 2
+
+	// then
+	assertEqual(t, 14, monitor.check())
+
+	// when GC is neither idle nor busy
+	stats.gcCPU, stats.totalCPU = 0.25, 3
+
+	// then
+	assertEqual(t, 14, monitor.check())
+
+	// when heap goal exceeds the memory limit
+	stats.totalCPU, stats.heapGoal, stats.memoryLimit = 4, 95<<20, 100<<20
+
+	// then
+	assertEqual(t, 12, monitor.check())
+	assertEqual(t, 12, cache.HardMaxCacheSize())
+
+	// when heap goal leaves no room to grow
+	stats.totalCPU, stats.heapGoal = 5, 89<<20+1
+
+	// then
+	assertEqual(t, 12, monitor.check())
+}
+
+func TestAdaptiveMonitorKeepsBounds(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:               1,
+		LifeWindow:           time.Minute,
+		AdaptiveMinCacheSize: 1,
+		AdaptiveMaxCacheSize: 2,
+	})
+	stats := runtimeStats{}
+	monitor := newAdaptiveMonitor(cache)
+	monitor.read = func() runtimeStats { return stats }
+	monitor.last = stats
+
+	// when
+	for i := 1; i <= 5; i++ {
+		stats.totalCPU = float64(i)
+		monitor.check()
+	}
+
+	// then
+	assertEqual(t, 2, cache.HardMaxCacheSize())
+
+	// when
+	for i := 6; i <= 10; i++ {
+		stats.gcCPU, stats.totalCPU = float64(i), float64(i)
+		monitor.check()
+	}
+
+	// then
+	assertEqual(t, 1, cache.HardMaxCacheSize())
+}
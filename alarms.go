@@ -0,0 +1,62 @@
+package bigcache
+
+import "time"
+
+// AlarmSnapshot describes the cache at the end of the AlarmWindow in which an alarm was raised
+type AlarmSnapshot struct {
+	// Window is the duration in which rates were measured
+	Window time.Duration
+	// Stats are cumulative statistics of the cache
+	Stats Stats
+	// Evictions is a number of entries evicted for lack of space in the window
+	Evictions int64
+	// EvictionRate is a number of entries evicted for lack of space per second in the window
+	EvictionRate float64
+	// Reads is a number of hits and misses in the window
+	Reads int64
+	// HitRatio is the ratio of hits to reads in the window
+	HitRatio float64
+	// Len is the number of entries in the cache
+	Len int
+	// Capacity is the number of bytes allocated for entries
+	Capacity int
+}
+
+// alarmMonitor compares statistics of consecutive alarm windows
+type alarmMonitor struct {
+	cache    *BigCache
+	previous Stats
+}
+
+func newAlarmMonitor(cache *BigCache) *alarmMonitor {
+	return &alarmMonitor{
+		cache:    cache,
+		previous: cache.Stats(),
+	}
+}
+
+// check raises alarms for the window which has just ended
+func (m *alarmMonitor) check(window time.Duration) {
+	config := m.cache.config
+	stats := m.cache.Stats()
+	snapshot := AlarmSnapshot{
+		Window:    window,
+		Stats:     stats,
+		Evictions: stats.Evictions - m.previous.Evictions,
+		Reads:     stats.Hits + stats.Misses - m.previous.Hits - m.previous.Misses,
+		Len:       m.cache.Len(),
+		Capacity:  m.cache.Capacity(),
+	}
+	snapshot.EvictionRate = float64(snapshot.Evictions) / window.Seconds()
+	if snapshot.Reads > 0 {
+		snapshot.HitRatio = float64(stats.Hits-m.previous.Hits) / float64(snapshot.Reads)
+	}
+	m.previous = stats
+
+	if config.OnHighEvictionRate != nil && snapshot.Evictions > 0 && snapshot.EvictionRate > config.HighEvictionRate {
+		config.OnHighEvictionRate(snapshot)
+	}
+	if config.OnLowHitRatio != nil && snapshot.Reads > 0 && snapshot.HitRatio < config.LowHitRatio {
+		config.OnLowHitRatio(snapshot)
+	}
+}
@@ -0,0 +1,134 @@
+package bigcache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHighEvictionRateAlarm(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var snapshots []AlarmSnapshot
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		MaxEntries:         10,
+		HighEvictionRate:   4,
+		OnHighEvictionRate: func(snapshot AlarmSnapshot) {
+			snapshots = append(snapshots, snapshot)
+		},
+	})
+	monitor := newAlarmMonitor(cache)
+	for i := 0; i < 15; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+
+	// when
+	monitor.check(time.Second)
+	monitor.check(time.Second)
+
+	// then
+	assertEqual(t, 1, len(snapshots))
+	assertEqual(t, int64(5), snapshots[0].Evictions)
+	assertEqual(t, 5.0, snapshots[0].EvictionRate)
+	assertEqual(t, 10, snapshots[0].Len)
+}
+
+func TestHighEvictionRateAlarmBelowThreshold(t *testing.T) {
+	t.Parallel()
+
+	// given
+	raised := false
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		MaxEntries:         10,
+		HighEvictionRate:   1,
+		OnHighEvictionRate: func(snapshot AlarmSnapshot) {
+			raised = true
+		},
+	})
+	monitor := newAlarmMonitor(cache)
+	for i := 0; i < 15; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+
+	// when
+	monitor.check(10 * time.Second)
+
+	// then
+	assertEqual(t, false, raised)
+}
+
+func TestLowHitRatioAlarm(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var snapshots []AlarmSnapshot
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		LowHitRatio:        0.5,
+		OnLowHitRatio: func(snapshot AlarmSnapshot) {
+			snapshots = append(snapshots, snapshot)
+		},
+	})
+	monitor := newAlarmMonitor(cache)
+	cache.Set("key", []byte("value"))
+	cache.Get("key")
+	cache.Get("missing1")
+	cache.Get("missing2")
+
+	// when
+	monitor.check(time.Second)
+	cache.Get("key")
+	monitor.check(time.Second)
+	monitor.check(time.Second)
+
+	// then
+	assertEqual(t, 1, len(snapshots))
+	assertEqual(t, int64(3), snapshots[0].Reads)
+	assertEqual(t, 1.0/3, snapshots[0].HitRatio)
+}
+
+func TestAlarmsInBackground(t *testing.T) {
+	t.Parallel()
+
+	// given
+	raised := make(chan AlarmSnapshot, 1)
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		AlarmWindow:        time.Millisecond,
+		LowHitRatio:        1,
+		OnLowHitRatio: func(snapshot AlarmSnapshot) {
+			select {
+			case raised <- snapshot:
+			default:
+			}
+		},
+	})
+	defer cache.Close()
+
+	// when
+	cache.Get("missing")
+
+	// then
+	select {
+	case snapshot := <-raised:
+		assertEqual(t, time.Millisecond, snapshot.Window)
+	case <-time.After(time.Second):
+		t.Error("alarm was not raised")
+	}
+}
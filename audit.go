@@ -0,0 +1,55 @@
+package bigcache
+
+import (
+	"context"
+	"time"
+)
+
+// AuditEvent describes a destructive operation performed on the cache
+type AuditEvent struct {
+	// Operation is the name of the method, e.g. Reset or ResetShard, or RecoverShard for a reset of a corrupted shard
+	Operation string
+	// Shard is the index of affected shard, -1 when all shards are affected
+	Shard int
+	// Actor is who requested the operation, taken from the context
+	Actor string
+	// Reason is why the operation was requested, taken from the context
+	Reason string
+	// Time is when the operation was performed
+	Time time.Time
+}
+
+type auditContextKey struct{}
+
+type auditInfo struct {
+	actor  string
+	reason string
+}
+
+// WithAuditInfo returns a copy of ctx carrying who requests destructive operations and why,
+// which is passed to Config.OnAudit by the context aware methods like ResetContext.
+func WithAuditInfo(ctx context.Context, actor string, reason string) context.Context {
+	return context.WithValue(ctx, auditContextKey{}, auditInfo{actor: actor, reason: reason})
+}
+
+// LogAudit returns OnAudit hook writing events as key=value lines to the logger
+func LogAudit(logger Logger) func(event AuditEvent) {
+	return func(event AuditEvent) {
+		logger.Printf("audit operation=%s shard=%d actor=%q reason=%q time=%s",
+			event.Operation, event.Shard, event.Actor, event.Reason, event.Time.UTC().Format(time.RFC3339))
+	}
+}
+
+func (c *BigCache) audit(ctx context.Context, operation string, shard int) {
+	if c.config.OnAudit == nil {
+		return
+	}
+	info, _ := ctx.Value(auditContextKey{}).(auditInfo)
+	c.config.OnAudit(AuditEvent{
+		Operation: operation,
+		Shard:     shard,
+		Actor:     info.actor,
+		Reason:    info.reason,
+		Time:      time.Now(),
+	})
+}
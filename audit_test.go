@@ -0,0 +1,123 @@
+package bigcache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditOfDestructiveOperations(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var events []AuditEvent
+	cache, _ := New(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		OnAudit: func(event AuditEvent) {
+			events = append(events, event)
+		},
+	})
+
+	// when
+	cache.Reset()
+	cache.ResetShardContext(WithAuditInfo(context.Background(), "admin", "cleanup"), 2)
+	cache.ResetShard(4)
+
+	// then
+	assertEqual(t, 2, len(events))
+	assertEqual(t, "Reset", events[0].Operation)
+	assertEqual(t, -1, events[0].Shard)
+	assertEqual(t, "", events[0].Actor)
+	assertEqual(t, "ResetShard", events[1].Operation)
+	assertEqual(t, 2, events[1].Shard)
+	assertEqual(t, "admin", events[1].Actor)
+	assertEqual(t, "cleanup", events[1].Reason)
+}
+
+func TestAuditOfBulkRemovals(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var events []AuditEvent
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       1024,
+		OnAudit: func(event AuditEvent) {
+			events = append(events, event)
+		},
+	})
+	defer cache.Close()
+	for i := 0; i < 2000; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), blob('a', 1024))
+	}
+
+	// when
+	cache.DeleteMulti([]string{"missing"})
+	cache.DeleteMultiContext(WithAuditInfo(context.Background(), "admin", "invalidation"), []string{"key0", "key1"})
+	cache.SetHardMaxCacheSize(1)
+
+	// then
+	assertEqual(t, 2, len(events))
+	assertEqual(t, "DeleteMulti", events[0].Operation)
+	assertEqual(t, -1, events[0].Shard)
+	assertEqual(t, "admin", events[0].Actor)
+	assertEqual(t, "invalidation", events[0].Reason)
+	assertEqual(t, "SetHardMaxCacheSize", events[1].Operation)
+	assertEqual(t, -1, events[1].Shard)
+}
+
+func TestAuditOfCorruptedShardReset(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var events []AuditEvent
+	clock := mockedClock{value: 100}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		RecoverPanics:      true,
+		OnRemove:           func(key string, entry []byte) {},
+		OnAudit: func(event AuditEvent) {
+			events = append(events, event)
+		},
+	}, &clock)
+	cache.Set("key", []byte("value"))
+	oldest, _ := cache.shards[0].queue().Peek()
+	oldest[timestampSizeInBytes+hashSizeInBytes] = 0xff
+	clock.set(110)
+
+	// when
+	cache.Set("other", []byte("value"))
+
+	// then
+	assertEqual(t, 1, len(events))
+	assertEqual(t, "RecoverShard", events[0].Operation)
+	assertEqual(t, 0, events[0].Shard)
+	assertEqual(t, "bigcache", events[0].Actor)
+	assertEqual(t, true, strings.HasPrefix(events[0].Reason, "internal corruption"))
+}
+
+func TestLogAudit(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var buf bytes.Buffer
+	hook := LogAudit(log.New(&buf, "", 0))
+
+	// when
+	hook(AuditEvent{Operation: "Reset", Shard: -1, Actor: "admin", Reason: "cleanup", Time: time.Unix(0, 0)})
+
+	// then
+	assertEqual(t, `audit operation=Reset shard=-1 actor="admin" reason="cleanup" time=1970-01-01T00:00:00Z`, strings.TrimSpace(buf.String()))
+}
@@ -0,0 +1,246 @@
+package bigcache
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// GetMulti reads entries for multiple keys at once, acquiring lock of every involved shard only once.
+// Returned entries are in the order of keys, entry is nil when no entry exists for the given key.
+// When Config.ParallelBatchThreshold is set and reached, shards are read in parallel on a bounded
+// pool of goroutines, so latency approaches the one of the slowest shard instead of the sum of them.
+func (c *BigCache) GetMulti(keys []string) ([][]byte, error) {
+	entries := make([][]byte, len(keys))
+	if c.config.KeyNormalizer != nil {
+		normalized := make([]string, len(keys))
+		for i, key := range keys {
+			normalized[i] = c.normalizeKey(key)
+		}
+		keys = normalized
+	}
+	hashedKeys, groups := c.groupByShard(keys)
+
+	if c.config.ParallelBatchThreshold <= 0 || len(keys) < c.config.ParallelBatchThreshold || len(groups) < 2 {
+		var firstErr error
+		for shardIndex, indexes := range groups {
+			err := c.recoverShardIndex(shardIndex, c.shards[shardIndex].getMulti(keys, hashedKeys, indexes, entries))
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return entries, firstErr
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(groups) {
+		workers = len(groups)
+	}
+	jobs := make(chan uint64, len(groups))
+	for shardIndex := range groups {
+		jobs <- shardIndex
+	}
+	close(jobs)
+
+	var (
+		wg       sync.WaitGroup
+		errLock  sync.Mutex
+		firstErr error
+	)
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for shardIndex := range jobs {
+				err := c.recoverShardIndex(shardIndex, c.shards[shardIndex].getMulti(keys, hashedKeys, groups[shardIndex], entries))
+				if err != nil {
+					errLock.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errLock.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return entries, firstErr
+}
+
+// DeleteMulti removes multiple keys at once, acquiring lock of every involved shard only once, e.g. for
+// invalidations fanned out from a message bus. It returns the number of removed keys, keys which are not
+// cached are skipped. Errors do not stop removal of other keys, the first of them is returned.
+func (c *BigCache) DeleteMulti(keys []string) (int, error) {
+	return c.DeleteMultiContext(context.Background(), keys)
+}
+
+// DeleteMultiContext removes multiple keys like DeleteMulti, reporting the actor and reason carried by ctx
+// to Config.OnAudit when any key was removed.
+func (c *BigCache) DeleteMultiContext(ctx context.Context, keys []string) (int, error) {
+	if err := c.writable(); err != nil {
+		return 0, err
+	}
+	if c.config.KeyNormalizer != nil {
+		normalized := make([]string, len(keys))
+		for i, key := range keys {
+			normalized[i] = c.normalizeKey(key)
+		}
+		keys = normalized
+	}
+	hashedKeys, groups := c.groupByShard(keys)
+
+	var firstErr error
+	removed := 0
+	for shardIndex, indexes := range groups {
+		n, err := c.shards[shardIndex].delMulti(hashedKeys, indexes)
+		removed += n
+		if err = c.recoverShardIndex(shardIndex, err); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if c.spiller != nil {
+		for _, key := range keys {
+			c.spiller.delete(key)
+		}
+	}
+	if removed > 0 {
+		c.audit(ctx, "DeleteMulti", -1)
+	}
+	return removed, firstErr
+}
+
+// TouchMulti refreshes timestamps of entries of multiple keys, so they live for a whole LifeWindow again,
+// acquiring lock of every involved shard only once, e.g. to keep alive sessions used by a burst of requests.
+// Entries are moved to the tail of the queue like by Expire, so they are evicted after entries written before.
+// It returns the number of refreshed keys, keys which are not cached or already expired are skipped.
+// Errors do not stop refreshing of other keys, the first of them is returned.
+func (c *BigCache) TouchMulti(keys []string) (int, error) {
+	if err := c.writable(); err != nil {
+		return 0, err
+	}
+	if c.config.KeyNormalizer != nil {
+		normalized := make([]string, len(keys))
+		for i, key := range keys {
+			normalized[i] = c.normalizeKey(key)
+		}
+		keys = normalized
+	}
+	hashedKeys, groups := c.groupByShard(keys)
+
+	var firstErr error
+	touched := 0
+	for shardIndex, indexes := range groups {
+		n, err := c.shards[shardIndex].touchMulti(keys, hashedKeys, indexes)
+		touched += n
+		if err = c.recoverShardIndex(shardIndex, err); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return touched, firstErr
+}
+
+// groupByShard hashes keys and groups their positions by the index of shard owning them
+func (c *BigCache) groupByShard(keys []string) ([]uint64, map[uint64][]int) {
+	hashedKeys := make([]uint64, len(keys))
+	groups := make(map[uint64][]int)
+	for i, key := range keys {
+		hashedKey := c.hash.Sum64(key)
+		hashedKeys[i] = hashedKey
+		shardIndex := c.shardIndex(hashedKey)
+		groups[shardIndex] = append(groups[shardIndex], i)
+	}
+	return hashedKeys, groups
+}
+
+func (s *cacheShard) getMulti(keys []string, hashedKeys []uint64, indexes []int, entries [][]byte) error {
+	var firstErr error
+	s.lock.RLock()
+	for _, i := range indexes {
+		wrappedEntry, err := s.getWrappedEntry(hashedKeys[i])
+		if err != nil {
+			if err != ErrEntryNotFound && err != ErrEntryDeleted && firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if !compareKeyFromEntry(wrappedEntry, keys[i]) {
+			s.collision()
+			if s.isVerbose() {
+				s.logger.Printf("Collision detected. Both %q and %q have the same hash %x", keys[i], readKeyFromEntry(wrappedEntry), hashedKeys[i])
+			}
+			continue
+		}
+		entries[i] = readEntry(wrappedEntry)
+	}
+	s.lock.RUnlock()
+
+	for _, i := range indexes {
+		if entries[i] != nil {
+			s.hit(hashedKeys[i], len(entries[i]))
+		}
+	}
+	return firstErr
+}
+
+// delMulti removes entries of hashes at indexes under a single lock and returns the number of removed ones
+func (s *cacheShard) delMulti(hashedKeys []uint64, indexes []int) (int, error) {
+	var firstErr error
+	removed := 0
+	s.lock.Lock()
+	for _, i := range indexes {
+		itemIndex := s.hashmap[hashedKeys[i]]
+		if itemIndex == 0 {
+			continue
+		}
+		wrappedEntry, err := s.entries.Get(int(itemIndex))
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		s.delWithoutLock(hashedKeys[i], wrappedEntry)
+		removed++
+	}
+	s.lock.Unlock()
+
+	atomic.AddInt64(&s.stats.DelHits, int64(removed))
+	atomic.AddInt64(&s.stats.DelMisses, int64(len(indexes)-removed))
+	return removed, firstErr
+}
+
+// touchMulti stamps live entries of keys at indexes with the current time under a single lock, moving them
+// to the tail of the queue, and returns the number of touched ones
+func (s *cacheShard) touchMulti(keys []string, hashedKeys []uint64, indexes []int) (int, error) {
+	var firstErr error
+	touched := 0
+	currentTimestamp := uint64(s.clock.Epoch())
+	s.lock.Lock()
+	for _, i := range indexes {
+		itemIndex := s.hashmap[hashedKeys[i]]
+		if itemIndex == 0 {
+			continue
+		}
+		wrappedEntry, err := s.entries.Get(int(itemIndex))
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if !compareKeyFromEntry(wrappedEntry, keys[i]) || (s.lifeWindow != 0 && s.isExpired(wrappedEntry, currentTimestamp)) {
+			continue
+		}
+		if err := s.restamp(wrappedEntry, hashedKeys[i], s.entryTimestamp(currentTimestamp)); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		touched++
+	}
+	s.lock.Unlock()
+	return touched, firstErr
+}
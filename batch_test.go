@@ -0,0 +1,172 @@
+package bigcache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestGetMulti(t *testing.T) {
+	t.Parallel()
+
+	for _, threshold := range []int{0, 1} {
+		t.Run(fmt.Sprintf("threshold %d", threshold), func(t *testing.T) {
+			// given
+			config := DefaultConfig(time.Minute)
+			config.Shards = 16
+			config.ParallelBatchThreshold = threshold
+			config.StatsEnabled = true
+			cache, _ := New(context.Background(), config)
+			defer cache.Close()
+			keys := make([]string, 0, 200)
+			for i := 0; i < 200; i++ {
+				key := fmt.Sprintf("key%d", i)
+				keys = append(keys, key)
+				if i%2 == 0 {
+					cache.Set(key, []byte(key))
+				}
+			}
+
+			// when
+			entries, err := cache.GetMulti(keys)
+
+			// then
+			noError(t, err)
+			assertEqual(t, len(keys), len(entries))
+			for i, key := range keys {
+				if i%2 == 0 {
+					assertEqual(t, []byte(key), entries[i])
+				} else {
+					assertEqual(t, []byte(nil), entries[i])
+				}
+			}
+			assertEqual(t, int64(100), cache.Stats().Hits)
+			assertEqual(t, int64(100), cache.Stats().Misses)
+			assertEqual(t, uint32(1), cache.KeyMetadata("key0").RequestCount)
+		})
+	}
+}
+
+func TestDeleteMulti(t *testing.T) {
+	t.Parallel()
+
+	// given
+	config := DefaultConfig(time.Minute)
+	config.Shards = 16
+	var removed []string
+	config.OnRemoveWithReason = func(key string, entry []byte, reason RemoveReason) {
+		removed = append(removed, key)
+	}
+	cache, _ := New(context.Background(), config)
+	defer cache.Close()
+	keys := make([]string, 0, 200)
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("key%d", i)
+		keys = append(keys, key)
+		if i%2 == 0 {
+			cache.Set(key, []byte(key))
+		}
+	}
+
+	// when
+	n, err := cache.DeleteMulti(append(keys, "key0"))
+
+	// then
+	noError(t, err)
+	assertEqual(t, 100, n)
+	assertEqual(t, 100, len(removed))
+	assertEqual(t, 0, cache.Len())
+	assertEqual(t, int64(100), cache.Stats().DelHits)
+	assertEqual(t, int64(101), cache.Stats().DelMisses)
+	cache.Set("key0", []byte("value"))
+	entry, _ := cache.Get("key0")
+	assertEqual(t, []byte("value"), entry)
+}
+
+func TestGetMultiWithEmptyValue(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	cache.Set("empty", []byte{})
+
+	// when
+	entries, err := cache.GetMulti([]string{"empty"})
+
+	// then
+	noError(t, err)
+	assertEqual(t, []byte{}, entries[0])
+}
+
+func TestTouchMulti(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         10 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}, &clock)
+	cache.Set("session1", []byte("a"))
+	cache.Set("session2", []byte("b"))
+	cache.Set("stale", []byte("c"))
+	clock.set(8)
+	cache.Set("session3", []byte("d"))
+
+	// when
+	n, err := cache.TouchMulti([]string{"session1", "session2", "session3", "unknown"})
+
+	// then
+	noError(t, err)
+	assertEqual(t, 3, n)
+	for _, key := range []string{"session1", "session2", "session3"} {
+		ttl, _ := cache.TTL(key)
+		assertEqual(t, 10*time.Second, ttl)
+	}
+	ttl, _ := cache.TTL("stale")
+	assertEqual(t, 2*time.Second, ttl)
+	clock.set(20)
+	n, _ = cache.TouchMulti([]string{"session1"})
+	assertEqual(t, 0, n)
+}
+
+func TestExpiredEntriesBehindTouchedOnesAreCleanedUp(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         10 * time.Second,
+		CleanWindow:        time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}, &clock)
+	defer cache.Close()
+	cache.Set("session", []byte("a"))
+	clock.set(1)
+	cache.Set("stale1", []byte("b"))
+	cache.Set("stale2", []byte("c"))
+
+	// when
+	clock.set(2)
+	n, err := cache.TouchMulti([]string{"session"})
+	clock.set(12)
+	cache.cleanUp(uint64(clock.Epoch()))
+
+	// then
+	noError(t, err)
+	assertEqual(t, 1, n)
+	assertEqual(t, 1, cache.Len())
+	_, err = cache.Get("stale1")
+	assertEqual(t, ErrEntryNotFound, err)
+	_, err = cache.Get("stale2")
+	assertEqual(t, ErrEntryNotFound, err)
+	entry, err := cache.Get("session")
+	noError(t, err)
+	assertEqual(t, []byte("a"), entry)
+}
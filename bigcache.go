@@ -3,7 +3,12 @@ package bigcache
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/allegro/bigcache/v3/queue"
 )
 
 const (
@@ -14,13 +19,43 @@ const (
 // It keeps entries on heap but omits GC for them. To achieve that, operations take place on byte arrays,
 // therefore entries (de)serialization in front of the cache will be needed in most use cases.
 type BigCache struct {
-	shards     []*cacheShard
-	lifeWindow uint64
-	clock      clock
-	hash       Hasher
-	config     Config
-	shardMask  uint64
-	close      chan struct{}
+	// lifeWindow and cleanWindow are accessed atomically, they are first for 64-bit alignment on 32-bit platforms
+	lifeWindow  uint64
+	cleanWindow int64
+	shards      []*cacheShard
+	clock       clock
+	hash        Hasher
+	config      Config
+	shardMask   uint64
+	close       chan struct{}
+	// maxCacheSize is the current HardMaxCacheSize, accessed atomically
+	maxCacheSize int32
+	// shedder drops low priority writes under overload, it is nil unless shedding is configured
+	shedder *loadShedder
+	// expiries stages events of expired entries, it is nil unless Config.ExpiryBufferSize is set
+	expiries *expiryBuffer
+	// removals calls removal callbacks asynchronously, it is nil unless Config.OnRemoveWorkers is set
+	removals *removalDispatcher
+	// prefetcher loads keys passed to Prefetch, it is nil unless Config.Loader is set
+	prefetcher *prefetcher
+	// canary tests round trips through all shards, it is nil unless Config.CanaryInterval is set
+	canary *canary
+	// spiller keeps entries evicted for space in Config.SpillStore, it is nil unless it is set
+	spiller *spiller
+
+	// verbose is set when logging is enabled, accessed atomically
+	verbose int32
+	// readOnly is set when writes are rejected with ErrReadOnly, accessed atomically
+	readOnly int32
+	// drainLock serializes calls of Drain
+	drainLock sync.Mutex
+	// configLock guards fields of config changed on a running cache by SetLifeWindow and SetMaxEntrySize
+	configLock sync.RWMutex
+	// done is closed with the context of the cache, cleanUpOnce starts the clean up loop and
+	// cleanWindowChanged wakes it up when the window is changed
+	done               <-chan struct{}
+	cleanUpOnce        sync.Once
+	cleanWindowChanged chan struct{}
 }
 
 // Response will contain metadata about the entry for which GetWithInfo(key) was called
@@ -28,6 +63,14 @@ type Response struct {
 	EntryStatus RemoveReason
 }
 
+// Options are stored with an entry by SetWithOptions
+type Options struct {
+	// ContentType is the media type of the entry, at most 255 bytes long, e.g. served by the HTTP server
+	ContentType string
+	// Priority decides whether the write can be shed under overload, see Config.SetBudget
+	Priority Priority
+}
+
 // RemoveReason is a value used to signal to the user why a particular key was removed in the OnRemove callback.
 type RemoveReason uint32
 
@@ -41,9 +84,16 @@ const (
 	Deleted = RemoveReason(3)
 )
 
+// EvictedEntry is an entry removed from the cache to make room for a new one, returned by SetE
+type EvictedEntry struct {
+	Key    string
+	Value  []byte
+	Reason RemoveReason
+}
+
 // New initialize new instance of BigCache
 func New(ctx context.Context, config Config) (*BigCache, error) {
-	return newBigCache(ctx, config, &systemClock{})
+	return newBigCache(ctx, config, newClock(config))
 }
 
 // NewBigCache initialize new instance of BigCache
@@ -52,7 +102,14 @@ func New(ctx context.Context, config Config) (*BigCache, error) {
 // New takes in context and can gracefully
 // shutdown with context cancellations
 func NewBigCache(config Config) (*BigCache, error) {
-	return newBigCache(context.Background(), config, &systemClock{})
+	return newBigCache(context.Background(), config, newClock(config))
+}
+
+func newClock(config Config) clock {
+	if config.MonotonicClock {
+		return newMonotonicClock(config.timestampUnit())
+	}
+	return &systemClock{unit: config.timestampUnit()}
 }
 
 func newBigCache(ctx context.Context, config Config, clock clock) (*BigCache, error) {
@@ -68,24 +125,193 @@ func newBigCache(ctx context.Context, config Config, clock clock) (*BigCache, er
 	if config.HardMaxCacheSize < 0 {
 		return nil, errors.New("HardMaxCacheSize must be >= 0")
 	}
+	if config.HardMaxCacheSize > maximumCacheSize() {
+		return nil, fmt.Errorf("HardMaxCacheSize must be <= %d on this platform", maximumCacheSize())
+	}
+	if config.MaxEntries < 0 {
+		return nil, errors.New("MaxEntries must be >= 0")
+	}
+	if config.InitialShardBytes < 0 {
+		return nil, errors.New("InitialShardBytes must be >= 0")
+	}
+	if config.initialShardBytes() > queue.MaxCapacity/int64(config.Shards) {
+		return nil, fmt.Errorf("initial size of shards must be <= %d bytes in total on this platform", queue.MaxCapacity)
+	}
+	if config.EvictionPolicy != FIFO && config.EvictionPolicy != SLRU && config.EvictionPolicy != ARC && config.EvictionPolicy != LFU {
+		return nil, errors.New("EvictionPolicy is not supported")
+	}
+	if config.NewPolicy != nil && config.EvictionPolicy != FIFO {
+		return nil, errors.New("EvictionPolicy must be FIFO when NewPolicy is set")
+	}
+	if config.OnFullPolicy != EvictOldest && config.OnFullPolicy != RejectWrite {
+		return nil, errors.New("OnFullPolicy is not supported")
+	}
+	if config.SLRUProtectedRatio < 0 || config.SLRUProtectedRatio >= 1 {
+		return nil, errors.New("SLRUProtectedRatio must be >= 0 and < 1")
+	}
+	if config.TimeSegments < 0 || config.TimeSegments > maxTimeSegments {
+		return nil, fmt.Errorf("TimeSegments must be between 0 and %d", maxTimeSegments)
+	}
+	if config.TimestampPrecision != 0 && config.TimestampPrecision != time.Second && config.TimestampPrecision != time.Millisecond &&
+		config.TimestampPrecision != time.Microsecond && config.TimestampPrecision != time.Nanosecond {
+		return nil, errors.New("TimestampPrecision must be one of time.Second, time.Millisecond, time.Microsecond or time.Nanosecond")
+	}
+	if config.TimeSegments > 0 && config.lifeWindow() < uint64(config.TimeSegments) {
+		return nil, errors.New("LifeWindow in seconds must be >= TimeSegments")
+	}
+	if config.ParallelBatchThreshold < 0 {
+		return nil, errors.New("ParallelBatchThreshold must be >= 0")
+	}
+	if config.TombstoneTTL < 0 {
+		return nil, errors.New("TombstoneTTL must be >= 0")
+	}
+	if config.TTLJitter < 0 || config.TTLJitter > 100 {
+		return nil, errors.New("TTLJitter must be between 0 and 100")
+	}
+	if config.DeleteExpiredOnGet && !config.ExpireOnGet {
+		return nil, errors.New("DeleteExpiredOnGet requires ExpireOnGet")
+	}
+	if config.EarlyExpirationBeta < 0 {
+		return nil, errors.New("EarlyExpirationBeta must be >= 0")
+	}
+	if config.MaxKeyLength < 0 {
+		return nil, errors.New("MaxKeyLength must be >= 0")
+	}
+	if config.SoftMemoryLimit < -1 {
+		return nil, errors.New("SoftMemoryLimit must be >= -1")
+	}
+	if config.MemoryCheckWindow < 0 {
+		return nil, errors.New("MemoryCheckWindow must be >= 0")
+	}
+	if config.AdaptiveMaxCacheSize < 0 {
+		return nil, errors.New("AdaptiveMaxCacheSize must be >= 0")
+	}
+	if config.AdaptiveMaxCacheSize > maximumCacheSize() {
+		return nil, fmt.Errorf("AdaptiveMaxCacheSize must be <= %d on this platform", maximumCacheSize())
+	}
+	if config.AdaptiveMaxCacheSize > 0 && (config.AdaptiveMinCacheSize <= 0 || config.AdaptiveMinCacheSize > config.AdaptiveMaxCacheSize) {
+		return nil, errors.New("AdaptiveMinCacheSize must be > 0 and <= AdaptiveMaxCacheSize")
+	}
+	if config.AdaptiveWindow < 0 {
+		return nil, errors.New("AdaptiveWindow must be >= 0")
+	}
+	if config.AdaptiveGCFraction < 0 || config.AdaptiveGCFraction >= 1 {
+		return nil, errors.New("AdaptiveGCFraction must be >= 0 and < 1")
+	}
+	if config.ExpiryBufferSize < 0 {
+		return nil, errors.New("ExpiryBufferSize must be >= 0")
+	}
+	if config.ExpiryAckTimeout < 0 {
+		return nil, errors.New("ExpiryAckTimeout must be >= 0")
+	}
+	if config.CanaryInterval < 0 {
+		return nil, errors.New("CanaryInterval must be >= 0")
+	}
+	if config.CanaryTimeout < 0 {
+		return nil, errors.New("CanaryTimeout must be >= 0")
+	}
+	if config.OnRemoveWorkers < 0 {
+		return nil, errors.New("OnRemoveWorkers must be >= 0")
+	}
+	if config.OnRemoveQueueSize < 0 {
+		return nil, errors.New("OnRemoveQueueSize must be >= 0")
+	}
+	if config.OnRemoveOverflow != DropCallback && config.OnRemoveOverflow != WaitForQueue && config.OnRemoveOverflow != CallInline {
+		return nil, errors.New("OnRemoveOverflow is not supported")
+	}
+	if config.LockTimeout < 0 {
+		return nil, errors.New("LockTimeout must be >= 0")
+	}
+	if config.PrefetchWorkers < 0 {
+		return nil, errors.New("PrefetchWorkers must be >= 0")
+	}
+	if config.PrefetchQueueSize < 0 {
+		return nil, errors.New("PrefetchQueueSize must be >= 0")
+	}
+	if config.SpillQueueSize < 0 {
+		return nil, errors.New("SpillQueueSize must be >= 0")
+	}
+	if config.SetBudget < 0 {
+		return nil, errors.New("SetBudget must be >= 0")
+	}
+	if config.ShedEvictionRatio < 0 {
+		return nil, errors.New("ShedEvictionRatio must be >= 0")
+	}
+	if config.ShedWindow < 0 {
+		return nil, errors.New("ShedWindow must be >= 0")
+	}
+	if config.AlarmWindow < 0 {
+		return nil, errors.New("AlarmWindow must be >= 0")
+	}
+	if config.LowHitRatio < 0 || config.LowHitRatio > 1 {
+		return nil, errors.New("LowHitRatio must be between 0 and 1")
+	}
+	if config.DefragmentMaxEntries < 0 {
+		return nil, errors.New("DefragmentMaxEntries must be >= 0")
+	}
+	if config.DefragmentMaxBytes < 0 {
+		return nil, errors.New("DefragmentMaxBytes must be >= 0")
+	}
+	if config.DefragmentDeadRatio < 0 || config.DefragmentDeadRatio >= 1 {
+		return nil, errors.New("DefragmentDeadRatio must be >= 0 and < 1")
+	}
+	if config.EntryFormat != 0 && config.EntryFormat != EntryFormatV1 && config.EntryFormat != EntryFormatV2 {
+		return nil, errors.New("EntryFormat is not supported")
+	}
+	if config.EntryChecksum && config.EntryFormat != EntryFormatV2 {
+		return nil, errors.New("EntryChecksum requires EntryFormatV2")
+	}
+	if config.EntrySequence && config.EntryFormat != EntryFormatV2 {
+		return nil, errors.New("EntrySequence requires EntryFormatV2")
+	}
+	if config.EntryDigest && config.EntryFormat != EntryFormatV2 {
+		return nil, errors.New("EntryDigest requires EntryFormatV2")
+	}
+	if config.ValueVersion != 0 && config.EntryFormat != EntryFormatV2 {
+		return nil, errors.New("ValueVersion requires EntryFormatV2")
+	}
+	if config.OmitEntryKeys && config.EntryFormat != EntryFormatV2 {
+		return nil, errors.New("OmitEntryKeys requires EntryFormatV2")
+	}
+	if config.OmitEntryKeys && config.SpillStore != nil {
+		return nil, errors.New("OmitEntryKeys cannot be used with SpillStore")
+	}
+	if config.SeparateKeyStore && !config.OmitEntryKeys {
+		return nil, errors.New("SeparateKeyStore requires OmitEntryKeys")
+	}
 
-	lifeWindowSeconds := uint64(config.LifeWindow.Seconds())
-	if config.CleanWindow > 0 && lifeWindowSeconds == 0 {
+	lifeWindow := config.lifeWindow()
+	if config.CleanPhases < 0 || config.CleanPhases > config.Shards {
+		return nil, errors.New("CleanPhases must be >= 0 and <= Shards")
+	}
+	if config.MaxCleanupPause < 0 {
+		return nil, errors.New("MaxCleanupPause must be >= 0")
+	}
+	if config.CleanWindow > 0 && lifeWindow == 0 {
 		return nil, errors.New("LifeWindow must be >= 1s when CleanWindow is set")
 	}
 
 	if config.Hasher == nil {
 		config.Hasher = newDefaultHasher()
 	}
+	if config.AdaptiveMaxCacheSize > 0 {
+		config.HardMaxCacheSize = min(max(config.HardMaxCacheSize, config.AdaptiveMinCacheSize), config.AdaptiveMaxCacheSize)
+	}
 
 	cache := &BigCache{
-		shards:     make([]*cacheShard, config.Shards),
-		lifeWindow: lifeWindowSeconds,
-		clock:      clock,
-		hash:       config.Hasher,
-		config:     config,
-		shardMask:  uint64(config.Shards - 1),
-		close:      make(chan struct{}),
+		shards:       make([]*cacheShard, config.Shards),
+		lifeWindow:   lifeWindow,
+		clock:        clock,
+		hash:         config.Hasher,
+		config:       config,
+		shardMask:    uint64(config.Shards - 1),
+		close:        make(chan struct{}),
+		maxCacheSize: int32(config.HardMaxCacheSize),
+
+		cleanWindow:        int64(config.CleanWindow),
+		verbose:            boolToInt32(config.Verbose),
+		done:               ctx.Done(),
+		cleanWindowChanged: make(chan struct{}, 1),
 	}
 
 	var onRemove func(wrappedEntry []byte, reason RemoveReason)
@@ -98,21 +324,158 @@ func newBigCache(ctx context.Context, config Config, clock clock) (*BigCache, er
 	} else {
 		onRemove = cache.notProvidedOnRemove
 	}
+	if config.OnRemoveWorkers > 0 && (config.OnRemoveWithMetadata != nil || config.OnRemove != nil || config.OnRemoveWithReason != nil) {
+		cache.removals = newRemovalDispatcher(cache)
+		onRemove = cache.removals.dispatch
+		for i := 0; i < config.OnRemoveWorkers; i++ {
+			go cache.removals.work()
+		}
+	}
 
 	for i := 0; i < config.Shards; i++ {
 		cache.shards[i] = initNewShard(config, onRemove, clock)
+		if config.OnQueueResize != nil {
+			shard := i
+			cache.shards[i].onQueueResize = func(from, to int, took time.Duration) {
+				config.OnQueueResize(shard, from, to, took)
+			}
+		}
+		if config.Indexer != nil {
+			shard := i
+			cache.shards[i].onIndex = func(event IndexEvent) {
+				event.Shard = shard
+				config.Indexer.Index(event)
+			}
+		}
+	}
+	if config.ExpiryBufferSize > 0 {
+		cache.expiries = newExpiryBuffer(config.ExpiryBufferSize, config.expiryAckTimeout())
+		for _, shard := range cache.shards {
+			shard.expiries = cache.expiries
+		}
+	}
+
+	if config.SpillStore != nil {
+		cache.spiller = newSpiller(config)
+		for _, shard := range cache.shards {
+			shard.spiller = cache.spiller
+		}
+		go cache.spiller.work(ctx.Done(), cache.close)
 	}
 
 	if config.CleanWindow > 0 {
+		cache.startCleanUp()
+	}
+
+	if config.alarmsEnabled() {
+		monitor := newAlarmMonitor(cache)
+		go func() {
+			window := config.alarmWindow()
+			ticker := time.NewTicker(window)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					monitor.check(window)
+				case <-cache.close:
+					return
+				}
+			}
+		}()
+	}
+
+	if config.sheddingEnabled() {
+		cache.shedder = newLoadShedder(cache)
+		go func() {
+			window := config.shedWindow()
+			ticker := time.NewTicker(window)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					cache.shedder.check(window)
+				case <-cache.close:
+					return
+				}
+			}
+		}()
+	}
+
+	if config.Loader != nil {
+		cache.prefetcher = newPrefetcher(cache)
+		for i := 0; i < config.prefetchWorkers(); i++ {
+			go cache.prefetcher.work(ctx.Done())
+		}
+	}
+
+	if config.CanaryInterval > 0 {
+		cache.canary = newCanary(cache)
+		go func() {
+			ticker := time.NewTicker(config.CanaryInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					cache.canary.check()
+				case <-cache.close:
+					return
+				}
+			}
+		}()
+	}
+
+	if config.AdaptiveMaxCacheSize > 0 {
+		monitor := newAdaptiveMonitor(cache)
+		go func() {
+			ticker := time.NewTicker(config.adaptiveWindow())
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					monitor.check()
+				case <-cache.close:
+					return
+				}
+			}
+		}()
+	}
+
+	if config.SoftMemoryLimit != 0 {
+		monitor := newMemoryMonitor(cache)
+		go func() {
+			ticker := time.NewTicker(config.memoryCheckWindow())
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					monitor.check()
+				case <-cache.close:
+					return
+				}
+			}
+		}()
+	}
+
+	if config.DefragmentWindow > 0 && config.TimeSegments == 0 {
 		go func() {
-			ticker := time.NewTicker(config.CleanWindow)
+			ticker := time.NewTicker(config.DefragmentWindow)
 			defer ticker.Stop()
 			for {
 				select {
 				case <-ctx.Done():
 					return
-				case t := <-ticker.C:
-					cache.cleanUp(uint64(t.Unix()))
+				case <-ticker.C:
+					cache.defragment()
 				case <-cache.close:
 					return
 				}
@@ -134,49 +497,331 @@ func (c *BigCache) Close() error {
 // Get reads entry for the key.
 // It returns an ErrEntryNotFound when
 // no entry exists for the given key.
+// With Config.SpillStore, missed keys are read from the store and restored to the cache.
 func (c *BigCache) Get(key string) ([]byte, error) {
+	key = c.normalizeKey(key)
+	hashedKey := c.hash.Sum64(key)
+	shard := c.getShard(hashedKey)
+	entry, err := shard.get(key, hashedKey)
+	if err == ErrEntryNotFound && c.spiller != nil {
+		entry, err = c.getSpilled(key, hashedKey)
+		c.missed(key, hashedKey, err)
+		return entry, err
+	}
+	c.missed(key, hashedKey, err)
+	return entry, c.recoverShard(hashedKey, err)
+}
+
+// GetUnsafe reads entry for the key without copying it. The returned slice references cache memory and
+// is valid only until release is called. Until then the shard owning the key is read locked, so writes to it
+// block: release must be called as soon as possible and exactly once, the slice must not be modified and
+// must not be used after release. It returns ErrUnsafeGetDisabled unless Config.UnsafeGetEnabled is set
+// and an ErrEntryNotFound when no entry exists for the given key.
+func (c *BigCache) GetUnsafe(key string) (entry []byte, release func(), err error) {
+	if !c.config.UnsafeGetEnabled {
+		return nil, nil, ErrUnsafeGetDisabled
+	}
+	key = c.normalizeKey(key)
+	hashedKey := c.hash.Sum64(key)
+	shard := c.getShard(hashedKey)
+	entry, release, err = shard.getUnsafe(key, hashedKey)
+	if err != nil {
+		// the shard is not locked only when reading failed
+		err = c.recoverShard(hashedKey, err)
+	}
+	return entry, release, err
+}
+
+// GetFn calls fn with entry for the key without copying it. The entry references cache memory, so it is valid
+// only during the call, must not be modified or retained. The shard owning the key is read locked while fn runs,
+// therefore fn should be short, e.g. write the entry to a buffered writer. Error returned by fn is passed through.
+// It returns an ErrEntryNotFound when no entry exists for the given key.
+func (c *BigCache) GetFn(key string, fn func(entry []byte) error) error {
+	key = c.normalizeKey(key)
+	hashedKey := c.hash.Sum64(key)
+	shard := c.getShard(hashedKey)
+	err := shard.getFn(key, hashedKey, fn)
+	c.missed(key, hashedKey, err)
+	return c.recoverShard(hashedKey, err)
+}
+
+// GetFnWithOptions calls fn with entry for the key and options it was saved with, entries saved without
+// SetWithOptions have empty options. The entry is not copied, so the same rules as for GetFn apply.
+// It returns an ErrEntryNotFound when no entry exists for the given key.
+func (c *BigCache) GetFnWithOptions(key string, fn func(entry []byte, options Options) error) error {
+	key = c.normalizeKey(key)
 	hashedKey := c.hash.Sum64(key)
 	shard := c.getShard(hashedKey)
-	return shard.get(key, hashedKey)
+	return c.recoverShard(hashedKey, shard.getWrappedFn(key, hashedKey, func(wrappedEntry []byte) error {
+		return fn(readEntryWithoutCopy(wrappedEntry), Options{ContentType: readContentTypeFromEntry(wrappedEntry)})
+	}))
+}
+
+// GetRange reads length bytes of entry for the key starting at offset, copying only them. The range is truncated
+// at the end of the entry, so a shorter slice is returned when it exceeds the entry. It returns ErrInvalidRange
+// when offset or length is negative or offset is beyond the end of the entry and an ErrEntryNotFound
+// when no entry exists for the given key.
+func (c *BigCache) GetRange(key string, offset, length int) ([]byte, error) {
+	if offset < 0 || length < 0 {
+		return nil, ErrInvalidRange
+	}
+	var data []byte
+	err := c.GetFn(key, func(entry []byte) error {
+		if offset > len(entry) {
+			return ErrInvalidRange
+		}
+		length = min(length, len(entry)-offset)
+		data = make([]byte, length)
+		copy(data, entry[offset:offset+length])
+		return nil
+	})
+	return data, err
 }
 
 // GetWithInfo reads entry for the key with Response info.
 // It returns an ErrEntryNotFound when
 // no entry exists for the given key.
 func (c *BigCache) GetWithInfo(key string) ([]byte, Response, error) {
+	key = c.normalizeKey(key)
 	hashedKey := c.hash.Sum64(key)
 	shard := c.getShard(hashedKey)
-	return shard.getWithInfo(key, hashedKey)
+	entry, resp, err := shard.getWithInfo(key, hashedKey)
+	return entry, resp, c.recoverShard(hashedKey, err)
 }
 
-// Set saves entry under the key
+// Set saves entry under the key. It returns ErrWriteShed when the write is shed under overload, see Config.SetBudget.
 func (c *BigCache) Set(key string, entry []byte) error {
+	key = c.normalizeKey(key)
+	if err := c.checkKeyLength(key); err != nil {
+		return err
+	}
+	if err := c.admit(LowPriority); err != nil {
+		return err
+	}
+	hashedKey := c.hash.Sum64(key)
+	shard := c.getShard(hashedKey)
+	return c.recoverShard(hashedKey, shard.set(key, hashedKey, entry))
+}
+
+// SetWithSequence saves entry under the key like Set and returns the sequence number it was stamped with,
+// which is greater than sequence numbers of all entries written to the same shard before.
+// It is 0 unless Config.EntrySequence is set or when the write failed.
+func (c *BigCache) SetWithSequence(key string, entry []byte) (uint64, error) {
+	key = c.normalizeKey(key)
+	if err := c.checkKeyLength(key); err != nil {
+		return 0, err
+	}
+	if err := c.admit(LowPriority); err != nil {
+		return 0, err
+	}
+	hashedKey := c.hash.Sum64(key)
+	shard := c.getShard(hashedKey)
+	sequence, err := shard.setWithSequence(key, hashedKey, entry)
+	return sequence, c.recoverShard(hashedKey, err)
+}
+
+// SetWithOptions saves entry under the key with the options, GetFnWithOptions reads them back.
+// It returns ErrContentTypeTooLong when the content type does not fit in the entry header.
+// Writes with HighPriority are never shed under overload, unlike writes of Set.
+func (c *BigCache) SetWithOptions(key string, entry []byte, options Options) error {
+	if len(options.ContentType) > maxContentTypeLength {
+		return ErrContentTypeTooLong
+	}
+	key = c.normalizeKey(key)
+	if err := c.checkKeyLength(key); err != nil {
+		return err
+	}
+	if err := c.admit(options.Priority); err != nil {
+		return err
+	}
+	hashedKey := c.hash.Sum64(key)
+	shard := c.getShard(hashedKey)
+	return c.recoverShard(hashedKey, shard.setWithOptions(key, hashedKey, entry, options))
+}
+
+// SetE saves entry under the key like Set and returns entries which were removed to make room for it,
+// because they expired or there was no space left. Overwritten entry of the key is not returned.
+// It lets write paths maintain external indexes or emit invalidations synchronously.
+func (c *BigCache) SetE(key string, entry []byte) ([]EvictedEntry, error) {
+	key = c.normalizeKey(key)
+	if err := c.checkKeyLength(key); err != nil {
+		return nil, err
+	}
+	if err := c.admit(LowPriority); err != nil {
+		return nil, err
+	}
+	hashedKey := c.hash.Sum64(key)
+	shard := c.getShard(hashedKey)
+	evicted, err := shard.setE(key, hashedKey, entry)
+	return evicted, c.recoverShard(hashedKey, err)
+}
+
+// Replace saves entry under the key only if an entry for the key already exists.
+// Check and write are done atomically under the shard lock.
+// It returns an ErrEntryNotFound when no entry exists for the given key.
+func (c *BigCache) Replace(key string, entry []byte) error {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	key = c.normalizeKey(key)
+	if err := c.checkKeyLength(key); err != nil {
+		return err
+	}
+	hashedKey := c.hash.Sum64(key)
+	shard := c.getShard(hashedKey)
+	return c.recoverShard(hashedKey, shard.replace(key, hashedKey, entry))
+}
+
+// Update atomically modifies entry under the key. fn is called under the shard lock with the current entry
+// and whether it was found, and returns the new entry and whether it should be written. Error returned by fn
+// is passed through and nothing is written then. The old entry references cache memory, it may be returned
+// as the new entry but must not be modified or retained. fn must not call the cache as the shard is locked.
+func (c *BigCache) Update(key string, fn func(old []byte, found bool) (new []byte, write bool, err error)) error {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	key = c.normalizeKey(key)
+	if err := c.checkKeyLength(key); err != nil {
+		return err
+	}
 	hashedKey := c.hash.Sum64(key)
 	shard := c.getShard(hashedKey)
-	return shard.set(key, hashedKey, entry)
+	return c.recoverShard(hashedKey, shard.update(key, hashedKey, fn))
 }
 
 // Append appends entry under the key if key exists, otherwise
 // it will set the key (same behaviour as Set()). With Append() you can
 // concatenate multiple entries under the same key in a lock-optimized way.
 func (c *BigCache) Append(key string, entry []byte) error {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	key = c.normalizeKey(key)
+	if err := c.checkKeyLength(key); err != nil {
+		return err
+	}
 	hashedKey := c.hash.Sum64(key)
 	shard := c.getShard(hashedKey)
-	return shard.append(key, hashedKey, entry)
+	return c.recoverShard(hashedKey, shard.append(key, hashedKey, entry))
 }
 
-// Delete removes the key
+// Delete removes the key. With Config.SpillStore, it is removed from the store as well and no ErrEntryNotFound
+// is returned, since the key might be spilled only.
 func (c *BigCache) Delete(key string) error {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	key = c.normalizeKey(key)
+	hashedKey := c.hash.Sum64(key)
+	shard := c.getShard(hashedKey)
+	err := shard.del(hashedKey)
+	if c.spiller != nil {
+		c.spiller.delete(key)
+		if err == ErrEntryNotFound {
+			// the key may be spilled only, its removal is not a miss then
+			err = nil
+		}
+	}
+	return c.recoverShard(hashedKey, err)
+}
+
+// DeleteIf removes the key only if pred returns true for its current entry and reports whether it was removed,
+// which allows deleting a key only when it still holds an expected value. pred is called under the shard lock
+// with the entry and its info referencing cache memory, they must not be modified or retained and pred must not
+// call the cache. It returns an ErrEntryNotFound when no entry exists for the given key.
+func (c *BigCache) DeleteIf(key string, pred func(entry []byte, info EntryInfo) bool) (bool, error) {
+	if err := c.writable(); err != nil {
+		return false, err
+	}
+	key = c.normalizeKey(key)
+	hashedKey := c.hash.Sum64(key)
+	shard := c.getShard(hashedKey)
+	deleted, err := shard.deleteIf(key, hashedKey, pred)
+	return deleted, c.recoverShard(hashedKey, err)
+}
+
+// SoftDelete removes the key and leaves a tombstone for Config.TombstoneTTL. Until the tombstone expires
+// or the key is set again, Get, Append and Update of the key return ErrEntryDeleted instead of ErrEntryNotFound,
+// which lets replication layers tell recently deleted keys from never written ones. The tombstone is left even
+// if no entry exists for the key. Tombstones are identified by key hash only.
+func (c *BigCache) SoftDelete(key string) error {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	key = c.normalizeKey(key)
 	hashedKey := c.hash.Sum64(key)
 	shard := c.getShard(hashedKey)
-	return shard.del(hashedKey)
+	return c.recoverShard(hashedKey, shard.softDelete(key, hashedKey))
+}
+
+// TTL returns the remaining lifetime of the entry with the resolution of Config.TimestampPrecision.
+// It returns an ErrEntryNotFound when no entry exists for the given key.
+// Zero is returned for entries which are already expired but not yet evicted.
+func (c *BigCache) TTL(key string) (time.Duration, error) {
+	key = c.normalizeKey(key)
+	hashedKey := c.hash.Sum64(key)
+	shard := c.getShard(hashedKey)
+	ttl, err := shard.ttl(key, hashedKey)
+	return ttl, c.recoverShard(hashedKey, err)
+}
+
+// GetDigest returns the 64-bit XXH3 hash of the value stored under the key, read from the entry when it was
+// written with Config.EntryDigest and computed from the value otherwise, so it is the same in both cases.
+// It returns an ErrEntryNotFound when no entry exists for the given key.
+func (c *BigCache) GetDigest(key string) (uint64, error) {
+	key = c.normalizeKey(key)
+	hashedKey := c.hash.Sum64(key)
+	shard := c.getShard(hashedKey)
+	digest, err := shard.digest(key, hashedKey)
+	return digest, c.recoverShard(hashedKey, err)
+}
+
+// Expire sets the remaining lifetime of the entry to ttl, rounded down to Config.TimestampPrecision.
+// The entry is moved to the tail of the queue, so it is evicted after entries written before.
+// A non-positive ttl removes the entry. It returns an ErrEntryNotFound when no entry exists for the given key
+// and an ErrTTLExceedsLifeWindow when ttl is longer than Config.LifeWindow.
+func (c *BigCache) Expire(key string, ttl time.Duration) error {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	key = c.normalizeKey(key)
+	hashedKey := c.hash.Sum64(key)
+	shard := c.getShard(hashedKey)
+	if ttl <= 0 {
+		return c.recoverShard(hashedKey, shard.del(hashedKey))
+	}
+	return c.recoverShard(hashedKey, shard.expire(key, hashedKey, c.currentConfig().timestampUnits(ttl)))
 }
 
 // Reset empties all cache shards
 func (c *BigCache) Reset() error {
+	return c.ResetContext(context.Background())
+}
+
+// ResetContext empties all cache shards, reporting the actor and reason carried by ctx to Config.OnAudit
+func (c *BigCache) ResetContext(ctx context.Context) error {
+	config := c.currentConfig()
 	for _, shard := range c.shards {
-		shard.reset(c.config)
+		shard.reset(config)
+	}
+	c.audit(ctx, "Reset", -1)
+	return nil
+}
+
+// ResetShard empties a single cache shard.
+// It returns an ErrInvalidShardIndex when the shard index is out of range.
+func (c *BigCache) ResetShard(shard int) error {
+	return c.ResetShardContext(context.Background(), shard)
+}
+
+// ResetShardContext empties a single cache shard, reporting the actor and reason carried by ctx to Config.OnAudit.
+// It returns an ErrInvalidShardIndex when the shard index is out of range.
+func (c *BigCache) ResetShardContext(ctx context.Context, shard int) error {
+	if shard < 0 || shard >= len(c.shards) {
+		return ErrInvalidShardIndex
 	}
+	c.shards[shard].reset(c.currentConfig())
+	c.audit(ctx, "ResetShard", shard)
 	return nil
 }
 
@@ -206,6 +851,49 @@ func (c *BigCache) Capacity() int {
 	return len
 }
 
+// Preallocate grows queues of all shards so the cache holds bytes in total, bounded by HardMaxCacheSize.
+// Queues never shrink, so the final capacity can be forced at startup, after restoring a snapshot
+// or before a known bulk load, avoiding pauses to grow queues while serving traffic.
+func (c *BigCache) Preallocate(bytes int) {
+	for _, shard := range c.shards {
+		shard.preallocate(bytes / len(c.shards))
+	}
+}
+
+// SetHardMaxCacheSize changes HardMaxCacheSize of a running cache, size is in MB and 0 means no limit.
+// When the limit is lowered below the size of a shard queue, its oldest entries are evicted with NoSpace reason
+// and the queue is compacted to the new size. Queues split into TimeSegments are not compacted,
+// they stay bigger until their windows are dropped.
+func (c *BigCache) SetHardMaxCacheSize(size int) error {
+	return c.SetHardMaxCacheSizeContext(context.Background(), size)
+}
+
+// SetHardMaxCacheSizeContext changes HardMaxCacheSize like SetHardMaxCacheSize, reporting the actor and reason
+// carried by ctx to Config.OnAudit when entries were evicted.
+func (c *BigCache) SetHardMaxCacheSizeContext(ctx context.Context, size int) error {
+	if size < 0 {
+		return ErrInvalidCacheSize
+	}
+	if size > maximumCacheSize() {
+		return ErrCacheSizeTooBig
+	}
+	atomic.StoreInt32(&c.maxCacheSize, int32(size))
+	maxShardSize := int(cacheSizeInBytes(size) / int64(len(c.shards)))
+	evicted := 0
+	for _, shard := range c.shards {
+		evicted += shard.resize(maxShardSize)
+	}
+	if evicted > 0 {
+		c.audit(ctx, "SetHardMaxCacheSize", -1)
+	}
+	return nil
+}
+
+// HardMaxCacheSize returns the current limit of the cache size in MB, 0 means no limit
+func (c *BigCache) HardMaxCacheSize() int {
+	return int(atomic.LoadInt32(&c.maxCacheSize))
+}
+
 // Stats returns cache's statistics
 func (c *BigCache) Stats() Stats {
 	var s Stats
@@ -216,12 +904,93 @@ func (c *BigCache) Stats() Stats {
 		s.DelHits += tmp.DelHits
 		s.DelMisses += tmp.DelMisses
 		s.Collisions += tmp.Collisions
+		s.Evictions += tmp.Evictions
+		s.LazyExpirations += tmp.LazyExpirations
+		s.LockTimeouts += tmp.LockTimeouts
+		s.Migrations += tmp.Migrations
+		s.MigrationErrors += tmp.MigrationErrors
+		s.Sets += tmp.Sets
+		s.BytesWritten += tmp.BytesWritten
+		s.BytesRead += tmp.BytesRead
+		s.QueueResizes += tmp.QueueResizes
+		var cleanUps ShardStats
+		shard.cleanUpStats(&cleanUps)
+		s.CleanUps += cleanUps.CleanUps
+		s.CleanUpYields += cleanUps.CleanUpYields
+		s.CleanUpTime += cleanUps.CleanUpTime
+		if cleanUps.MaxCleanUpTime > s.MaxCleanUpTime {
+			s.MaxCleanUpTime = cleanUps.MaxCleanUpTime
+		}
+		if shard.initialSizeExceeded() {
+			s.InitialSizeExceeded++
+		}
+		s.KeyStoreBytes += int64(shard.keyStoreBytes())
+		used, dead, overhead := shard.memoryUsage()
+		s.UsedBytes += int64(used)
+		s.DeadBytes += int64(dead)
+		s.OverheadBytes += int64(overhead)
+		shard.forecastExpiries(&s.ExpiringEntries, &s.ExpiringBytes)
+	}
+	s.Fragmentation = fragmentation(s.UsedBytes, s.DeadBytes, s.OverheadBytes)
+	if c.shedder != nil {
+		s.ShedWrites = atomic.LoadInt64(&c.shedder.shedWrites)
+	}
+	if c.expiries != nil {
+		s.ExpiryOverflows = c.expiries.overflowed()
+	}
+	if c.removals != nil {
+		s.DroppedCallbacks = atomic.LoadInt64(&c.removals.dropped)
+	}
+	if c.spiller != nil {
+		s.Spilled = atomic.LoadInt64(&c.spiller.spilled)
+		s.SpillHits = atomic.LoadInt64(&c.spiller.hits)
+		s.SpillDropped = atomic.LoadInt64(&c.spiller.dropped)
+		s.SpillErrors = atomic.LoadInt64(&c.spiller.failed)
+	}
+	if c.prefetcher != nil {
+		s.PrefetchDropped = atomic.LoadInt64(&c.prefetcher.dropped)
+		s.PrefetchErrors = atomic.LoadInt64(&c.prefetcher.failed)
+	}
+	return s
+}
+
+// ShardStats returns statistics of every shard, lock statistics are collected with Config.LockStatsEnabled
+func (c *BigCache) ShardStats() []ShardStats {
+	stats := make([]ShardStats, len(c.shards))
+	for i, shard := range c.shards {
+		// read before locking the shard for other statistics, so they are not counted
+		shard.lock.stats(&stats[i])
+		stats[i].Entries = shard.len()
+		stats[i].Capacity = shard.capacity()
+		stats[i].UsedBytes, stats[i].DeadBytes, stats[i].OverheadBytes = shard.memoryUsage()
+		shard.queueStats(&stats[i])
+		shard.cleanUpStats(&stats[i])
+		stats[i].Fragmentation = fragmentation(int64(stats[i].UsedBytes), int64(stats[i].DeadBytes), int64(stats[i].OverheadBytes))
+	}
+	return stats
+}
+
+// SegmentStats returns statistics of segments of the eviction policy.
+// It is empty when the policy does not split entries into segments.
+func (c *BigCache) SegmentStats() SegmentStats {
+	var s SegmentStats
+	for _, shard := range c.shards {
+		if shard.policy == nil {
+			continue
+		}
+		tmp := shard.policy.stats()
+		s.ProbationEntries += tmp.ProbationEntries
+		s.ProtectedEntries += tmp.ProtectedEntries
+		s.GhostEntries += tmp.GhostEntries
+		s.Promotions += tmp.Promotions
+		s.Demotions += tmp.Demotions
 	}
 	return s
 }
 
 // KeyMetadata returns number of times a cached resource was requested.
 func (c *BigCache) KeyMetadata(key string) Metadata {
+	key = c.normalizeKey(key)
 	hashedKey := c.hash.Sum64(key)
 	shard := c.getShard(hashedKey)
 	return shard.getKeyMetadataWithLock(hashedKey)
@@ -237,7 +1006,7 @@ func (c *BigCache) onEvict(oldestEntry []byte, currentTimestamp uint64, evict fu
 	if currentTimestamp < oldestTimestamp {
 		return false
 	}
-	if currentTimestamp-oldestTimestamp > c.lifeWindow {
+	if currentTimestamp-oldestTimestamp > atomic.LoadUint64(&c.lifeWindow) {
 		evict(Expired)
 		return true
 	}
@@ -245,13 +1014,64 @@ func (c *BigCache) onEvict(oldestEntry []byte, currentTimestamp uint64, evict fu
 }
 
 func (c *BigCache) cleanUp(currentTimestamp uint64) {
-	for _, shard := range c.shards {
-		shard.cleanUp(currentTimestamp)
+	c.cleanUpPhase(currentTimestamp, 0, 1)
+}
+
+// cleanUpPhase cleans up shards of the phase, every phases-th shard starting at the index of the phase
+func (c *BigCache) cleanUpPhase(currentTimestamp uint64, phase, phases int) {
+	c.sweep(currentTimestamp, phase, phases, time.Time{})
+}
+
+// sweep cleans up every phases-th shard starting at the shard from until the deadline, a zero one means
+// no deadline. It returns the shard the next sweep resumes from, the number of shards when all were cleaned up.
+// At least one entry is removed in every sweep, so clean ups make progress with any budget.
+func (c *BigCache) sweep(currentTimestamp uint64, from, phases int, deadline time.Time) int {
+	for i := from; i < len(c.shards); i += phases {
+		if i != from && !deadline.IsZero() && time.Now().After(deadline) {
+			return i
+		}
+		finished := c.shards[i].cleanUp(currentTimestamp, deadline)
+		c.recoverShardIndex(uint64(i), nil)
+		if !finished {
+			return i
+		}
 	}
+	return len(c.shards)
 }
 
 func (c *BigCache) getShard(hashedKey uint64) (shard *cacheShard) {
-	return c.shards[hashedKey&c.shardMask]
+	return c.shards[c.shardIndex(hashedKey)]
+}
+
+// shardIndex returns index of the shard owning hashedKey
+func (c *BigCache) shardIndex(hashedKey uint64) uint64 {
+	if c.config.ShardingFunc != nil {
+		// out of range results of custom functions are wrapped instead of panicking
+		return uint64(c.config.ShardingFunc(hashedKey, len(c.shards))) % uint64(len(c.shards))
+	}
+	return hashedKey & c.shardMask
+}
+
+// normalizeKey applies Config.KeyNormalizer to the key
+func (c *BigCache) normalizeKey(key string) string {
+	if c.config.KeyNormalizer == nil {
+		return key
+	}
+	return c.config.KeyNormalizer(key)
+}
+
+// checkKeyLength returns ErrKeyTooLong when the normalized key is longer than Config.MaxKeyLength or
+// than the key size field of an entry can hold, keys of extendedHeaderMarker bytes would read as extensible headers
+func (c *BigCache) checkKeyLength(key string) error {
+	if len(key) >= extendedHeaderMarker || c.config.MaxKeyLength > 0 && len(key) > c.config.MaxKeyLength {
+		return ErrKeyTooLong
+	}
+	return nil
+}
+
+// ShardFor returns index of the shard the key is stored in
+func (c *BigCache) ShardFor(key string) int {
+	return int(c.shardIndex(c.hash.Sum64(c.normalizeKey(key))))
 }
 
 func (c *BigCache) providedOnRemove(wrappedEntry []byte, reason RemoveReason) {
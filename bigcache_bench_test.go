@@ -76,6 +76,31 @@ func BenchmarkReadFromCacheWithInfo(b *testing.B) {
 		})
 	}
 }
+func BenchmarkGetMulti(b *testing.B) {
+	for _, threshold := range []int{0, 1} {
+		b.Run(fmt.Sprintf("threshold-%d", threshold), func(b *testing.B) {
+			cache, _ := New(context.Background(), Config{
+				Shards:                 1024,
+				LifeWindow:             100 * time.Second,
+				MaxEntriesInWindow:     10000,
+				MaxEntrySize:           256,
+				ParallelBatchThreshold: threshold,
+			})
+			keys := make([]string, 500)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("key-%d", i)
+				cache.Set(keys[i], message)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cache.GetMulti(keys)
+			}
+		})
+	}
+}
+
 func BenchmarkIterateOverCache(b *testing.B) {
 
 	m := blob('a', 1)
@@ -208,3 +233,33 @@ func readFromCacheNonExistentKeys(b *testing.B, shards int) {
 		}
 	})
 }
+
+func BenchmarkKeyStorage(b *testing.B) {
+	for _, mode := range []struct {
+		name   string
+		config Config
+	}{
+		{"keys in entries", Config{EntryFormat: EntryFormatV2}},
+		{"keys omitted", Config{EntryFormat: EntryFormatV2, OmitEntryKeys: true}},
+		{"separate key store", Config{EntryFormat: EntryFormatV2, OmitEntryKeys: true, SeparateKeyStore: true}},
+	} {
+		b.Run(mode.name, func(b *testing.B) {
+			config := mode.config
+			config.Shards = 16
+			config.LifeWindow = time.Minute
+			config.MaxEntriesInWindow = b.N
+			config.MaxEntrySize = 64
+			cache, _ := New(context.Background(), config)
+			value := blob('a', 64)
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				cache.Set(fmt.Sprintf("user:session:%d", i), value)
+			}
+
+			stats := cache.Stats()
+			b.ReportMetric(float64(stats.UsedBytes+stats.KeyStoreBytes)/float64(b.N), "bytes/entry")
+		})
+	}
+}
@@ -3,6 +3,7 @@ package bigcache
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
@@ -11,6 +12,8 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/allegro/bigcache/v3/queue"
 )
 
 func TestWriteAndGetOnCache(t *testing.T) {
@@ -18,6 +21,7 @@ func TestWriteAndGetOnCache(t *testing.T) {
 
 	// given
 	cache, _ := New(context.Background(), DefaultConfig(5*time.Second))
+	defer cache.Close()
 	value := []byte("value")
 
 	// when
@@ -34,6 +38,7 @@ func TestAppendAndGetOnCache(t *testing.T) {
 
 	// given
 	cache, _ := New(context.Background(), DefaultConfig(5*time.Second))
+	defer cache.Close()
 	key := "key"
 	value1 := make([]byte, 50)
 	rand.Read(value1)
@@ -175,6 +180,142 @@ func TestAppendCollision(t *testing.T) {
 
 }
 
+func TestDeleteIf(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var removed []string
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         5 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		StatsEnabled:       true,
+		Hasher:             hashStub(5),
+		OnRemove: func(key string, entry []byte) {
+			removed = append(removed, key)
+		},
+	})
+	cache.Set("a", []byte("1"))
+	matches := func(expected string) func(entry []byte, info EntryInfo) bool {
+		return func(entry []byte, info EntryInfo) bool {
+			return info.Key() == "a" && string(entry) == expected
+		}
+	}
+
+	// when
+	deleted, err := cache.DeleteIf("a", matches("2"))
+
+	// then
+	noError(t, err)
+	assertEqual(t, false, deleted)
+	assertEqual(t, 1, cache.Len())
+
+	// when
+	deleted, collisionErr := cache.DeleteIf("b", matches("1"))
+	deleted, err = cache.DeleteIf("a", matches("1"))
+	_, missingErr := cache.DeleteIf("a", matches("1"))
+
+	// then
+	noError(t, err)
+	assertEqual(t, true, deleted)
+	assertEqual(t, ErrEntryNotFound, collisionErr)
+	assertEqual(t, ErrEntryNotFound, missingErr)
+	assertEqual(t, 0, cache.Len())
+	assertEqual(t, []string{"a"}, removed)
+	assertEqual(t, int64(1), cache.Stats().DelHits)
+	assertEqual(t, int64(2), cache.Stats().DelMisses)
+}
+
+func TestReplace(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         5 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		Hasher:             hashStub(5),
+	})
+
+	// when
+	err := cache.Replace("a", []byte("1"))
+
+	// then
+	assertEqual(t, ErrEntryNotFound, err)
+	assertEqual(t, 0, cache.Len())
+
+	// when
+	cache.Set("a", []byte("1"))
+	err = cache.Replace("a", []byte("2"))
+
+	// then
+	noError(t, err)
+	cachedValue, _ := cache.Get("a")
+	assertEqual(t, []byte("2"), cachedValue)
+
+	// when
+	err = cache.Replace("b", []byte("3"))
+
+	// then
+	assertEqual(t, ErrEntryNotFound, err)
+	cachedValue, _ = cache.Get("a")
+	assertEqual(t, []byte("2"), cachedValue)
+}
+
+func TestUpdate(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         5 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	})
+	increment := func(old []byte, found bool) ([]byte, bool, error) {
+		if !found {
+			return []byte{1}, true, nil
+		}
+		return []byte{old[0] + 1}, true, nil
+	}
+
+	// when
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				noError(t, cache.Update("counter", increment))
+			}
+		}()
+	}
+	wg.Wait()
+
+	// then
+	cachedValue, _ := cache.Get("counter")
+	assertEqual(t, []byte{100}, cachedValue)
+
+	// when
+	errAbort := errors.New("abort")
+	err := cache.Update("counter", func(old []byte, found bool) ([]byte, bool, error) {
+		return nil, true, errAbort
+	})
+	cache.Update("missing", func(old []byte, found bool) ([]byte, bool, error) {
+		assertEqual(t, false, found)
+		return nil, false, nil
+	})
+
+	// then
+	assertEqual(t, errAbort, err)
+	cachedValue, _ = cache.Get("counter")
+	assertEqual(t, []byte{100}, cachedValue)
+	_, err = cache.Get("missing")
+	assertEqual(t, ErrEntryNotFound, err)
+}
+
 func TestConstructCacheWithDefaultHasher(t *testing.T) {
 	t.Parallel()
 
@@ -213,6 +354,198 @@ func TestNewBigcacheValidation(t *testing.T) {
 			cfg:  Config{Shards: 16, HardMaxCacheSize: -1},
 			want: "HardMaxCacheSize must be >= 0",
 		},
+		{
+			cfg:  Config{Shards: 16, MaxEntries: -1},
+			want: "MaxEntries must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, InitialShardBytes: -1},
+			want: "InitialShardBytes must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, EntryFormat: 3},
+			want: "EntryFormat is not supported",
+		},
+		{
+			cfg:  Config{Shards: 16, EntryChecksum: true},
+			want: "EntryChecksum requires EntryFormatV2",
+		},
+		{
+			cfg:  Config{Shards: 16, EntrySequence: true},
+			want: "EntrySequence requires EntryFormatV2",
+		},
+		{
+			cfg:  Config{Shards: 16, EntryDigest: true},
+			want: "EntryDigest requires EntryFormatV2",
+		},
+		{
+			cfg:  Config{Shards: 16, ValueVersion: 1},
+			want: "ValueVersion requires EntryFormatV2",
+		},
+		{
+			cfg:  Config{Shards: 16, OmitEntryKeys: true},
+			want: "OmitEntryKeys requires EntryFormatV2",
+		},
+		{
+			cfg:  Config{Shards: 16, EntryFormat: EntryFormatV2, OmitEntryKeys: true, SpillStore: newMapSpillStore()},
+			want: "OmitEntryKeys cannot be used with SpillStore",
+		},
+		{
+			cfg:  Config{Shards: 16, SeparateKeyStore: true},
+			want: "SeparateKeyStore requires OmitEntryKeys",
+		},
+		{
+			cfg:  Config{Shards: 16, DeleteExpiredOnGet: true},
+			want: "DeleteExpiredOnGet requires ExpireOnGet",
+		},
+		{
+			cfg:  Config{Shards: 16, CleanPhases: 17},
+			want: "CleanPhases must be >= 0 and <= Shards",
+		},
+		{
+			cfg:  Config{Shards: 16, MaxCleanupPause: -1},
+			want: "MaxCleanupPause must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, SetBudget: -1},
+			want: "SetBudget must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, ShedEvictionRatio: -1},
+			want: "ShedEvictionRatio must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, ShedWindow: -1},
+			want: "ShedWindow must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, ExpiryBufferSize: -1},
+			want: "ExpiryBufferSize must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, ExpiryAckTimeout: -1},
+			want: "ExpiryAckTimeout must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, HardMaxCacheSize: maximumCacheSize() + 1},
+			want: fmt.Sprintf("HardMaxCacheSize must be <= %d on this platform", maximumCacheSize()),
+		},
+		{
+			cfg:  Config{Shards: 16, AdaptiveMaxCacheSize: maximumCacheSize() + 1},
+			want: fmt.Sprintf("AdaptiveMaxCacheSize must be <= %d on this platform", maximumCacheSize()),
+		},
+		{
+			cfg:  Config{Shards: 16, InitialShardBytes: int(queue.MaxCapacity/16) + 1},
+			want: fmt.Sprintf("initial size of shards must be <= %d bytes in total on this platform", queue.MaxCapacity),
+		},
+		{
+			cfg:  Config{Shards: 16, CanaryInterval: -1},
+			want: "CanaryInterval must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, CanaryTimeout: -1},
+			want: "CanaryTimeout must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, OnRemoveWorkers: -1},
+			want: "OnRemoveWorkers must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, OnRemoveQueueSize: -1},
+			want: "OnRemoveQueueSize must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, OnRemoveOverflow: 3},
+			want: "OnRemoveOverflow is not supported",
+		},
+		{
+			cfg:  Config{Shards: 16, LockTimeout: -1},
+			want: "LockTimeout must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, PrefetchWorkers: -1},
+			want: "PrefetchWorkers must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, PrefetchQueueSize: -1},
+			want: "PrefetchQueueSize must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, SpillQueueSize: -1},
+			want: "SpillQueueSize must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, TombstoneTTL: -1},
+			want: "TombstoneTTL must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, TTLJitter: 101},
+			want: "TTLJitter must be between 0 and 100",
+		},
+		{
+			cfg:  Config{Shards: 16, AlarmWindow: -1},
+			want: "AlarmWindow must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, LowHitRatio: 2},
+			want: "LowHitRatio must be between 0 and 1",
+		},
+		{
+			cfg:  Config{Shards: 16, EarlyExpirationBeta: -1},
+			want: "EarlyExpirationBeta must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, DefragmentMaxEntries: -1},
+			want: "DefragmentMaxEntries must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, DefragmentMaxBytes: -1},
+			want: "DefragmentMaxBytes must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, DefragmentDeadRatio: 1},
+			want: "DefragmentDeadRatio must be >= 0 and < 1",
+		},
+		{
+			cfg:  Config{Shards: 16, OnFullPolicy: OnFullPolicy(2)},
+			want: "OnFullPolicy is not supported",
+		},
+		{
+			cfg:  Config{Shards: 16, SoftMemoryLimit: -2},
+			want: "SoftMemoryLimit must be >= -1",
+		},
+		{
+			cfg:  Config{Shards: 16, MemoryCheckWindow: -1},
+			want: "MemoryCheckWindow must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, MaxKeyLength: -1},
+			want: "MaxKeyLength must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, AdaptiveMaxCacheSize: -1},
+			want: "AdaptiveMaxCacheSize must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, AdaptiveMaxCacheSize: 10},
+			want: "AdaptiveMinCacheSize must be > 0 and <= AdaptiveMaxCacheSize",
+		},
+		{
+			cfg:  Config{Shards: 16, AdaptiveMaxCacheSize: 10, AdaptiveMinCacheSize: 11},
+			want: "AdaptiveMinCacheSize must be > 0 and <= AdaptiveMaxCacheSize",
+		},
+		{
+			cfg:  Config{Shards: 16, AdaptiveWindow: -1},
+			want: "AdaptiveWindow must be >= 0",
+		},
+		{
+			cfg:  Config{Shards: 16, AdaptiveGCFraction: 1},
+			want: "AdaptiveGCFraction must be >= 0 and < 1",
+		},
+		{
+			cfg:  Config{Shards: 16, TimestampPrecision: 10 * time.Millisecond},
+			want: "TimestampPrecision must be one of time.Second, time.Millisecond, time.Microsecond or time.Nanosecond",
+		},
 	} {
 		t.Run(tc.want, func(t *testing.T) {
 			cache, error := New(context.Background(), tc.cfg)
@@ -272,71 +605,224 @@ func TestTimingEviction(t *testing.T) {
 	assertEqual(t, ErrEntryNotFound, err)
 }
 
-func TestTimingEvictionShouldEvictOnlyFromUpdatedShard(t *testing.T) {
+func TestTTLJitter(t *testing.T) {
 	t.Parallel()
 
 	// given
-	clock := mockedClock{value: 0}
+	clock := mockedClock{value: 1000}
 	cache, _ := newBigCache(context.Background(), Config{
-		Shards:             4,
-		LifeWindow:         time.Second,
-		MaxEntriesInWindow: 1,
+		Shards:             1,
+		LifeWindow:         100 * time.Second,
+		MaxEntriesInWindow: 10,
 		MaxEntrySize:       256,
+		TTLJitter:          10,
 	}, &clock)
 
 	// when
-	cache.Set("key", []byte("value"))
-	clock.set(5)
-	cache.Set("key2", []byte("value 2"))
-	value, err := cache.Get("key")
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+	}
 
 	// then
-	noError(t, err)
-	assertEqual(t, []byte("value"), value)
+	timestamps := make(map[uint64]struct{})
+	iterator := cache.Iterator()
+	for iterator.SetNext() {
+		entry, err := iterator.Value()
+		noError(t, err)
+		if entry.Timestamp() < 990 || entry.Timestamp() > 1000 {
+			t.Errorf("timestamp %d out of jitter range", entry.Timestamp())
+		}
+		timestamps[entry.Timestamp()] = struct{}{}
+	}
+	if len(timestamps) < 2 {
+		t.Errorf("expected entries to be stamped with different timestamps")
+	}
 }
 
-func TestCleanShouldEvictAll(t *testing.T) {
+func TestTTLAndExpire(t *testing.T) {
 	t.Parallel()
 
 	// given
-	cache, _ := New(context.Background(), Config{
-		Shards:             4,
-		LifeWindow:         time.Second,
+	clock := mockedClock{value: 100}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         10 * time.Second,
 		CleanWindow:        time.Second,
-		MaxEntriesInWindow: 1,
+		MaxEntriesInWindow: 10,
 		MaxEntrySize:       256,
-	})
+	}, &clock)
+	cache.Set("key", []byte("value"))
 
 	// when
-	cache.Set("key", []byte("value"))
-	<-time.After(3 * time.Second)
-	value, err := cache.Get("key")
+	clock.set(104)
+	ttl, err := cache.TTL("key")
+
+	// then
+	noError(t, err)
+	assertEqual(t, 6*time.Second, ttl)
+
+	// when
+	err = cache.Expire("key", 8*time.Second)
+	clock.set(111)
+	ttl, _ = cache.TTL("key")
+	cache.cleanUp(uint64(clock.Epoch()))
+
+	// then
+	noError(t, err)
+	assertEqual(t, time.Second, ttl)
+	_, err = cache.Get("key")
+	noError(t, err)
+
+	// when
+	cache.Expire("key", time.Second)
+	clock.set(113)
+	cache.cleanUp(uint64(clock.Epoch()))
+	_, err = cache.Get("key")
 
 	// then
 	assertEqual(t, ErrEntryNotFound, err)
-	assertEqual(t, value, []byte(nil))
+	_, err = cache.TTL("key")
+	assertEqual(t, ErrEntryNotFound, err)
+	assertEqual(t, ErrEntryNotFound, cache.Expire("key", time.Second))
 }
 
-func TestOnRemoveCallback(t *testing.T) {
+func TestExpiredEntriesBehindExpireAreCleanedUp(t *testing.T) {
 	t.Parallel()
 
 	// given
-	clock := mockedClock{value: 0}
-	onRemoveInvoked := false
-	onRemoveExtInvoked := false
-	onRemove := func(key string, entry []byte) {
-		onRemoveInvoked = true
-		assertEqual(t, "key", key)
-		assertEqual(t, []byte("value"), entry)
-	}
-	onRemoveExt := func(key string, entry []byte, reason RemoveReason) {
-		onRemoveExtInvoked = true
-	}
+	clock := mockedClock{value: 100}
 	cache, _ := newBigCache(context.Background(), Config{
 		Shards:             1,
-		LifeWindow:         time.Second,
-		MaxEntriesInWindow: 1,
-		MaxEntrySize:       256,
+		LifeWindow:         5 * time.Second,
+		CleanWindow:        time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}, &clock)
+	defer cache.Close()
+	noError(t, cache.Set("a", []byte("value")))
+	clock.set(101)
+	noError(t, cache.Set("b", []byte("value")))
+
+	// when
+	clock.set(102)
+	noError(t, cache.Expire("a", 5*time.Second))
+	clock.set(107)
+	cache.cleanUp(uint64(clock.Epoch()))
+
+	// then
+	_, err := cache.Get("b")
+	assertEqual(t, ErrEntryNotFound, err)
+	entry, err := cache.Get("a")
+	noError(t, err)
+	assertEqual(t, []byte("value"), entry)
+	assertEqual(t, 1, cache.Len())
+}
+func TestExpireRejectsTTLLongerThanLifeWindow(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 100}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         10 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}, &clock)
+	cache.Set("key", []byte("value"))
+	cache.Set("other", []byte("value"))
+
+	// when
+	err := cache.Expire("key", 11*time.Second)
+	clock.set(111)
+	cache.cleanUp(uint64(clock.Epoch()))
+
+	// then
+	assertEqual(t, ErrTTLExceedsLifeWindow, err)
+	assertEqual(t, 0, cache.Len())
+}
+
+func TestExpireWithNonPositiveTTLRemovesEntry(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	cache.Set("key", []byte("value"))
+
+	// when
+	err := cache.Expire("key", 0)
+	_, getErr := cache.Get("key")
+
+	// then
+	noError(t, err)
+	assertEqual(t, ErrEntryNotFound, getErr)
+}
+
+func TestTimingEvictionShouldEvictOnlyFromUpdatedShard(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 1,
+		MaxEntrySize:       256,
+	}, &clock)
+
+	// when
+	cache.Set("key", []byte("value"))
+	clock.set(5)
+	cache.Set("key2", []byte("value 2"))
+	value, err := cache.Get("key")
+
+	// then
+	noError(t, err)
+	assertEqual(t, []byte("value"), value)
+}
+
+func TestCleanShouldEvictAll(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         time.Second,
+		CleanWindow:        time.Second,
+		MaxEntriesInWindow: 1,
+		MaxEntrySize:       256,
+	})
+
+	// when
+	cache.Set("key", []byte("value"))
+	<-time.After(3 * time.Second)
+	value, err := cache.Get("key")
+
+	// then
+	assertEqual(t, ErrEntryNotFound, err)
+	assertEqual(t, value, []byte(nil))
+}
+
+func TestOnRemoveCallback(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	onRemoveInvoked := false
+	onRemoveExtInvoked := false
+	onRemove := func(key string, entry []byte) {
+		onRemoveInvoked = true
+		assertEqual(t, "key", key)
+		assertEqual(t, []byte("value"), entry)
+	}
+	onRemoveExt := func(key string, entry []byte, reason RemoveReason) {
+		onRemoveExtInvoked = true
+	}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 1,
+		MaxEntrySize:       256,
 		OnRemove:           onRemove,
 		OnRemoveWithReason: onRemoveExt,
 	}, &clock)
@@ -529,8 +1015,59 @@ func TestCacheLen(t *testing.T) {
 	assertEqual(t, keys, cache.Len())
 }
 
+func TestSetEReturnsEvictedEntries(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		MaxEntries:         2,
+	})
+	cache.Set("a", []byte("1"))
+	cache.Set("b", []byte("2"))
+
+	// when
+	evicted, err := cache.SetE("c", []byte("3"))
+	overwritten, overwriteErr := cache.SetE("c", []byte("4"))
+
+	// then
+	noError(t, err)
+	noError(t, overwriteErr)
+	assertEqual(t, []EvictedEntry{{Key: "a", Value: []byte("1"), Reason: NoSpace}}, evicted)
+	assertEqual(t, 0, len(overwritten))
+}
+
+func TestSetEReturnsExpiredEntries(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}, &clock)
+	cache.Set("a", []byte("1"))
+	clock.set(5)
+
+	// when
+	evicted, err := cache.SetE("b", []byte("2"))
+
+	// then
+	noError(t, err)
+	assertEqual(t, []EvictedEntry{{Key: "a", Value: []byte("1"), Reason: Expired}}, evicted)
+	assertEqual(t, 1, cache.Len())
+}
+
 func TestCacheCapacity(t *testing.T) {
 	t.Parallel()
+	if entryGuardBytes > 0 {
+		t.Skip("guard bytes of debug builds change growth of queues checked by the test")
+	}
 
 	// given
 	cache, _ := New(context.Background(), Config{
@@ -578,6 +1115,168 @@ func TestCacheInitialCapacity(t *testing.T) {
 	assertEqual(t, 1024*1024, cache.Capacity())
 }
 
+func TestPreallocate(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             2,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		HardMaxCacheSize:   1,
+	})
+	cache.Set("key", []byte("value"))
+
+	// when
+	cache.Preallocate(64 * 1024)
+
+	// then
+	assertEqual(t, 64*1024, cache.Capacity())
+	entry, err := cache.Get("key")
+	noError(t, err)
+	assertEqual(t, []byte("value"), entry)
+
+	// when
+	cache.Preallocate(16 * 1024 * 1024)
+
+	// then
+	assertEqual(t, 1024*1024, cache.Capacity())
+}
+
+func TestPreallocateTimeSegments(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         4 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		TimeSegments:       3,
+	})
+
+	// when
+	cache.Preallocate(4096)
+
+	// then
+	assertEqual(t, 1024, cache.Capacity())
+	assertEqual(t, 1024, cache.shards[0].entries.(*segmentedQueue).capacity)
+}
+
+func TestCacheInitialShardBytes(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             2,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 2 * 1024,
+		MaxEntrySize:       1024,
+		InitialShardBytes:  1000,
+	})
+
+	// then
+	assertEqual(t, 2000, cache.Capacity())
+	assertEqual(t, int64(0), cache.Stats().InitialSizeExceeded)
+
+	// when
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), blob('a', 100))
+	}
+
+	// then
+	assertEqual(t, int64(2), cache.Stats().InitialSizeExceeded)
+}
+
+func TestEntryFormatV2WithChecksum(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		EntryFormat:        EntryFormatV2,
+		EntryChecksum:      true,
+	})
+	cache.Set("key", []byte("value"))
+	cache.Append("key", []byte("-appended"))
+
+	// when
+	cachedValue, err := cache.Get("key")
+
+	// then
+	noError(t, err)
+	assertEqual(t, []byte("value-appended"), cachedValue)
+
+	// when
+	shard := cache.shards[0]
+	wrappedEntry, _ := shard.entries.Get(int(shard.hashmap[cache.hash.Sum64("key")]))
+	wrappedEntry[len(wrappedEntry)-1]++
+	_, err = cache.Get("key")
+
+	// then
+	assertEqual(t, ErrEntryCorrupted, err)
+}
+
+func TestCachePreallocateShards(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 4 * 1024,
+		MaxEntrySize:       256,
+		PreallocateShards:  true,
+	})
+
+	// when
+	cache.Set("key", []byte("value"))
+	cachedValue, err := cache.Get("key")
+
+	// then
+	noError(t, err)
+	assertEqual(t, []byte("value"), cachedValue)
+	assertEqual(t, 4*1024*256, cache.Capacity())
+}
+
+func TestMaxEntries(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var evicted []string
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		MaxEntries:         3,
+		OnRemoveWithReason: func(key string, entry []byte, reason RemoveReason) {
+			assertEqual(t, NoSpace, reason)
+			evicted = append(evicted, key)
+		},
+	})
+
+	// when
+	for i := 0; i < 5; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+
+	// then
+	assertEqual(t, 3, cache.Len())
+	assertEqual(t, []string{"key0", "key1"}, evicted)
+
+	// when
+	cache.Set("key4", []byte("updated"))
+
+	// then
+	assertEqual(t, 3, cache.Len())
+	assertEqual(t, 2, len(evicted))
+}
+
 func TestRemoveEntriesWhenShardIsFull(t *testing.T) {
 	t.Parallel()
 
@@ -645,8 +1344,48 @@ func TestCacheStats(t *testing.T) {
 	assertEqual(t, stats.Misses, int64(10))
 	assertEqual(t, stats.DelHits, int64(10))
 	assertEqual(t, stats.DelMisses, int64(10))
+	assertEqual(t, int64(100), stats.Sets)
+	assertEqual(t, int64(500), stats.BytesWritten)
+	assertEqual(t, int64(50), stats.BytesRead)
 }
-func TestCacheEntryStats(t *testing.T) {
+
+func TestStatsSub(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}, &clock)
+	cache.Set("key", []byte("value"))
+	cache.Get("key")
+	prev := cache.Stats()
+
+	// when
+	cache.Set("other", []byte("value"))
+	cache.Get("other")
+	cache.Get("missing")
+	cache.Preallocate(1 << 20)
+	clock.set(5)
+	cache.cleanUp(5)
+	delta := cache.Stats().Sub(prev)
+
+	// then
+	assertEqual(t, int64(1), delta.Hits)
+	assertEqual(t, int64(1), delta.Misses)
+	assertEqual(t, int64(1), delta.Sets)
+	assertEqual(t, int64(5), delta.BytesWritten)
+	assertEqual(t, int64(5), delta.BytesRead)
+	assertEqual(t, int64(1), delta.QueueResizes)
+	assertEqual(t, int64(1), delta.CleanUps)
+	assertEqual(t, cache.Stats().UsedBytes, delta.UsedBytes)
+	assertEqual(t, cache.Stats().MaxCleanUpTime, delta.MaxCleanUpTime)
+}
+
+func TestCacheEntryStats(t *testing.T) {
 	t.Parallel()
 
 	// given
@@ -724,6 +1463,7 @@ func TestCacheDel(t *testing.T) {
 
 	// given
 	cache, _ := New(context.Background(), DefaultConfig(time.Second))
+	defer cache.Close()
 
 	// when
 	err := cache.Delete("nonExistingKey")
@@ -810,6 +1550,7 @@ func TestWriteAndReadParallelSameKeyWithStats(t *testing.T) {
 	c.StatsEnabled = true
 
 	cache, _ := New(context.Background(), c)
+	defer cache.Close()
 	var wg sync.WaitGroup
 	ntest := 1000
 	n := 10
@@ -832,7 +1573,11 @@ func TestWriteAndReadParallelSameKeyWithStats(t *testing.T) {
 
 	wg.Wait()
 
-	assertEqual(t, Stats{Hits: int64(n * ntest)}, cache.Stats())
+	// 1000 overwrites of a 1KB value outgrow the queue size derived from DefaultConfig
+	stats := cache.Stats()
+	assertEqual(t, int64(n*ntest), stats.Hits)
+	assertEqual(t, int64(1), stats.InitialSizeExceeded)
+	assertEqual(t, int64((ntest-1)*(headersSizeInBytes+len(key)+len(value))), stats.DeadBytes)
 	assertEqual(t, ntest*n, int(cache.KeyMetadata(key).RequestCount))
 }
 
@@ -871,6 +1616,34 @@ func TestCacheReset(t *testing.T) {
 	assertEqual(t, keys, cache.Len())
 }
 
+func TestCacheResetShard(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             2,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 1,
+		MaxEntrySize:       256,
+		Hasher:             hashStub(1),
+	})
+	cache.Set("key", []byte("value"))
+
+	// when
+	errInvalid := cache.ResetShard(2)
+	noError(t, cache.ResetShard(0))
+
+	// then
+	assertEqual(t, ErrInvalidShardIndex, errInvalid)
+	assertEqual(t, 1, cache.Len())
+
+	// when
+	noError(t, cache.ResetShard(1))
+
+	// then
+	assertEqual(t, 0, cache.Len())
+}
+
 func TestIterateOnResetCache(t *testing.T) {
 	t.Parallel()
 
@@ -972,6 +1745,199 @@ func TestOldestEntryDeletionWhenMaxCacheSizeIsReached(t *testing.T) {
 	assertEqual(t, blob('c', 1024*800), entry3)
 }
 
+func TestGetUnsafe(t *testing.T) {
+	t.Parallel()
+
+	// given
+	config := DefaultConfig(time.Minute)
+	config.Shards = 1
+	config.UnsafeGetEnabled = true
+	config.StatsEnabled = true
+	cache, _ := New(context.Background(), config)
+	defer cache.Close()
+	cache.Set("key", []byte("value"))
+
+	// when
+	entry, release, err := cache.GetUnsafe("key")
+
+	// then
+	noError(t, err)
+	assertEqual(t, []byte("value"), entry)
+	assertEqual(t, len(entry), cap(entry))
+
+	// when
+	written := make(chan struct{})
+	go func() {
+		cache.Set("other", []byte("value"))
+		close(written)
+	}()
+
+	// then
+	select {
+	case <-written:
+		t.Error("write should wait for release")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	release()
+	<-written
+	assertEqual(t, int64(1), cache.Stats().Hits)
+
+	_, _, err = cache.GetUnsafe("missing")
+	assertEqual(t, ErrEntryNotFound, err)
+}
+
+func TestPanickingCallbacksReleaseShardLock(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	})
+	defer cache.Close()
+	cache.Set("key", []byte("value"))
+	callbacks := map[string]func(){
+		"GetFn": func() {
+			cache.GetFn("key", func([]byte) error { panic("callback") })
+		},
+		"GetFnWithOptions": func() {
+			cache.GetFnWithOptions("key", func([]byte, Options) error { panic("callback") })
+		},
+		"Update": func() {
+			cache.Update("key", func([]byte, bool) ([]byte, bool, error) { panic("callback") })
+		},
+		"DeleteIf": func() {
+			cache.DeleteIf("key", func([]byte, EntryInfo) bool { panic("callback") })
+		},
+	}
+
+	for name, callback := range callbacks {
+		// when
+		recovered := panicValue(callback)
+
+		// then
+		assertEqual(t, "callback", recovered, name)
+		noError(t, cache.Set("key", []byte("value")))
+	}
+}
+
+// panicValue calls fn and returns the value it panicked with
+func panicValue(fn func()) (recovered interface{}) {
+	defer func() {
+		recovered = recover()
+	}()
+	fn()
+	return nil
+}
+
+func TestGetFn(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	cache.Set("key", []byte("value"))
+	var buf bytes.Buffer
+	errWrite := errors.New("write failed")
+
+	// when
+	err := cache.GetFn("key", func(entry []byte) error {
+		_, err := buf.Write(entry)
+		return err
+	})
+	missErr := cache.GetFn("missing", func(entry []byte) error {
+		t.Error("callback should not be called for missing key")
+		return nil
+	})
+	fnErr := cache.GetFn("key", func(entry []byte) error {
+		return errWrite
+	})
+
+	// then
+	noError(t, err)
+	assertEqual(t, []byte("value"), buf.Bytes())
+	assertEqual(t, ErrEntryNotFound, missErr)
+	assertEqual(t, errWrite, fnErr)
+}
+
+func TestGetRange(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	cache.Set("key", []byte("header:body"))
+
+	// when
+	header, err := cache.GetRange("key", 0, 6)
+	body, bodyErr := cache.GetRange("key", 7, 100)
+	empty, emptyErr := cache.GetRange("key", 11, 1)
+	_, beyondErr := cache.GetRange("key", 12, 1)
+	_, negativeErr := cache.GetRange("key", -1, 1)
+	_, missErr := cache.GetRange("missing", 0, 1)
+
+	// then
+	noError(t, err)
+	assertEqual(t, []byte("header"), header)
+	noError(t, bodyErr)
+	assertEqual(t, []byte("body"), body)
+	noError(t, emptyErr)
+	assertEqual(t, []byte{}, empty)
+	assertEqual(t, ErrInvalidRange, beyondErr)
+	assertEqual(t, ErrInvalidRange, negativeErr)
+	assertEqual(t, ErrEntryNotFound, missErr)
+}
+
+func TestSetWithOptions(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	var contentTypes []string
+	read := func(entry []byte, options Options) error {
+		contentTypes = append(contentTypes, options.ContentType)
+		return nil
+	}
+
+	// when
+	err := cache.SetWithOptions("json", []byte(`{}`), Options{ContentType: "application/json"})
+	cache.Set("plain", []byte("value"))
+	cache.GetFnWithOptions("json", read)
+	cache.GetFnWithOptions("plain", read)
+	cache.Append("json", []byte(` `))
+	cache.GetFnWithOptions("json", read)
+	tooLongErr := cache.SetWithOptions("long", nil, Options{ContentType: string(blob('a', 256))})
+
+	// then
+	noError(t, err)
+	assertEqual(t, []string{"application/json", "", "application/json"}, contentTypes)
+	entry, _ := cache.Get("json")
+	assertEqual(t, []byte(`{} `), entry)
+	assertEqual(t, ErrContentTypeTooLong, tooLongErr)
+	assertEqual(t, 0, len(cache.Verify()))
+}
+
+func TestGetUnsafeDisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	cache.Set("key", []byte("value"))
+
+	// when
+	entry, release, err := cache.GetUnsafe("key")
+
+	// then
+	assertEqual(t, ErrUnsafeGetDisabled, err)
+	assertEqual(t, []byte(nil), entry)
+	assertEqual(t, true, release == nil)
+}
+
 func TestRetrievingEntryShouldCopy(t *testing.T) {
 	t.Parallel()
 
@@ -1014,7 +1980,34 @@ func TestEntryBiggerThanMaxShardSizeError(t *testing.T) {
 	err := cache.Set("key1", blob('a', 1024*1025))
 
 	// then
-	assertEqual(t, "entry is bigger than max shard size", err.Error())
+	assertEqual(t, ErrEntryExceedsShardCapacity, err)
+}
+
+func TestEntryBiggerThanMaxShardSizeKeepsEntries(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         5 * time.Second,
+		MaxEntriesInWindow: 1,
+		MaxEntrySize:       1,
+		HardMaxCacheSize:   1,
+	})
+	cache.Set("key1", blob('a', 1024))
+	cache.Set("key2", blob('b', 1024))
+
+	// when
+	err := cache.Set("key1", blob('c', 1024*1025))
+	appendErr := cache.Append("key2", blob('c', 1024*1025))
+
+	// then
+	assertEqual(t, ErrEntryExceedsShardCapacity, err)
+	assertEqual(t, ErrEntryExceedsShardCapacity, appendErr)
+	entry1, _ := cache.Get("key1")
+	entry2, _ := cache.Get("key2")
+	assertEqual(t, blob('a', 1024), entry1)
+	assertEqual(t, blob('b', 1024), entry2)
 }
 
 func TestHashCollision(t *testing.T) {
@@ -1266,6 +2259,7 @@ func TestCache_SetWithoutCleanWindow(t *testing.T) {
 	opt.CleanWindow = 0
 	opt.HardMaxCacheSize = 1
 	bc, _ := New(context.Background(), opt)
+	defer bc.Close()
 
 	err := bc.Set("2225", make([]byte, 200))
 	if nil != err {
@@ -1282,6 +2276,7 @@ func TestCache_RepeatedSetWithBiggerEntry(t *testing.T) {
 	opt.MaxEntrySize = 1
 	opt.HardMaxCacheSize = 1
 	bc, _ := New(context.Background(), opt)
+	defer bc.Close()
 
 	err := bc.Set("2225", make([]byte, 200))
 	if nil != err {
@@ -1389,3 +2384,557 @@ func TestRemoveNonExpiredData(t *testing.T) {
 		noError(t, err)
 	}
 }
+
+func TestMillisecondTimestampPrecision(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 1000}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         500 * time.Millisecond,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		TimestampPrecision: time.Millisecond,
+	}, &clock)
+	cache.Set("key", []byte("value"))
+
+	// when
+	clock.set(1400)
+	ttl, err := cache.TTL("key")
+
+	// then
+	noError(t, err)
+	assertEqual(t, 100*time.Millisecond, ttl)
+
+	// when
+	cache.Expire("key", 250*time.Millisecond)
+	ttl, _ = cache.TTL("key")
+
+	// then
+	assertEqual(t, 250*time.Millisecond, ttl)
+
+	// when
+	clock.set(1700)
+	cache.Set("other", []byte("value"))
+	_, err = cache.Get("key")
+
+	// then
+	assertEqual(t, ErrEntryNotFound, err)
+}
+
+func TestMonotonicClock(t *testing.T) {
+	t.Parallel()
+
+	// given
+	start := time.Now()
+	clock := &monotonicClock{start: start.Add(-2 * time.Second), unit: time.Millisecond}
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Second,
+		CleanWindow:        time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		MonotonicClock:     true,
+	})
+
+	// when
+	epoch := clock.Epoch()
+	cache.Set("key", []byte("value"))
+	value, err := cache.Get("key")
+
+	// then
+	assertEqual(t, true, epoch >= start.UnixNano()/int64(time.Millisecond))
+	assertEqual(t, true, epoch-start.UnixNano()/int64(time.Millisecond) < 1000)
+	noError(t, err)
+	assertEqual(t, []byte("value"), value)
+}
+
+func TestShardingFunc(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         5 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		ShardingFunc: func(hash uint64, shards int) int {
+			return int(hash>>32) + shards
+		},
+	})
+	defaultCache, _ := New(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         5 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	})
+
+	// when
+	cache.Set("key", []byte("value"))
+	shard := cache.ShardFor("key")
+
+	// then
+	hash := cache.hash.Sum64("key")
+	assertEqual(t, int((hash>>32+4)%4), shard)
+	assertEqual(t, 1, cache.shards[shard].len())
+	assertEqual(t, int(hash&3), defaultCache.ShardFor("key"))
+	values, _ := cache.GetMulti([]string{"key"})
+	assertEqual(t, [][]byte{[]byte("value")}, values)
+}
+
+func TestShardStats(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             2,
+		LifeWindow:         5 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		LockStatsEnabled:   true,
+		Hasher:             hashStub(0),
+	})
+
+	// when
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+				cache.Get(fmt.Sprintf("key%d", i))
+			}
+		}(i)
+	}
+	wg.Wait()
+	stats := cache.ShardStats()
+
+	// then
+	assertEqual(t, 2, len(stats))
+	assertEqual(t, 1, stats[0].Entries)
+	assertEqual(t, 0, stats[1].Entries)
+	assertEqual(t, true, stats[0].LockAcquisitions >= 2000)
+	assertEqual(t, int64(0), stats[1].LockAcquisitions)
+	var histogramCount int64
+	for _, count := range stats[0].LockWaitHistogram {
+		histogramCount += count
+	}
+	assertEqual(t, stats[0].LockAcquisitions, histogramCount)
+
+	// when
+	cache.ResetStats()
+
+	// then
+	assertEqual(t, int64(0), cache.ShardStats()[0].LockAcquisitions)
+}
+
+func TestShardStatsQueuePointers(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		HardMaxCacheSize:   1,
+	})
+
+	// when
+	for i := 0; i < 10000; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), blob('a', 200))
+	}
+	stats := cache.ShardStats()[0]
+
+	// then
+	assertEqual(t, true, stats.Wraps > 0)
+	assertEqual(t, true, stats.Tail <= stats.Head)
+	assertEqual(t, true, stats.Head < stats.RightMargin)
+	assertEqual(t, true, stats.RightMargin <= stats.Capacity)
+}
+
+func TestKeyNormalizer(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		KeyNormalizer: func(key string) string {
+			return strings.ToLower(strings.TrimSpace(key))
+		},
+	})
+
+	// when
+	cache.Set(" Key ", []byte("value"))
+
+	// then
+	entry, err := cache.Get("KEY")
+	noError(t, err)
+	assertEqual(t, []byte("value"), entry)
+	entries, _ := cache.GetMulti([]string{"kEy", "other"})
+	assertEqual(t, [][]byte{[]byte("value"), nil}, entries)
+	assertEqual(t, cache.ShardFor("key"), cache.ShardFor(" KEY"))
+	err = cache.DoAtomic([]string{"Key"}, func(tx Txn) error {
+		return tx.Set("KEY ", []byte("updated"))
+	})
+	noError(t, err)
+	entry, _ = cache.Get("key")
+	assertEqual(t, []byte("updated"), entry)
+	noError(t, cache.Delete("KEY"))
+	assertEqual(t, 0, cache.Len())
+}
+
+func TestMaxKeyLength(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		MaxKeyLength:       8,
+	})
+
+	// when
+	err := cache.Set("too-long-key", []byte("value"))
+
+	// then
+	assertEqual(t, ErrKeyTooLong, err)
+	assertEqual(t, ErrKeyTooLong, cache.Append("too-long-key", []byte("value")))
+	_, err = cache.GetOrLoad("too-long-key", func() ([]byte, error) { return []byte("value"), nil })
+	assertEqual(t, ErrKeyTooLong, err)
+	_, err = cache.Get("too-long-key")
+	assertEqual(t, ErrEntryNotFound, err)
+	noError(t, cache.Set("key", []byte("value")))
+	assertEqual(t, 1, cache.Len())
+}
+
+func TestKeyOfExtendedHeaderMarkerLengthIsRejected(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	})
+	defer cache.Close()
+	key := string(blob('a', 65535))
+
+	// when
+	err := cache.Set(key, []byte("value"))
+
+	// then
+	assertEqual(t, ErrKeyTooLong, err)
+	_, err = cache.Get(key)
+	assertEqual(t, ErrEntryNotFound, err)
+	noError(t, cache.Set(key[:65534], []byte("value")))
+	entry, err := cache.Get(key[:65534])
+	noError(t, err)
+	assertEqual(t, []byte("value"), entry)
+}
+
+func TestSetWithSequence(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		EntryFormat:        EntryFormatV2,
+		EntrySequence:      true,
+	})
+
+	// when
+	first, err := cache.SetWithSequence("key1", []byte("value"))
+	noError(t, err)
+	cache.Set("key2", []byte("value"))
+	second, err := cache.SetWithSequence("key1", []byte("value2"))
+	noError(t, err)
+
+	// then
+	assertEqual(t, uint64(1), first)
+	assertEqual(t, uint64(3), second)
+	cachedValue, err := cache.Get("key1")
+	noError(t, err)
+	assertEqual(t, []byte("value2"), cachedValue)
+
+	sequences := map[string]uint64{}
+	cache.ForEach(func(key string, entry []byte, info EntryInfo) bool {
+		sequences[key] = info.Sequence()
+		return true
+	})
+	assertEqual(t, map[string]uint64{"key1": 3, "key2": 2}, sequences)
+
+	iterator := cache.Iterator()
+	for iterator.SetNext() {
+		info, err := iterator.Value()
+		noError(t, err)
+		assertEqual(t, sequences[info.Key()], info.Sequence())
+	}
+}
+
+func TestSetWithSequenceDisabled(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+
+	// when
+	sequence, err := cache.SetWithSequence("key", []byte("value"))
+
+	// then
+	noError(t, err)
+	assertEqual(t, uint64(0), sequence)
+	cachedValue, err := cache.Get("key")
+	noError(t, err)
+	assertEqual(t, []byte("value"), cachedValue)
+}
+
+func TestGetDigest(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		EntryFormat:        EntryFormatV2,
+		EntryDigest:        true,
+	})
+	plain, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer plain.Close()
+	cache.Set("key", []byte("value"))
+	plain.Set("key", []byte("value"))
+
+	// when
+	digest, err := cache.GetDigest("key")
+	plainDigest, plainErr := plain.GetDigest("key")
+	cache.Append("key", []byte("2"))
+	appendedDigest, _ := cache.GetDigest("key")
+	_, missingErr := cache.GetDigest("missing")
+
+	// then
+	noError(t, err)
+	noError(t, plainErr)
+	assertEqual(t, xxh3([]byte("value")), digest)
+	assertEqual(t, digest, plainDigest)
+	assertEqual(t, xxh3([]byte("value2")), appendedDigest)
+	assertEqual(t, ErrEntryNotFound, missingErr)
+	wrapped, _ := cache.shards[0].getEntry(cache.hash.Sum64("key"))
+	stored, ok := readDigestFromEntry(wrapped)
+	assertEqual(t, true, ok)
+	assertEqual(t, appendedDigest, stored)
+}
+
+func TestExpireOnGet(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		ExpireOnGet:        true,
+	}, &clock)
+	cache.Set("key", []byte("value"))
+
+	// when
+	clock.set(1)
+	cachedValue, err := cache.Get("key")
+
+	// then
+	noError(t, err)
+	assertEqual(t, []byte("value"), cachedValue)
+
+	// when
+	clock.set(5)
+	_, err = cache.Get("key")
+
+	// then
+	assertEqual(t, ErrEntryNotFound, err)
+	assertEqual(t, int64(1), cache.Stats().LazyExpirations)
+	assertEqual(t, int64(1), cache.Stats().Misses)
+	assertEqual(t, 1, cache.Len())
+}
+
+func TestDeleteExpiredOnGet(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	var removed []string
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		ExpireOnGet:        true,
+		DeleteExpiredOnGet: true,
+		OnRemoveWithReason: func(key string, entry []byte, reason RemoveReason) {
+			if reason == Expired {
+				removed = append(removed, key)
+			}
+		},
+	}, &clock)
+	cache.Set("key", []byte("value"))
+
+	// when
+	clock.set(5)
+	_, err := cache.Get("key")
+
+	// then
+	assertEqual(t, ErrEntryNotFound, err)
+	assertEqual(t, []string{"key"}, removed)
+	assertEqual(t, 0, cache.Len())
+	assertEqual(t, int64(1), cache.Stats().LazyExpirations)
+	assertEqual(t, 0, len(cache.Verify()))
+}
+
+func TestCleanUpPhase(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		CleanPhases:        2,
+	}, &clock)
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+
+	// when
+	clock.set(5)
+	cache.cleanUpPhase(5, 1, 2)
+
+	// then
+	for i, stats := range cache.ShardStats() {
+		if i%2 == 1 {
+			assertEqual(t, 0, stats.Entries)
+			assertEqual(t, int64(1), stats.CleanUps)
+			assertEqual(t, true, stats.MaxCleanUpTime > 0 && stats.MaxCleanUpTime <= stats.CleanUpTime)
+		} else {
+			assertEqual(t, true, stats.Entries > 0)
+			assertEqual(t, int64(0), stats.CleanUps)
+		}
+	}
+}
+
+func TestSweepStopsAtDeadlineAndResumesFromCursor(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             2,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}, &clock)
+	for i := 0; cache.shards[0].entries.Len() < 2 || cache.shards[1].entries.Len() < 2; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+	shardLen := func(shard int) int { return cache.shards[shard].entries.Len() }
+	lengths := []int{shardLen(0), shardLen(1)}
+	passed := time.Now().Add(-time.Second)
+	clock.set(5)
+
+	// when
+	cursor := cache.sweep(5, 0, 1, passed)
+
+	// then
+	assertEqual(t, 0, cursor)
+	assertEqual(t, lengths[0]-1, shardLen(0))
+	assertEqual(t, lengths[1], shardLen(1))
+
+	// when
+	for cursor == 0 {
+		cursor = cache.sweep(5, cursor, 1, passed)
+	}
+
+	// then
+	assertEqual(t, 1, cursor)
+	assertEqual(t, 0, shardLen(0))
+	assertEqual(t, lengths[1], shardLen(1))
+
+	// when
+	for cursor == 1 {
+		cursor = cache.sweep(5, cursor, 1, passed)
+	}
+
+	// then
+	assertEqual(t, 2, cursor)
+	assertEqual(t, 0, cache.Len())
+	stats := cache.ShardStats()
+	assertEqual(t, int64(lengths[0]), stats[0].CleanUpYields)
+	assertEqual(t, int64(lengths[1]), stats[1].CleanUpYields)
+}
+
+func TestStaggeredCleanUp(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         time.Second,
+		CleanWindow:        40 * time.Millisecond,
+		CleanPhases:        4,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	})
+	defer cache.Close()
+
+	// when
+	time.Sleep(200 * time.Millisecond)
+
+	// then
+	for _, stats := range cache.ShardStats() {
+		assertEqual(t, true, stats.CleanUps > 0)
+	}
+}
+
+func TestOnQueueResize(t *testing.T) {
+	t.Parallel()
+
+	// given
+	type resize struct{ shard, from, to int }
+	var resizes []resize
+	var took time.Duration
+	cache, _ := New(context.Background(), Config{
+		Shards:             2,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 2,
+		MaxEntrySize:       16,
+		Hasher:             hashStub(1),
+		OnQueueResize: func(shard int, from int, to int, d time.Duration) {
+			resizes = append(resizes, resize{shard, from, to})
+			took += d
+		},
+	})
+	from := cache.shards[1].capacity()
+
+	// when
+	cache.Set("key", blob('a', 1024))
+	cache.Set("key", blob('b', 16))
+
+	// then
+	assertEqual(t, []resize{{1, from, cache.shards[1].capacity()}}, resizes)
+	assertEqual(t, true, took >= 0)
+}
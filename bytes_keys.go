@@ -0,0 +1,19 @@
+package bigcache
+
+// Methods taking keys as bytes avoid converting keys built in reusable buffers, e.g. by the keys package,
+// to strings. Keys are not retained by the cache, so their buffers can be reused once the call returns.
+
+// GetBytesKey reads entry for the key like Get
+func (c *BigCache) GetBytesKey(key []byte) ([]byte, error) {
+	return c.Get(bytesToString(key))
+}
+
+// SetBytesKey saves entry under the key like Set
+func (c *BigCache) SetBytesKey(key []byte, entry []byte) error {
+	return c.Set(bytesToString(key), entry)
+}
+
+// DeleteBytesKey removes the key like Delete
+func (c *BigCache) DeleteBytesKey(key []byte) error {
+	return c.Delete(bytesToString(key))
+}
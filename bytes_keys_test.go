@@ -0,0 +1,31 @@
+package bigcache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBytesKeyMethods(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(5*time.Second))
+	defer cache.Close()
+	key := []byte("key")
+
+	// when
+	noError(t, cache.SetBytesKey(key, []byte("value")))
+	copy(key, "xyz")
+
+	// then
+	entry, err := cache.Get("key")
+	noError(t, err)
+	assertEqual(t, []byte("value"), entry)
+	entry, err = cache.GetBytesKey([]byte("key"))
+	noError(t, err)
+	assertEqual(t, []byte("value"), entry)
+	noError(t, cache.DeleteBytesKey([]byte("key")))
+	_, err = cache.Get("key")
+	assertEqual(t, ErrEntryNotFound, err)
+}
@@ -0,0 +1,210 @@
+//go:build go1.18
+// +build go1.18
+
+package cacheaside
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+const (
+	presentValue = 0 // Header of entries holding an encoded value
+	absentValue  = 1 // Header of entries caching absence of a value
+
+	// headerSize is the size of the kind of the entry and the time it was stored at
+	headerSize = 9
+)
+
+// ErrNotFound is returned by loaders when the value does not exist. Fetch caches the absence for
+// Options.NegativeTTL and returns the error of the loader.
+var ErrNotFound = errors.New("cacheaside: value not found")
+
+// NegativeError is returned by Fetch when absence of the value is cached, errors.Is(err, ErrNotFound) holds for it
+type NegativeError struct {
+	Key string
+}
+
+func (e *NegativeError) Error() string {
+	return fmt.Sprintf("cacheaside: value of %q is cached as not found", e.Key)
+}
+
+// Is reports whether target is ErrNotFound
+func (e *NegativeError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// StaleError is returned by Fetch together with a stale value, when loading of a fresh one failed
+type StaleError struct {
+	Key string
+	// Age is the time since the stale value was stored
+	Age time.Duration
+	// Err is the error of the loader
+	Err error
+}
+
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("cacheaside: serving value of %q stored %s ago: %v", e.Key, e.Age, e.Err)
+}
+
+func (e *StaleError) Unwrap() error {
+	return e.Err
+}
+
+// LoadError is returned by Fetch when the value was missing and the loader failed with an error other than ErrNotFound
+type LoadError struct {
+	Key string
+	Err error
+}
+
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("cacheaside: loading value of %q: %v", e.Key, e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// Options configure how Fetch caches values of type T
+type Options[T any] struct {
+	// TTL is how long a loaded value is fresh. Zero means the lifetime of the cache.
+	TTL time.Duration
+	// StaleTTL is how long after TTL a value is returned with StaleError when loading fails. Zero disables it.
+	StaleTTL time.Duration
+	// NegativeTTL is how long absence reported with ErrNotFound is cached. Zero disables negative caching.
+	NegativeTTL time.Duration
+	// Marshal and Unmarshal encode values, they default to encoding/json
+	Marshal   func(value T) ([]byte, error)
+	Unmarshal func(data []byte) (T, error)
+}
+
+func (o Options[T]) marshal(value T) ([]byte, error) {
+	if o.Marshal != nil {
+		return o.Marshal(value)
+	}
+	return json.Marshal(value)
+}
+
+func (o Options[T]) unmarshal(data []byte) (T, error) {
+	if o.Unmarshal != nil {
+		return o.Unmarshal(data)
+	}
+	var value T
+	err := json.Unmarshal(data, &value)
+	return value, err
+}
+
+// Cache shares BigCache and in-flight loads between Fetch calls
+type Cache struct {
+	cache *bigcache.BigCache
+	lock  sync.Mutex
+	calls map[string]*call
+	now   func() time.Time
+}
+
+type call struct {
+	wg    sync.WaitGroup
+	value interface{}
+	err   error
+}
+
+// New returns cache-aside reads through the cache
+func New(cache *bigcache.BigCache) *Cache {
+	return &Cache{cache: cache, calls: make(map[string]*call), now: time.Now}
+}
+
+// Fetch returns the value of the key, calling load when it is missing or no longer fresh. Concurrent calls
+// for the same key share a single load. The outcome is told apart by the error:
+//   - nil for a cached or loaded value
+//   - *NegativeError when absence of the value is cached
+//   - *StaleError with the stale value when it was not fresh and load failed
+//   - *LoadError when the value was missing and load failed
+//   - the error of load, e.g. ErrNotFound, when it reported the value does not exist
+func Fetch[T any](ctx context.Context, c *Cache, key string, load func(ctx context.Context) (T, error), options Options[T]) (T, error) {
+	var zero T
+	now := c.now()
+	entry, err := c.cache.Get(key)
+	stale, hasStale := zero, false
+	var storedAt time.Time
+	if err == nil && len(entry) >= headerSize {
+		storedAt = time.Unix(0, int64(binary.LittleEndian.Uint64(entry[1:])))
+		age := now.Sub(storedAt)
+		switch entry[0] {
+		case absentValue:
+			if age < options.NegativeTTL {
+				return zero, &NegativeError{Key: key}
+			}
+		case presentValue:
+			if value, err := options.unmarshal(entry[headerSize:]); err == nil {
+				if options.TTL <= 0 || age < options.TTL {
+					return value, nil
+				}
+				stale, hasStale = value, age < options.TTL+options.StaleTTL
+			}
+		}
+	}
+
+	value, err := loadOnce(ctx, c, key, load, options)
+	switch {
+	case err == nil:
+		return value, nil
+	case errors.Is(err, ErrNotFound):
+		return zero, err
+	case hasStale:
+		return stale, &StaleError{Key: key, Age: now.Sub(storedAt), Err: err}
+	default:
+		return zero, &LoadError{Key: key, Err: err}
+	}
+}
+
+// loadOnce calls load once for concurrent callers of the key and caches its result
+func loadOnce[T any](ctx context.Context, c *Cache, key string, load func(ctx context.Context) (T, error), options Options[T]) (T, error) {
+	c.lock.Lock()
+	if f, ok := c.calls[key]; ok {
+		c.lock.Unlock()
+		f.wg.Wait()
+		// calls of the key with values of another type load on their own
+		if value, ok := f.value.(T); ok || f.err != nil {
+			return value, f.err
+		}
+		return load(ctx)
+	}
+	f := &call{}
+	f.wg.Add(1)
+	c.calls[key] = f
+	c.lock.Unlock()
+
+	value, err := load(ctx)
+	f.value, f.err = value, err
+	switch {
+	case err == nil:
+		if data, err := options.marshal(value); err == nil {
+			c.store(key, presentValue, data, options.TTL+options.StaleTTL)
+		}
+	case errors.Is(err, ErrNotFound) && options.NegativeTTL > 0:
+		c.store(key, absentValue, nil, options.NegativeTTL)
+	}
+	c.lock.Lock()
+	delete(c.calls, key)
+	c.lock.Unlock()
+	f.wg.Done()
+	return value, err
+}
+
+// store caches the entry of the kind stamped with the current time, zero ttl means the lifetime of the cache
+func (c *Cache) store(key string, kind byte, data []byte, ttl time.Duration) {
+	entry := make([]byte, headerSize+len(data))
+	entry[0] = kind
+	binary.LittleEndian.PutUint64(entry[1:], uint64(c.now().UnixNano()))
+	copy(entry[headerSize:], data)
+	if c.cache.Set(key, entry) == nil && ttl > 0 {
+		c.cache.Expire(key, ttl)
+	}
+}
@@ -0,0 +1,143 @@
+//go:build go1.18
+// +build go1.18
+
+package cacheaside
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+type user struct {
+	Name string
+}
+
+func newCache(t *testing.T) (*Cache, *time.Time) {
+	cache, err := bigcache.New(context.Background(), bigcache.DefaultConfig(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(cache)
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestFetchLoadsAndCaches(t *testing.T) {
+	c, _ := newCache(t)
+	loads := 0
+	load := func(ctx context.Context) (user, error) {
+		loads++
+		return user{Name: "alice"}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		value, err := Fetch(context.Background(), c, "user:1", load, Options[user]{TTL: time.Minute})
+		if err != nil || value.Name != "alice" {
+			t.Errorf("Expected alice, got %v, %v", value, err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("Expected 1 load, got %d", loads)
+	}
+}
+
+func TestFetchCachesAbsence(t *testing.T) {
+	c, now := newCache(t)
+	loads := 0
+	load := func(ctx context.Context) (user, error) {
+		loads++
+		return user{}, ErrNotFound
+	}
+	options := Options[user]{TTL: time.Minute, NegativeTTL: 10 * time.Second}
+
+	_, err := Fetch(context.Background(), c, "user:2", load, options)
+	if err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	_, err = Fetch(context.Background(), c, "user:2", load, options)
+	var negative *NegativeError
+	if !errors.As(err, &negative) || !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected NegativeError, got %v", err)
+	}
+	if loads != 1 {
+		t.Errorf("Expected 1 load, got %d", loads)
+	}
+
+	*now = now.Add(11 * time.Second)
+	Fetch(context.Background(), c, "user:2", load, options)
+	if loads != 2 {
+		t.Errorf("Expected absence to be loaded again after NegativeTTL, got %d loads", loads)
+	}
+}
+
+func TestFetchServesStaleValue(t *testing.T) {
+	c, now := newCache(t)
+	failure := errors.New("database is down")
+	options := Options[user]{TTL: time.Minute, StaleTTL: time.Hour}
+	Fetch(context.Background(), c, "user:3", func(ctx context.Context) (user, error) {
+		return user{Name: "bob"}, nil
+	}, options)
+	*now = now.Add(2 * time.Minute)
+
+	value, err := Fetch(context.Background(), c, "user:3", func(ctx context.Context) (user, error) {
+		return user{}, failure
+	}, options)
+
+	var stale *StaleError
+	if !errors.As(err, &stale) || !errors.Is(err, failure) {
+		t.Fatalf("Expected StaleError, got %v", err)
+	}
+	if value.Name != "bob" || stale.Age != 2*time.Minute {
+		t.Errorf("Expected bob stored 2m ago, got %v stored %s ago", value, stale.Age)
+	}
+}
+
+func TestFetchReportsLoadError(t *testing.T) {
+	c, _ := newCache(t)
+	failure := errors.New("database is down")
+
+	_, err := Fetch(context.Background(), c, "user:4", func(ctx context.Context) (user, error) {
+		return user{}, failure
+	}, Options[user]{})
+
+	var loadErr *LoadError
+	if !errors.As(err, &loadErr) || !errors.Is(err, failure) {
+		t.Errorf("Expected LoadError, got %v", err)
+	}
+}
+
+func TestFetchSharesConcurrentLoads(t *testing.T) {
+	c, _ := newCache(t)
+	var loads int32
+	release := make(chan struct{})
+	load := func(ctx context.Context) (string, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return "value", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, err := Fetch(context.Background(), c, "key", load, Options[string]{}); err != nil || value != "value" {
+				t.Errorf("Expected value, got %q, %v", value, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if loads != 1 {
+		t.Errorf("Expected 1 load, got %d", loads)
+	}
+}
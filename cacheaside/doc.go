@@ -0,0 +1,5 @@
+// Package cacheaside reads values of any type through BigCache with Fetch, which combines loading of missing
+// values, a single load per key for concurrent callers, negative caching of absent values and serving of stale
+// values when loading fails. Outcomes other than a fresh value are reported with distinct error types.
+// It requires Go 1.18 or newer.
+package cacheaside
@@ -0,0 +1,224 @@
+package bigcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxCanaryKeyAttempts bounds the search for sentinel keys, shards a custom ShardingFunc never picks are not tested
+const maxCanaryKeyAttempts = 1 << 20
+
+var (
+	// ErrCanaryMismatch is reported when a sentinel entry read back differs from the written one
+	ErrCanaryMismatch = errors.New("canary entry read back differs from the written one")
+	// ErrCanaryTimeout is reported when a round trip did not finish within Config.CanaryTimeout, e.g. because of a deadlock
+	ErrCanaryTimeout = errors.New("canary round trip timed out")
+)
+
+// CanaryFailure is a failed round trip of the self test enabled with Config.CanaryInterval
+type CanaryFailure struct {
+	// Shard the sentinel entry was written to
+	Shard int `json:"shard"`
+	// Err is the cause of the failure
+	Err error `json:"-"`
+	// Message is the message of Err
+	Message string `json:"message"`
+	// RoundTrip is how long the round trip took, or CanaryTimeout when it did not finish
+	RoundTrip time.Duration `json:"round_trip"`
+	// Time of the check
+	Time time.Time `json:"time"`
+}
+
+// CanaryStatus is the result of the self test enabled with Config.CanaryInterval
+type CanaryStatus struct {
+	// Enabled is set when Config.CanaryInterval is set
+	Enabled bool `json:"enabled"`
+	// Healthy is set when all round trips of the last check succeeded, or no check ran yet
+	Healthy bool `json:"healthy"`
+	// Checks is the number of checks of all shards done
+	Checks int64 `json:"checks"`
+	// Failures is the number of failed round trips
+	Failures int64 `json:"failures"`
+	// LastCheck is the time of the last check
+	LastCheck time.Time `json:"last_check"`
+	// MaxRoundTrip is the longest round trip of the last check
+	MaxRoundTrip time.Duration `json:"max_round_trip"`
+	// LastFailure is the most recent failed round trip, nil when none failed
+	LastFailure *CanaryFailure `json:"last_failure,omitempty"`
+}
+
+// canary writes, reads back and deletes a sentinel entry in every shard every CanaryInterval
+type canary struct {
+	cache   *BigCache
+	timeout time.Duration
+	// keys and hashes of sentinel entries by shard, keys of shards without one are empty
+	keys   []string
+	hashes []uint64
+	// running is set for shards with a round trip in progress, accessed atomically
+	running []int32
+
+	lock   sync.Mutex
+	status CanaryStatus
+}
+
+// canaryResult is a finished round trip
+type canaryResult struct {
+	shard     int
+	roundTrip time.Duration
+	err       error
+}
+
+func newCanary(cache *BigCache) *canary {
+	shards := len(cache.shards)
+	m := &canary{
+		cache:   cache,
+		timeout: cache.config.canaryTimeout(),
+		keys:    make([]string, shards),
+		hashes:  make([]uint64, shards),
+		running: make([]int32, shards),
+		status:  CanaryStatus{Enabled: true, Healthy: true},
+	}
+	missing := shards
+	for n := 0; missing > 0 && n < maxCanaryKeyAttempts; n++ {
+		key := "bigcache-canary:" + strconv.Itoa(n)
+		hashedKey := cache.hash.Sum64(key)
+		if shard := cache.shardIndex(hashedKey); m.keys[shard] == "" {
+			m.keys[shard] = key
+			m.hashes[shard] = hashedKey
+			missing--
+		}
+	}
+	return m
+}
+
+// check does a round trip in every shard and waits for them at most the timeout.
+// Shards whose round trip from a previous check is still in progress are reported as timed out.
+func (m *canary) check() {
+	now := time.Now()
+	results := make(chan canaryResult, len(m.keys))
+	var failures []CanaryFailure
+	pending := make(map[int]bool)
+	for i, key := range m.keys {
+		if key == "" {
+			continue
+		}
+		if !atomic.CompareAndSwapInt32(&m.running[i], 0, 1) {
+			failures = append(failures, CanaryFailure{Shard: i, Err: ErrCanaryTimeout, RoundTrip: m.timeout})
+			continue
+		}
+		pending[i] = true
+		go func(i int) {
+			start := time.Now()
+			err := m.roundTrip(i, start)
+			atomic.StoreInt32(&m.running[i], 0)
+			results <- canaryResult{shard: i, roundTrip: time.Since(start), err: err}
+		}(i)
+	}
+
+	var maxRoundTrip time.Duration
+	timer := time.NewTimer(m.timeout)
+	defer timer.Stop()
+	for len(pending) > 0 {
+		select {
+		case result := <-results:
+			delete(pending, result.shard)
+			if result.roundTrip > maxRoundTrip {
+				maxRoundTrip = result.roundTrip
+			}
+			if result.err != nil {
+				failures = append(failures, CanaryFailure{Shard: result.shard, Err: result.err, RoundTrip: result.roundTrip})
+			}
+		case <-timer.C:
+			for i := range pending {
+				failures = append(failures, CanaryFailure{Shard: i, Err: ErrCanaryTimeout, RoundTrip: m.timeout})
+			}
+			pending = nil
+			maxRoundTrip = m.timeout
+		}
+	}
+
+	m.lock.Lock()
+	m.status.Checks++
+	m.status.Failures += int64(len(failures))
+	m.status.LastCheck = now
+	m.status.MaxRoundTrip = maxRoundTrip
+	m.status.Healthy = len(failures) == 0
+	for i := range failures {
+		failures[i].Message = failures[i].Err.Error()
+		failures[i].Time = now
+	}
+	if len(failures) > 0 {
+		last := failures[len(failures)-1]
+		m.status.LastFailure = &last
+	}
+	m.lock.Unlock()
+
+	if onFailure := m.cache.config.OnCanaryFailure; onFailure != nil {
+		for _, failure := range failures {
+			onFailure(failure)
+		}
+	}
+}
+
+// roundTrip writes the sentinel entry of the shard stamped with start, reads it back and deletes it
+func (m *canary) roundTrip(shard int, start time.Time) error {
+	value := make([]byte, 16)
+	binary.LittleEndian.PutUint64(value, uint64(start.UnixNano()))
+	binary.LittleEndian.PutUint64(value[8:], uint64(shard))
+	err := m.cache.shards[shard].roundTrip(m.keys[shard], m.hashes[shard], value)
+	if err == ErrReadOnly {
+		// the sentinel cannot be written to a read-only cache, it is not tested then
+		return nil
+	}
+	return m.cache.recoverShardIndex(uint64(shard), err)
+}
+
+func (m *canary) currentStatus() CanaryStatus {
+	m.lock.Lock()
+	status := m.status
+	m.lock.Unlock()
+	if status.LastFailure != nil {
+		last := *status.LastFailure
+		status.LastFailure = &last
+	}
+	return status
+}
+
+// CanaryStatus returns the result of the self test enabled with Config.CanaryInterval
+func (c *BigCache) CanaryStatus() CanaryStatus {
+	if c.canary == nil {
+		return CanaryStatus{Healthy: true}
+	}
+	return c.canary.currentStatus()
+}
+
+// roundTrip saves the entry, reads it back comparing it byte for byte and deletes it,
+// without counting hits, misses or deletes
+func (s *cacheShard) roundTrip(key string, hashedKey uint64, entry []byte) error {
+	if err := s.set(key, hashedKey, entry); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	itemIndex := s.hashmap[hashedKey]
+	if itemIndex == 0 {
+		s.lock.Unlock()
+		return ErrEntryNotFound
+	}
+	wrappedEntry, err := s.entries.Get(int(itemIndex))
+	if err != nil {
+		s.lock.Unlock()
+		return err
+	}
+	if !compareKeyFromEntry(wrappedEntry, key) || !bytes.Equal(readEntry(wrappedEntry), entry) {
+		s.lock.Unlock()
+		return ErrCanaryMismatch
+	}
+	s.discardEntry(wrappedEntry, hashedKey, Deleted)
+	s.lock.Unlock()
+	return nil
+}
@@ -0,0 +1,102 @@
+package bigcache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func canaryConfig() Config {
+	return Config{
+		Shards:             4,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		StatsEnabled:       true,
+		CanaryInterval:     time.Hour,
+		CanaryTimeout:      20 * time.Millisecond,
+	}
+}
+
+func TestCanaryRoundTrips(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), canaryConfig())
+	defer cache.Close()
+	cache.Set("key", []byte("value"))
+
+	// when
+	cache.canary.check()
+
+	// then
+	status := cache.CanaryStatus()
+	assertEqual(t, true, status.Enabled)
+	assertEqual(t, true, status.Healthy)
+	assertEqual(t, int64(1), status.Checks)
+	assertEqual(t, int64(0), status.Failures)
+	if status.LastFailure != nil {
+		t.Errorf("Unexpected failure %v", status.LastFailure.Err)
+	}
+	assertEqual(t, 1, cache.Len())
+	assertEqual(t, int64(0), cache.Stats().Hits)
+	for i, key := range cache.canary.keys {
+		assertEqual(t, uint64(i), cache.shardIndex(cache.hash.Sum64(key)))
+	}
+}
+
+func TestCanaryReportsStuckShards(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var lock sync.Mutex
+	var failures []CanaryFailure
+	config := canaryConfig()
+	config.OnCanaryFailure = func(failure CanaryFailure) {
+		lock.Lock()
+		failures = append(failures, failure)
+		lock.Unlock()
+	}
+	cache, _ := New(context.Background(), config)
+	defer cache.Close()
+	cache.shards[2].lock.Lock()
+
+	// when
+	cache.canary.check()
+	cache.canary.check()
+
+	// then
+	status := cache.CanaryStatus()
+	assertEqual(t, false, status.Healthy)
+	assertEqual(t, int64(2), status.Failures)
+	assertEqual(t, 2, status.LastFailure.Shard)
+	assertEqual(t, ErrCanaryTimeout, status.LastFailure.Err)
+	lock.Lock()
+	assertEqual(t, 2, len(failures))
+	assertEqual(t, 2, failures[0].Shard)
+	lock.Unlock()
+
+	// when
+	cache.shards[2].lock.Unlock()
+	waitFor(t, func() bool { return atomic.LoadInt32(&cache.canary.running[2]) == 0 })
+	cache.canary.check()
+
+	// then
+	assertEqual(t, true, cache.CanaryStatus().Healthy)
+}
+
+func TestCanaryDisabled(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+
+	// when
+	status := cache.CanaryStatus()
+
+	// then
+	assertEqual(t, CanaryStatus{Healthy: true}, status)
+}
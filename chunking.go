@@ -0,0 +1,162 @@
+package bigcache
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"strconv"
+)
+
+const (
+	wholeValue   = 0 // Header of values stored in a single entry by ChunkingMiddleware
+	chunkedValue = 1 // Header of manifests of values split into chunks by ChunkingMiddleware
+)
+
+// ErrInvalidChunkedValue is returned by ChunkingMiddleware when a read value was not written by it
+// or its chunks do not add up to the value
+var ErrInvalidChunkedValue = errors.New("value was not written by chunking middleware")
+
+// ChunkingMiddleware splits entries bigger than chunkSize into chunks stored under keys derived from the key,
+// so a big value is spread over many shards instead of requiring a single queue to hold it contiguously.
+// The key holds a manifest of the chunks, Get reassembles the value and returns ErrEntryNotFound when any
+// chunk was evicted. Chunks of overwritten and deleted values are deleted. Entries are prefixed with a header
+// byte, so all of them have to be written through the middleware, Get returns ErrInvalidChunkedValue for others.
+func ChunkingMiddleware(chunkSize int) Middleware {
+	return func(next Interface) Interface {
+		return &chunkingCache{Interface: next, chunkSize: chunkSize}
+	}
+}
+
+type chunkingCache struct {
+	Interface
+	chunkSize int
+}
+
+// manifest describes chunks of a value, generation distinguishes chunks of subsequent writes of the key
+type manifest struct {
+	generation uint64
+	length     int
+	chunks     int
+}
+
+func (c *chunkingCache) Get(key string) ([]byte, error) {
+	entry, err := c.Interface.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	m, chunked, err := readManifest(entry)
+	if err != nil {
+		return nil, err
+	}
+	if !chunked {
+		return entry[1:], nil
+	}
+	value := make([]byte, 0, m.length)
+	for i := 0; i < m.chunks; i++ {
+		chunk, err := c.Interface.Get(chunkKey(key, m.generation, i))
+		if err != nil {
+			return nil, err
+		}
+		value = append(value, chunk...)
+	}
+	if len(value) != m.length {
+		return nil, ErrInvalidChunkedValue
+	}
+	return value, nil
+}
+
+func (c *chunkingCache) Set(key string, entry []byte) error {
+	previous, _ := c.manifest(key)
+	if c.chunkSize <= 0 || len(entry) <= c.chunkSize {
+		value := make([]byte, len(entry)+1)
+		value[0] = wholeValue
+		copy(value[1:], entry)
+		err := c.Interface.Set(key, value)
+		if err == nil {
+			c.deleteChunks(key, previous, previous.chunks)
+		}
+		return err
+	}
+
+	m := manifest{
+		generation: rand.Uint64(),
+		length:     len(entry),
+		chunks:     (len(entry) + c.chunkSize - 1) / c.chunkSize,
+	}
+	for i := 0; i < m.chunks; i++ {
+		chunk := entry[i*c.chunkSize : min((i+1)*c.chunkSize, len(entry))]
+		if err := c.Interface.Set(chunkKey(key, m.generation, i), chunk); err != nil {
+			c.deleteChunks(key, m, i)
+			return err
+		}
+	}
+	if err := c.Interface.Set(key, writeManifest(m)); err != nil {
+		c.deleteChunks(key, m, m.chunks)
+		return err
+	}
+	c.deleteChunks(key, previous, previous.chunks)
+	return nil
+}
+
+func (c *chunkingCache) Delete(key string) error {
+	m, _ := c.manifest(key)
+	err := c.Interface.Delete(key)
+	c.deleteChunks(key, m, m.chunks)
+	return err
+}
+
+// manifest reads manifest of the key, it is empty when the value is not chunked
+func (c *chunkingCache) manifest(key string) (manifest, error) {
+	entry, err := c.Interface.Get(key)
+	if err != nil {
+		return manifest{}, err
+	}
+	m, _, err := readManifest(entry)
+	return m, err
+}
+
+// deleteChunks deletes the first n chunks of the manifest
+func (c *chunkingCache) deleteChunks(key string, m manifest, n int) {
+	for i := 0; i < n; i++ {
+		c.Interface.Delete(chunkKey(key, m.generation, i))
+	}
+}
+
+func chunkKey(key string, generation uint64, i int) string {
+	return key + "\x00chunk:" + strconv.FormatUint(generation, 36) + ":" + strconv.Itoa(i)
+}
+
+func writeManifest(m manifest) []byte {
+	buf := make([]byte, 1+8+2*binary.MaxVarintLen64)
+	buf[0] = chunkedValue
+	binary.LittleEndian.PutUint64(buf[1:], m.generation)
+	n := 9
+	n += binary.PutUvarint(buf[n:], uint64(m.length))
+	n += binary.PutUvarint(buf[n:], uint64(m.chunks))
+	return buf[:n]
+}
+
+// readManifest reads manifest of the entry, it reports whether the entry is chunked
+func readManifest(entry []byte) (manifest, bool, error) {
+	if len(entry) == 0 {
+		return manifest{}, false, ErrInvalidChunkedValue
+	}
+	switch entry[0] {
+	case wholeValue:
+		return manifest{}, false, nil
+	case chunkedValue:
+		if len(entry) < 9 {
+			return manifest{}, false, ErrInvalidChunkedValue
+		}
+		m := manifest{generation: binary.LittleEndian.Uint64(entry[1:])}
+		length, n := binary.Uvarint(entry[9:])
+		chunks, k := binary.Uvarint(entry[9+max(n, 0):])
+		if n <= 0 || k <= 0 {
+			return manifest{}, false, ErrInvalidChunkedValue
+		}
+		m.length, m.chunks = int(length), int(chunks)
+		return m, true, nil
+	default:
+		return manifest{}, false, ErrInvalidChunkedValue
+	}
+}
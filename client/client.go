@@ -0,0 +1,224 @@
+// Package client provides a client of the BigCache HTTP server with the same Get/Set/Delete methods as
+// the embedded cache, so code can switch between embedded and remote caches.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+const (
+	cachePath = "/api/v1/cache/"
+	statsPath = "/api/v1/stats"
+	lenPath   = "/api/v1/len"
+
+	defaultTimeout      = time.Second
+	defaultRetryBackoff = 50 * time.Millisecond
+	defaultMaxIdleConns = 16
+)
+
+var _ bigcache.Interface = (*Client)(nil)
+
+// Config of the Client
+type Config struct {
+	// BaseURL of the server, e.g. http://localhost:9090
+	BaseURL string
+	// Timeout of a single call including retries. Default value is 0 which means 1 second.
+	Timeout time.Duration
+	// Retries is the number of times a call is repeated after a transient error:
+	// a network error or 429, 502, 503 or 504 response. Default value is 0 which means no retries.
+	Retries int
+	// RetryBackoff is the delay before the first retry, it is doubled before every next one.
+	// Default value is 0 which means 50 milliseconds.
+	RetryBackoff time.Duration
+	// MaxIdleConns is the number of idle connections to the server kept in the pool.
+	// Default value is 0 which means 16.
+	MaxIdleConns int
+	// HTTPClient is used to send requests instead of a client with pooled transport built from this config.
+	HTTPClient *http.Client
+}
+
+// StatusError is returned when the server responds with an unexpected status
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected response status %d: %s", e.StatusCode, e.Body)
+}
+
+// Client of the BigCache HTTP server. It is safe for concurrent use.
+type Client struct {
+	baseURL      string
+	timeout      time.Duration
+	retries      int
+	retryBackoff time.Duration
+	http         *http.Client
+}
+
+// New creates a client of the server at config.BaseURL
+func New(config Config) (*Client, error) {
+	if config.BaseURL == "" {
+		return nil, errors.New("BaseURL must be set")
+	}
+	if config.Timeout < 0 || config.Retries < 0 || config.RetryBackoff < 0 || config.MaxIdleConns < 0 {
+		return nil, errors.New("Timeout, Retries, RetryBackoff and MaxIdleConns must be >= 0")
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultTimeout
+	}
+	if config.RetryBackoff == 0 {
+		config.RetryBackoff = defaultRetryBackoff
+	}
+	if config.MaxIdleConns == 0 {
+		config.MaxIdleConns = defaultMaxIdleConns
+	}
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConns = config.MaxIdleConns
+		transport.MaxIdleConnsPerHost = config.MaxIdleConns
+		httpClient = &http.Client{Transport: transport}
+	}
+	return &Client{
+		baseURL:      strings.TrimSuffix(config.BaseURL, "/"),
+		timeout:      config.Timeout,
+		retries:      config.Retries,
+		retryBackoff: config.RetryBackoff,
+		http:         httpClient,
+	}, nil
+}
+
+// Get reads entry for the key.
+// It returns an bigcache.ErrEntryNotFound when no entry exists for the given key.
+func (c *Client) Get(key string) ([]byte, error) {
+	return c.do(http.MethodGet, cachePath+url.PathEscape(key), nil, http.StatusOK)
+}
+
+// Set saves entry under the key
+func (c *Client) Set(key string, entry []byte) error {
+	_, err := c.do(http.MethodPut, cachePath+url.PathEscape(key), entry, http.StatusCreated)
+	return err
+}
+
+// Delete removes the key.
+// It returns an bigcache.ErrEntryNotFound when no entry exists for the given key.
+func (c *Client) Delete(key string) error {
+	_, err := c.do(http.MethodDelete, cachePath+url.PathEscape(key), nil, http.StatusOK)
+	return err
+}
+
+// Len returns the number of entries in the remote cache, 0 when it cannot be read.
+// Use FetchLen to get the error.
+func (c *Client) Len() int {
+	length, _ := c.FetchLen()
+	return length
+}
+
+// FetchLen returns the number of entries in the remote cache
+func (c *Client) FetchLen() (int, error) {
+	body, err := c.do(http.MethodGet, lenPath, nil, http.StatusOK)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(body)))
+}
+
+// Stats returns statistics of the remote cache, empty statistics when they cannot be read.
+// Use FetchStats to get the error.
+func (c *Client) Stats() bigcache.Stats {
+	stats, _ := c.FetchStats()
+	return stats
+}
+
+// FetchStats returns statistics of the remote cache
+func (c *Client) FetchStats() (bigcache.Stats, error) {
+	var stats bigcache.Stats
+	body, err := c.do(http.MethodGet, statsPath, nil, http.StatusOK)
+	if err != nil {
+		return stats, err
+	}
+	err = json.Unmarshal(body, &stats)
+	return stats, err
+}
+
+// Close releases pooled connections
+func (c *Client) Close() error {
+	c.http.CloseIdleConnections()
+	return nil
+}
+
+func (c *Client) do(method string, path string, body []byte, expectedStatus int) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		response, err := c.send(ctx, method, path, body, expectedStatus)
+		if err == nil || attempt == c.retries || !isTransient(err) {
+			return response, err
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method string, path string, body []byte, expectedStatus int) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.http.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch response.StatusCode {
+	case expectedStatus:
+		return content, nil
+	case http.StatusNotFound:
+		return nil, bigcache.ErrEntryNotFound
+	default:
+		return nil, &StatusError{StatusCode: response.StatusCode, Body: string(content)}
+	}
+}
+
+// isTransient reports whether the call may succeed when repeated
+func isTransient(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
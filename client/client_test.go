@@ -0,0 +1,169 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+// newTestServer serves the cache API of the BigCache server, failing the first failures requests with 503
+func newTestServer(t *testing.T, failures int32) (*httptest.Server, *int32) {
+	cache, _ := bigcache.New(context.Background(), bigcache.DefaultConfig(time.Minute))
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		switch r.URL.Path {
+		case statsPath:
+			w.Write([]byte(`{"hits":7}`))
+			return
+		case lenPath:
+			w.Write([]byte(strconv.Itoa(cache.Len())))
+			return
+		}
+		key := r.URL.Path[len(cachePath):]
+		switch r.Method {
+		case http.MethodGet:
+			entry, err := cache.Get(key)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(entry)
+		case http.MethodPut:
+			entry, _ := io.ReadAll(r.Body)
+			cache.Set(key, entry)
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodDelete:
+			if cache.Delete(key) != nil {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestSetGetDelete(t *testing.T) {
+	t.Parallel()
+
+	// given
+	server, _ := newTestServer(t, 0)
+	client, err := New(Config{BaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// when
+	if err := client.Set("key/with spaces", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := client.Get("key/with spaces")
+
+	// then
+	if err != nil || string(entry) != "value" {
+		t.Errorf("want: value; got: %q, %v", entry, err)
+	}
+
+	// when
+	err = client.Delete("key/with spaces")
+
+	// then
+	if err != nil {
+		t.Error(err)
+	}
+	if _, err := client.Get("key/with spaces"); err != bigcache.ErrEntryNotFound {
+		t.Errorf("want: %v; got: %v", bigcache.ErrEntryNotFound, err)
+	}
+	if stats, err := client.FetchStats(); err != nil || stats.Hits != 7 {
+		t.Errorf("want 7 hits; got: %+v, %v", stats, err)
+	}
+	client.Set("other", []byte("value"))
+	if length := client.Len(); length != 1 {
+		t.Errorf("want: 1; got: %d", length)
+	}
+}
+
+func TestRetriesTransientErrors(t *testing.T) {
+	t.Parallel()
+
+	// given
+	server, requests := newTestServer(t, 2)
+	client, _ := New(Config{BaseURL: server.URL, Retries: 2, RetryBackoff: time.Millisecond})
+
+	// when
+	err := client.Set("key", []byte("value"))
+
+	// then
+	if err != nil {
+		t.Error(err)
+	}
+	if atomic.LoadInt32(requests) != 3 {
+		t.Errorf("want: 3 requests; got: %d", atomic.LoadInt32(requests))
+	}
+}
+
+func TestGivesUpAfterRetries(t *testing.T) {
+	t.Parallel()
+
+	// given
+	server, requests := newTestServer(t, 5)
+	client, _ := New(Config{BaseURL: server.URL, Retries: 1, RetryBackoff: time.Millisecond})
+
+	// when
+	_, err := client.Get("key")
+
+	// then
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("want 503 status error; got: %v", err)
+	}
+	if atomic.LoadInt32(requests) != 2 {
+		t.Errorf("want: 2 requests; got: %d", atomic.LoadInt32(requests))
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	t.Parallel()
+
+	// given
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+	client, _ := New(Config{BaseURL: server.URL, Timeout: 10 * time.Millisecond, Retries: 3})
+
+	// when
+	start := time.Now()
+	_, err := client.Get("key")
+
+	// then
+	if err == nil {
+		t.Error("want timeout error")
+	}
+	if time.Since(start) > 80*time.Millisecond {
+		t.Errorf("call took %s despite 10ms timeout", time.Since(start))
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	if _, err := New(Config{}); err == nil {
+		t.Error("want error for missing BaseURL")
+	}
+	if _, err := New(Config{BaseURL: "http://localhost", Retries: -1}); err == nil {
+		t.Error("want error for negative Retries")
+	}
+}
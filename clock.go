@@ -7,8 +7,27 @@ type clock interface {
 }
 
 type systemClock struct {
+	unit time.Duration // Unit of returned timestamps, seconds when zero
 }
 
 func (c systemClock) Epoch() int64 {
-	return time.Now().Unix()
+	if c.unit == 0 {
+		return time.Now().Unix()
+	}
+	return time.Now().UnixNano() / int64(c.unit)
+}
+
+// monotonicClock measures time elapsed since its creation with the monotonic clock and adds it to
+// the wall clock time of creation, so steps of the wall clock do not affect it
+type monotonicClock struct {
+	start time.Time
+	unit  time.Duration
+}
+
+func newMonotonicClock(unit time.Duration) *monotonicClock {
+	return &monotonicClock{start: time.Now(), unit: unit}
+}
+
+func (c *monotonicClock) Epoch() int64 {
+	return (c.start.UnixNano() + int64(time.Since(c.start))) / int64(c.unit)
 }
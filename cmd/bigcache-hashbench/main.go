@@ -0,0 +1,71 @@
+// Command bigcache-hashbench compares hashers available for Config.Hasher on a sample of real keys,
+// read one per line from files given as arguments or from the standard input, and recommends the best one.
+//
+//	bigcache-hashbench -shards 1024 keys.txt
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/allegro/bigcache/v3/hasher"
+)
+
+func main() {
+	shards := flag.Int("shards", hasher.DefaultShards, "number of shards, a power of two")
+	limit := flag.Int("limit", 1000000, "maximum number of keys to read")
+	flag.Parse()
+
+	if *shards <= 0 || *shards&(*shards-1) != 0 {
+		log.Fatalf("shards must be a power of two, got %d", *shards)
+	}
+
+	var keys []string
+	var err error
+	if flag.NArg() == 0 {
+		keys, err = readKeys(os.Stdin, keys, *limit)
+	}
+	for _, name := range flag.Args() {
+		file, openErr := os.Open(name)
+		if openErr != nil {
+			log.Fatal(openErr)
+		}
+		keys, err = readKeys(file, keys, *limit)
+		file.Close()
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(keys) == 0 {
+		log.Fatal("no keys read")
+	}
+
+	results := hasher.RaceWith(keys, *shards, hasher.Candidates())
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "hasher\tns/key\tcollisions\tdispersion\t")
+	for _, result := range results {
+		fmt.Fprintf(w, "%s\t%.1f\t%d\t%.3f\t\n", result.Name, result.NsPerKey, result.Collisions, result.Dispersion)
+	}
+	w.Flush()
+	fmt.Printf("\n%d keys, %d shards, recommended hasher: %s\n", len(keys), *shards, results[0].Name)
+}
+
+// readKeys appends non-empty lines of r to keys until there are limit of them
+func readKeys(r io.Reader, keys []string, limit int) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for len(keys) < limit && scanner.Scan() {
+		if key := scanner.Text(); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys, scanner.Err()
+}
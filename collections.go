@@ -0,0 +1,186 @@
+package bigcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrInvalidCollection is returned when entry of a CachedSet or CachedList cannot be decoded
+var ErrInvalidCollection = errors.New("entry is not a valid collection")
+
+// CachedSet is a set of values stored as a single cache entry. Values are kept in a compact binary
+// form, so modifications do not deserialize the whole set and are atomic as they are done with Update.
+// It fits small sets, every modification rewrites the whole entry.
+type CachedSet struct {
+	cache *BigCache
+	key   string
+}
+
+// NewCachedSet returns set stored in the cache under the key
+func NewCachedSet(cache *BigCache, key string) *CachedSet {
+	return &CachedSet{cache: cache, key: key}
+}
+
+// Add adds value to the set and reports whether it was not present before
+func (s *CachedSet) Add(value []byte) (bool, error) {
+	var added bool
+	err := s.cache.Update(s.key, func(old []byte, found bool) ([]byte, bool, error) {
+		contains, err := containsCollectionItem(old, value)
+		if err != nil || contains {
+			return nil, false, err
+		}
+		added = true
+		return appendCollectionItem(copyCollection(old, len(value)), value), true, nil
+	})
+	return added, err
+}
+
+// Remove removes value from the set and reports whether it was present
+func (s *CachedSet) Remove(value []byte) (bool, error) {
+	return removeCollectionItems(s.cache, s.key, value, true)
+}
+
+// Contains reports whether value is in the set
+func (s *CachedSet) Contains(value []byte) (bool, error) {
+	var contains bool
+	err := s.cache.GetFn(s.key, func(entry []byte) (err error) {
+		contains, err = containsCollectionItem(entry, value)
+		return err
+	})
+	if err == ErrEntryNotFound {
+		return false, nil
+	}
+	return contains, err
+}
+
+// Members returns all values of the set in the order they were added
+func (s *CachedSet) Members() ([][]byte, error) {
+	return readCollection(s.cache, s.key)
+}
+
+// Len returns the number of values in the set
+func (s *CachedSet) Len() (int, error) {
+	return collectionLen(s.cache, s.key)
+}
+
+// CachedList is a list of values stored as a single cache entry. Values are kept in a compact binary
+// form, pushes are atomic appends to the entry and removals are done with Update.
+// It fits small lists, every removal rewrites the whole entry.
+type CachedList struct {
+	cache *BigCache
+	key   string
+}
+
+// NewCachedList returns list stored in the cache under the key
+func NewCachedList(cache *BigCache, key string) *CachedList {
+	return &CachedList{cache: cache, key: key}
+}
+
+// Push adds value to the end of the list
+func (l *CachedList) Push(value []byte) error {
+	return l.cache.Append(l.key, appendCollectionItem(nil, value))
+}
+
+// Remove removes all occurrences of value from the list and reports whether any was found
+func (l *CachedList) Remove(value []byte) (bool, error) {
+	return removeCollectionItems(l.cache, l.key, value, false)
+}
+
+// Items returns all values of the list
+func (l *CachedList) Items() ([][]byte, error) {
+	return readCollection(l.cache, l.key)
+}
+
+// Len returns the number of values in the list
+func (l *CachedList) Len() (int, error) {
+	return collectionLen(l.cache, l.key)
+}
+
+// appendCollectionItem appends value prefixed with its uvarint encoded length
+func appendCollectionItem(collection []byte, value []byte) []byte {
+	var header [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(header[:], uint64(len(value)))
+	collection = append(collection, header[:n]...)
+	return append(collection, value...)
+}
+
+// copyCollection copies collection referencing cache memory, leaving space for an additional value
+func copyCollection(collection []byte, extra int) []byte {
+	dst := make([]byte, len(collection), len(collection)+extra+binary.MaxVarintLen64)
+	copy(dst, collection)
+	return dst
+}
+
+// iterateCollection calls fn for every value of encoded collection until it returns false
+func iterateCollection(collection []byte, fn func(value []byte) bool) error {
+	for len(collection) > 0 {
+		length, n := binary.Uvarint(collection)
+		if n <= 0 || length > uint64(len(collection)-n) {
+			return ErrInvalidCollection
+		}
+		value := collection[n : n+int(length)]
+		collection = collection[n+int(length):]
+		if !fn(value) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func containsCollectionItem(collection []byte, value []byte) (bool, error) {
+	var contains bool
+	err := iterateCollection(collection, func(item []byte) bool {
+		contains = bytes.Equal(item, value)
+		return !contains
+	})
+	return contains, err
+}
+
+func removeCollectionItems(cache *BigCache, key string, value []byte, first bool) (bool, error) {
+	var removed bool
+	err := cache.Update(key, func(old []byte, found bool) ([]byte, bool, error) {
+		collection := make([]byte, 0, len(old))
+		err := iterateCollection(old, func(item []byte) bool {
+			if bytes.Equal(item, value) && !(first && removed) {
+				removed = true
+				return true
+			}
+			collection = appendCollectionItem(collection, item)
+			return true
+		})
+		if err != nil || !removed {
+			return nil, false, err
+		}
+		return collection, true, nil
+	})
+	return removed, err
+}
+
+func readCollection(cache *BigCache, key string) ([][]byte, error) {
+	var values [][]byte
+	err := cache.GetFn(key, func(entry []byte) error {
+		return iterateCollection(entry, func(value []byte) bool {
+			values = append(values, append([]byte(nil), value...))
+			return true
+		})
+	})
+	if err == ErrEntryNotFound {
+		return nil, nil
+	}
+	return values, err
+}
+
+func collectionLen(cache *BigCache, key string) (int, error) {
+	var length int
+	err := cache.GetFn(key, func(entry []byte) error {
+		return iterateCollection(entry, func(value []byte) bool {
+			length++
+			return true
+		})
+	})
+	if err == ErrEntryNotFound {
+		return 0, nil
+	}
+	return length, err
+}
@@ -0,0 +1,118 @@
+package bigcache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCachedSet(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(5*time.Second))
+	defer cache.Close()
+	set := NewCachedSet(cache, "set")
+
+	// when
+	added, err := set.Add([]byte("a"))
+	noError(t, err)
+	addedAgain, _ := set.Add([]byte("a"))
+	set.Add([]byte("b"))
+	set.Add([]byte(""))
+
+	// then
+	assertEqual(t, true, added)
+	assertEqual(t, false, addedAgain)
+	contains, _ := set.Contains([]byte("b"))
+	assertEqual(t, true, contains)
+	contains, _ = set.Contains([]byte("c"))
+	assertEqual(t, false, contains)
+	length, _ := set.Len()
+	assertEqual(t, 3, length)
+
+	// when
+	removed, _ := set.Remove([]byte("a"))
+	removedAgain, _ := set.Remove([]byte("a"))
+
+	// then
+	assertEqual(t, true, removed)
+	assertEqual(t, false, removedAgain)
+	members, _ := set.Members()
+	assertEqual(t, [][]byte{[]byte("b"), nil}, members)
+}
+
+func TestCachedSetConcurrentAdds(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(5*time.Second))
+	defer cache.Close()
+	set := NewCachedSet(cache, "set")
+
+	// when
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				set.Add([]byte(fmt.Sprintf("%d-%d", i, j)))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// then
+	length, _ := set.Len()
+	assertEqual(t, 100, length)
+}
+
+func TestCachedList(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(5*time.Second))
+	defer cache.Close()
+	list := NewCachedList(cache, "list")
+
+	// when
+	items, err := list.Items()
+
+	// then
+	noError(t, err)
+	assertEqual(t, 0, len(items))
+
+	// when
+	list.Push([]byte("a"))
+	list.Push([]byte("b"))
+	list.Push([]byte("a"))
+	removed, _ := list.Remove([]byte("a"))
+
+	// then
+	assertEqual(t, true, removed)
+	items, _ = list.Items()
+	assertEqual(t, [][]byte{[]byte("b")}, items)
+	length, _ := list.Len()
+	assertEqual(t, 1, length)
+}
+
+func TestInvalidCollection(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(5*time.Second))
+	defer cache.Close()
+	cache.Set("set", []byte{100, 1})
+	set := NewCachedSet(cache, "set")
+
+	// when
+	_, err := set.Contains([]byte("a"))
+	_, addErr := set.Add([]byte("a"))
+
+	// then
+	assertEqual(t, ErrInvalidCollection, err)
+	assertEqual(t, ErrInvalidCollection, addErr)
+}
@@ -1,6 +1,12 @@
 package bigcache
 
-import "time"
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/allegro/bigcache/v3/queue"
+)
 
 // Config for BigCache
 type Config struct {
@@ -9,27 +15,72 @@ type Config struct {
 	// Time after which entry can be evicted
 	LifeWindow time.Duration
 	// Interval between removing expired entries (clean up).
-	// If set to <= 0 then no action is performed. Setting to < 1 second is counterproductive — bigcache has a one second resolution.
+	// If set to <= 0 then no action is performed. Setting it below TimestampPrecision is counterproductive.
 	CleanWindow time.Duration
+	// CleanPhases is the number of groups shards are cleaned up in, one group after another spread evenly
+	// across CleanWindow, so clean ups of all shards do not take their locks at the same moment. Shard i is
+	// cleaned up in phase i % CleanPhases. Value must not exceed Shards. Default value is 0 which means
+	// all shards are cleaned up at once.
+	CleanPhases int
+	// MaxCleanupPause is the time budget of a clean up run every CleanWindow. Once it is spent the clean up
+	// stops, also in the middle of a shard, and the next one of the phase resumes from the shard it stopped at,
+	// which bounds how long it holds shard locks at the cost of expired entries being removed later.
+	// Default value is 0 which means clean ups are not limited.
+	MaxCleanupPause time.Duration
+	// TimestampPrecision is the resolution of entry timestamps and expiry, one of time.Second, time.Millisecond,
+	// time.Microsecond or time.Nanosecond. Finer precision allows sub-second lifetimes. Snapshots are converted
+	// when restored into a cache with a different precision. Default value is 0 which means time.Second.
+	TimestampPrecision time.Duration
+	// MonotonicClock stamps and expires entries with time measured by the monotonic clock since the cache
+	// was created, so steps of the wall clock, e.g. by NTP or after VM migration, neither expire entries
+	// at once nor keep them forever. Timestamps start at the wall clock time of creation, so they stay
+	// comparable with timestamps of snapshots. Default value is false.
+	MonotonicClock bool
 	// Max number of entries in life window. Used only to calculate initial size for cache shards.
 	// When proper value is set then additional memory allocation does not occur.
 	MaxEntriesInWindow int
 	// Max size of entry in bytes. Used only to calculate initial size for cache shards.
 	MaxEntrySize int
+	// InitialShardBytes is the initial size of the queue of every shard in bytes. When set, it is used instead of the size
+	// computed from MaxEntriesInWindow and MaxEntrySize. Default value is 0 which means the computed size is used.
+	InitialShardBytes int
+	// PreallocateShards allocates memory of all shards when the cache is created and writes to every page of it,
+	// so latency of first writes does not suffer from allocation and page faults. By default memory of a shard
+	// is allocated on the first write to it, which keeps caches with many shards and little data small.
+	PreallocateShards bool
 	// StatsEnabled if true calculate the number of times a cached resource was requested.
 	StatsEnabled bool
+	// LockStatsEnabled measures how long acquisitions of shard locks wait, reported by ShardStats.
+	// It helps to decide whether the number of shards should be raised, at the cost of reading time on every lock.
+	LockStatsEnabled bool
+	// LockTimeout is how long Get and Set wait for the lock of a shard before they return ErrLockTimeout,
+	// bounding their latency when a lock is held for long, e.g. by a slow OnRemove callback. It requires Go 1.18,
+	// with older versions they wait indefinitely. Default value is 0 which means no timeout.
+	LockTimeout time.Duration
 	// Verbose mode prints information about new memory allocation
 	Verbose bool
 	// Hasher used to map between string keys and unsigned 64bit integers, by default fnv64 hashing is used.
 	Hasher Hasher
+	// KeyNormalizer is applied to keys of every operation before they are hashed and stored, e.g. to lowercase
+	// or trim them, or to replace long keys with their digest. It must be idempotent and safe for concurrent use.
+	// Keys passed to callbacks and returned by iteration are normalized. Default value is nil which means keys are used as is.
+	KeyNormalizer func(key string) string
+	// MaxKeyLength is the maximum length of a normalized key in bytes, writes of longer keys return ErrKeyTooLong.
+	// Default value is 0 which means no limit other than keys of 65535 bytes or more always being rejected.
+	MaxKeyLength int
 	// HardMaxCacheSize is a limit for BytesQueue size in MB.
 	// It can protect application from consuming all available memory on machine, therefore from running OOM Killer.
-	// Default value is 0 which means unlimited size. When the limit is higher than 0 and reached then
+	// Default value is 0 which means unlimited size. On 32-bit platforms limits above 2047 MB are rejected and a shard queue
+	// never grows beyond 2047 MB, its oldest entries are overridden instead. When the limit is higher than 0 and reached then
 	// the oldest entries are overridden for the new ones. The max memory consumption will be bigger than
 	// HardMaxCacheSize due to Shards' s additional memory. Every Shard consumes additional memory for map of keys
 	// and statistics (map[uint64]uint32) the size of this map is equal to number of entries in
 	// cache ~ 2×(64+32)×n bits + overhead or map itself.
 	HardMaxCacheSize int
+	// MaxEntries is a limit for the number of entries in the cache. It is split evenly between shards and when
+	// a shard reaches its part, its oldest entries are evicted with NoSpace reason. It works together with
+	// HardMaxCacheSize, whichever is reached first. Default value is 0 which means unlimited number of entries.
+	MaxEntries int
 	// OnRemove is a callback fired when the oldest entry is removed because of its expiration time or no space left
 	// for the new entry, or because delete was called.
 	// Default value is nil which means no callback and it prevents from unwrapping the oldest entry.
@@ -44,9 +95,253 @@ type Config struct {
 	// Default value is nil which means no callback and it prevents from unwrapping the oldest entry.
 	// Ignored if OnRemove is specified.
 	OnRemoveWithReason func(key string, entry []byte, reason RemoveReason)
+	// OnMiss is a callback fired when Get or GetFn did not find the key, with the kind of the miss: whether
+	// the key expired, was evicted for space, was deleted or was not removed recently, e.g. to tell misses
+	// caused by too small a cache from natural ones. Reasons of removals are remembered in a table of 8 bytes
+	// per expected entry of a shard, removals of keys sharing a slot overwrite each other.
+	// Default value is nil which means no callback.
+	OnMiss func(key string, kind MissKind)
+	// Indexer receives every write, removal and change of timestamp of entries, e.g. to maintain external
+	// secondary indexes. It is called with the shard lock held. Default value is nil which means no indexer.
+	Indexer Indexer
+	// OnRemoveWorkers is the number of goroutines calling removal callbacks when set, so slow callbacks do not hold
+	// shard locks. Removed entries are copied and queued, callbacks run after the removal and in no particular order
+	// between workers. Callbacks still queued when the cache is closed are not called.
+	// Default value is 0 which means callbacks are called synchronously.
+	OnRemoveWorkers int
+	// OnRemoveQueueSize is the maximum number of removals waiting for OnRemoveWorkers. Default value is 0 which means 1024.
+	OnRemoveQueueSize int
+	// OnRemoveOverflow decides what happens to callbacks when the queue of OnRemoveWorkers is full.
+	// Default value is DropCallback.
+	OnRemoveOverflow OnRemoveOverflowPolicy
 
 	onRemoveFilter int
 
+	// OnAudit is a callback fired after a destructive operation was performed: Reset, ResetShard, DeleteMulti
+	// removing keys, SetHardMaxCacheSize evicting entries and RecoverShard, the reset of a corrupted shard with
+	// RecoverPanics. Use LogAudit to write the events with a Logger. Context aware variants of the operations
+	// pass who requested them and why, set with WithAuditInfo, operations started by the cache itself have
+	// the actor "bigcache". Default value is nil which means no audit.
+	OnAudit func(event AuditEvent)
+
+	// TTLJitter is a percentage (0-100) of LifeWindow by which entry timestamps are randomly moved back
+	// when they are stamped. It spreads expiration of entries inserted in a burst across multiple clean
+	// windows. Entries never live longer than LifeWindow. Default value is 0 which means no jitter.
+	TTLJitter int
+
+	// EvictionPolicy decides which entries are evicted when there is no space left for a new entry.
+	// Default value is FIFO, SLRU, ARC and LFU keep frequently read entries longer.
+	EvictionPolicy EvictionPolicy
+	// NewPolicy creates a custom eviction policy for every shard, consulted when space is needed for a new entry.
+	// EvictionPolicy must be FIFO when it is set. Default value is nil which means EvictionPolicy is used.
+	NewPolicy func() Policy
+	// SLRUProtectedRatio is the maximum fraction of entries kept in the protected segment of SLRU policy.
+	// Default value is 0 which means 0.8.
+	SLRUProtectedRatio float64
+	// OnFullPolicy decides whether a full shard evicts entries or rejects new ones with ErrShardFull.
+	// Default value is EvictOldest.
+	OnFullPolicy OnFullPolicy
+
+	// TimeSegments is the number of windows LifeWindow is split into. When set, every window is stored
+	// in a separate queue in each shard and the whole window is dropped at once when all its entries
+	// expire, instead of removing the entries one by one. It fits best when all entries share the same TTL.
+	// A window holds at most 1/(TimeSegments+1) of HardMaxCacheSize. Value must not exceed 31 and LifeWindow
+	// in seconds. Default value is 0 which means a single queue per shard.
+	TimeSegments int
+
+	// ParallelBatchThreshold is the number of keys from which GetMulti reads shards in parallel.
+	// Default value is 0 which means shards are always read sequentially.
+	ParallelBatchThreshold int
+
+	// UnsafeGetEnabled enables GetUnsafe, which returns entries without copying them.
+	// It is disabled by default as misuse of the returned entry can block writes or corrupt data.
+	UnsafeGetEnabled bool
+	// NoCopyGet makes Get return entries referencing cache memory instead of copies, saving an allocation
+	// and a copy per read in read-heavy workloads. Returned entries must not be modified and must not be used
+	// after the next write to the cache, which may reuse their memory. Default value is false.
+	NoCopyGet bool
+	// NoCopyGetDebug makes Get with NoCopyGet return copies which are overwritten with garbage on the next write
+	// to their shard, so callers keeping them too long read wrong data and are reported by the race detector.
+	// It is meant for tests, as it makes reads more expensive than without NoCopyGet.
+	NoCopyGetDebug bool
+
+	// EntryFormat is the binary layout of stored entries. Default value is 0 which means EntryFormatV1.
+	// EntryFormatV2 costs 4 more bytes per entry and is required by per-entry features like EntryChecksum.
+	// Entries of both formats can be read regardless of this setting, e.g. when restored from a snapshot.
+	EntryFormat EntryFormat
+	// EntryChecksum stores a checksum of key and value in every entry and verifies it when the entry is read,
+	// reads of corrupted entries fail with ErrEntryCorrupted. It requires EntryFormatV2.
+	EntryChecksum bool
+	// EntrySequence stamps every written entry with a sequence number increasing monotonically within its shard,
+	// returned by SetWithSequence and EntryInfo.Sequence, so consumers can order writes of keys in the same shard.
+	// It costs 8 more bytes per entry and requires EntryFormatV2.
+	EntrySequence bool
+	// EntryDigest stores the 64-bit XXH3 hash of the value in every entry when it is written, returned by GetDigest
+	// without reading the value, e.g. for change detection or HTTP ETags of large values. It costs 8 more bytes
+	// per entry and hashing of values on writes, and requires EntryFormatV2.
+	EntryDigest bool
+
+	// ValueVersion is the version of the encoding of values, stored in every written entry. It requires EntryFormatV2,
+	// entries written with EntryFormatV1 or before versions were configured have version 0. Default value is 0.
+	ValueVersion uint8
+	// ValueMigrator converts the value of an entry of another version than ValueVersion found by Get, so deploys
+	// changing encoding of values do not have to flush the cache. It returns the converted value and its version and
+	// is called until ValueVersion is reached, then the entry is replaced keeping its timestamp. Entries it fails to
+	// migrate are removed and Get returns ErrEntryNotFound for them. Default value is nil which means values are
+	// returned as they are stored.
+	ValueMigrator func(version uint8, old []byte) ([]byte, uint8, error)
+
+	// OmitEntryKeys stores entries without their keys, saving the length of the key per entry. Entries are identified
+	// by the hash of their keys only, so collisions are not detected and Get of a colliding key returns the entry
+	// of the other one. Keys are not known to Iterator, ForEach, Export, removal callbacks and expiry events then,
+	// unless SeparateKeyStore is set. It requires EntryFormatV2 and cannot be used with SpillStore.
+	OmitEntryKeys bool
+	// SeparateKeyStore keeps keys of entries written with OmitEntryKeys in a compact per-shard arena indexed by
+	// a pointer-free map, so Iterator, ForEach and Export list keys while entries stay compact. It takes about 18 bytes
+	// per entry more than storing keys in entries, reported in Stats.KeyStoreBytes. It requires OmitEntryKeys.
+	SeparateKeyStore bool
+
+	// TombstoneTTL is how long SoftDelete remembers removed keys. Default value is 0 which means LifeWindow.
+	TombstoneTTL time.Duration
+
+	// ExpireOnGet makes reads treat entries older than LifeWindow as not found, instead of returning them until
+	// the next clean up removes them. It has no effect without LifeWindow. Default value is false.
+	ExpireOnGet bool
+	// DeleteExpiredOnGet makes Get with ExpireOnGet remove the expired entry it found right away,
+	// OnRemoveWithReason is called with Expired for it. It requires ExpireOnGet.
+	DeleteExpiredOnGet bool
+
+	// ExpiryForecast counts live entries of every shard by the minute they were written in, so Stats can estimate
+	// how many entries and bytes expire within ExpiryForecastBuckets, e.g. to pre-warm the cache before a miss storm.
+	// It costs a map update on every write and removal and a slot per minute of LifeWindow in every shard.
+	ExpiryForecast bool
+	// ExpiryBufferSize is the number of events of expired entries staged for ExpiryEvents until they are
+	// acknowledged, for workflows driven by expirations. Unlike OnRemoveWithReason, events outlive failures
+	// of consumers. Events of entries expiring while the buffer is full are dropped and counted in
+	// Stats.ExpiryOverflows. Default value is 0 which means no events are staged.
+	ExpiryBufferSize int
+	// ExpiryAckTimeout is how long events returned by ExpiryEvents wait for acknowledgement before they are
+	// returned again. Default value is 0 which means 1 minute.
+	ExpiryAckTimeout time.Duration
+
+	// EarlyExpirationBeta scales how early GetOrLoad reloads entries before they expire, relative to how long
+	// their load took. Higher values reload earlier. Default value is 0 which means 1.
+	EarlyExpirationBeta float64
+
+	// Loader loads entries of keys passed to Prefetch, it must be safe for concurrent use.
+	// Default value is nil which means Prefetch returns ErrPrefetchDisabled.
+	Loader func(ctx context.Context, key string) ([]byte, error)
+	// PrefetchWorkers is the number of goroutines calling Loader. Default value is 0 which means 4.
+	PrefetchWorkers int
+	// PrefetchQueueSize is the maximum number of keys waiting for a worker, Prefetch drops keys beyond it.
+	// Default value is 0 which means 1024.
+	PrefetchQueueSize int
+
+	// SpillStore keeps entries evicted for space, not the expired ones, in a secondary store, e.g. spill.File
+	// on disk, so the cache is effectively bigger for read-heavy workloads. Evicted entries are written by
+	// a background goroutine, Get reads keys missed in memory from the store and restores them with their
+	// original timestamp, Delete removes keys from it as well. Default value is nil which means no spilling.
+	SpillStore SpillStore
+	// SpillQueueSize is the maximum number of evicted entries waiting to be written to SpillStore, entries
+	// beyond it are not spilled. Default value is 0 which means 1024.
+	SpillQueueSize int
+
+	// RecoverPanics recovers panics of shard queues caused by corrupted indices, e.g. slice out of range.
+	// The operation fails with ErrInternalCorruption, the shard is reset and OnCorruption is called,
+	// so one bad entry cannot take down the whole service. Default value is false.
+	RecoverPanics bool
+
+	// OnCorruption is called with the index of the shard and the recovered panic value after the shard
+	// was reset because of corruption caught with RecoverPanics. Default value is nil.
+	OnCorruption func(shard int, cause interface{})
+
+	// ShardingFunc returns index of the shard storing entries with the hash, results out of [0, shards) are wrapped.
+	// It allows co-locating related keys in one shard, e.g. with a Hasher putting hash of a key prefix in the highest
+	// bits and ShardingFunc using them. Default value is nil which means the lowest bits of the hash are used.
+	ShardingFunc func(hash uint64, shards int) int
+
+	// DefragmentWindow is the interval of background defragmentation, which reclaims space of deleted and overwritten
+	// entries by moving live entries from the head of a shard queue to its tail. Shards with TimeSegments reclaim
+	// space when their windows are dropped and are not defragmented. Default value is 0 which disables it.
+	DefragmentWindow time.Duration
+	// DefragmentMaxEntries is the maximum number of entries moved in a shard per defragmentation tick. Together with
+	// DefragmentMaxBytes it bounds how long a shard is locked. Default value is 0 which means 1000 entries.
+	DefragmentMaxEntries int
+	// DefragmentMaxBytes is the maximum number of bytes moved in a shard per defragmentation tick.
+	// Default value is 0 which means 1MB.
+	DefragmentMaxBytes int
+	// DefragmentDeadRatio is the fraction of shard capacity taken by dead entries above which the shard is
+	// defragmented. Default value is 0 which means 0.25.
+	DefragmentDeadRatio float64
+
+	// AlarmWindow is the interval in which eviction rate and hit ratio are measured and queue resizes are checked
+	// for alarm callbacks. Default value is 0 which means 10 seconds.
+	AlarmWindow time.Duration
+	// HighEvictionRate is the number of entries evicted per second for lack of space, above which
+	// OnHighEvictionRate is called. Default value is 0 which means any eviction raises the alarm.
+	HighEvictionRate float64
+	// OnHighEvictionRate is called after every AlarmWindow in which the eviction rate was above HighEvictionRate.
+	// Default value is nil.
+	OnHighEvictionRate func(snapshot AlarmSnapshot)
+	// LowHitRatio is the ratio of hits to reads below which OnLowHitRatio is called, between 0 and 1.
+	// Default value is 0 which means the alarm is never raised.
+	LowHitRatio float64
+	// OnLowHitRatio is called after every AlarmWindow with reads in which the hit ratio was below LowHitRatio.
+	// Default value is nil.
+	OnLowHitRatio func(snapshot AlarmSnapshot)
+	// OnQueueResize is called when the queue of a shard grew on a write or Preallocate, or shrunk when it was
+	// compacted, with capacities in bytes and how long the change took, e.g. to emit metrics of growing shards.
+	// It is called with the shard lock held, so it must be fast and must not use the cache. Default value is nil.
+	OnQueueResize func(shard int, oldCap, newCap int, took time.Duration)
+
+	// SoftMemoryLimit is the target of memory used by the Go runtime in MB, checked every MemoryCheckWindow.
+	// When it is exceeded, the oldest entries of all shards are evicted with NoSpace reason until the cache
+	// shrinks by the excess and queues are compacted to release their memory, keeping the process out of OOM
+	// territory before HardMaxCacheSize is reached. Value -1 targets 90% of the limit set with
+	// debug.SetMemoryLimit or GOMEMLIMIT. Default value is 0 which means no soft limit.
+	SoftMemoryLimit int
+	// MemoryCheckWindow is the interval of comparing memory with SoftMemoryLimit. Default value is 0 which means 1 second.
+	MemoryCheckWindow time.Duration
+
+	// AdaptiveMaxCacheSize enables adaptive sizing when set, it is the upper bound in MB HardMaxCacheSize is
+	// adjusted within every AdaptiveWindow. The cache grows when the GC is idle and shrinks when the GC takes
+	// more than AdaptiveGCFraction of CPU time or the heap goal approaches the runtime memory limit.
+	// HardMaxCacheSize is the initial size, it defaults to AdaptiveMinCacheSize. Default value is 0 which means
+	// HardMaxCacheSize is fixed.
+	AdaptiveMaxCacheSize int
+	// AdaptiveMinCacheSize is the lower bound of HardMaxCacheSize in MB in adaptive sizing, it is required
+	// with AdaptiveMaxCacheSize.
+	AdaptiveMinCacheSize int
+	// AdaptiveWindow is the interval of adjusting HardMaxCacheSize. Default value is 0 which means 10 seconds.
+	AdaptiveWindow time.Duration
+	// AdaptiveGCFraction is the fraction of CPU time spent in GC above which the cache shrinks, it grows only
+	// below half of it. Default value is 0 which means 0.05.
+	AdaptiveGCFraction float64
+
+	// SetBudget is the number of writes per second above which low priority writes are shed, dropped with
+	// ErrWriteShed with the probability which keeps admitted writes within the budget, protecting latency
+	// of reads under overload. Writes with HighPriority are always admitted. Default value is 0 which means
+	// writes are not shed for their rate.
+	SetBudget int
+	// ShedEvictionRatio is the number of evictions per admitted write above which low priority writes are shed,
+	// with the probability growing with the ratio, when writes mostly churn a cache too small for them.
+	// Default value is 0 which means writes are not shed for evictions.
+	ShedEvictionRatio float64
+	// ShedWindow is the interval in which writes and evictions are measured to adjust shedding.
+	// Default value is 0 which means 1 second.
+	ShedWindow time.Duration
+
+	// CanaryInterval enables a self test when set: every interval a sentinel entry is written to every shard, read back,
+	// compared byte for byte and deleted, and round trips are timed. Results are returned by CanaryStatus, failures are
+	// passed to OnCanaryFailure, as an early warning of corruption or deadlocks. Sentinel entries are removed with
+	// Deleted reason and may evict entries of full shards. Default value is 0 which means no self test.
+	CanaryInterval time.Duration
+	// CanaryTimeout is how long round trips of the self test may take before they are reported as failed with
+	// ErrCanaryTimeout. Default value is 0 which means CanaryInterval.
+	CanaryTimeout time.Duration
+	// OnCanaryFailure is called with every failed round trip of the self test
+	OnCanaryFailure func(failure CanaryFailure)
+
 	// Logger is a logging interface and used in combination with `Verbose`
 	// Defaults to `DefaultLogger()`
 	Logger Logger
@@ -74,15 +369,221 @@ func (c Config) initialShardSize() int {
 	return max(c.MaxEntriesInWindow/c.Shards, minimumEntriesInShard)
 }
 
+// initialShardSizeInBytes computes initial size of shard queue in bytes
+func (c Config) initialShardSizeInBytes() int {
+	return int(c.initialShardBytes())
+}
+
+// initialShardBytes computes initial size of shard queue in bytes with 64-bit integers,
+// so sizes overflowing int on 32-bit platforms are rejected by validation instead of wrapping around
+func (c Config) initialShardBytes() int64 {
+	initialShardSize := int64(c.initialShardSize()) * int64(c.MaxEntrySize)
+	if c.InitialShardBytes > 0 {
+		initialShardSize = int64(c.InitialShardBytes)
+	}
+	maximumShardSizeInBytes := int64(c.maximumShardSizeInBytes())
+	if maximumShardSizeInBytes > 0 && initialShardSize > maximumShardSizeInBytes {
+		initialShardSize = maximumShardSizeInBytes
+	}
+	return initialShardSize
+}
+
 // maximumShardSizeInBytes computes maximum shard size in bytes
 func (c Config) maximumShardSizeInBytes() int {
-	maxShardSize := 0
+	return int(cacheSizeInBytes(c.HardMaxCacheSize) / int64(c.Shards))
+}
+
+// cacheSizeInBytes converts size in MB to bytes with 64-bit integers
+func cacheSizeInBytes(size int) int64 {
+	return int64(size) * 1024 * 1024
+}
+
+// maximumCacheSize returns the biggest HardMaxCacheSize in MB, bounded by the capacity of a queue
+// on this platform and by the 32-bit field holding the size of a running cache
+func maximumCacheSize() int {
+	if size := queue.MaxCapacity >> 20; size < math.MaxInt32 {
+		return int(size)
+	}
+	return math.MaxInt32
+}
+
+// maximumShardEntries computes maximum number of entries in a shard
+func (c Config) maximumShardEntries() int {
+	if c.MaxEntries <= 0 {
+		return 0
+	}
+	return (c.MaxEntries + c.Shards - 1) / c.Shards
+}
+
+// maximumTTLJitter computes the maximum jitter in timestamp units
+func (c Config) maximumTTLJitter() uint64 {
+	return c.lifeWindow() * uint64(c.TTLJitter) / 100
+}
+
+// tombstoneTTL computes lifetime of tombstones in timestamp units
+func (c Config) tombstoneTTL() uint64 {
+	if c.TombstoneTTL > 0 {
+		return c.timestampUnits(c.TombstoneTTL)
+	}
+	return c.lifeWindow()
+}
+
+// cleanPhases returns CleanPhases or its default
+func (c Config) cleanPhases() int {
+	if c.CleanPhases > 0 {
+		return c.CleanPhases
+	}
+	return 1
+}
+
+// earlyExpirationBeta returns EarlyExpirationBeta or its default
+func (c Config) earlyExpirationBeta() float64 {
+	if c.EarlyExpirationBeta > 0 {
+		return c.EarlyExpirationBeta
+	}
+	return 1
+}
+
+// alarmsEnabled reports whether any alarm callback is set
+func (c Config) alarmsEnabled() bool {
+	return c.OnHighEvictionRate != nil || c.OnLowHitRatio != nil
+}
+
+// alarmWindow returns AlarmWindow or its default
+func (c Config) alarmWindow() time.Duration {
+	if c.AlarmWindow > 0 {
+		return c.AlarmWindow
+	}
+	return 10 * time.Second
+}
+
+// memoryCheckWindow returns MemoryCheckWindow or its default
+func (c Config) memoryCheckWindow() time.Duration {
+	if c.MemoryCheckWindow > 0 {
+		return c.MemoryCheckWindow
+	}
+	return time.Second
+}
+
+// adaptiveWindow returns AdaptiveWindow or its default
+func (c Config) adaptiveWindow() time.Duration {
+	if c.AdaptiveWindow > 0 {
+		return c.AdaptiveWindow
+	}
+	return 10 * time.Second
+}
+
+// expiryAckTimeout returns ExpiryAckTimeout or its default
+func (c Config) expiryAckTimeout() time.Duration {
+	if c.ExpiryAckTimeout > 0 {
+		return c.ExpiryAckTimeout
+	}
+	return time.Minute
+}
+
+// onRemoveQueueSize returns OnRemoveQueueSize or its default
+func (c Config) onRemoveQueueSize() int {
+	if c.OnRemoveQueueSize > 0 {
+		return c.OnRemoveQueueSize
+	}
+	return defaultOnRemoveQueueSize
+}
+
+// canaryTimeout returns CanaryTimeout or its default
+func (c Config) canaryTimeout() time.Duration {
+	if c.CanaryTimeout > 0 {
+		return c.CanaryTimeout
+	}
+	return c.CanaryInterval
+}
+
+// prefetchWorkers returns PrefetchWorkers or its default
+func (c Config) prefetchWorkers() int {
+	if c.PrefetchWorkers > 0 {
+		return c.PrefetchWorkers
+	}
+	return defaultPrefetchWorkers
+}
+
+// prefetchQueueSize returns PrefetchQueueSize or its default
+func (c Config) prefetchQueueSize() int {
+	if c.PrefetchQueueSize > 0 {
+		return c.PrefetchQueueSize
+	}
+	return defaultPrefetchQueueSize
+}
 
-	if c.HardMaxCacheSize > 0 {
-		maxShardSize = convertMBToBytes(c.HardMaxCacheSize) / c.Shards
+// spillQueueSize returns SpillQueueSize or its default
+func (c Config) spillQueueSize() int {
+	if c.SpillQueueSize > 0 {
+		return c.SpillQueueSize
 	}
+	return defaultSpillQueueSize
+}
+
+// shedWindow returns ShedWindow or its default
+func (c Config) shedWindow() time.Duration {
+	if c.ShedWindow > 0 {
+		return c.ShedWindow
+	}
+	return time.Second
+}
+
+// sheddingEnabled reports whether writes are shed under overload
+func (c Config) sheddingEnabled() bool {
+	return c.SetBudget > 0 || c.ShedEvictionRatio > 0
+}
+
+// adaptiveGCFraction returns AdaptiveGCFraction or its default
+func (c Config) adaptiveGCFraction() float64 {
+	if c.AdaptiveGCFraction > 0 {
+		return c.AdaptiveGCFraction
+	}
+	return 0.05
+}
+
+// lifeWindow computes LifeWindow in timestamp units
+func (c Config) lifeWindow() uint64 {
+	return c.timestampUnits(c.LifeWindow)
+}
 
-	return maxShardSize
+// timestampUnit returns the duration of a single unit of entry timestamps
+func (c Config) timestampUnit() time.Duration {
+	if c.TimestampPrecision > 0 {
+		return c.TimestampPrecision
+	}
+	return time.Second
+}
+
+// timestampUnits converts duration to timestamp units, rounding it down
+func (c Config) timestampUnits(d time.Duration) uint64 {
+	return uint64(d / c.timestampUnit())
+}
+
+// timestamp converts time to an entry timestamp
+func (c Config) timestamp(t time.Time) uint64 {
+	return uint64(t.UnixNano() / int64(c.timestampUnit()))
+}
+
+// entryFields returns optional fields of extensible header stored in entries, 0 means EntryFormatV1 is used
+func (c Config) entryFields() byte {
+	if c.EntryFormat != EntryFormatV2 {
+		return 0
+	}
+	var fields byte = entryFieldKey
+	if c.OmitEntryKeys {
+		fields = 0
+	}
+	if c.EntryChecksum {
+		fields |= entryFieldChecksum
+	}
+	if c.EntrySequence {
+		fields |= entryFieldSequence
+	}
+	if c.EntryDigest {
+		fields |= entryFieldDigest
+	}
+	return fields
 }
 
 // OnRemoveFilterSet sets which remove reasons will trigger a call to OnRemoveWithReason.
@@ -0,0 +1,7 @@
+//go:build bigcache_debug
+// +build bigcache_debug
+
+package bigcache
+
+// entryGuardBytes is the number of guard bytes queues of debug builds add around every entry
+const entryGuardBytes = 8
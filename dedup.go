@@ -0,0 +1,216 @@
+package bigcache
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+const (
+	uniqueValue = 0 // Header of values stored under their key by DeduplicationMiddleware
+	sharedValue = 1 // Header of references to values shared by DeduplicationMiddleware
+
+	dedupLocks = 64 // Number of locks guarding reference counts of shared values, and references held by keys
+)
+
+// ErrInvalidSharedValue is returned by DeduplicationMiddleware when a read value was not written by it
+var ErrInvalidSharedValue = errors.New("value was not written by deduplication middleware")
+
+// DeduplicationMiddleware stores values of at least minSize bytes once under a key derived from their SHA-256
+// digest, keys hold only a reference to it. Identical values cached under many keys, e.g. per-user views
+// of a shared object, take memory of a single entry. References are counted, so a shared value is deleted
+// with the last key deleted or overwritten. Evicted keys are not counted down, their shared values are evicted
+// on their own then, and Get returns ErrEntryNotFound for keys whose shared value was evicted. Entries are
+// prefixed with a header byte, so all of them have to be written through the middleware, Get returns
+// ErrInvalidSharedValue for others.
+func DeduplicationMiddleware(minSize int) Middleware {
+	return func(next Interface) Interface {
+		return &dedupCache{Interface: next, minSize: minSize}
+	}
+}
+
+type dedupCache struct {
+	Interface
+	minSize  int
+	locks    [dedupLocks]sync.Mutex
+	keyLocks [dedupLocks]sync.Mutex
+}
+
+func (c *dedupCache) Get(key string) ([]byte, error) {
+	entry, err := c.Interface.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	digest, shared, err := readReference(entry)
+	if err != nil {
+		return nil, err
+	}
+	if !shared {
+		return entry[1:], nil
+	}
+	value, err := c.Interface.Get(contentKey(digest))
+	if err == ErrEntryNotFound {
+		// the shared value was evicted, it is written again by the next Set of the same value
+		lock := c.lock(digest)
+		c.Interface.Delete(refsKey(digest))
+		lock.Unlock()
+	}
+	return value, err
+}
+
+func (c *dedupCache) Set(key string, entry []byte) error {
+	// the previous reference is counted down exactly once when the key is written concurrently
+	lock := c.lockKey(key)
+	defer lock.Unlock()
+	previous, _ := c.reference(key)
+	if c.minSize <= 0 || len(entry) < c.minSize {
+		value := make([]byte, len(entry)+1)
+		value[0] = uniqueValue
+		copy(value[1:], entry)
+		err := c.Interface.Set(key, value)
+		if err == nil {
+			c.release(previous)
+		}
+		return err
+	}
+
+	digest := sha256.Sum256(entry)
+	if previous != nil && *previous == digest {
+		// the key already references the value, it is only stored again when it was evicted
+		return c.restore(digest, entry)
+	}
+	if err := c.acquire(digest, entry); err != nil {
+		return err
+	}
+	value := make([]byte, 1+len(digest))
+	value[0] = sharedValue
+	copy(value[1:], digest[:])
+	if err := c.Interface.Set(key, value); err != nil {
+		c.release(&digest)
+		return err
+	}
+	c.release(previous)
+	return nil
+}
+
+func (c *dedupCache) Delete(key string) error {
+	lock := c.lockKey(key)
+	defer lock.Unlock()
+	previous, _ := c.reference(key)
+	err := c.Interface.Delete(key)
+	c.release(previous)
+	return err
+}
+
+// reference reads the digest of the value shared by the key, it is nil when the value is not shared
+func (c *dedupCache) reference(key string) (*[sha256.Size]byte, error) {
+	entry, err := c.Interface.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	digest, shared, err := readReference(entry)
+	if !shared {
+		return nil, err
+	}
+	return &digest, nil
+}
+
+// acquire counts a new reference to the shared value, storing the value when it is not referenced yet
+func (c *dedupCache) acquire(digest [sha256.Size]byte, entry []byte) error {
+	lock := c.lock(digest)
+	defer lock.Unlock()
+	refs := c.refs(digest)
+	if refs == 0 {
+		if err := c.Interface.Set(contentKey(digest), entry); err != nil {
+			return err
+		}
+	}
+	return c.setRefs(digest, refs+1)
+}
+
+// restore stores the shared value again with a single reference when it was evicted
+func (c *dedupCache) restore(digest [sha256.Size]byte, entry []byte) error {
+	lock := c.lock(digest)
+	defer lock.Unlock()
+	if c.refs(digest) > 0 {
+		return nil
+	}
+	if err := c.Interface.Set(contentKey(digest), entry); err != nil {
+		return err
+	}
+	return c.setRefs(digest, 1)
+}
+
+// release counts down references to the shared value, deleting it with the last one
+func (c *dedupCache) release(digest *[sha256.Size]byte) {
+	if digest == nil {
+		return
+	}
+	lock := c.lock(*digest)
+	defer lock.Unlock()
+	refs := c.refs(*digest)
+	if refs <= 1 {
+		c.Interface.Delete(contentKey(*digest))
+		c.Interface.Delete(refsKey(*digest))
+		return
+	}
+	c.setRefs(*digest, refs-1)
+}
+
+// lock locks and returns the lock guarding reference count of the digest
+func (c *dedupCache) lock(digest [sha256.Size]byte) *sync.Mutex {
+	lock := &c.locks[int(digest[0])%dedupLocks]
+	lock.Lock()
+	return lock
+}
+
+// lockKey locks and returns the lock guarding the reference held by the key, it is taken before locks of digests
+func (c *dedupCache) lockKey(key string) *sync.Mutex {
+	lock := &c.keyLocks[newDefaultHasher().Sum64(key)%dedupLocks]
+	lock.Lock()
+	return lock
+}
+
+// refs reads reference count of the digest, it is 0 when it was never counted or evicted
+func (c *dedupCache) refs(digest [sha256.Size]byte) uint32 {
+	entry, err := c.Interface.Get(refsKey(digest))
+	if err != nil || len(entry) != 4 {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(entry)
+}
+
+func (c *dedupCache) setRefs(digest [sha256.Size]byte, refs uint32) error {
+	var entry [4]byte
+	binary.LittleEndian.PutUint32(entry[:], refs)
+	return c.Interface.Set(refsKey(digest), entry[:])
+}
+
+func contentKey(digest [sha256.Size]byte) string {
+	return "\x00content:" + string(digest[:])
+}
+
+func refsKey(digest [sha256.Size]byte) string {
+	return "\x00refs:" + string(digest[:])
+}
+
+// readReference reads digest of the value referenced by the entry, it reports whether the value is shared
+func readReference(entry []byte) ([sha256.Size]byte, bool, error) {
+	var digest [sha256.Size]byte
+	if len(entry) == 0 {
+		return digest, false, ErrInvalidSharedValue
+	}
+	switch entry[0] {
+	case uniqueValue:
+		return digest, false, nil
+	case sharedValue:
+		if len(entry) != 1+sha256.Size {
+			return digest, false, ErrInvalidSharedValue
+		}
+		copy(digest[:], entry[1:])
+		return digest, true, nil
+	default:
+		return digest, false, ErrInvalidSharedValue
+	}
+}
@@ -0,0 +1,75 @@
+package bigcache
+
+import "github.com/allegro/bigcache/v3/queue"
+
+const (
+	defaultDefragmentMaxEntries = 1000
+	defaultDefragmentMaxBytes   = 1024 * 1024
+	defaultDefragmentDeadRatio  = 0.25
+)
+
+// defragment moves live entries of fragmented shards within the budget configured for a single tick
+func (c *BigCache) defragment() {
+	maxEntries := c.config.DefragmentMaxEntries
+	if maxEntries == 0 {
+		maxEntries = defaultDefragmentMaxEntries
+	}
+	maxBytes := c.config.DefragmentMaxBytes
+	if maxBytes == 0 {
+		maxBytes = defaultDefragmentMaxBytes
+	}
+	ratio := c.config.DefragmentDeadRatio
+	if ratio == 0 {
+		ratio = defaultDefragmentDeadRatio
+	}
+	for i, shard := range c.shards {
+		shard.defragment(maxEntries, maxBytes, ratio)
+		c.recoverShardIndex(uint64(i), nil)
+	}
+}
+
+// Compact removes all dead entries of every shard, moving live entries to the tail of their queues.
+// Unlike the background defragmentation it has no budget, so each shard is locked for a whole pass
+// over its queue. It returns the number of processed entries.
+func (c *BigCache) Compact() int {
+	processed := 0
+	for i, shard := range c.shards {
+		processed += shard.defragment(int(queue.MaxCapacity), int(queue.MaxCapacity), 0)
+		c.recoverShardIndex(uint64(i), nil)
+	}
+	return processed
+}
+
+// defragment pops entries from the head of the queue, dropping dead ones and pushing live ones to the tail,
+// until dead entries take at most the ratio of the capacity or the budget of entries or bytes is spent.
+// It returns the number of processed entries.
+func (s *cacheShard) defragment(maxEntries int, maxBytes int, ratio float64) int {
+	s.lock.Lock()
+	target := int(ratio * float64(s.entries.Capacity()))
+	// entries pushed to the tail are not visited again
+	limit := min(maxEntries, s.entries.Len())
+	entries, bytes := 0, 0
+	for s.deadBytes > target && entries < limit && bytes < maxBytes {
+		oldest, err := s.entries.Pop()
+		if err != nil {
+			break
+		}
+		entries++
+		bytes += len(oldest)
+
+		hash := readHashFromEntry(oldest)
+		if hash == 0 {
+			s.reclaimDead(oldest)
+			continue
+		}
+		if !s.reinsert(oldest, hash) {
+			reason := NoSpace
+			if s.isExpired(oldest, uint64(s.clock.Epoch())) {
+				reason = Expired
+			}
+			s.removeEntry(oldest, hash, reason)
+		}
+	}
+	s.lock.Unlock()
+	return entries
+}
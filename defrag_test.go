@@ -0,0 +1,232 @@
+package bigcache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDefragmentReclaimsDeadEntries(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 100,
+		MaxEntrySize:       16,
+	})
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+	for i := 0; i < 100; i += 2 {
+		cache.Delete(fmt.Sprintf("key%d", i))
+	}
+	shard := cache.shards[0]
+	deadBytes := shard.deadBytes
+
+	// when
+	processed := shard.defragment(1000, 1<<20, 0)
+
+	// then
+	assertEqual(t, true, deadBytes > 0)
+	assertEqual(t, 99, processed)
+	assertEqual(t, 0, shard.deadBytes)
+	assertEqual(t, 50, shard.entries.Len())
+	assertEqual(t, 0, len(cache.Verify()))
+	for i := 1; i < 100; i += 2 {
+		value, err := cache.Get(fmt.Sprintf("key%d", i))
+		noError(t, err)
+		assertEqual(t, []byte("value"), value)
+	}
+}
+
+func TestCompactReclaimsAllDeadEntries(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 100,
+		MaxEntrySize:       16,
+	})
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+	for i := 0; i < 100; i += 2 {
+		cache.Delete(fmt.Sprintf("key%d", i))
+	}
+
+	// when
+	processed := cache.Compact()
+
+	// then
+	assertEqual(t, true, processed >= 50)
+	assertEqual(t, int64(0), cache.Stats().DeadBytes)
+	assertEqual(t, 50, cache.Len())
+	assertEqual(t, 0, len(cache.Verify()))
+	for i := 1; i < 100; i += 2 {
+		value, err := cache.Get(fmt.Sprintf("key%d", i))
+		noError(t, err)
+		assertEqual(t, []byte("value"), value)
+	}
+}
+
+func TestDefragmentKeepsBudget(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 100,
+		MaxEntrySize:       16,
+	})
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+	for i := 0; i < 100; i += 2 {
+		cache.Set(fmt.Sprintf("key%d", i), []byte("other"))
+	}
+	shard := cache.shards[0]
+
+	// when
+	processed := shard.defragment(10, 1<<20, 0)
+	byBytes := shard.defragment(1000, 1, 0)
+
+	// then
+	assertEqual(t, 10, processed)
+	assertEqual(t, 1, byBytes)
+	assertEqual(t, 0, len(cache.Verify()))
+}
+
+func TestDefragmentSkipsShardsUnderRatio(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 100,
+		MaxEntrySize:       16,
+	})
+	cache.Set("key", []byte("value"))
+	cache.Set("key", []byte("other"))
+
+	// when
+	processed := cache.shards[0].defragment(1000, 1<<20, 0.5)
+
+	// then
+	assertEqual(t, 0, processed)
+}
+
+func TestDefragmentRemovesExpiredEntries(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	var removed []RemoveReason
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         10 * time.Second,
+		MaxEntriesInWindow: 100,
+		MaxEntrySize:       16,
+		OnRemoveWithReason: func(key string, entry []byte, reason RemoveReason) {
+			removed = append(removed, reason)
+		},
+	}, &clock)
+	cache.Set("old", []byte("value"))
+	cache.Set("deleted", []byte("value"))
+	cache.Delete("deleted")
+	clock.set(20)
+
+	// when
+	cache.shards[0].defragment(1000, 1<<20, 0)
+
+	// then
+	assertEqual(t, []RemoveReason{Deleted, Expired}, removed)
+	assertEqual(t, 0, cache.shards[0].entries.Len())
+	_, err := cache.Get("old")
+	assertEqual(t, ErrEntryNotFound, err)
+}
+
+func TestDefragmentInBackground(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:               1,
+		LifeWindow:           time.Minute,
+		MaxEntriesInWindow:   100,
+		MaxEntrySize:         16,
+		DefragmentWindow:     time.Millisecond,
+		DefragmentMaxEntries: 5,
+		DefragmentDeadRatio:  0.001,
+	})
+	defer cache.Close()
+	shard := cache.shards[0]
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+		cache.Delete(fmt.Sprintf("key%d", i))
+	}
+
+	// when
+	deadline := time.Now().Add(time.Second)
+	for queued(shard) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// then
+	assertEqual(t, 0, queued(shard))
+}
+
+func queued(s *cacheShard) int {
+	s.lock.RLock()
+	res := s.entries.Len()
+	s.lock.RUnlock()
+	return res
+}
+
+func TestFragmentationStats(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 100,
+		MaxEntrySize:       16,
+	})
+	entrySize := headersSizeInBytes + len("key0") + len("value")
+	for i := 0; i < 10; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+	for i := 0; i < 5; i++ {
+		cache.Delete(fmt.Sprintf("key%d", i))
+	}
+
+	// when
+	stats := cache.Stats()
+	shardStats := cache.ShardStats()[0]
+
+	// then
+	// every entry is preceded by a single byte of its length in the queue and surrounded by guards in debug builds
+	assertEqual(t, int64(10*(entrySize+1+entryGuardBytes)), stats.UsedBytes)
+	assertEqual(t, int64(5*entrySize), stats.DeadBytes)
+	assertEqual(t, int64(5*headersSizeInBytes+10+10*entryGuardBytes), stats.OverheadBytes)
+	assertEqual(t, float64(5*entrySize+5*headersSizeInBytes+10+10*entryGuardBytes)/float64(10*(entrySize+1+entryGuardBytes)), stats.Fragmentation)
+	assertEqual(t, int(stats.DeadBytes), shardStats.DeadBytes)
+	assertEqual(t, stats.Fragmentation, shardStats.Fragmentation)
+	assertEqual(t, shardStats.Capacity-1-shardStats.UsedBytes, shardStats.FreeBytes)
+	assertEqual(t, 1+shardStats.UsedBytes, shardStats.RightMargin)
+
+	// when
+	cache.shards[0].defragment(1000, 1<<20, 0)
+	stats = cache.Stats()
+
+	// then
+	assertEqual(t, int64(0), stats.DeadBytes)
+	assertEqual(t, int64(5*(entrySize+1+entryGuardBytes)), stats.UsedBytes)
+}
@@ -0,0 +1,354 @@
+package bigcache
+
+import (
+	"bytes"
+	"compress/flate"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	dictionaryValue = 2 // Header of values compressed with a dictionary, followed by the dictionary id
+
+	maxDictionarySize        = 32 * 1024 // Deflate cannot reach farther back than its window
+	minDictionarySamples     = 16        // Number of sampled values below which no dictionary is trained
+	dictionaryShingleSize    = 8         // Length of substrings counted by the trainer
+	dictionarySegmentSize    = 64        // Length of substrings copied to the dictionary
+	dictionarySegmentStep    = 16        // Distance between starts of candidate segments
+	defaultDictionarySamples = 1024
+	defaultDictionaryHistory = 4
+)
+
+// ErrNotEnoughSamples is returned by DictionaryCompression.Train when too few values were sampled
+// or they have nothing in common
+var ErrNotEnoughSamples = errors.New("not enough samples to train a dictionary")
+
+// DictionaryConfig configures DictionaryCompression
+type DictionaryConfig struct {
+	// MinSize is the size of entries from which they are compressed. Default value is 0 which means all entries.
+	MinSize int
+	// Samples is the number of written values sampled for training. Default value is 0 which means 1024.
+	Samples int
+	// TrainInterval is the interval between trainings of a new dictionary from values sampled since the previous
+	// one, so the dictionary follows changes of values. Default value is 0 which means Train has to be called.
+	TrainInterval time.Duration
+	// History is the number of recent dictionaries kept to read entries compressed with them. Entries compressed
+	// with older dictionaries are reported as not found, so they are loaded again. Default value is 0 which means 4.
+	History int
+}
+
+// DictionaryCompression compresses entries with deflate and a dictionary trained on sampled values, which
+// improves ratios of small similar values, e.g. JSON documents of the same schema, far beyond compressing
+// them one by one. The dictionary holds substrings shared by most samples, segments shared more often
+// are placed closer to its end, where deflate references them with shorter distances. Until the first
+// dictionary is trained entries are compressed as by CompressionMiddleware, whose entries are read as well.
+type DictionaryCompression struct {
+	config DictionaryConfig
+	// lock guards dictionaries, the current dictionary and the id of the last one
+	lock         sync.RWMutex
+	dictionaries map[uint32]*dictionary
+	current      *dictionary
+	lastID       uint32
+	// samplesLock guards reservoir sampling of written values
+	samplesLock sync.Mutex
+	samples     [][]byte
+	seen        int
+	rand        *rand.Rand
+	close       chan struct{}
+	closeOnce   sync.Once
+}
+
+type dictionary struct {
+	id      uint32
+	data    []byte
+	writers sync.Pool
+}
+
+// NewDictionaryCompression creates DictionaryCompression with the config, training dictionaries every
+// TrainInterval until ctx is done or Close is called
+func NewDictionaryCompression(ctx context.Context, config DictionaryConfig) *DictionaryCompression {
+	if config.Samples <= 0 {
+		config.Samples = defaultDictionarySamples
+	}
+	if config.History <= 0 {
+		config.History = defaultDictionaryHistory
+	}
+	d := &DictionaryCompression{
+		config:       config,
+		dictionaries: make(map[uint32]*dictionary),
+		rand:         rand.New(rand.NewSource(time.Now().UnixNano())),
+		close:        make(chan struct{}),
+	}
+	if config.TrainInterval > 0 {
+		go d.trainLoop(ctx)
+	}
+	return d
+}
+
+// Middleware compresses entries with the current dictionary
+func (d *DictionaryCompression) Middleware() Middleware {
+	return func(next Interface) Interface {
+		return &dictionaryCache{Interface: next, compression: d}
+	}
+}
+
+// Train trains a new dictionary from values sampled since the previous one and uses it for subsequent writes.
+// It returns ErrNotEnoughSamples when too few values were sampled, the current dictionary is kept then.
+func (d *DictionaryCompression) Train() error {
+	d.samplesLock.Lock()
+	samples := d.samples
+	if len(samples) >= minDictionarySamples {
+		d.samples, d.seen = nil, 0
+	}
+	d.samplesLock.Unlock()
+	if len(samples) < minDictionarySamples {
+		return ErrNotEnoughSamples
+	}
+	data := trainDictionary(samples, maxDictionarySize)
+	if len(data) == 0 {
+		return ErrNotEnoughSamples
+	}
+
+	d.lock.Lock()
+	d.lastID++
+	dict := &dictionary{id: d.lastID, data: data}
+	d.dictionaries[dict.id] = dict
+	delete(d.dictionaries, dict.id-uint32(d.config.History))
+	d.current = dict
+	d.lock.Unlock()
+	return nil
+}
+
+// Close stops training of dictionaries
+func (d *DictionaryCompression) Close() error {
+	d.closeOnce.Do(func() {
+		close(d.close)
+	})
+	return nil
+}
+
+func (d *DictionaryCompression) trainLoop(ctx context.Context) {
+	ticker := time.NewTicker(d.config.TrainInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.close:
+			return
+		case <-ticker.C:
+			d.Train()
+		}
+	}
+}
+
+// sample keeps a copy of the value with reservoir sampling, so every written value is equally likely kept
+func (d *DictionaryCompression) sample(value []byte) {
+	d.samplesLock.Lock()
+	d.seen++
+	if len(d.samples) < d.config.Samples {
+		d.samples = append(d.samples, append([]byte(nil), value...))
+	} else if i := d.rand.Intn(d.seen); i < len(d.samples) {
+		d.samples[i] = append(d.samples[i][:0], value...)
+	}
+	d.samplesLock.Unlock()
+}
+
+func (d *DictionaryCompression) currentDictionary() *dictionary {
+	d.lock.RLock()
+	dict := d.current
+	d.lock.RUnlock()
+	return dict
+}
+
+func (d *DictionaryCompression) dictionary(id uint32) *dictionary {
+	d.lock.RLock()
+	dict := d.dictionaries[id]
+	d.lock.RUnlock()
+	return dict
+}
+
+// compress writes the value compressed with the dictionary to buf
+func (dict *dictionary) compress(buf *bytes.Buffer, value []byte) {
+	writer, _ := dict.writers.Get().(*flate.Writer)
+	if writer == nil {
+		// lower levels of compress/flate hardly find matches in the dictionary of small values
+		writer, _ = flate.NewWriterDict(buf, flate.BestCompression, dict.data)
+	} else {
+		writer.Reset(buf)
+	}
+	writer.Write(value)
+	writer.Close()
+	dict.writers.Put(writer)
+}
+
+type dictionaryCache struct {
+	Interface
+	compression *DictionaryCompression
+}
+
+func (c *dictionaryCache) Get(key string) ([]byte, error) {
+	entry, err := c.Interface.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(entry) == 0 {
+		return nil, ErrInvalidCompressedValue
+	}
+	var reader io.ReadCloser
+	switch entry[0] {
+	case rawValue:
+		return entry[1:], nil
+	case compressedValue:
+		reader = flate.NewReader(bytes.NewReader(entry[1:]))
+	case dictionaryValue:
+		if len(entry) < 5 {
+			return nil, ErrInvalidCompressedValue
+		}
+		dict := c.compression.dictionary(binary.LittleEndian.Uint32(entry[1:]))
+		if dict == nil {
+			// the dictionary was dropped from the history, the entry is lost
+			return nil, ErrEntryNotFound
+		}
+		reader = flate.NewReaderDict(bytes.NewReader(entry[5:]), dict.data)
+	default:
+		return nil, ErrInvalidCompressedValue
+	}
+	defer reader.Close()
+	value, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, ErrInvalidCompressedValue
+	}
+	return value, nil
+}
+
+func (c *dictionaryCache) Set(key string, entry []byte) error {
+	if len(entry) >= c.compression.config.MinSize {
+		c.compression.sample(entry)
+		var buf bytes.Buffer
+		if dict := c.compression.currentDictionary(); dict != nil {
+			var header [5]byte
+			header[0] = dictionaryValue
+			binary.LittleEndian.PutUint32(header[1:], dict.id)
+			buf.Write(header[:])
+			dict.compress(&buf, entry)
+		} else {
+			buf.WriteByte(compressedValue)
+			writer, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+			writer.Write(entry)
+			writer.Close()
+		}
+		if buf.Len() < len(entry)+1 {
+			return c.Interface.Set(key, buf.Bytes())
+		}
+	}
+	value := make([]byte, len(entry)+1)
+	value[0] = rawValue
+	copy(value[1:], entry)
+	return c.Interface.Set(key, value)
+}
+
+// trainDictionary selects segments of samples covering substrings shared by most of them, until maxSize.
+// It is a greedy cover: a segment scores the number of samples containing each of its distinct shingles,
+// shingles of selected segments score nothing afterwards, so the dictionary does not repeat itself.
+func trainDictionary(samples [][]byte, maxSize int) []byte {
+	// frequency counts samples containing the shingle, every sample is counted once
+	frequency := make(map[uint64]int)
+	lastSample := make(map[uint64]int)
+	for i, sample := range samples {
+		for j := 0; j+dictionaryShingleSize <= len(sample); j++ {
+			shingle := binary.LittleEndian.Uint64(sample[j:])
+			if last, ok := lastSample[shingle]; !ok || last != i {
+				lastSample[shingle] = i
+				frequency[shingle]++
+			}
+		}
+	}
+
+	candidates := &segmentHeap{}
+	for _, sample := range samples {
+		for start := 0; start < len(sample); start += dictionarySegmentStep {
+			end := min(start+dictionarySegmentSize, len(sample))
+			if end-start < dictionaryShingleSize {
+				break
+			}
+			segment := sample[start:end]
+			if score := segmentScore(segment, frequency); score > 0 {
+				candidates.segments = append(candidates.segments, scoredSegment{data: segment, score: score})
+			}
+		}
+	}
+	heap.Init(candidates)
+
+	var selected [][]byte
+	size := 0
+	for candidates.Len() > 0 && size < maxSize {
+		best := heap.Pop(candidates).(scoredSegment)
+		// scores only fall as shingles are covered, so a recomputed score still at the top is the best one
+		if score := segmentScore(best.data, frequency); score != best.score {
+			if score > 0 {
+				best.score = score
+				heap.Push(candidates, best)
+			}
+			continue
+		}
+		segment := best.data[:min(len(best.data), maxSize-size)]
+		for j := 0; j+dictionaryShingleSize <= len(segment); j++ {
+			delete(frequency, binary.LittleEndian.Uint64(segment[j:]))
+		}
+		selected = append(selected, segment)
+		size += len(segment)
+	}
+
+	// the best segments go last, closest to the compressed data
+	data := make([]byte, 0, size)
+	for i := len(selected) - 1; i >= 0; i-- {
+		data = append(data, selected[i]...)
+	}
+	return data
+}
+
+// segmentScore sums frequencies of distinct shingles of the segment which are shared by at least two samples
+func segmentScore(segment []byte, frequency map[uint64]int) int {
+	score := 0
+	var counted map[uint64]struct{}
+	for j := 0; j+dictionaryShingleSize <= len(segment); j++ {
+		shingle := binary.LittleEndian.Uint64(segment[j:])
+		if f := frequency[shingle]; f > 1 {
+			if counted == nil {
+				counted = make(map[uint64]struct{}, len(segment))
+			}
+			if _, ok := counted[shingle]; !ok {
+				counted[shingle] = struct{}{}
+				score += f
+			}
+		}
+	}
+	return score
+}
+
+type scoredSegment struct {
+	data  []byte
+	score int
+}
+
+// segmentHeap orders candidate segments by descending score
+type segmentHeap struct {
+	segments []scoredSegment
+}
+
+func (h *segmentHeap) Len() int           { return len(h.segments) }
+func (h *segmentHeap) Less(i, j int) bool { return h.segments[i].score > h.segments[j].score }
+func (h *segmentHeap) Swap(i, j int)      { h.segments[i], h.segments[j] = h.segments[j], h.segments[i] }
+func (h *segmentHeap) Push(x interface{}) { h.segments = append(h.segments, x.(scoredSegment)) }
+func (h *segmentHeap) Pop() interface{} {
+	last := h.segments[len(h.segments)-1]
+	h.segments = h.segments[:len(h.segments)-1]
+	return last
+}
@@ -0,0 +1,120 @@
+package bigcache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func userJSON(i int) []byte {
+	return []byte(fmt.Sprintf(`{"id":%d,"name":"user%d","email":"user%d@example.com","active":true,"roles":["reader","writer"],"locale":"en_US"}`, i, i, i))
+}
+
+func TestDictionaryCompressionImprovesRatio(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	compression := NewDictionaryCompression(context.Background(), DictionaryConfig{MinSize: 32})
+	defer compression.Close()
+	wrapped := Wrap(cache, compression.Middleware())
+	for i := 0; i < 200; i++ {
+		wrapped.Set(fmt.Sprintf("before%d", i), userJSON(i))
+	}
+
+	// when
+	err := compression.Train()
+	for i := 0; i < 200; i++ {
+		wrapped.Set(fmt.Sprintf("after%d", i), userJSON(i))
+	}
+
+	// then
+	noError(t, err)
+	before, after := 0, 0
+	for i := 0; i < 200; i++ {
+		entry, _ := cache.Get(fmt.Sprintf("before%d", i))
+		before += len(entry)
+		entry, _ = cache.Get(fmt.Sprintf("after%d", i))
+		after += len(entry)
+		value, err := wrapped.Get(fmt.Sprintf("before%d", i))
+		noError(t, err)
+		assertEqual(t, userJSON(i), value)
+		value, err = wrapped.Get(fmt.Sprintf("after%d", i))
+		noError(t, err)
+		assertEqual(t, userJSON(i), value)
+	}
+	assertEqual(t, true, after*2 < before)
+}
+
+func TestDictionaryCompressionKeepsHistory(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	compression := NewDictionaryCompression(context.Background(), DictionaryConfig{History: 2})
+	defer compression.Close()
+	wrapped := Wrap(cache, compression.Middleware())
+	train := func() {
+		for i := 0; i < minDictionarySamples; i++ {
+			wrapped.Set("sample", userJSON(i))
+		}
+		noError(t, compression.Train())
+	}
+
+	// when
+	train()
+	wrapped.Set("first", userJSON(1))
+	train()
+	wrapped.Set("second", userJSON(2))
+	value, firstErr := wrapped.Get("first")
+	train()
+
+	// then
+	noError(t, firstErr)
+	assertEqual(t, userJSON(1), value)
+	_, err := wrapped.Get("first")
+	assertEqual(t, ErrEntryNotFound, err)
+	value, _ = wrapped.Get("second")
+	assertEqual(t, userJSON(2), value)
+}
+
+func TestDictionaryCompressionNeedsSamples(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	compression := NewDictionaryCompression(context.Background(), DictionaryConfig{})
+	defer compression.Close()
+	wrapped := Wrap(cache, compression.Middleware())
+
+	// when
+	wrapped.Set("key", userJSON(1))
+	err := compression.Train()
+
+	// then
+	assertEqual(t, ErrNotEnoughSamples, err)
+	value, _ := wrapped.Get("key")
+	assertEqual(t, userJSON(1), value)
+}
+
+func TestTrainDictionaryCoversSharedSubstrings(t *testing.T) {
+	t.Parallel()
+
+	// given
+	samples := make([][]byte, 100)
+	for i := range samples {
+		samples[i] = userJSON(i)
+	}
+
+	// when
+	dictionary := trainDictionary(samples, 256)
+
+	// then
+	assertEqual(t, true, len(dictionary) > 0 && len(dictionary) <= 256)
+	assertEqual(t, true, bytes.Contains(dictionary, []byte(`"roles":["reader","writer"]`)))
+}
@@ -0,0 +1,102 @@
+package bigcache
+
+import (
+	"sync/atomic"
+)
+
+const defaultOnRemoveQueueSize = 1024
+
+// OnRemoveOverflowPolicy decides what happens to a removal callback when the queue of OnRemoveWorkers is full
+type OnRemoveOverflowPolicy int
+
+const (
+	// DropCallback skips the callback and counts it in Stats.DroppedCallbacks. It is the default.
+	DropCallback = OnRemoveOverflowPolicy(0)
+	// WaitForQueue blocks the removal until the callback fits in the queue, so no callback is lost
+	// but eviction latency depends on callback cost again under sustained overload.
+	WaitForQueue = OnRemoveOverflowPolicy(1)
+	// CallInline calls the callback synchronously, like without OnRemoveWorkers.
+	CallInline = OnRemoveOverflowPolicy(2)
+)
+
+// removal is a removed entry passed to the callback by a worker of removalDispatcher
+type removal struct {
+	key      string
+	entry    []byte
+	reason   RemoveReason
+	metadata Metadata
+}
+
+// removalDispatcher calls removal callbacks on Config.OnRemoveWorkers goroutines
+type removalDispatcher struct {
+	// dropped is accessed atomically, it comes first to be 64-bit aligned on 32-bit platforms
+	dropped  int64
+	cache    *BigCache
+	removals chan removal
+}
+
+func newRemovalDispatcher(cache *BigCache) *removalDispatcher {
+	return &removalDispatcher{
+		cache:    cache,
+		removals: make(chan removal, cache.config.onRemoveQueueSize()),
+	}
+}
+
+// dispatch copies the removed entry and queues it for a worker, it is called with the shard lock held
+func (d *removalDispatcher) dispatch(wrappedEntry []byte, reason RemoveReason) {
+	c := d.cache
+	if c.config.OnRemoveWithMetadata == nil && c.config.OnRemove == nil &&
+		c.config.onRemoveFilter != 0 && (1<<uint(reason))&c.config.onRemoveFilter == 0 {
+		return
+	}
+	r := removal{key: readKeyFromEntry(wrappedEntry), entry: readEntry(wrappedEntry), reason: reason}
+	if c.config.OnRemoveWithMetadata != nil {
+		hashedKey := c.hash.Sum64(r.key)
+		r.metadata = c.getShard(hashedKey).getKeyMetadata(hashedKey)
+	}
+
+	select {
+	case d.removals <- r:
+		return
+	default:
+	}
+	switch c.config.OnRemoveOverflow {
+	case WaitForQueue:
+		select {
+		case d.removals <- r:
+		case <-c.close:
+		case <-c.done:
+		}
+	case CallInline:
+		d.deliver(r)
+	default:
+		atomic.AddInt64(&d.dropped, 1)
+	}
+}
+
+// work calls callbacks of queued removals until the cache is closed
+func (d *removalDispatcher) work() {
+	for {
+		select {
+		case <-d.cache.done:
+			return
+		case <-d.cache.close:
+			return
+		case r := <-d.removals:
+			d.deliver(r)
+		}
+	}
+}
+
+// deliver calls the configured callback with the same precedence as synchronous callbacks
+func (d *removalDispatcher) deliver(r removal) {
+	config := d.cache.config
+	switch {
+	case config.OnRemoveWithMetadata != nil:
+		config.OnRemoveWithMetadata(r.key, r.entry, r.metadata)
+	case config.OnRemove != nil:
+		config.OnRemove(r.key, r.entry)
+	default:
+		config.OnRemoveWithReason(r.key, r.entry, r.reason)
+	}
+}
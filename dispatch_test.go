@@ -0,0 +1,177 @@
+package bigcache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func dispatchConfig() Config {
+	return Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		OnRemoveWorkers:    1,
+	}
+}
+
+// waitFor waits until condition holds
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition was not met")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOnRemoveWorkersCallCallbacksAsynchronously(t *testing.T) {
+	t.Parallel()
+
+	// given
+	release := make(chan struct{})
+	removed := make(chan string, 1)
+	config := dispatchConfig()
+	config.OnRemove = func(key string, entry []byte) {
+		<-release
+		removed <- key + "=" + string(entry)
+	}
+	cache, _ := New(context.Background(), config)
+	defer cache.Close()
+	cache.Set("key", []byte("value"))
+
+	// when
+	noError(t, cache.Delete("key"))
+	close(release)
+
+	// then
+	select {
+	case r := <-removed:
+		assertEqual(t, "key=value", r)
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback was not called")
+	}
+}
+
+func TestOnRemoveWorkersDropCallbacksWhenQueueIsFull(t *testing.T) {
+	t.Parallel()
+
+	// given
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var lock sync.Mutex
+	var removed []string
+	config := dispatchConfig()
+	config.OnRemoveQueueSize = 1
+	config.OnRemove = func(key string, entry []byte) {
+		if key == "a" {
+			started <- struct{}{}
+			<-release
+		}
+		lock.Lock()
+		removed = append(removed, key)
+		lock.Unlock()
+	}
+	cache, _ := New(context.Background(), config)
+	defer cache.Close()
+	for _, key := range []string{"a", "b", "c"} {
+		cache.Set(key, []byte("value"))
+	}
+	cache.Delete("a")
+	<-started
+
+	// when
+	cache.Delete("b")
+	cache.Delete("c")
+	close(release)
+
+	// then
+	assertEqual(t, int64(1), cache.Stats().DroppedCallbacks)
+	waitFor(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(removed) == 2
+	})
+	assertEqual(t, []string{"a", "b"}, removed)
+}
+
+func TestOnRemoveWorkersCallInlineWhenQueueIsFull(t *testing.T) {
+	t.Parallel()
+
+	// given
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	inline := make(chan string, 1)
+	config := dispatchConfig()
+	config.OnRemoveQueueSize = 1
+	config.OnRemoveOverflow = CallInline
+	config.OnRemoveWithReason = func(key string, entry []byte, reason RemoveReason) {
+		switch key {
+		case "a":
+			started <- struct{}{}
+			<-release
+		case "c":
+			inline <- key
+		}
+	}
+	cache, _ := New(context.Background(), config)
+	defer cache.Close()
+	for _, key := range []string{"a", "b", "c"} {
+		cache.Set(key, []byte("value"))
+	}
+	cache.Delete("a")
+	<-started
+
+	// when
+	cache.Delete("b")
+	cache.Delete("c")
+
+	// then
+	select {
+	case key := <-inline:
+		assertEqual(t, "c", key)
+	default:
+		t.Error("callback of c was not called inline")
+	}
+	close(release)
+	assertEqual(t, int64(0), cache.Stats().DroppedCallbacks)
+}
+
+func TestOnRemoveWorkersRespectFilter(t *testing.T) {
+	t.Parallel()
+
+	// given
+	removed := make(chan RemoveReason, 2)
+	config := dispatchConfig().OnRemoveFilterSet(Deleted)
+	config.OnRemoveWithReason = func(key string, entry []byte, reason RemoveReason) {
+		removed <- reason
+	}
+	clock := mockedClock{value: 0}
+	config.LifeWindow = time.Second
+	cache, _ := newBigCache(context.Background(), config, &clock)
+	defer cache.Close()
+	cache.Set("expired", []byte("value"))
+	clock.set(5)
+	cache.Set("deleted", []byte("value"))
+
+	// when
+	cache.cleanUp(uint64(clock.Epoch()))
+	cache.Delete("deleted")
+
+	// then
+	select {
+	case reason := <-removed:
+		assertEqual(t, Deleted, reason)
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback was not called")
+	}
+	select {
+	case reason := <-removed:
+		t.Errorf("Unexpected callback with reason %v", reason)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
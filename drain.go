@@ -0,0 +1,121 @@
+package bigcache
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Drain streams all entries to sink and makes the cache read-only, for a handover to another process which
+// imports the stream before traffic is switched to it. Reads are served while draining and writes are accepted
+// until the cache becomes read-only. Shards remember keys written while draining, and once no write can commit
+// anymore their latest entries are streamed again, so the stream ends with the latest value of every key.
+// Deletes made while draining are not streamed. The key and entry passed to sink are copies. When sink returns
+// an error or ctx is done, Drain stops and returns it, the cache stays writable then.
+func (c *BigCache) Drain(ctx context.Context, sink func(key string, entry []byte) error) error {
+	c.drainLock.Lock()
+	defer c.drainLock.Unlock()
+
+	for _, shard := range c.shards {
+		shard.lock.Lock()
+		shard.dirty = make(map[uint64]struct{})
+		shard.lock.Unlock()
+	}
+	err := c.drainAll(ctx, sink)
+	if err == nil {
+		c.SetReadOnly(true)
+		err = c.drainDirty(ctx, sink)
+	}
+	if err != nil {
+		for _, shard := range c.shards {
+			shard.lock.Lock()
+			shard.dirty = nil
+			shard.lock.Unlock()
+		}
+		c.SetReadOnly(false)
+	}
+	return err
+}
+
+// drainAll streams all entries to sink
+func (c *BigCache) drainAll(ctx context.Context, sink func(key string, entry []byte) error) error {
+	iterator := c.Iterator()
+	for iterator.SetNext() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		info, err := iterator.Value()
+		if err != nil {
+			continue
+		}
+		if err := sink(info.Key(), info.Value()); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// drainDirty streams entries written since the drain started, the cache has to be read-only already
+func (c *BigCache) drainDirty(ctx context.Context, sink func(key string, entry []byte) error) error {
+	for _, shard := range c.shards {
+		keys, entries := shard.takeDirty()
+		for i, key := range keys {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := sink(key, entries[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// takeDirty stops remembering written keys and returns copies of the latest entries of keys written so far,
+// deleted ones are skipped
+func (s *cacheShard) takeDirty() ([]string, [][]byte) {
+	s.lock.Lock()
+	dirty := s.dirty
+	s.dirty = nil
+	keys := make([]string, 0, len(dirty))
+	entries := make([][]byte, 0, len(dirty))
+	for hashedKey := range dirty {
+		itemIndex := s.hashmap[hashedKey]
+		if itemIndex == 0 {
+			continue
+		}
+		wrappedEntry, err := s.entries.Get(int(itemIndex))
+		if err != nil {
+			continue
+		}
+		keys = append(keys, s.entryKey(wrappedEntry))
+		entries = append(entries, readEntry(wrappedEntry))
+	}
+	s.lock.Unlock()
+	return keys, entries
+}
+
+// SetReadOnly makes the cache read-only or writable again, e.g. when a handover prepared by Drain is aborted.
+// Writes to a read-only cache return ErrReadOnly, except Reset and ResetShard, so memory of a drained cache
+// can be released. Removals of expired and evicted entries go on. Once SetReadOnly(true) returns, no write
+// started before it commits anymore, shards are locked one by one to reject them.
+func (c *BigCache) SetReadOnly(readOnly bool) {
+	atomic.StoreInt32(&c.readOnly, boolToInt32(readOnly))
+	for _, shard := range c.shards {
+		shard.lock.Lock()
+		shard.readOnly = readOnly
+		shard.lock.Unlock()
+	}
+}
+
+// ReadOnly reports whether writes to the cache return ErrReadOnly
+func (c *BigCache) ReadOnly() bool {
+	return atomic.LoadInt32(&c.readOnly) == 1
+}
+
+// writable returns ErrReadOnly when the cache is read-only
+func (c *BigCache) writable() error {
+	if atomic.LoadInt32(&c.readOnly) == 1 {
+		return ErrReadOnly
+	}
+	return nil
+}
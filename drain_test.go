@@ -0,0 +1,193 @@
+package bigcache
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestDrainStreamsEntriesAndMakesCacheReadOnly(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	})
+	cache.Set("a", []byte("1"))
+	cache.Set("b", []byte("2"))
+	cache.Set("c", []byte("3"))
+
+	// when
+	drained := make(map[string]string)
+	err := cache.Drain(context.Background(), func(key string, entry []byte) error {
+		drained[key] = string(entry)
+		return nil
+	})
+
+	// then
+	noError(t, err)
+	assertEqual(t, map[string]string{"a": "1", "b": "2", "c": "3"}, drained)
+	assertEqual(t, true, cache.ReadOnly())
+	value, err := cache.Get("a")
+	noError(t, err)
+	assertEqual(t, []byte("1"), value)
+	assertEqual(t, ErrReadOnly, cache.Set("d", []byte("4")))
+	assertEqual(t, ErrReadOnly, cache.Delete("a"))
+	assertEqual(t, ErrReadOnly, cache.Append("a", []byte("1")))
+	_, err = cache.DeleteMulti([]string{"a"})
+	assertEqual(t, ErrReadOnly, err)
+	loaded, err := cache.GetOrLoad("e", func() ([]byte, error) { return []byte("5"), nil })
+	noError(t, err)
+	assertEqual(t, []byte("5"), loaded)
+	assertEqual(t, 3, cache.Len())
+
+	// when
+	cache.SetReadOnly(false)
+
+	// then
+	noError(t, cache.Set("d", []byte("4")))
+	assertEqual(t, 4, cache.Len())
+}
+
+func TestDrainStreamsEntriesWrittenWhileDraining(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 100}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}, &clock)
+	cache.Set("a", []byte("1"))
+	cache.Set("b", []byte("2"))
+	clock.set(110)
+
+	// when
+	var drained []string
+	err := cache.Drain(context.Background(), func(key string, entry []byte) error {
+		if len(drained) == 0 {
+			// a write to the shard being streamed already
+			noError(t, cache.Set("c", []byte("3")))
+		}
+		drained = append(drained, key+"="+string(entry))
+		return nil
+	})
+
+	// then
+	noError(t, err)
+	assertEqual(t, 3, len(drained))
+	sort.Strings(drained[:2])
+	assertEqual(t, []string{"a=1", "b=2", "c=3"}, drained)
+	assertEqual(t, true, cache.ReadOnly())
+}
+
+func TestDrainStreamsEntriesRestampedWhileDraining(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 100}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}, &clock)
+	cache.Set("a", []byte("1"))
+
+	// when
+	var drained []string
+	err := cache.Drain(context.Background(), func(key string, entry []byte) error {
+		if len(drained) == 0 {
+			// the entry is stamped before the drain started
+			noError(t, cache.Set("b", []byte("2")))
+			noError(t, cache.Expire("b", time.Second))
+		}
+		drained = append(drained, key+"="+string(entry))
+		return nil
+	})
+
+	// then
+	noError(t, err)
+	assertEqual(t, []string{"a=1", "b=2"}, drained)
+}
+
+func TestReadOnlyRejectsWritesPastTheCheck(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	})
+	hashedKey := cache.hash.Sum64("a")
+
+	// when
+	cache.SetReadOnly(true)
+	// a write which passed the check of the cache before it became read-only
+	err := cache.shards[0].set("a", hashedKey, []byte("1"))
+
+	// then
+	assertEqual(t, ErrReadOnly, err)
+	assertEqual(t, 0, cache.Len())
+}
+
+func TestDrainStopsOnSinkError(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	})
+	cache.Set("a", []byte("1"))
+	cache.Set("b", []byte("2"))
+	sinkErr := errors.New("connection reset")
+
+	// when
+	calls := 0
+	err := cache.Drain(context.Background(), func(key string, entry []byte) error {
+		calls++
+		return sinkErr
+	})
+
+	// then
+	assertEqual(t, sinkErr, err)
+	assertEqual(t, 1, calls)
+	assertEqual(t, false, cache.ReadOnly())
+	noError(t, cache.Set("c", []byte("3")))
+}
+
+func TestDrainStopsWhenContextIsDone(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	})
+	cache.Set("a", []byte("1"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// when
+	err := cache.Drain(ctx, func(key string, entry []byte) error {
+		return nil
+	})
+
+	// then
+	assertEqual(t, context.Canceled, err)
+	assertEqual(t, false, cache.ReadOnly())
+}
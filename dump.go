@@ -0,0 +1,89 @@
+//go:build !bigcache_noexport
+// +build !bigcache_noexport
+
+package bigcache
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/allegro/bigcache/v3/queue"
+)
+
+// shardDump is the JSON document written by DumpShard
+type shardDump struct {
+	Shard           int              `json:"shard"`
+	Queues          []queue.Geometry `json:"queues"`
+	MapSize         int              `json:"map_size"`
+	OldestTimestamp uint64           `json:"oldest_timestamp"`
+	NewestTimestamp uint64           `json:"newest_timestamp"`
+	Entries         []entryHeader    `json:"entries,omitempty"`
+}
+
+// entryHeader describes an entry stored in a shard queue, Live is false for deleted and overwritten entries
+type entryHeader struct {
+	Index     int    `json:"index"`
+	Timestamp uint64 `json:"timestamp"`
+	Hash      uint64 `json:"hash"`
+	Key       string `json:"key,omitempty"`
+	Size      int    `json:"size"`
+	Live      bool   `json:"live"`
+}
+
+// DumpShard writes indented JSON describing internals of the shard to w: geometry of its queues, size
+// of its hashmap and timestamps of its oldest and newest entries. When withEntries is set headers of all
+// entries in the queue are included, which can be large. It is meant for support and bug reports.
+// It returns an ErrInvalidShardIndex when the shard index is out of range.
+func (c *BigCache) DumpShard(id int, w io.Writer, withEntries bool) error {
+	if id < 0 || id >= len(c.shards) {
+		return ErrInvalidShardIndex
+	}
+	dump := c.shards[id].dump(withEntries)
+	dump.Shard = id
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(dump)
+}
+
+func (s *cacheShard) dump(withEntries bool) shardDump {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	dump := shardDump{MapSize: len(s.hashmap)}
+	if segments, ok := s.segments(); ok {
+		segments.eachInUse(func(slot int, segment *segment) bool {
+			dump.Queues = append(dump.Queues, segment.entries.Geometry())
+			return true
+		})
+	} else if q, ok := s.queue().(*queue.BytesQueue); ok {
+		dump.Queues = []queue.Geometry{q.Geometry()}
+	}
+	first := true
+	s.entries.Iterate(func(index int, data []byte) bool {
+		if len(data) < headersSizeInBytes || readTimestampFromEntry(data) == 0 && readHashFromEntry(data) == 0 {
+			// filler left by growing a wrapped queue
+			return true
+		}
+		timestamp := readTimestampFromEntry(data)
+		if first {
+			dump.OldestTimestamp = timestamp
+			first = false
+		}
+		dump.NewestTimestamp = timestamp
+		if withEntries {
+			hash := readHashFromEntry(data)
+			header := entryHeader{Index: index, Timestamp: timestamp, Hash: hash, Size: len(data)}
+			if current, ok := s.hashmap[hash]; ok && current == uint64(index) {
+				header.Live = true
+			}
+			if isValidEntry(data) && hasKeyInEntry(data) {
+				header.Key = readKeyFromEntry(data)
+			} else if header.Live && s.keys != nil {
+				header.Key = s.keys.get(hash)
+			}
+			dump.Entries = append(dump.Entries, header)
+		}
+		return true
+	})
+	return dump
+}
@@ -0,0 +1,53 @@
+//go:build !bigcache_noexport
+// +build !bigcache_noexport
+
+package bigcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDumpShard(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 100}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}, &clock)
+	cache.Set("a", []byte("value"))
+	clock.set(110)
+	cache.Set("b", []byte("value"))
+	cache.Set("a", []byte("other"))
+
+	// when
+	var summary, full bytes.Buffer
+	err := cache.DumpShard(0, &summary, false)
+	noError(t, err)
+	noError(t, cache.DumpShard(0, &full, true))
+
+	// then
+	var dump shardDump
+	noError(t, json.Unmarshal(summary.Bytes(), &dump))
+	assertEqual(t, 2, dump.MapSize)
+	assertEqual(t, uint64(100), dump.OldestTimestamp)
+	assertEqual(t, uint64(110), dump.NewestTimestamp)
+	assertEqual(t, 1, len(dump.Queues))
+	assertEqual(t, 3, dump.Queues[0].Count)
+	assertEqual(t, 0, len(dump.Entries))
+
+	noError(t, json.Unmarshal(full.Bytes(), &dump))
+	assertEqual(t, 3, len(dump.Entries))
+	assertEqual(t, "a", dump.Entries[0].Key)
+	assertEqual(t, false, dump.Entries[0].Live)
+	assertEqual(t, "a", dump.Entries[2].Key)
+	assertEqual(t, true, dump.Entries[2].Live)
+	assertEqual(t, ErrInvalidShardIndex, cache.DumpShard(1, &full, false))
+}
@@ -2,6 +2,18 @@ package bigcache
 
 import (
 	"encoding/binary"
+	"hash/crc32"
+)
+
+// EntryFormat is a binary layout of entries stored in the cache
+type EntryFormat int
+
+const (
+	// EntryFormatV1 stores timestamp, hash, key length, key and entry. It is the default format.
+	EntryFormatV1 = EntryFormat(1)
+	// EntryFormatV2 extends EntryFormatV1 header with a version and a set of optional fields,
+	// so new per-entry fields can be added without breaking the layout.
+	EntryFormatV2 = EntryFormat(2)
 )
 
 const (
@@ -9,6 +21,35 @@ const (
 	hashSizeInBytes      = 8                                                       // Number of bytes used for hash
 	keySizeInBytes       = 2                                                       // Number of bytes used for size of entry key
 	headersSizeInBytes   = timestampSizeInBytes + hashSizeInBytes + keySizeInBytes // Number of bytes used for all headers
+
+	extendedHeaderMarker      = 0xFFFF // Key size marking entry with extensible header, it is followed by version and fields
+	extendedHeaderVersion     = 2      // Version of extensible header
+	extendedHeaderSizeInBytes = 2      // Number of bytes used for version and fields of extensible header
+)
+
+// Optional fields of extensible header. Present fields are stored after the header in the order of their bits.
+const (
+	entryFieldKey      = 1 << 0 // key size, without it the entry is identified by its hash only
+	entryFieldTTL      = 1 << 1 // lifetime of the entry in seconds
+	entryFieldFlags    = 1 << 2 // bit flags of the entry
+	entryFieldChecksum = 1 << 3 // crc32 of key and entry
+	entryFieldSequence = 1 << 4 // sequence number of the write in its shard
+	entryFieldDigest   = 1 << 5 // xxh3 of the value
+)
+
+// Bit flags of entryFieldFlags
+const (
+	entryFlagContentType = 1 << 0 // content type prefixed with its length is stored before the key
+
+	entryFlagsValueVersionShift = 8 // value version, see Config.ValueVersion, is stored in the second byte of flags
+)
+
+// maxContentTypeLength is the length of the longest content type which can be stored in an entry
+const maxContentTypeLength = 255
+
+var (
+	entryFieldSizes = [...]int{keySizeInBytes, 8, 4, 4, 8, 8}
+	checksumTable   = crc32.MakeTable(crc32.Castagnoli)
 )
 
 func wrapEntry(timestamp uint64, hash uint64, key string, entry []byte, buffer *[]byte) []byte {
@@ -29,6 +70,70 @@ func wrapEntry(timestamp uint64, hash uint64, key string, entry []byte, buffer *
 	return blob[:blobLength]
 }
 
+// wrapEntryWithFields wraps entry using extensible header with the given optional fields
+func wrapEntryWithFields(timestamp uint64, hash uint64, key string, entry []byte, fields byte, buffer *[]byte) []byte {
+	return wrapEntryWithContentType(timestamp, hash, key, entry, fields, "", buffer)
+}
+
+// wrapEntryWithContentType wraps entry using extensible header with the given optional fields, storing
+// a non-empty content type before the key. Content type must not be longer than maxContentTypeLength.
+func wrapEntryWithContentType(timestamp uint64, hash uint64, key string, entry []byte, fields byte, contentType string, buffer *[]byte) []byte {
+	return wrapEntryWithFlags(timestamp, hash, key, entry, fields, contentType, 0, buffer)
+}
+
+// wrapEntryWithFlags wraps entry using extensible header with the given optional fields, storing a non-empty
+// content type before the key and a non-zero value version in flags
+func wrapEntryWithFlags(timestamp uint64, hash uint64, key string, entry []byte, fields byte, contentType string, valueVersion uint8, buffer *[]byte) []byte {
+	keyLength := len(key)
+	if fields&entryFieldKey == 0 {
+		keyLength = 0
+	}
+	var flags uint32
+	if contentType != "" {
+		flags |= entryFlagContentType
+	}
+	flags |= uint32(valueVersion) << entryFlagsValueVersionShift
+	if flags != 0 {
+		fields |= entryFieldFlags
+	}
+	contentTypeOffset := headersSizeInBytes + extendedHeaderSizeInBytes + entryFieldsSize(fields)
+	keyOffset := contentTypeOffset
+	if contentType != "" {
+		keyOffset += 1 + len(contentType)
+	}
+	blobLength := keyOffset + keyLength + len(entry)
+
+	if blobLength > len(*buffer) {
+		*buffer = make([]byte, blobLength)
+	}
+	blob := (*buffer)[:blobLength]
+
+	binary.LittleEndian.PutUint64(blob, timestamp)
+	binary.LittleEndian.PutUint64(blob[timestampSizeInBytes:], hash)
+	binary.LittleEndian.PutUint16(blob[timestampSizeInBytes+hashSizeInBytes:], extendedHeaderMarker)
+	blob[headersSizeInBytes] = extendedHeaderVersion
+	blob[headersSizeInBytes+1] = fields
+	for i := headersSizeInBytes + extendedHeaderSizeInBytes; i < contentTypeOffset; i++ {
+		blob[i] = 0
+	}
+	if fields&entryFieldKey != 0 {
+		binary.LittleEndian.PutUint16(blob[entryFieldOffset(fields, entryFieldKey):], uint16(keyLength))
+	}
+	if flags != 0 {
+		binary.LittleEndian.PutUint32(blob[entryFieldOffset(fields, entryFieldFlags):], flags)
+	}
+	if contentType != "" {
+		blob[contentTypeOffset] = byte(len(contentType))
+		copy(blob[contentTypeOffset+1:], contentType)
+	}
+	copy(blob[keyOffset:], key[:keyLength])
+	copy(blob[keyOffset+keyLength:], entry)
+	updateEntryDigest(blob)
+	updateEntryChecksum(blob)
+
+	return blob
+}
+
 func appendToWrappedEntry(timestamp uint64, wrappedEntry []byte, entry []byte, buffer *[]byte) []byte {
 	blobLength := len(wrappedEntry) + len(entry)
 	if blobLength > len(*buffer) {
@@ -40,38 +145,226 @@ func appendToWrappedEntry(timestamp uint64, wrappedEntry []byte, entry []byte, b
 	binary.LittleEndian.PutUint64(blob, timestamp)
 	copy(blob[timestampSizeInBytes:], wrappedEntry[timestampSizeInBytes:])
 	copy(blob[len(wrappedEntry):], entry)
+	updateEntryDigest(blob[:blobLength])
+	updateEntryChecksum(blob[:blobLength])
 
 	return blob[:blobLength]
 }
 
+// entryFieldsSize returns the number of bytes used by the optional fields
+func entryFieldsSize(fields byte) int {
+	size := 0
+	for i, fieldSize := range entryFieldSizes {
+		if fields&(1<<uint(i)) != 0 {
+			size += fieldSize
+		}
+	}
+	return size
+}
+
+// entryFieldOffset returns offset of the optional field in entry with extensible header
+func entryFieldOffset(fields byte, field byte) int {
+	return headersSizeInBytes + extendedHeaderSizeInBytes + entryFieldsSize(fields&(field-1))
+}
+
+func hasExtendedHeader(data []byte) bool {
+	return binary.LittleEndian.Uint16(data[timestampSizeInBytes+hashSizeInBytes:]) == extendedHeaderMarker
+}
+
+// readKeyBoundsFromEntry returns offset and length of the key, the entry follows the key
+func readKeyBoundsFromEntry(data []byte) (int, int) {
+	length := int(binary.LittleEndian.Uint16(data[timestampSizeInBytes+hashSizeInBytes:]))
+	if length != extendedHeaderMarker {
+		return headersSizeInBytes, length
+	}
+	fields := data[headersSizeInBytes+1]
+	offset := headersSizeInBytes + extendedHeaderSizeInBytes + entryFieldsSize(fields)
+	if hasContentType(data, fields) {
+		offset += 1 + int(data[offset])
+	}
+	if fields&entryFieldKey == 0 {
+		return offset, 0
+	}
+	return offset, int(binary.LittleEndian.Uint16(data[entryFieldOffset(fields, entryFieldKey):]))
+}
+
+// hasContentType reports whether entry with extensible header stores content type before the key
+func hasContentType(data []byte, fields byte) bool {
+	return fields&entryFieldFlags != 0 &&
+		binary.LittleEndian.Uint32(data[entryFieldOffset(fields, entryFieldFlags):])&entryFlagContentType != 0
+}
+
+// readContentTypeFromEntry returns content type stored in the entry, it is empty when none was stored
+func readContentTypeFromEntry(data []byte) string {
+	if !hasExtendedHeader(data) {
+		return ""
+	}
+	fields := data[headersSizeInBytes+1]
+	if !hasContentType(data, fields) {
+		return ""
+	}
+	offset := headersSizeInBytes + extendedHeaderSizeInBytes + entryFieldsSize(fields)
+	return string(data[offset+1 : offset+1+int(data[offset])])
+}
+
+// readValueVersionFromEntry returns version of the value stored in flags of the entry, it is 0 when none was stored
+func readValueVersionFromEntry(data []byte) uint8 {
+	if !hasExtendedHeader(data) {
+		return 0
+	}
+	fields := data[headersSizeInBytes+1]
+	if fields&entryFieldFlags == 0 {
+		return 0
+	}
+	return uint8(binary.LittleEndian.Uint32(data[entryFieldOffset(fields, entryFieldFlags):]) >> entryFlagsValueVersionShift)
+}
+
+// readSequenceFromEntry returns sequence number of the write of the entry, it is 0 when none was stored
+func readSequenceFromEntry(data []byte) uint64 {
+	if !hasExtendedHeader(data) {
+		return 0
+	}
+	fields := data[headersSizeInBytes+1]
+	if fields&entryFieldSequence == 0 {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(data[entryFieldOffset(fields, entryFieldSequence):])
+}
+
+// writeSequenceToEntry stores sequence number in the entry, it reports false when the entry has no room for it
+func writeSequenceToEntry(data []byte, sequence uint64) bool {
+	if !hasExtendedHeader(data) {
+		return false
+	}
+	fields := data[headersSizeInBytes+1]
+	if fields&entryFieldSequence == 0 {
+		return false
+	}
+	binary.LittleEndian.PutUint64(data[entryFieldOffset(fields, entryFieldSequence):], sequence)
+	return true
+}
+
+// hasKeyInEntry returns false for entries with extensible header which were stored without key
+func hasKeyInEntry(data []byte) bool {
+	return !hasExtendedHeader(data) || data[headersSizeInBytes+1]&entryFieldKey != 0
+}
+
+// isValidEntry checks whether headers and the key of wrapped entry fit into it and its checksum matches
+func isValidEntry(data []byte) bool {
+	if len(data) < headersSizeInBytes {
+		return false
+	}
+	if !hasExtendedHeader(data) {
+		return headersSizeInBytes+int(binary.LittleEndian.Uint16(data[timestampSizeInBytes+hashSizeInBytes:])) <= len(data)
+	}
+	if len(data) < headersSizeInBytes+extendedHeaderSizeInBytes || data[headersSizeInBytes] != extendedHeaderVersion {
+		return false
+	}
+	fields := data[headersSizeInBytes+1]
+	fieldsEnd := headersSizeInBytes + extendedHeaderSizeInBytes + entryFieldsSize(fields)
+	if fieldsEnd > len(data) {
+		return false
+	}
+	if hasContentType(data, fields) && (fieldsEnd >= len(data) || fieldsEnd+1+int(data[fieldsEnd]) > len(data)) {
+		return false
+	}
+	offset, length := readKeyBoundsFromEntry(data)
+	return offset+length <= len(data) && isValidEntryChecksum(data)
+}
+
+// isValidEntryChecksum verifies checksum of key and entry, entries without checksum are always valid
+func isValidEntryChecksum(data []byte) bool {
+	if !hasExtendedHeader(data) {
+		return true
+	}
+	fields := data[headersSizeInBytes+1]
+	if fields&entryFieldChecksum == 0 {
+		return true
+	}
+	offset, _ := readKeyBoundsFromEntry(data)
+	checksum := binary.LittleEndian.Uint32(data[entryFieldOffset(fields, entryFieldChecksum):])
+	return checksum == crc32.Checksum(data[offset:], checksumTable)
+}
+
+// updateEntryChecksum recomputes checksum of key and entry if the entry has one
+func updateEntryChecksum(data []byte) {
+	if !hasExtendedHeader(data) {
+		return
+	}
+	fields := data[headersSizeInBytes+1]
+	if fields&entryFieldChecksum == 0 {
+		return
+	}
+	offset, _ := readKeyBoundsFromEntry(data)
+	binary.LittleEndian.PutUint32(data[entryFieldOffset(fields, entryFieldChecksum):], crc32.Checksum(data[offset:], checksumTable))
+}
+
+// readDigestFromEntry returns xxh3 of the value stored in the entry, it reports false when none was stored
+func readDigestFromEntry(data []byte) (uint64, bool) {
+	if !hasExtendedHeader(data) {
+		return 0, false
+	}
+	fields := data[headersSizeInBytes+1]
+	if fields&entryFieldDigest == 0 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(data[entryFieldOffset(fields, entryFieldDigest):]), true
+}
+
+// updateEntryDigest recomputes xxh3 of the value if the entry has room for it
+func updateEntryDigest(data []byte) {
+	if !hasExtendedHeader(data) {
+		return
+	}
+	fields := data[headersSizeInBytes+1]
+	if fields&entryFieldDigest == 0 {
+		return
+	}
+	binary.LittleEndian.PutUint64(data[entryFieldOffset(fields, entryFieldDigest):], xxh3(readEntryWithoutCopy(data)))
+}
+
 func readEntry(data []byte) []byte {
-	length := binary.LittleEndian.Uint16(data[timestampSizeInBytes+hashSizeInBytes:])
+	offset, length := readKeyBoundsFromEntry(data)
 
 	// copy on read
-	dst := make([]byte, len(data)-int(headersSizeInBytes+length))
-	copy(dst, data[headersSizeInBytes+length:])
+	dst := make([]byte, len(data)-(offset+length))
+	copy(dst, data[offset+length:])
 
 	return dst
 }
 
+// readEntryWithoutCopy returns entry referencing wrapped entry memory, capacity is limited so append will not overwrite it
+func readEntryWithoutCopy(data []byte) []byte {
+	offset, length := readKeyBoundsFromEntry(data)
+	return data[offset+length : len(data) : len(data)]
+}
+
 func readTimestampFromEntry(data []byte) uint64 {
 	return binary.LittleEndian.Uint64(data)
 }
 
+func writeTimestampToEntry(data []byte, timestamp uint64) {
+	binary.LittleEndian.PutUint64(data, timestamp)
+}
+
 func readKeyFromEntry(data []byte) string {
-	length := binary.LittleEndian.Uint16(data[timestampSizeInBytes+hashSizeInBytes:])
+	offset, length := readKeyBoundsFromEntry(data)
 
 	// copy on read
 	dst := make([]byte, length)
-	copy(dst, data[headersSizeInBytes:headersSizeInBytes+length])
+	copy(dst, data[offset:offset+length])
 
 	return bytesToString(dst)
 }
 
+// compareKeyFromEntry reports whether the entry is stored under the key, entries stored without key always match
 func compareKeyFromEntry(data []byte, key string) bool {
-	length := binary.LittleEndian.Uint16(data[timestampSizeInBytes+hashSizeInBytes:])
+	if !hasKeyInEntry(data) {
+		return true
+	}
+	offset, length := readKeyBoundsFromEntry(data)
 
-	return bytesToString(data[headersSizeInBytes:headersSizeInBytes+length]) == key
+	return bytesToString(data[offset:offset+length]) == key
 }
 
 func readHashFromEntry(data []byte) uint64 {
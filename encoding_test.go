@@ -42,3 +42,109 @@ func TestAllocateBiggerBuffer(t *testing.T) {
 	assertEqual(t, data, readEntry(wrapped))
 	assertEqual(t, 2+headersSizeInBytes, len(buffer))
 }
+
+func TestEncodeDecodeWithExtendedHeader(t *testing.T) {
+	// given
+	now := uint64(time.Now().Unix())
+	hash := uint64(42)
+	key := "key"
+	data := []byte("data")
+	buffer := make([]byte, 10)
+
+	// when
+	wrapped := wrapEntryWithFields(now, hash, key, data, entryFieldKey|entryFieldChecksum, &buffer)
+
+	// then
+	assertEqual(t, headersSizeInBytes+extendedHeaderSizeInBytes+2+4+len(key)+len(data), len(wrapped))
+	assertEqual(t, key, readKeyFromEntry(wrapped))
+	assertEqual(t, hash, readHashFromEntry(wrapped))
+	assertEqual(t, now, readTimestampFromEntry(wrapped))
+	assertEqual(t, data, readEntry(wrapped))
+	assertEqual(t, true, compareKeyFromEntry(wrapped, key))
+	assertEqual(t, false, compareKeyFromEntry(wrapped, "other"))
+	assertEqual(t, true, isValidEntry(wrapped))
+
+	// when
+	appended := appendToWrappedEntry(now+1, wrapped, []byte("more"), &buffer)
+
+	// then
+	assertEqual(t, []byte("datamore"), readEntry(appended))
+	assertEqual(t, now+1, readTimestampFromEntry(appended))
+	assertEqual(t, true, isValidEntryChecksum(appended))
+
+	// when
+	appended[len(appended)-1] = 'x'
+
+	// then
+	assertEqual(t, false, isValidEntryChecksum(appended))
+	assertEqual(t, false, isValidEntry(appended))
+}
+
+func TestEncodeDecodeWithoutKey(t *testing.T) {
+	// given
+	buffer := make([]byte, 100)
+
+	// when
+	wrapped := wrapEntryWithFields(1, 42, "key", []byte("data"), entryFieldTTL, &buffer)
+
+	// then
+	assertEqual(t, "", readKeyFromEntry(wrapped))
+	assertEqual(t, []byte("data"), readEntry(wrapped))
+	assertEqual(t, false, hasKeyInEntry(wrapped))
+	assertEqual(t, true, compareKeyFromEntry(wrapped, "any"))
+	assertEqual(t, true, isValidEntry(wrapped))
+}
+
+func TestEncodeDecodeWithContentType(t *testing.T) {
+	// given
+	buffer := make([]byte, 100)
+
+	// when
+	wrapped := wrapEntryWithContentType(1, 42, "key", []byte("data"), entryFieldKey|entryFieldChecksum, "application/json", &buffer)
+
+	// then
+	assertEqual(t, "key", readKeyFromEntry(wrapped))
+	assertEqual(t, []byte("data"), readEntry(wrapped))
+	assertEqual(t, "application/json", readContentTypeFromEntry(wrapped))
+	assertEqual(t, true, isValidEntry(wrapped))
+	assertEqual(t, false, isValidEntry(wrapped[:headersSizeInBytes+extendedHeaderSizeInBytes+entryFieldsSize(wrapped[headersSizeInBytes+1])+4]))
+	assertEqual(t, "", readContentTypeFromEntry(wrapEntryWithFields(1, 42, "key", []byte("data"), entryFieldKey, &buffer)))
+}
+
+func TestEncodeDecodeWithValueVersion(t *testing.T) {
+	// given
+	buffer := make([]byte, 100)
+
+	// when
+	wrapped := wrapEntryWithFlags(1, 42, "key", []byte("data"), entryFieldKey|entryFieldChecksum, "text/plain", 7, &buffer)
+
+	// then
+	assertEqual(t, uint8(7), readValueVersionFromEntry(wrapped))
+	assertEqual(t, "text/plain", readContentTypeFromEntry(wrapped))
+	assertEqual(t, []byte("data"), readEntry(wrapped))
+	assertEqual(t, true, isValidEntry(wrapped))
+	assertEqual(t, uint8(0), readValueVersionFromEntry(wrapEntryWithContentType(1, 42, "key", []byte("data"), entryFieldKey, "text/plain", &buffer)))
+	assertEqual(t, uint8(0), readValueVersionFromEntry(wrapEntry(1, 42, "key", []byte("data"), &buffer)))
+}
+
+func TestEncodeDecodeWithSequence(t *testing.T) {
+	// given
+	buffer := make([]byte, 10)
+	wrapped := wrapEntryWithFields(1, 42, "key", []byte("data"), entryFieldKey|entryFieldSequence|entryFieldChecksum, &buffer)
+
+	// when
+	written := writeSequenceToEntry(wrapped, 7)
+
+	// then
+	assertEqual(t, true, written)
+	assertEqual(t, uint64(7), readSequenceFromEntry(wrapped))
+	assertEqual(t, []byte("data"), readEntry(wrapped))
+	assertEqual(t, true, isValidEntry(wrapped))
+
+	// when
+	plain := wrapEntry(1, 42, "key", []byte("data"), &buffer)
+
+	// then
+	assertEqual(t, false, writeSequenceToEntry(plain, 7))
+	assertEqual(t, uint64(0), readSequenceFromEntry(plain))
+}
@@ -5,4 +5,41 @@ import "errors"
 var (
 	// ErrEntryNotFound is an error type struct which is returned when entry was not found for provided key
 	ErrEntryNotFound = errors.New("Entry not found")
+	// ErrUnsafeGetDisabled is returned by GetUnsafe when Config.UnsafeGetEnabled is not set
+	ErrUnsafeGetDisabled = errors.New("unsafe get is disabled")
+	// ErrEntryDeleted is returned when the entry was removed with SoftDelete and its tombstone did not expire yet
+	ErrEntryDeleted = errors.New("entry is deleted")
+	// ErrEntryCorrupted is returned when checksum of the entry does not match its content
+	ErrEntryCorrupted = errors.New("entry is corrupted")
+	// ErrEntryExceedsShardCapacity is returned when the entry is bigger than a shard can ever hold,
+	// it is detected before any entry is evicted to make room for it
+	ErrEntryExceedsShardCapacity = errors.New("entry exceeds shard capacity")
+	// ErrKeyTooLong is returned by writes of keys longer than Config.MaxKeyLength after normalization,
+	// or of keys of 65535 bytes or more regardless of it
+	ErrKeyTooLong = errors.New("key is longer than MaxKeyLength")
+	// ErrInvalidRange is returned by GetRange when the range is negative or starts beyond the end of the entry
+	ErrInvalidRange = errors.New("invalid range")
+	// ErrContentTypeTooLong is returned by SetWithOptions when the content type is longer than 255 bytes
+	ErrContentTypeTooLong = errors.New("content type is longer than 255 bytes")
+	// ErrTTLExceedsLifeWindow is returned by Expire when the ttl is longer than Config.LifeWindow,
+	// entries are evicted in write order so none can outlive the entries written after it
+	ErrTTLExceedsLifeWindow = errors.New("ttl exceeds LifeWindow")
+	// ErrInvalidCacheSize is returned by SetHardMaxCacheSize when the size is negative
+	ErrInvalidCacheSize = errors.New("cache size must be >= 0")
+	// ErrCacheSizeTooBig is returned by SetHardMaxCacheSize when the size exceeds the limit of the platform,
+	// which is 2047 MB on 32-bit platforms
+	ErrCacheSizeTooBig = errors.New("cache size exceeds the limit of this platform")
+	// ErrShardFull is returned by writes to a full shard when Config.OnFullPolicy is RejectWrite
+	ErrShardFull = errors.New("shard is full")
+	// ErrWriteShed is returned by low priority writes dropped under overload, see Config.SetBudget
+	ErrWriteShed = errors.New("write was shed under overload")
+	// ErrLockTimeout is returned by Get and Set when the lock of the shard was not acquired within Config.LockTimeout
+	ErrLockTimeout = errors.New("shard lock timeout")
+	// ErrPrefetchDisabled is returned by Prefetch when Config.Loader is not set
+	ErrPrefetchDisabled = errors.New("prefetch requires Config.Loader")
+	// ErrReadOnly is returned by writes to a cache made read-only by Drain or SetReadOnly
+	ErrReadOnly = errors.New("cache is read-only")
+	// ErrInternalCorruption is returned when internal structures of a shard were found corrupted with Config.RecoverPanics,
+	// the shard is reset then
+	ErrInternalCorruption = errors.New("internal corruption, shard was reset")
 )
@@ -0,0 +1,123 @@
+package bigcache
+
+import (
+	"sync"
+	"time"
+)
+
+// ExpiryEvent notifies about an entry removed because it expired, returned by ExpiryEvents
+type ExpiryEvent struct {
+	// ID increases with every event, AckExpiryEvents acknowledges events up to it
+	ID uint64
+	// Key and Value of the expired entry
+	Key   string
+	Value []byte
+	// Timestamp the entry was written at in units of Config.TimestampPrecision
+	Timestamp uint64
+}
+
+// expiryBuffer stages expiry events in a bounded ring until they are acknowledged. Events delivered
+// and not acknowledged within ackTimeout are delivered again, so none is lost when a consumer fails.
+type expiryBuffer struct {
+	lock   sync.Mutex
+	events []ExpiryEvent
+	// start is the index of the oldest staged event, count the number of staged events
+	// and delivered the number of them returned to the consumer and not acknowledged yet
+	start     int
+	count     int
+	delivered int
+	// deliveredAt is the time of the oldest outstanding delivery, or the last acknowledgement after it
+	deliveredAt time.Time
+	nextID      uint64
+	overflows   int64
+	ackTimeout  time.Duration
+	now         func() time.Time
+}
+
+func newExpiryBuffer(size int, ackTimeout time.Duration) *expiryBuffer {
+	return &expiryBuffer{events: make([]ExpiryEvent, size), nextID: 1, ackTimeout: ackTimeout, now: time.Now}
+}
+
+// stage adds event of the expired entry, it is dropped and counted as an overflow when the buffer is full
+func (b *expiryBuffer) stage(wrappedEntry []byte) {
+	b.lock.Lock()
+	if b.count == len(b.events) {
+		b.overflows++
+		b.lock.Unlock()
+		return
+	}
+	b.events[(b.start+b.count)%len(b.events)] = ExpiryEvent{
+		ID:        b.nextID,
+		Key:       readKeyFromEntry(wrappedEntry),
+		Value:     readEntry(wrappedEntry),
+		Timestamp: readTimestampFromEntry(wrappedEntry),
+	}
+	b.nextID++
+	b.count++
+	b.lock.Unlock()
+}
+
+// poll returns at most max events which were not delivered yet, or were not acknowledged in time
+func (b *expiryBuffer) poll(max int) []ExpiryEvent {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := b.now()
+	if b.delivered > 0 && now.Sub(b.deliveredAt) >= b.ackTimeout {
+		b.delivered = 0
+	}
+	n := b.count - b.delivered
+	if max < n {
+		n = max
+	}
+	if n <= 0 {
+		return nil
+	}
+	events := make([]ExpiryEvent, n)
+	for i := range events {
+		events[i] = b.events[(b.start+b.delivered+i)%len(b.events)]
+	}
+	if b.delivered == 0 {
+		b.deliveredAt = now
+	}
+	b.delivered += n
+	return events
+}
+
+// ack removes staged events up to the id
+func (b *expiryBuffer) ack(id uint64) {
+	b.lock.Lock()
+	for b.count > 0 && b.events[b.start].ID <= id {
+		b.events[b.start] = ExpiryEvent{}
+		b.start = (b.start + 1) % len(b.events)
+		b.count--
+		if b.delivered > 0 {
+			b.delivered--
+		}
+	}
+	// the consumer is alive, outstanding deliveries get the full timeout again
+	b.deliveredAt = b.now()
+	b.lock.Unlock()
+}
+
+func (b *expiryBuffer) overflowed() int64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.overflows
+}
+
+// ExpiryEvents returns at most max events of expired entries, oldest first, which were not returned before.
+// Events not acknowledged with AckExpiryEvents within Config.ExpiryAckTimeout are returned again,
+// so every event is delivered at least once. It returns nil unless Config.ExpiryBufferSize is set.
+func (c *BigCache) ExpiryEvents(max int) []ExpiryEvent {
+	if c.expiries == nil {
+		return nil
+	}
+	return c.expiries.poll(max)
+}
+
+// AckExpiryEvents acknowledges events up to the id, which frees their space in the buffer
+func (c *BigCache) AckExpiryEvents(id uint64) {
+	if c.expiries != nil {
+		c.expiries.ack(id)
+	}
+}
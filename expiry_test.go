@@ -0,0 +1,112 @@
+package bigcache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExpiryEvents(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		ExpiryBufferSize:   10,
+	}, &clock)
+	cache.Set("key1", []byte("value1"))
+	cache.Set("key2", []byte("value2"))
+	cache.Delete("key2")
+
+	// when
+	cache.cleanUp(5)
+	events := cache.ExpiryEvents(10)
+
+	// then
+	assertEqual(t, []ExpiryEvent{{ID: 1, Key: "key1", Value: []byte("value1"), Timestamp: 0}}, events)
+	assertEqual(t, 0, len(cache.ExpiryEvents(10)))
+
+	// when
+	cache.AckExpiryEvents(1)
+
+	// then
+	assertEqual(t, 0, cache.expiries.count)
+}
+
+func TestExpiryEventsRedelivery(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		ExpiryBufferSize:   10,
+		ExpiryAckTimeout:   time.Minute,
+	}, &clock)
+	now := time.Unix(0, 0)
+	cache.expiries.now = func() time.Time { return now }
+	for i := 0; i < 3; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+	cache.cleanUp(5)
+
+	// when
+	first := cache.ExpiryEvents(2)
+	cache.AckExpiryEvents(first[0].ID)
+	now = now.Add(2 * time.Minute)
+	redelivered := cache.ExpiryEvents(10)
+
+	// then
+	assertEqual(t, 2, len(first))
+	assertEqual(t, 2, len(redelivered))
+	assertEqual(t, "key1", redelivered[0].Key)
+	assertEqual(t, "key2", redelivered[1].Key)
+}
+
+func TestExpiryEventsOverflow(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		ExpiryBufferSize:   2,
+	}, &clock)
+	for i := 0; i < 5; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+
+	// when
+	cache.cleanUp(5)
+
+	// then
+	assertEqual(t, int64(3), cache.Stats().ExpiryOverflows)
+	events := cache.ExpiryEvents(10)
+	assertEqual(t, 2, len(events))
+	assertEqual(t, "key0", events[0].Key)
+}
+
+func TestExpiryEventsDisabled(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Second))
+	defer cache.Close()
+
+	// when
+	cache.AckExpiryEvents(1)
+
+	// then
+	assertEqual(t, 0, len(cache.ExpiryEvents(10)))
+}
@@ -0,0 +1,110 @@
+//go:build !bigcache_noexport
+// +build !bigcache_noexport
+
+package bigcache
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ExportFormat is a text format entries are exported in by Export
+type ExportFormat int
+
+const (
+	// ExportCSV writes a header row and a row of key, size, timestamp, ttl and value per entry
+	ExportCSV = ExportFormat(1)
+	// ExportJSONLines writes a JSON object per line with fields key, size, timestamp, ttl and value
+	ExportJSONLines = ExportFormat(2)
+)
+
+// ErrInvalidExportFormat is returned by Export when the format is not supported
+var ErrInvalidExportFormat = errors.New("export format is not supported")
+
+// ExportOptions decide what Export writes about every entry
+type ExportOptions struct {
+	// WithValues includes values of entries encoded with base64, they are left empty otherwise
+	WithValues bool
+}
+
+// exportRecord describes an entry written by Export. Timestamp is the time the entry was written at
+// in RFC 3339 format and TTL its remaining lifetime in seconds, 0 for expired entries.
+type exportRecord struct {
+	Key       string  `json:"key"`
+	Size      int     `json:"size"`
+	Timestamp string  `json:"timestamp"`
+	TTL       float64 `json:"ttl"`
+	Value     string  `json:"value,omitempty"`
+}
+
+var exportColumns = []string{"key", "size", "timestamp", "ttl", "value"}
+
+// Export writes keys, value sizes, timestamps and remaining lifetimes of all entries to w, for offline analysis
+// of what the cache holds, e.g. in a spreadsheet or a data warehouse. Entries are copied one by one like with
+// Iterator, so shards are not locked while w is written. It returns ErrInvalidExportFormat for unknown formats.
+func (c *BigCache) Export(w io.Writer, format ExportFormat, options ExportOptions) error {
+	var write func(record exportRecord) error
+	var flush func() error
+	switch format {
+	case ExportCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(exportColumns); err != nil {
+			return err
+		}
+		write = func(record exportRecord) error {
+			return writer.Write([]string{
+				record.Key,
+				strconv.Itoa(record.Size),
+				record.Timestamp,
+				strconv.FormatFloat(record.TTL, 'f', -1, 64),
+				record.Value,
+			})
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	case ExportJSONLines:
+		encoder := json.NewEncoder(w)
+		write = func(record exportRecord) error {
+			return encoder.Encode(record)
+		}
+		flush = func() error { return nil }
+	default:
+		return ErrInvalidExportFormat
+	}
+
+	unit := c.currentConfig().timestampUnit()
+	iterator := c.Iterator()
+	for iterator.SetNext() {
+		info, err := iterator.Value()
+		if err != nil {
+			continue
+		}
+		if err := write(c.exportRecord(info, unit, options)); err != nil {
+			return err
+		}
+	}
+	return flush()
+}
+
+func (c *BigCache) exportRecord(info EntryInfo, unit time.Duration, options ExportOptions) exportRecord {
+	record := exportRecord{
+		Key:       info.Key(),
+		Size:      len(info.Value()),
+		Timestamp: time.Unix(0, int64(info.Timestamp())*int64(unit)).UTC().Format(time.RFC3339Nano),
+	}
+	if expiresAt, now := info.Timestamp()+atomic.LoadUint64(&c.lifeWindow), uint64(c.clock.Epoch()); expiresAt > now {
+		record.TTL = (time.Duration(expiresAt-now) * unit).Seconds()
+	}
+	if options.WithValues {
+		record.Value = base64.StdEncoding.EncodeToString(info.Value())
+	}
+	return record
+}
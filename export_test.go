@@ -0,0 +1,102 @@
+//go:build !bigcache_noexport
+// +build !bigcache_noexport
+
+package bigcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportCSV(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 1000}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}, &clock)
+	cache.Set("key", []byte("value"))
+	clock.set(1010)
+	var buf bytes.Buffer
+
+	// when
+	err := cache.Export(&buf, ExportCSV, ExportOptions{WithValues: true})
+
+	// then
+	noError(t, err)
+	assertEqual(t, "key,size,timestamp,ttl,value\nkey,5,1970-01-01T00:16:40Z,50,dmFsdWU=\n", buf.String())
+}
+
+func TestExportJSONLines(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 1000}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}, &clock)
+	cache.Set("key1", []byte("value"))
+	cache.Set("key2", []byte("other value"))
+	clock.set(1100)
+	var buf bytes.Buffer
+
+	// when
+	err := cache.Export(&buf, ExportJSONLines, ExportOptions{})
+
+	// then
+	noError(t, err)
+	sizes := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record exportRecord
+		noError(t, json.Unmarshal([]byte(line), &record))
+		assertEqual(t, 0.0, record.TTL)
+		assertEqual(t, "", record.Value)
+		sizes[record.Key] = record.Size
+	}
+	assertEqual(t, map[string]int{"key1": 5, "key2": 11}, sizes)
+}
+
+func TestExportInvalidFormat(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+
+	// when
+	err := cache.Export(&bytes.Buffer{}, ExportFormat(0), ExportOptions{})
+
+	// then
+	assertEqual(t, ErrInvalidExportFormat, err)
+}
+
+func TestExportListsKeysOfKeyLessEntries(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache := newKeyLessCache(t, true)
+	cache.Set("a", []byte("1"))
+	cache.Set("b", []byte("2"))
+	cache.Set("c", []byte("3"))
+	cache.Delete("b")
+
+	// when
+	var export bytes.Buffer
+	noError(t, cache.Export(&export, ExportJSONLines, ExportOptions{}))
+
+	// then
+	assertEqual(t, true, strings.Contains(export.String(), `"key":"a"`))
+	assertEqual(t, false, strings.Contains(export.String(), `"key":"b"`))
+	assertEqual(t, true, strings.Contains(export.String(), `"key":"c"`))
+}
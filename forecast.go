@@ -0,0 +1,93 @@
+package bigcache
+
+import "time"
+
+// ExpiryForecastBuckets are horizons of Stats.ExpiringEntries and Stats.ExpiringBytes,
+// every bucket counts entries expiring within its horizon from now, so buckets include the shorter ones
+var ExpiryForecastBuckets = [...]time.Duration{time.Minute, 5 * time.Minute, time.Hour}
+
+// expiryForecastSlot is the span of write timestamps whose entries are counted together by expiryForecast
+const expiryForecastSlot = time.Minute
+
+// forecastSlot counts live entries written within a slot and their bytes
+type forecastSlot struct {
+	entries int64
+	bytes   int64
+}
+
+// expiryForecast counts live entries of a shard and their bytes by the minute they were written in, so entries
+// expiring soon can be estimated without scanning the queue. It keeps a slot per minute of LifeWindow and is
+// guarded by the shard lock.
+type expiryForecast struct {
+	// width is the span of a slot in timestamp units
+	width uint64
+	slots map[uint64]forecastSlot
+}
+
+func newExpiryForecast(timestampUnit time.Duration) *expiryForecast {
+	return &expiryForecast{
+		width: uint64(max(int(expiryForecastSlot/timestampUnit), 1)),
+		slots: make(map[uint64]forecastSlot),
+	}
+}
+
+// add counts the entry written at the timestamp, remove uncounts it
+func (f *expiryForecast) add(timestamp uint64, size int) {
+	slot := f.slots[timestamp/f.width]
+	slot.entries++
+	slot.bytes += int64(size)
+	f.slots[timestamp/f.width] = slot
+}
+
+func (f *expiryForecast) remove(timestamp uint64, size int) {
+	key := timestamp / f.width
+	slot := f.slots[key]
+	slot.entries--
+	slot.bytes -= int64(size)
+	if slot.entries <= 0 {
+		delete(f.slots, key)
+	} else {
+		f.slots[key] = slot
+	}
+}
+
+func (f *expiryForecast) reset() {
+	f.slots = make(map[uint64]forecastSlot)
+}
+
+// estimate adds entries and bytes expiring within every bucket to the counters. Entries are assumed to be spread
+// evenly within their slot, expired entries which were not removed yet are counted as expiring.
+func (f *expiryForecast) estimate(currentTimestamp, lifeWindow uint64, timestampUnit time.Duration,
+	entries, bytes *[len(ExpiryForecastBuckets)]int64) {
+	width := float64(f.width)
+	for key, slot := range f.slots {
+		// entries of the slot expire between expiresFrom and expiresFrom + width
+		expiresFrom := float64(key*f.width + lifeWindow)
+		for i, bucket := range ExpiryForecastBuckets {
+			deadline := float64(currentTimestamp) + float64(bucket/timestampUnit)
+			covered := (deadline - expiresFrom) / width
+			if covered <= 0 {
+				continue
+			}
+			if covered > 1 {
+				covered = 1
+			}
+			entries[i] += int64(covered * float64(slot.entries))
+			bytes[i] += int64(covered * float64(slot.bytes))
+		}
+	}
+}
+
+// forecastExpiries adds estimates of entries of the shard expiring within ExpiryForecastBuckets to the counters
+func (s *cacheShard) forecastExpiries(entries, bytes *[len(ExpiryForecastBuckets)]int64) {
+	if s.forecast == nil {
+		return
+	}
+	currentTimestamp := uint64(s.clock.Epoch())
+	s.lock.RLock()
+	// entries never expire without LifeWindow
+	if s.lifeWindow > 0 {
+		s.forecast.estimate(currentTimestamp, s.lifeWindow, s.timestampUnit, entries, bytes)
+	}
+	s.lock.RUnlock()
+}
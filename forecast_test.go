@@ -0,0 +1,72 @@
+package bigcache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExpiryForecast(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 30}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         10 * time.Minute,
+		MaxEntriesInWindow: 100,
+		MaxEntrySize:       256,
+		ExpiryForecast:     true,
+	}, &clock)
+	for i := 0; i < 10; i++ {
+		cache.Set(fmt.Sprintf("early%d", i), []byte("value"))
+	}
+	clock.set(330)
+	for i := 0; i < 5; i++ {
+		cache.Set(fmt.Sprintf("late%d", i), []byte("value"))
+	}
+
+	// when
+	clock.set(600)
+	stats := cache.Stats()
+
+	// then
+	assertEqual(t, [3]int64{10, 10, 15}, stats.ExpiringEntries)
+	liveBytes := 0
+	for _, shard := range cache.shards {
+		liveBytes += shard.liveBytes
+	}
+	assertEqual(t, int64(liveBytes), stats.ExpiringBytes[2])
+
+	// when
+	cache.Delete("early0")
+	cache.Expire("early1", 8*time.Minute)
+	cache.Set("late0", []byte("value"))
+	stats = cache.Stats()
+
+	// then
+	assertEqual(t, [3]int64{8, 8, 14}, stats.ExpiringEntries)
+	assertEqual(t, stats.ExpiringEntries, stats.Sub(Stats{ExpiringEntries: [3]int64{1, 1, 1}}).ExpiringEntries)
+
+	// when
+	cache.Reset()
+
+	// then
+	assertEqual(t, [3]int64{0, 0, 0}, cache.Stats().ExpiringEntries)
+}
+
+func TestExpiryForecastDisabled(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Second))
+	defer cache.Close()
+	cache.Set("key", []byte("value"))
+
+	// when
+	stats := cache.Stats()
+
+	// then
+	assertEqual(t, [3]int64{0, 0, 0}, stats.ExpiringEntries)
+}
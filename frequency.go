@@ -0,0 +1,119 @@
+package bigcache
+
+import "sync"
+
+const (
+	sketchDepth        = 4  // Number of counters of a key, its frequency is the minimum of them
+	maxSketchFrequency = 15 // Counters have 4 bits
+	minimumSketchWidth = 64
+	sketchSampleFactor = 10 // Counters are halved after sketchSampleFactor times width increments
+)
+
+var sketchSeeds = [sketchDepth]uint64{0xc3a5c85c97cb3127, 0xb492b66fbe98f273, 0x9ae16a3b2f90404f, 0xcbf29ce484222325}
+
+// frequencySketch estimates how often keys were accessed recently. It is a count-min sketch with 4-bit
+// counters, two of them packed in a byte, as used by TinyLFU. All counters are halved once the number
+// of increments reaches the sample size, so frequency decays exponentially and counters never overflow.
+type frequencySketch struct {
+	lock       sync.Mutex
+	rows       [sketchDepth][]byte
+	mask       uint64
+	additions  int
+	sampleSize int
+}
+
+func newFrequencySketch(entries int) *frequencySketch {
+	f := &frequencySketch{}
+	f.allocate(entries)
+	return f
+}
+
+// sketchEntries estimates the maximum number of entries in a shard, the sketch grows if it is exceeded
+func sketchEntries(config Config) int {
+	entries := max(config.initialShardSize(), config.maximumShardEntries())
+	if maxBytes := config.maximumShardSizeInBytes(); maxBytes > 0 && config.MaxEntrySize > 0 {
+		entries = max(entries, maxBytes/config.MaxEntrySize)
+	}
+	return entries
+}
+
+// allocate sizes counters for the number of entries, it has to be called with the lock held
+func (f *frequencySketch) allocate(entries int) {
+	width := minimumSketchWidth
+	for width < entries {
+		width *= 2
+	}
+	f.mask = uint64(width - 1)
+	f.sampleSize = sketchSampleFactor * width
+	f.additions = 0
+	for i := range f.rows {
+		f.rows[i] = make([]byte, width/2)
+	}
+}
+
+// ensureCapacity grows the sketch when the number of entries exceeds the number of counters in a row,
+// so estimates stay accurate. Counted frequencies are lost then.
+func (f *frequencySketch) ensureCapacity(entries int) {
+	f.lock.Lock()
+	if uint64(entries) > f.mask+1 {
+		f.allocate(entries)
+	}
+	f.lock.Unlock()
+}
+
+// index returns position of the counter of the key in the row
+func (f *frequencySketch) index(hashedKey uint64, row int) uint64 {
+	h := (hashedKey ^ sketchSeeds[row]) * 0x9e3779b97f4a7c15
+	return (h >> 32) & f.mask
+}
+
+func (f *frequencySketch) increment(hashedKey uint64) {
+	f.lock.Lock()
+	for row := range f.rows {
+		index := f.index(hashedKey, row)
+		shift := (index & 1) * 4
+		if (f.rows[row][index/2]>>shift)&0x0f < maxSketchFrequency {
+			f.rows[row][index/2] += 1 << shift
+		}
+	}
+	f.additions++
+	if f.additions >= f.sampleSize {
+		f.decay()
+	}
+	f.lock.Unlock()
+}
+
+// estimate returns frequency of the key, at most 15
+func (f *frequencySketch) estimate(hashedKey uint64) uint8 {
+	f.lock.Lock()
+	frequency := uint8(maxSketchFrequency)
+	for row := range f.rows {
+		index := f.index(hashedKey, row)
+		if counter := (f.rows[row][index/2] >> ((index & 1) * 4)) & 0x0f; counter < frequency {
+			frequency = counter
+		}
+	}
+	f.lock.Unlock()
+	return frequency
+}
+
+// decay halves all counters, it has to be called with the lock held
+func (f *frequencySketch) decay() {
+	for _, row := range f.rows {
+		for i := range row {
+			row[i] = (row[i] >> 1) & 0x77
+		}
+	}
+	f.additions /= 2
+}
+
+func (f *frequencySketch) reset() {
+	f.lock.Lock()
+	for _, row := range f.rows {
+		for i := range row {
+			row[i] = 0
+		}
+	}
+	f.additions = 0
+	f.lock.Unlock()
+}
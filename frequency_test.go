@@ -0,0 +1,59 @@
+package bigcache
+
+import (
+	"testing"
+)
+
+func TestFrequencySketchEstimatesAccesses(t *testing.T) {
+	t.Parallel()
+
+	// given
+	sketch := newFrequencySketch(1000)
+
+	// when
+	for i := 0; i < 5; i++ {
+		sketch.increment(1)
+	}
+	for i := 0; i < 20; i++ {
+		sketch.increment(2)
+	}
+
+	// then
+	assertEqual(t, uint8(5), sketch.estimate(1))
+	assertEqual(t, uint8(maxSketchFrequency), sketch.estimate(2))
+	assertEqual(t, uint8(0), sketch.estimate(3))
+}
+
+func TestFrequencySketchDecays(t *testing.T) {
+	t.Parallel()
+
+	// given
+	sketch := newFrequencySketch(minimumSketchWidth)
+	for i := 0; i < sketch.sampleSize-1; i++ {
+		sketch.increment(1)
+	}
+	assertEqual(t, uint8(maxSketchFrequency), sketch.estimate(1))
+
+	// when
+	sketch.increment(1)
+
+	// then
+	assertEqual(t, uint8(maxSketchFrequency/2), sketch.estimate(1))
+	assertEqual(t, sketch.sampleSize/2, sketch.additions)
+}
+
+func TestFrequencySketchGrows(t *testing.T) {
+	t.Parallel()
+
+	// given
+	sketch := newFrequencySketch(10)
+	sketch.increment(1)
+
+	// when
+	sketch.ensureCapacity(minimumSketchWidth + 1)
+
+	// then
+	assertEqual(t, uint64(2*minimumSketchWidth-1), sketch.mask)
+	assertEqual(t, 2*minimumSketchWidth*sketchSampleFactor, sketch.sampleSize)
+	assertEqual(t, uint8(0), sketch.estimate(1))
+}
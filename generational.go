@@ -0,0 +1,217 @@
+package bigcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// generationLocks is the number of locks ordering promotions of keys against their deletes
+const generationLocks = 64
+
+// GenerationStats stores statistics of both generations of Generations
+type GenerationStats struct {
+	// Current and Previous are statistics of the caches holding the generations, they swap on every rotation
+	Current  Stats `json:"current"`
+	Previous Stats `json:"previous"`
+	// Rotations is a number of times the previous generation was dropped
+	Rotations int64 `json:"rotations"`
+	// Promotions is a number of entries read from the previous generation and moved to the current one
+	Promotions int64 `json:"promotions"`
+}
+
+// Generations keeps entries in two caches, the current generation and the previous one, which are rotated
+// every interval: the previous generation is dropped wholesale and the current one takes its place.
+// Writes go to the current generation, reads check the current and then the previous one, promoting hits
+// to the current generation. Entries read at least once per interval stay, the others are gone after
+// two intervals without any per-entry work, and a scan of keys read once does not outlive them.
+type Generations struct {
+	// counters are accessed atomically, they come first to be 64-bit aligned on 32-bit platforms
+	hits       int64
+	misses     int64
+	delHits    int64
+	delMisses  int64
+	rotations  int64
+	promotions int64
+	// lock guards current and previous, it is held for writing only by Rotate
+	lock     sync.RWMutex
+	current  *BigCache
+	previous *BigCache
+	hasher   Hasher
+	// keyLocks order a promotion of a key against its delete, so a deleted entry is never promoted back
+	keyLocks  [generationLocks]sync.Mutex
+	close     chan struct{}
+	closeOnce sync.Once
+}
+
+var _ Interface = (*Generations)(nil)
+
+// NewGenerations creates both generations with the config and rotates them every interval,
+// 0 disables rotations and they have to be done by Rotate
+func NewGenerations(ctx context.Context, config Config, interval time.Duration) (*Generations, error) {
+	if interval < 0 {
+		return nil, errors.New("interval must be >= 0")
+	}
+	current, err := New(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := New(ctx, config)
+	if err != nil {
+		current.Close()
+		return nil, err
+	}
+	g := &Generations{
+		current:  current,
+		previous: previous,
+		hasher:   newDefaultHasher(),
+		close:    make(chan struct{}),
+	}
+	if interval > 0 {
+		go g.rotateLoop(ctx, interval)
+	}
+	return g, nil
+}
+
+func (g *Generations) rotateLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-g.close:
+			return
+		case <-ticker.C:
+			g.Rotate()
+		}
+	}
+}
+
+// Rotate drops the previous generation and makes the current one previous. Operations wait for it to finish.
+func (g *Generations) Rotate() {
+	g.lock.Lock()
+	g.previous.Reset()
+	g.current, g.previous = g.previous, g.current
+	g.lock.Unlock()
+	atomic.AddInt64(&g.rotations, 1)
+}
+
+// Get reads entry for the key from the current generation or, promoting it, from the previous one.
+// It returns an ErrEntryNotFound when no generation has the key.
+func (g *Generations) Get(key string) ([]byte, error) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	entry, err := g.current.Get(key)
+	if err == nil {
+		atomic.AddInt64(&g.hits, 1)
+	}
+	if err != ErrEntryNotFound {
+		return entry, err
+	}
+	keyLock := &g.keyLocks[g.hasher.Sum64(key)%generationLocks]
+	keyLock.Lock()
+	defer keyLock.Unlock()
+	if entry, err = g.previous.Get(key); err != nil {
+		if err == ErrEntryNotFound {
+			atomic.AddInt64(&g.misses, 1)
+		}
+		return entry, err
+	}
+	atomic.AddInt64(&g.hits, 1)
+	// the entry is written only when no Set stored a newer one in the meantime
+	promoted := false
+	err = g.current.Update(key, func(_ []byte, found bool) ([]byte, bool, error) {
+		promoted = !found
+		return entry, !found, nil
+	})
+	if err == nil {
+		g.previous.Delete(key)
+	}
+	if err == nil && promoted {
+		atomic.AddInt64(&g.promotions, 1)
+	}
+	return entry, nil
+}
+
+// Set saves entry under the key in the current generation
+func (g *Generations) Set(key string, entry []byte) error {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	return g.current.Set(key, entry)
+}
+
+// Delete removes the key from both generations.
+// It returns an ErrEntryNotFound when no generation has the key.
+func (g *Generations) Delete(key string) error {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	keyLock := &g.keyLocks[g.hasher.Sum64(key)%generationLocks]
+	keyLock.Lock()
+	defer keyLock.Unlock()
+	currentErr := g.current.Delete(key)
+	previousErr := g.previous.Delete(key)
+	if currentErr == nil || previousErr == nil {
+		atomic.AddInt64(&g.delHits, 1)
+		return nil
+	}
+	if currentErr != ErrEntryNotFound {
+		return currentErr
+	}
+	if previousErr != ErrEntryNotFound {
+		return previousErr
+	}
+	atomic.AddInt64(&g.delMisses, 1)
+	return ErrEntryNotFound
+}
+
+// Len returns the number of entries in both generations, a key set again before it was promoted is counted twice
+func (g *Generations) Len() int {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	return g.current.Len() + g.previous.Len()
+}
+
+// Stats returns hits and misses of both generations taken together and bytes they use,
+// see GenerationStats for statistics of each of them
+func (g *Generations) Stats() Stats {
+	stats := g.GenerationStats()
+	return Stats{
+		Hits:          atomic.LoadInt64(&g.hits),
+		Misses:        atomic.LoadInt64(&g.misses),
+		DelHits:       atomic.LoadInt64(&g.delHits),
+		DelMisses:     atomic.LoadInt64(&g.delMisses),
+		Sets:          stats.Current.Sets + stats.Previous.Sets,
+		BytesWritten:  stats.Current.BytesWritten + stats.Previous.BytesWritten,
+		Evictions:     stats.Current.Evictions + stats.Previous.Evictions,
+		UsedBytes:     stats.Current.UsedBytes + stats.Previous.UsedBytes,
+		DeadBytes:     stats.Current.DeadBytes + stats.Previous.DeadBytes,
+		OverheadBytes: stats.Current.OverheadBytes + stats.Previous.OverheadBytes,
+	}
+}
+
+// GenerationStats returns statistics of each generation and counts of rotations and promotions
+func (g *Generations) GenerationStats() GenerationStats {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	return GenerationStats{
+		Current:    g.current.Stats(),
+		Previous:   g.previous.Stats(),
+		Rotations:  atomic.LoadInt64(&g.rotations),
+		Promotions: atomic.LoadInt64(&g.promotions),
+	}
+}
+
+// Close stops rotations and releases both generations
+func (g *Generations) Close() error {
+	g.closeOnce.Do(func() {
+		close(g.close)
+		g.lock.RLock()
+		g.current.Close()
+		g.previous.Close()
+		g.lock.RUnlock()
+	})
+	return nil
+}
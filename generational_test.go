@@ -0,0 +1,109 @@
+package bigcache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGenerationsPromoteReadEntriesAndDropOthers(t *testing.T) {
+	t.Parallel()
+
+	// given
+	generations, _ := NewGenerations(context.Background(), DefaultConfig(time.Minute), 0)
+	defer generations.Close()
+	generations.Set("read", []byte("1"))
+	generations.Set("unread", []byte("2"))
+
+	// when
+	generations.Rotate()
+	value, err := generations.Get("read")
+	generations.Rotate()
+
+	// then
+	noError(t, err)
+	assertEqual(t, []byte("1"), value)
+	value, err = generations.Get("read")
+	noError(t, err)
+	assertEqual(t, []byte("1"), value)
+	_, err = generations.Get("unread")
+	assertEqual(t, ErrEntryNotFound, err)
+	assertEqual(t, 1, generations.Len())
+	stats := generations.GenerationStats()
+	assertEqual(t, int64(2), stats.Rotations)
+	assertEqual(t, int64(2), stats.Promotions)
+	assertEqual(t, int64(2), generations.Stats().Hits)
+	assertEqual(t, int64(1), generations.Stats().Misses)
+}
+
+func TestGenerationsKeepNewerEntryOverPromotion(t *testing.T) {
+	t.Parallel()
+
+	// given
+	generations, _ := NewGenerations(context.Background(), DefaultConfig(time.Minute), 0)
+	defer generations.Close()
+	generations.Set("key", []byte("old"))
+	generations.Rotate()
+
+	// when
+	generations.Set("key", []byte("new"))
+	value, err := generations.Get("key")
+
+	// then
+	noError(t, err)
+	assertEqual(t, []byte("new"), value)
+	assertEqual(t, int64(0), generations.GenerationStats().Promotions)
+	generations.Rotate()
+	generations.Rotate()
+	_, err = generations.Get("key")
+	assertEqual(t, ErrEntryNotFound, err)
+}
+
+func TestGenerationsDeleteFromBothGenerations(t *testing.T) {
+	t.Parallel()
+
+	// given
+	generations, _ := NewGenerations(context.Background(), DefaultConfig(time.Minute), 0)
+	defer generations.Close()
+	generations.Set("key", []byte("old"))
+	generations.Rotate()
+	generations.Set("key", []byte("new"))
+
+	// when
+	err := generations.Delete("key")
+
+	// then
+	noError(t, err)
+	_, err = generations.Get("key")
+	assertEqual(t, ErrEntryNotFound, err)
+	assertEqual(t, ErrEntryNotFound, generations.Delete("key"))
+	assertEqual(t, 0, generations.Len())
+}
+
+func TestGenerationsRotateEveryInterval(t *testing.T) {
+	t.Parallel()
+
+	// given
+	generations, _ := NewGenerations(context.Background(), DefaultConfig(time.Minute), 10*time.Millisecond)
+	defer generations.Close()
+
+	// when
+	generations.Set("key", []byte("value"))
+
+	// then
+	waitFor(t, func() bool {
+		return generations.GenerationStats().Rotations >= 2
+	})
+	_, err := generations.Get("key")
+	assertEqual(t, ErrEntryNotFound, err)
+}
+
+func TestGenerationsValidation(t *testing.T) {
+	t.Parallel()
+
+	// when
+	_, err := NewGenerations(context.Background(), DefaultConfig(time.Minute), -time.Second)
+
+	// then
+	assertEqual(t, "interval must be >= 0", err.Error())
+}
@@ -0,0 +1,164 @@
+// Package groupcache lets BigCache nodes take part in a groupcache deployment. PeerHandler serves
+// the groupcache HTTP peer protocol from BigCache and PeerGetter fetches values from groupcache peers.
+package groupcache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+// DefaultBasePath is the path groupcache peers serve their values at
+const DefaultBasePath = "/_groupcache/"
+
+// valueTag is protocol buffers tag of value field of GetResponse message of groupcache: field 1, length delimited
+const valueTag = 1<<3 | 2
+
+// ErrInvalidResponse is returned by PeerGetter when the peer response cannot be decoded
+var ErrInvalidResponse = errors.New("invalid groupcache response")
+
+// Getter loads the value of the key in the group when it is missing in the cache, like groupcache.Getter
+type Getter func(ctx context.Context, group string, key string) ([]byte, error)
+
+// PeerHandler answers requests of groupcache peers with values stored in the cache under group/key,
+// loading missing ones with the getter
+type PeerHandler struct {
+	cache    *bigcache.BigCache
+	getter   Getter
+	basePath string
+}
+
+// NewPeerHandler returns handler of the peer protocol at DefaultBasePath
+func NewPeerHandler(cache *bigcache.BigCache, getter Getter) *PeerHandler {
+	return &PeerHandler{cache: cache, getter: getter, basePath: DefaultBasePath}
+}
+
+func (h *PeerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, h.basePath) {
+		http.Error(w, "unexpected path "+r.URL.Path, http.StatusBadRequest)
+		return
+	}
+	parts := strings.SplitN(r.URL.Path[len(h.basePath):], "/", 2)
+	if len(parts) != 2 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	group, err := url.QueryUnescape(parts[0])
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	key, err := url.QueryUnescape(parts[1])
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	value, err := h.get(r.Context(), group, key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(encodeResponse(value))
+}
+
+func (h *PeerHandler) get(ctx context.Context, group string, key string) ([]byte, error) {
+	cacheKey := group + "/" + key
+	value, err := h.cache.Get(cacheKey)
+	if err != bigcache.ErrEntryNotFound {
+		return value, err
+	}
+	if value, err = h.getter(ctx, group, key); err != nil {
+		return nil, err
+	}
+	h.cache.Set(cacheKey, value)
+	return value, nil
+}
+
+// PeerGetter fetches values from a groupcache peer, like the HTTP getter of groupcache
+type PeerGetter struct {
+	// BaseURL of the peer including the base path, e.g. http://10.0.0.1:8000/_groupcache/
+	BaseURL string
+	// Client sends the requests, http.DefaultClient when nil
+	Client *http.Client
+}
+
+// Get returns the value of the key in the group held by the peer
+func (p *PeerGetter) Get(ctx context.Context, group string, key string) ([]byte, error) {
+	request, err := http.NewRequest(http.MethodGet, p.BaseURL+url.QueryEscape(group)+"/"+url.QueryEscape(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("groupcache peer responded with status %d", response.StatusCode)
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	return decodeResponse(body)
+}
+
+// encodeResponse encodes GetResponse message with the value
+func encodeResponse(value []byte) []byte {
+	response := make([]byte, 0, 1+binary.MaxVarintLen64+len(value))
+	response = append(response, valueTag)
+	var length [binary.MaxVarintLen64]byte
+	response = append(response, length[:binary.PutUvarint(length[:], uint64(len(value)))]...)
+	return append(response, value...)
+}
+
+// decodeResponse returns value of GetResponse message, skipping other fields
+func decodeResponse(response []byte) ([]byte, error) {
+	var value []byte
+	for len(response) > 0 {
+		tag, n := binary.Uvarint(response)
+		if n <= 0 {
+			return nil, ErrInvalidResponse
+		}
+		response = response[n:]
+		switch tag & 7 {
+		case 0:
+			if _, n = binary.Uvarint(response); n <= 0 {
+				return nil, ErrInvalidResponse
+			}
+		case 1:
+			n = 8
+		case 2:
+			length, m := binary.Uvarint(response)
+			if m <= 0 || length > uint64(len(response)-m) {
+				return nil, ErrInvalidResponse
+			}
+			if tag == valueTag {
+				value = response[m : m+int(length)]
+			}
+			n = m + int(length)
+		case 5:
+			n = 4
+		default:
+			return nil, ErrInvalidResponse
+		}
+		if n > len(response) {
+			return nil, ErrInvalidResponse
+		}
+		response = response[n:]
+	}
+	return value, nil
+}
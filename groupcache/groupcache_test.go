@@ -0,0 +1,61 @@
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+func TestPeerHandlerAndGetter(t *testing.T) {
+	t.Parallel()
+	cache, _ := bigcache.New(context.Background(), bigcache.DefaultConfig(time.Minute))
+	var loads int32
+	server := httptest.NewServer(NewPeerHandler(cache, func(ctx context.Context, group string, key string) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		if key == "broken" {
+			return nil, errors.New("origin failed")
+		}
+		return []byte(group + ":" + key), nil
+	}))
+	defer server.Close()
+	peer := &PeerGetter{BaseURL: server.URL + DefaultBasePath}
+
+	for i := 0; i < 2; i++ {
+		value, err := peer.Get(context.Background(), "users", "a b/c")
+		if err != nil || string(value) != "users:a b/c" {
+			t.Errorf("want: users:a b/c; got: %q, %v", value, err)
+		}
+	}
+	if got := atomic.LoadInt32(&loads); got != 1 {
+		t.Errorf("want value loaded once; got: %d", got)
+	}
+	if cached, _ := cache.Get("users/a b/c"); string(cached) != "users:a b/c" {
+		t.Errorf("value was not cached under group/key; got: %q", cached)
+	}
+	if _, err := peer.Get(context.Background(), "users", "broken"); err == nil {
+		t.Errorf("want error of failed load")
+	}
+}
+
+func TestDecodeResponse(t *testing.T) {
+	t.Parallel()
+	// value "hi" followed by minute_qps 1.0 as encoded by groupcache
+	response := []byte{0x0a, 0x02, 'h', 'i', 0x11, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f}
+
+	value, err := decodeResponse(response)
+
+	if err != nil || string(value) != "hi" {
+		t.Errorf("want: hi; got: %q, %v", value, err)
+	}
+	if _, err := decodeResponse(response[:3]); err != ErrInvalidResponse {
+		t.Errorf("want: %v; got: %v", ErrInvalidResponse, err)
+	}
+	if value, _ := decodeResponse(encodeResponse([]byte("value"))); string(value) != "value" {
+		t.Errorf("want: value; got: %q", value)
+	}
+}
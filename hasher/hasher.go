@@ -0,0 +1,202 @@
+// Package hasher provides hashers for Config.Hasher and Race, which compares their throughput
+// and distribution of keys over shards on a sample of real keys, to choose the best one for their shapes.
+package hasher
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"hash/crc64"
+	"hash/maphash"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+// DefaultShards is the number of shards distribution is measured for by Race
+const DefaultShards = 1024
+
+// raceDuration is the minimum time every hasher hashes the keys for to measure its throughput
+const raceDuration = 50 * time.Millisecond
+
+// acceptedDispersion is how many times worse than the best distribution, or than a random one if the best is better,
+// distribution of a hasher may be to be recommended for its speed
+const acceptedDispersion = 1.5
+
+// Candidate is a named hasher compared by Race
+type Candidate struct {
+	Name   string
+	Hasher bigcache.Hasher
+}
+
+// Result is a measurement of a single hasher
+type Result struct {
+	Name string
+	// NsPerKey is the average time of hashing a key in nanoseconds
+	NsPerKey float64
+	// Collisions is the number of distinct keys hashed to the same value as another key
+	Collisions int
+	// Dispersion is the variance of numbers of keys in shards divided by their mean. It is about 1 when keys
+	// are spread like by a random function, lower when they are spread more evenly and higher for skewed shards.
+	Dispersion float64
+}
+
+// Candidates returns hashers available without dependencies: FNV-1a used by default, maphash with a random seed,
+// CRC-64 and truncated SHA-256. Hashes of maphash differ between processes.
+func Candidates() []Candidate {
+	return []Candidate{
+		{Name: "fnv64a", Hasher: FNV64a()},
+		{Name: "maphash", Hasher: MapHash()},
+		{Name: "crc64", Hasher: CRC64()},
+		{Name: "sha256", Hasher: SHA256()},
+	}
+}
+
+// Race compares Candidates on the keys for DefaultShards shards, see RaceWith
+func Race(keys []string) []Result {
+	return RaceWith(keys, DefaultShards, Candidates())
+}
+
+// RaceWith measures throughput, collisions and imbalance of shards of the candidates hashing the keys.
+// Shards must be a power of two like Config.Shards. Results are sorted from the recommended one:
+// by collisions, then hashers distributing keys about as well as the best one or a random function by speed.
+func RaceWith(keys []string, shards int, candidates []Candidate) []Result {
+	results := make([]Result, len(candidates))
+	for i, candidate := range candidates {
+		results[i] = race(keys, shards, candidate)
+	}
+	if len(results) == 0 {
+		return results
+	}
+	best := results[0].Dispersion
+	for _, result := range results {
+		if result.Dispersion < best {
+			best = result.Dispersion
+		}
+	}
+	accepted := func(r Result) bool {
+		return r.Dispersion <= math.Max(best, 1)*acceptedDispersion
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Collisions != b.Collisions {
+			return a.Collisions < b.Collisions
+		}
+		if accepted(a) != accepted(b) {
+			return accepted(a)
+		}
+		if !accepted(a) && a.Dispersion != b.Dispersion {
+			return a.Dispersion < b.Dispersion
+		}
+		return a.NsPerKey < b.NsPerKey
+	})
+	return results
+}
+
+func race(keys []string, shards int, candidate Candidate) Result {
+	result := Result{Name: candidate.Name}
+	if len(keys) == 0 {
+		return result
+	}
+
+	counts := make([]int, shards)
+	hashes := make(map[uint64]struct{}, len(keys))
+	distinct := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		if _, ok := distinct[key]; ok {
+			continue
+		}
+		distinct[key] = struct{}{}
+		hash := candidate.Hasher.Sum64(key)
+		if _, ok := hashes[hash]; ok {
+			result.Collisions++
+		}
+		hashes[hash] = struct{}{}
+		counts[hash&uint64(shards-1)]++
+	}
+	mean := float64(len(distinct)) / float64(shards)
+	variance := 0.0
+	for _, count := range counts {
+		variance += (float64(count) - mean) * (float64(count) - mean)
+	}
+	result.Dispersion = variance / float64(shards) / mean
+
+	var sink uint64
+	hashed := 0
+	start := time.Now()
+	for time.Since(start) < raceDuration {
+		for _, key := range keys {
+			sink += candidate.Hasher.Sum64(key)
+		}
+		hashed += len(keys)
+	}
+	result.NsPerKey = float64(time.Since(start).Nanoseconds()) / float64(hashed)
+	if sink == 1 {
+		// keeps hashing from being optimized away
+		result.NsPerKey++
+	}
+	return result
+}
+
+// FNV64a returns the 64-bit FNV-1a hasher used by default, it makes no memory allocations
+func FNV64a() bigcache.Hasher {
+	return fnv64a{}
+}
+
+type fnv64a struct{}
+
+const (
+	offset64 = 14695981039346656037
+	prime64  = 1099511628211
+)
+
+func (fnv64a) Sum64(key string) uint64 {
+	var hash uint64 = offset64
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= prime64
+	}
+	return hash
+}
+
+// MapHash returns a hasher based on hash/maphash with a random seed, so hashes differ between processes
+func MapHash() bigcache.Hasher {
+	return mapHash{seed: maphash.MakeSeed()}
+}
+
+type mapHash struct {
+	seed maphash.Seed
+}
+
+func (h mapHash) Sum64(key string) uint64 {
+	var hash maphash.Hash
+	hash.SetSeed(h.seed)
+	hash.WriteString(key)
+	return hash.Sum64()
+}
+
+// CRC64 returns a hasher computing CRC-64 with the ECMA polynomial
+func CRC64() bigcache.Hasher {
+	return crc64Hash{table: crc64.MakeTable(crc64.ECMA)}
+}
+
+type crc64Hash struct {
+	table *crc64.Table
+}
+
+func (h crc64Hash) Sum64(key string) uint64 {
+	return crc64.Checksum([]byte(key), h.table)
+}
+
+// SHA256 returns a hasher truncating SHA-256 to 64 bits, it is slow but distributes any keys evenly
+func SHA256() bigcache.Hasher {
+	return sha256Hash{}
+}
+
+type sha256Hash struct{}
+
+func (sha256Hash) Sum64(key string) uint64 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.LittleEndian.Uint64(sum[:])
+}
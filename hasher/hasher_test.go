@@ -0,0 +1,68 @@
+package hasher
+
+import (
+	"fmt"
+	"testing"
+)
+
+// prefixHasher hashes only the first byte of keys, so it collides and skews shards
+type prefixHasher struct{}
+
+func (prefixHasher) Sum64(key string) uint64 {
+	return uint64(key[0])
+}
+
+func keys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user:%d", i)
+	}
+	return keys
+}
+
+func TestCandidatesSpreadKeys(t *testing.T) {
+	t.Parallel()
+	for _, result := range Race(keys(10000)) {
+		if result.Collisions != 0 {
+			t.Errorf("%s: expected no collisions, got %d", result.Name, result.Collisions)
+		}
+		if result.Dispersion > 2 {
+			t.Errorf("%s: expected dispersion of at most 2, got %f", result.Name, result.Dispersion)
+		}
+		if result.NsPerKey <= 0 {
+			t.Errorf("%s: expected positive time per key, got %f", result.Name, result.NsPerKey)
+		}
+	}
+}
+
+func TestRaceRanksBadHasherLast(t *testing.T) {
+	t.Parallel()
+	candidates := []Candidate{
+		{Name: "prefix", Hasher: prefixHasher{}},
+		{Name: "fnv64a", Hasher: FNV64a()},
+		{Name: "sha256", Hasher: SHA256()},
+	}
+	results := RaceWith(keys(1000), 16, candidates)
+
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	if results[0].Name != "fnv64a" {
+		t.Errorf("expected fnv64a to be recommended, got %s", results[0].Name)
+	}
+	last := results[2]
+	if last.Name != "prefix" || last.Collisions != 999 {
+		t.Errorf("expected prefix with 999 collisions last, got %s with %d", last.Name, last.Collisions)
+	}
+}
+
+func TestRaceCountsDistinctKeys(t *testing.T) {
+	t.Parallel()
+	results := RaceWith([]string{"a", "a", "b"}, 1, []Candidate{{Name: "prefix", Hasher: prefixHasher{}}})
+	if results[0].Collisions != 0 {
+		t.Errorf("expected no collisions of repeated keys, got %d", results[0].Collisions)
+	}
+	if results := RaceWith(nil, 1, Candidates()); len(results) != len(Candidates()) {
+		t.Errorf("expected results of all candidates for no keys, got %d", len(results))
+	}
+}
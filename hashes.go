@@ -0,0 +1,100 @@
+package bigcache
+
+import "encoding/binary"
+
+// Hash fields are stored as a single entry of alternating field names and values, encoded like
+// collections. Modifications are done with Update, so they are atomic and rewrite the whole entry.
+
+// HSet sets the field of the hash stored under the key to value, creating the hash if needed
+func (c *BigCache) HSet(key string, field string, value []byte) error {
+	return c.Update(key, func(old []byte, found bool) ([]byte, bool, error) {
+		hash := make([]byte, 0, len(old)+len(field)+len(value)+2*binary.MaxVarintLen64)
+		err := iterateHashFields(old, func(name []byte, v []byte) bool {
+			if string(name) != field {
+				hash = appendCollectionItem(appendCollectionItem(hash, name), v)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		return appendCollectionItem(appendCollectionItem(hash, []byte(field)), value), true, nil
+	})
+}
+
+// HGet returns value of the field of the hash stored under the key.
+// It returns an ErrEntryNotFound when the hash or the field does not exist.
+func (c *BigCache) HGet(key string, field string) ([]byte, error) {
+	var value []byte
+	err := c.GetFn(key, func(entry []byte) error {
+		return iterateHashFields(entry, func(name []byte, v []byte) bool {
+			if string(name) == field {
+				value = append([]byte{}, v...)
+				return false
+			}
+			return true
+		})
+	})
+	if err == nil && value == nil {
+		return nil, ErrEntryNotFound
+	}
+	return value, err
+}
+
+// HDel removes the field from the hash stored under the key and reports whether it was present
+func (c *BigCache) HDel(key string, field string) (bool, error) {
+	var removed bool
+	err := c.Update(key, func(old []byte, found bool) ([]byte, bool, error) {
+		hash := make([]byte, 0, len(old))
+		err := iterateHashFields(old, func(name []byte, v []byte) bool {
+			if string(name) == field {
+				removed = true
+			} else {
+				hash = appendCollectionItem(appendCollectionItem(hash, name), v)
+			}
+			return true
+		})
+		if err != nil || !removed {
+			return nil, false, err
+		}
+		return hash, true, nil
+	})
+	return removed, err
+}
+
+// HGetAll returns all fields of the hash stored under the key, nil when the hash does not exist
+func (c *BigCache) HGetAll(key string) (map[string][]byte, error) {
+	var fields map[string][]byte
+	err := c.GetFn(key, func(entry []byte) error {
+		fields = make(map[string][]byte)
+		return iterateHashFields(entry, func(name []byte, v []byte) bool {
+			fields[string(name)] = append([]byte{}, v...)
+			return true
+		})
+	})
+	if err == ErrEntryNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// iterateHashFields calls fn for every field of encoded hash until it returns false
+func iterateHashFields(hash []byte, fn func(name []byte, value []byte) bool) error {
+	var name []byte
+	isName := true
+	err := iterateCollection(hash, func(item []byte) bool {
+		if isName {
+			name, isName = item, false
+			return true
+		}
+		isName = true
+		return fn(name, item)
+	})
+	if err == nil && !isName {
+		return ErrInvalidCollection
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package bigcache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHashFields(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(5*time.Second))
+	defer cache.Close()
+
+	// when
+	fields, err := cache.HGetAll("user")
+	_, missingErr := cache.HGet("user", "name")
+
+	// then
+	noError(t, err)
+	assertEqual(t, 0, len(fields))
+	assertEqual(t, ErrEntryNotFound, missingErr)
+
+	// when
+	cache.HSet("user", "name", []byte("John"))
+	cache.HSet("user", "email", []byte("john@example.com"))
+	cache.HSet("user", "name", []byte("Jane"))
+	cache.HSet("user", "empty", nil)
+
+	// then
+	name, err := cache.HGet("user", "name")
+	noError(t, err)
+	assertEqual(t, []byte("Jane"), name)
+	empty, err := cache.HGet("user", "empty")
+	noError(t, err)
+	assertEqual(t, []byte{}, empty)
+	fields, _ = cache.HGetAll("user")
+	assertEqual(t, map[string][]byte{"name": []byte("Jane"), "email": []byte("john@example.com"), "empty": {}}, fields)
+
+	// when
+	removed, err := cache.HDel("user", "email")
+	removedAgain, _ := cache.HDel("user", "email")
+
+	// then
+	noError(t, err)
+	assertEqual(t, true, removed)
+	assertEqual(t, false, removedAgain)
+	_, err = cache.HGet("user", "email")
+	assertEqual(t, ErrEntryNotFound, err)
+}
+
+func TestInvalidHash(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(5*time.Second))
+	defer cache.Close()
+	cache.Set("user", []byte{4, 'n', 'a', 'm', 'e'})
+
+	// when
+	_, err := cache.HGet("user", "name")
+	setErr := cache.HSet("user", "name", []byte("John"))
+
+	// then
+	assertEqual(t, ErrInvalidCollection, err)
+	assertEqual(t, ErrInvalidCollection, setErr)
+}
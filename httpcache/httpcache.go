@@ -0,0 +1,185 @@
+// Package httpcache caches full responses of HTTP handlers in BigCache.
+package httpcache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+// KeyFunc returns the cache key of the request, empty key means the request is not cached
+type KeyFunc func(r *http.Request) string
+
+// TTLFunc returns how long the response should be cached. Zero means the response is not cached
+// and a negative value means the lifetime of the cache.
+type TTLFunc func(status int, header http.Header) time.Duration
+
+// response is a cached response. A response varying on request headers is stored as an index holding
+// only names of the headers, its variants are stored under keys extended with values of the headers.
+type response struct {
+	Vary   []string
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// DefaultKey caches GET and HEAD requests by method and URL
+func DefaultKey(r *http.Request) string {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return ""
+	}
+	return r.Method + " " + r.URL.String()
+}
+
+// DefaultTTL caches successful responses without cookies for the lifetime of the cache,
+// unless Cache-Control forbids storing them
+func DefaultTTL(status int, header http.Header) time.Duration {
+	if status != http.StatusOK || header.Get("Set-Cookie") != "" {
+		return 0
+	}
+	cacheControl := strings.ToLower(header.Get("Cache-Control"))
+	if strings.Contains(cacheControl, "no-store") || strings.Contains(cacheControl, "private") {
+		return 0
+	}
+	return -1
+}
+
+// Middleware caches responses of the wrapped handler in the cache, including status and headers.
+// keyFn and ttlFn default to DefaultKey and DefaultTTL when nil. Responses with a body longer than maxSize
+// bytes are not cached, zero maxSize means no limit. Responses with Vary header are cached per values
+// of the listed request headers, Vary: * responses are not cached.
+func Middleware(cache *bigcache.BigCache, keyFn KeyFunc, ttlFn TTLFunc, maxSize int) func(http.Handler) http.Handler {
+	if keyFn == nil {
+		keyFn = DefaultKey
+	}
+	if ttlFn == nil {
+		ttlFn = DefaultTTL
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := keyFn(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if cached, ok := lookup(cache, key, r); ok {
+				serve(w, cached)
+				return
+			}
+			recorder := &recorder{ResponseWriter: w, status: http.StatusOK, maxSize: maxSize}
+			next.ServeHTTP(recorder, r)
+			if recorder.tooBig {
+				return
+			}
+			if ttl := ttlFn(recorder.status, w.Header()); ttl != 0 {
+				store(cache, key, r, response{Status: recorder.status, Header: w.Header().Clone(), Body: recorder.body.Bytes()}, ttl)
+			}
+		})
+	}
+}
+
+func lookup(cache *bigcache.BigCache, key string, r *http.Request) (response, bool) {
+	cached, ok := get(cache, key)
+	if ok && len(cached.Vary) > 0 {
+		cached, ok = get(cache, variantKey(key, cached.Vary, r))
+	}
+	return cached, ok
+}
+
+func store(cache *bigcache.BigCache, key string, r *http.Request, cached response, ttl time.Duration) {
+	vary := varyHeaders(cached.Header)
+	for _, name := range vary {
+		if name == "*" {
+			return
+		}
+	}
+	if len(vary) > 0 {
+		if !set(cache, key, response{Vary: vary}, ttl) {
+			return
+		}
+		key = variantKey(key, vary, r)
+	}
+	set(cache, key, cached, ttl)
+}
+
+func get(cache *bigcache.BigCache, key string) (cached response, ok bool) {
+	entry, err := cache.Get(key)
+	if err != nil {
+		return cached, false
+	}
+	return cached, gob.NewDecoder(bytes.NewReader(entry)).Decode(&cached) == nil
+}
+
+func set(cache *bigcache.BigCache, key string, cached response, ttl time.Duration) bool {
+	var buf bytes.Buffer
+	if gob.NewEncoder(&buf).Encode(cached) != nil || cache.Set(key, buf.Bytes()) != nil {
+		return false
+	}
+	if ttl > 0 {
+		// a longer ttl than the life window of the cache keeps the entry for the life window
+		err := cache.Expire(key, ttl)
+		return err == nil || err == bigcache.ErrTTLExceedsLifeWindow
+	}
+	return true
+}
+
+func serve(w http.ResponseWriter, cached response) {
+	for name, values := range cached.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(cached.Status)
+	w.Write(cached.Body)
+}
+
+// varyHeaders returns canonical names of request headers listed in Vary response header
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+func variantKey(key string, vary []string, r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, name := range vary {
+		b.WriteByte(0)
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// recorder passes the response to the client, keeping its status and a copy of its body
+type recorder struct {
+	http.ResponseWriter
+	status  int
+	body    bytes.Buffer
+	maxSize int
+	tooBig  bool
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(data []byte) (int, error) {
+	if !r.tooBig {
+		if r.maxSize > 0 && r.body.Len()+len(data) > r.maxSize {
+			r.tooBig = true
+			r.body = bytes.Buffer{}
+		} else {
+			r.body.Write(data)
+		}
+	}
+	return r.ResponseWriter.Write(data)
+}
@@ -0,0 +1,118 @@
+package httpcache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+func newCachedHandler(maxSize int) (http.Handler, *int) {
+	cache, _ := bigcache.New(context.Background(), bigcache.DefaultConfig(time.Minute))
+	calls := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/vary":
+			w.Header().Set("Vary", "Accept-Language")
+			w.Write([]byte("hello in " + r.Header.Get("Accept-Language")))
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/big":
+			w.Write([]byte(strings.Repeat("a", 100)))
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("hello"))
+		}
+	})
+	return Middleware(cache, nil, nil, maxSize)(handler), &calls
+}
+
+func request(h http.Handler, method string, path string, language string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	if language != "" {
+		r.Header.Set("Accept-Language", language)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+	return rr
+}
+
+func TestMiddlewareCachesResponses(t *testing.T) {
+	t.Parallel()
+	handler, calls := newCachedHandler(0)
+
+	first := request(handler, http.MethodGet, "/hello", "")
+	second := request(handler, http.MethodGet, "/hello", "")
+
+	if *calls != 1 {
+		t.Errorf("want 1 call of the handler; got: %d", *calls)
+	}
+	if second.Body.String() != "hello" || second.Code != http.StatusOK {
+		t.Errorf("want: 200 hello; got: %d %s", second.Code, second.Body.String())
+	}
+	if first.Header().Get("Content-Type") != "text/plain" || second.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("want text/plain content type; got: %q", second.Header().Get("Content-Type"))
+	}
+}
+
+func TestMiddlewareSkipsUncacheableResponses(t *testing.T) {
+	t.Parallel()
+	handler, calls := newCachedHandler(50)
+
+	request(handler, http.MethodPost, "/hello", "")
+	request(handler, http.MethodPost, "/hello", "")
+	request(handler, http.MethodGet, "/missing", "")
+	request(handler, http.MethodGet, "/missing", "")
+	big := request(handler, http.MethodGet, "/big", "")
+	request(handler, http.MethodGet, "/big", "")
+
+	if *calls != 6 {
+		t.Errorf("want 6 calls of the handler; got: %d", *calls)
+	}
+	if big.Body.Len() != 100 {
+		t.Errorf("want whole body of big response; got %d bytes", big.Body.Len())
+	}
+}
+
+func TestMiddlewareVary(t *testing.T) {
+	t.Parallel()
+	handler, calls := newCachedHandler(0)
+
+	request(handler, http.MethodGet, "/vary", "en")
+	request(handler, http.MethodGet, "/vary", "pl")
+	english := request(handler, http.MethodGet, "/vary", "en")
+	polish := request(handler, http.MethodGet, "/vary", "pl")
+
+	if *calls != 2 {
+		t.Errorf("want 2 calls of the handler; got: %d", *calls)
+	}
+	if english.Body.String() != "hello in en" || polish.Body.String() != "hello in pl" {
+		t.Errorf("want variants per language; got: %q and %q", english.Body.String(), polish.Body.String())
+	}
+}
+
+func TestDefaultTTL(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		status int
+		header http.Header
+		want   time.Duration
+	}{
+		{http.StatusOK, http.Header{}, -1},
+		{http.StatusNotFound, http.Header{}, 0},
+		{http.StatusOK, http.Header{"Set-Cookie": {"a=b"}}, 0},
+		{http.StatusOK, http.Header{"Cache-Control": {"private, max-age=60"}}, 0},
+		{http.StatusOK, http.Header{"Cache-Control": {"No-Store"}}, 0},
+	} {
+		if got := DefaultTTL(tc.status, tc.header); got != tc.want {
+			t.Errorf("%d %v: want: %s; got: %s", tc.status, tc.header, tc.want, got)
+		}
+	}
+}
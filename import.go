@@ -0,0 +1,251 @@
+//go:build !bigcache_noexport
+// +build !bigcache_noexport
+
+package bigcache
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ImportConflictPolicy decides what Import does with records of keys which are already cached
+type ImportConflictPolicy int
+
+const (
+	// ImportOverwrite replaces cached entries with imported ones, it is the default policy
+	ImportOverwrite = ImportConflictPolicy(0)
+	// ImportSkip keeps cached entries and skips records of their keys
+	ImportSkip = ImportConflictPolicy(1)
+)
+
+const (
+	defaultImportBatchSize        = 100
+	defaultImportProgressInterval = 10000
+)
+
+// ErrInvalidImportRecord is returned by Import when a record cannot be decoded
+var ErrInvalidImportRecord = errors.New("invalid import record")
+
+// ImportOptions configure Import
+type ImportOptions struct {
+	// OnConflict decides what happens with records of keys which are already cached. Default value is ImportOverwrite.
+	OnConflict ImportConflictPolicy
+	// BatchSize is the number of records saved to a shard under a single lock. Default value is 0 which means 100.
+	BatchSize int
+	// OnProgress is called every ProgressInterval records and once when the import ends. Default value is nil.
+	OnProgress func(progress ImportProgress)
+	// ProgressInterval is the number of records between calls of OnProgress. Default value is 0 which means 10000.
+	ProgressInterval int
+}
+
+// ImportProgress counts records processed by Import
+type ImportProgress struct {
+	// Records is a number of records read
+	Records int64
+	// Imported is a number of records saved to the cache
+	Imported int64
+	// Skipped is a number of records of cached keys skipped with ImportSkip
+	Skipped int64
+	// Expired is a number of records which were already past LifeWindow
+	Expired int64
+	// Failed is a number of records which could not be saved, e.g. because they do not fit in a shard
+	Failed int64
+	// Bytes is a number of bytes read
+	Bytes int64
+}
+
+// importEntry is a decoded record waiting in a batch of its shard
+type importEntry struct {
+	key       string
+	hashedKey uint64
+	timestamp uint64
+	value     []byte
+}
+
+// Import loads entries written by Export in the format from r. Values have to be exported with
+// ExportOptions.WithValues. Entries keep their timestamps, so they expire as if they were never exported,
+// records without timestamp are stamped with the current time. Records are saved in batches per shard,
+// which keeps the number of lock acquisitions low for multi-GB loads. It returns progress of the import
+// and ErrInvalidImportRecord when a record cannot be decoded, records read before it stay imported.
+func (c *BigCache) Import(r io.Reader, format ExportFormat, options ImportOptions) (ImportProgress, error) {
+	if err := c.writable(); err != nil {
+		return ImportProgress{}, err
+	}
+	var progress ImportProgress
+	counter := &countingReader{r: r}
+	var read func() (exportRecord, error)
+	switch format {
+	case ExportCSV:
+		read = csvRecordReader(counter)
+	case ExportJSONLines:
+		decoder := json.NewDecoder(counter)
+		read = func() (exportRecord, error) {
+			var record exportRecord
+			err := decoder.Decode(&record)
+			return record, err
+		}
+	default:
+		return progress, ErrInvalidExportFormat
+	}
+
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultImportBatchSize
+	}
+	interval := options.ProgressInterval
+	if interval <= 0 {
+		interval = defaultImportProgressInterval
+	}
+	batches := make([][]importEntry, len(c.shards))
+	flush := func(shardIndex uint64) {
+		imported, skipped, failed := c.shards[shardIndex].importBatch(batches[shardIndex], options.OnConflict == ImportSkip)
+		c.recoverShardIndex(shardIndex, nil)
+		progress.Imported += int64(imported)
+		progress.Skipped += int64(skipped)
+		progress.Failed += int64(failed)
+		batches[shardIndex] = batches[shardIndex][:0]
+	}
+	flushAll := func() {
+		for i := range batches {
+			if len(batches[i]) > 0 {
+				flush(uint64(i))
+			}
+		}
+		progress.Bytes = counter.n
+	}
+
+	var err error
+	for {
+		var record exportRecord
+		if record, err = read(); err != nil {
+			// errors of r are returned as they are, others come from decoding
+			if err != io.EOF && err != counter.err && !errors.Is(err, ErrInvalidImportRecord) {
+				err = fmt.Errorf("%w: record %d: %v", ErrInvalidImportRecord, progress.Records+1, err)
+			}
+			break
+		}
+		progress.Records++
+		var entry importEntry
+		if entry, err = c.importEntry(record); err != nil {
+			err = fmt.Errorf("%w: record %d: %v", ErrInvalidImportRecord, progress.Records, err)
+			break
+		}
+		if lifeWindow := atomic.LoadUint64(&c.lifeWindow); lifeWindow > 0 && entry.timestamp+lifeWindow < uint64(c.clock.Epoch()) {
+			progress.Expired++
+		} else {
+			shardIndex := c.shardIndex(entry.hashedKey)
+			batches[shardIndex] = append(batches[shardIndex], entry)
+			if len(batches[shardIndex]) >= batchSize {
+				flush(shardIndex)
+			}
+		}
+		if options.OnProgress != nil && progress.Records%int64(interval) == 0 {
+			flushAll()
+			options.OnProgress(progress)
+		}
+	}
+	flushAll()
+	if options.OnProgress != nil {
+		options.OnProgress(progress)
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return progress, err
+}
+
+// importEntry decodes the exported record
+func (c *BigCache) importEntry(record exportRecord) (importEntry, error) {
+	key := c.normalizeKey(record.Key)
+	if err := c.checkKeyLength(key); err != nil {
+		return importEntry{}, err
+	}
+	value, err := base64.StdEncoding.DecodeString(record.Value)
+	if err != nil {
+		return importEntry{}, err
+	}
+	timestamp := uint64(c.clock.Epoch())
+	if record.Timestamp != "" {
+		t, err := time.Parse(time.RFC3339Nano, record.Timestamp)
+		if err != nil {
+			return importEntry{}, err
+		}
+		timestamp = c.currentConfig().timestamp(t)
+	}
+	return importEntry{key: key, hashedKey: c.hash.Sum64(key), timestamp: timestamp, value: value}, nil
+}
+
+// csvRecordReader returns reader of records of CSV with a header row naming columns written by Export
+func csvRecordReader(r io.Reader) func() (exportRecord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	var columns map[string]int
+	return func() (exportRecord, error) {
+		if columns == nil {
+			header, err := reader.Read()
+			if err != nil {
+				return exportRecord{}, err
+			}
+			columns = make(map[string]int, len(header))
+			for i, name := range header {
+				columns[name] = i
+			}
+			if _, ok := columns["key"]; !ok {
+				return exportRecord{}, fmt.Errorf("%w: missing key column", ErrInvalidImportRecord)
+			}
+		}
+		row, err := reader.Read()
+		if err != nil {
+			return exportRecord{}, err
+		}
+		column := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+		return exportRecord{Key: column("key"), Timestamp: column("timestamp"), Value: column("value")}, nil
+	}
+}
+
+// countingReader counts bytes read from r and keeps the last error of r
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if err != nil {
+		r.err = err
+	}
+	return n, err
+}
+
+// importBatch saves entries of the batch under a single lock, it returns numbers of saved, skipped and failed entries
+func (s *cacheShard) importBatch(entries []importEntry, skipCached bool) (imported, skipped, failed int) {
+	currentTimestamp := uint64(s.clock.Epoch())
+	s.lock.Lock()
+	for _, entry := range entries {
+		if skipCached && s.containsWithoutLock(entry.key, entry.hashedKey) {
+			skipped++
+			continue
+		}
+		w := s.wrapEntry(entry.timestamp, entry.hashedKey, entry.key, entry.value)
+		if s.setWrappedEntryWithoutLock(currentTimestamp, w, entry.hashedKey) != nil {
+			failed++
+			continue
+		}
+		imported++
+	}
+	s.lock.Unlock()
+	return imported, skipped, failed
+}
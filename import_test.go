@@ -0,0 +1,157 @@
+//go:build !bigcache_noexport
+// +build !bigcache_noexport
+
+package bigcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportExported(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range []ExportFormat{ExportCSV, ExportJSONLines} {
+		// given
+		clock := mockedClock{value: 1000}
+		config := Config{
+			Shards:             4,
+			LifeWindow:         time.Minute,
+			MaxEntriesInWindow: 10,
+			MaxEntrySize:       256,
+		}
+		source, _ := newBigCache(context.Background(), config, &clock)
+		for i := 0; i < 100; i++ {
+			source.Set(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)))
+		}
+		var buf bytes.Buffer
+		noError(t, source.Export(&buf, format, ExportOptions{WithValues: true}))
+		cache, _ := newBigCache(context.Background(), config, &clock)
+
+		// when
+		progress, err := cache.Import(&buf, format, ImportOptions{BatchSize: 7})
+
+		// then
+		noError(t, err)
+		assertEqual(t, ImportProgress{Records: 100, Imported: 100, Bytes: progress.Bytes}, progress)
+		assertEqual(t, 100, cache.Len())
+		value, err := cache.Get("key42")
+		noError(t, err)
+		assertEqual(t, []byte("value42"), value)
+
+		// when
+		cache.cleanUp(1061)
+
+		// then
+		assertEqual(t, 0, cache.Len())
+	}
+}
+
+func TestImportConflictPolicy(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	cache.Set("key", []byte("cached"))
+	input := "key,value\nkey,aW1wb3J0ZWQ=\nother,aW1wb3J0ZWQ=\n"
+
+	// when
+	progress, err := cache.Import(strings.NewReader(input), ExportCSV, ImportOptions{OnConflict: ImportSkip})
+
+	// then
+	noError(t, err)
+	assertEqual(t, int64(1), progress.Skipped)
+	assertEqual(t, int64(1), progress.Imported)
+	value, _ := cache.Get("key")
+	assertEqual(t, []byte("cached"), value)
+
+	// when
+	_, err = cache.Import(strings.NewReader(input), ExportCSV, ImportOptions{})
+
+	// then
+	noError(t, err)
+	value, _ = cache.Get("key")
+	assertEqual(t, []byte("imported"), value)
+}
+
+func TestImportProgress(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	var input strings.Builder
+	for i := 0; i < 25; i++ {
+		fmt.Fprintf(&input, "{\"key\":\"key%d\",\"value\":\"dmFsdWU=\"}\n", i)
+	}
+	var reported []ImportProgress
+
+	// when
+	progress, err := cache.Import(strings.NewReader(input.String()), ExportJSONLines, ImportOptions{
+		ProgressInterval: 10,
+		OnProgress: func(progress ImportProgress) {
+			reported = append(reported, progress)
+		},
+	})
+
+	// then
+	noError(t, err)
+	assertEqual(t, 3, len(reported))
+	assertEqual(t, int64(10), reported[0].Imported)
+	assertEqual(t, int64(20), reported[1].Imported)
+	assertEqual(t, progress, reported[2])
+	assertEqual(t, int64(input.Len()), progress.Bytes)
+}
+
+func TestImportSkipsExpiredRecords(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 1000}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}, &clock)
+	input := "key,timestamp,value\nold,1970-01-01T00:10:00Z,dmFsdWU=\nnew,1970-01-01T00:16:00Z,dmFsdWU=\n"
+
+	// when
+	progress, err := cache.Import(strings.NewReader(input), ExportCSV, ImportOptions{})
+
+	// then
+	noError(t, err)
+	assertEqual(t, int64(1), progress.Expired)
+	assertEqual(t, int64(1), progress.Imported)
+	ttl, err := cache.TTL("new")
+	noError(t, err)
+	assertEqual(t, 20*time.Second, ttl)
+}
+
+func TestImportInvalidRecord(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	input := "{\"key\":\"key\",\"value\":\"dmFsdWU=\"}\n{\"key\":\"broken\",\"value\":\"!\"}\n"
+
+	// when
+	progress, err := cache.Import(strings.NewReader(input), ExportJSONLines, ImportOptions{})
+
+	// then
+	assertEqual(t, true, errors.Is(err, ErrInvalidImportRecord))
+	assertEqual(t, int64(1), progress.Imported)
+	_, err = cache.Import(strings.NewReader("{"), ExportJSONLines, ImportOptions{})
+	assertEqual(t, true, errors.Is(err, ErrInvalidImportRecord))
+	_, err = cache.Import(strings.NewReader("value\nx\n"), ExportCSV, ImportOptions{})
+	assertEqual(t, true, errors.Is(err, ErrInvalidImportRecord))
+	_, err = cache.Import(strings.NewReader(""), ExportFormat(0), ImportOptions{})
+	assertEqual(t, ErrInvalidExportFormat, err)
+}
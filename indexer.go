@@ -0,0 +1,65 @@
+package bigcache
+
+// IndexOp is the kind of mutation passed to Indexer
+type IndexOp int
+
+const (
+	// IndexSet means the entry of the key was written, replacing the previous one if any
+	IndexSet = IndexOp(0)
+	// IndexRemove means the entry of the key was removed for the reason of the event
+	IndexRemove = IndexOp(1)
+	// IndexTouch means the timestamp of the entry was changed, e.g. by Expire or TouchMulti
+	IndexTouch = IndexOp(2)
+	// IndexReset means all entries of the shard were removed, the event carries no key
+	IndexReset = IndexOp(3)
+)
+
+// IndexEvent describes a mutation of an entry
+type IndexEvent struct {
+	Op IndexOp
+	// Shard is the index of the shard of the entry
+	Shard int
+	// Key is the key of the entry, it is empty for entries written without their keys and IndexReset
+	Key  string
+	Hash uint64
+	// Size is the length of the value
+	Size int
+	// Timestamp is the timestamp of the entry in units of Config.TimestampPrecision
+	Timestamp uint64
+	// Reason is the reason of IndexRemove
+	Reason RemoveReason
+}
+
+// Indexer receives every mutation of entries, e.g. to maintain external secondary indexes of them like
+// listings of keys per tenant. Index is called with the lock of the shard held, so mutations of a key
+// are received in the order they happened, but it has to be fast and must not call the cache.
+type Indexer interface {
+	Index(event IndexEvent)
+}
+
+// IndexerFunc is an adapter to use ordinary functions as Indexer
+type IndexerFunc func(event IndexEvent)
+
+// Index calls f(event)
+func (f IndexerFunc) Index(event IndexEvent) {
+	f(event)
+}
+
+// index passes the mutation of the wrapped entry to Config.Indexer, it has to be called with the write lock held
+func (s *cacheShard) index(op IndexOp, wrappedEntry []byte, reason RemoveReason) {
+	if s.onIndex == nil {
+		return
+	}
+	key := ""
+	if hasKeyInEntry(wrappedEntry) || s.keys != nil {
+		key = s.entryKey(wrappedEntry)
+	}
+	s.onIndex(IndexEvent{
+		Op:        op,
+		Key:       key,
+		Hash:      readHashFromEntry(wrappedEntry),
+		Size:      len(readEntryWithoutCopy(wrappedEntry)),
+		Timestamp: readTimestampFromEntry(wrappedEntry),
+		Reason:    reason,
+	})
+}
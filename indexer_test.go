@@ -0,0 +1,70 @@
+package bigcache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIndexerReceivesMutations(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var events []IndexEvent
+	clock := mockedClock{value: 100}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		Indexer: IndexerFunc(func(event IndexEvent) {
+			events = append(events, event)
+		}),
+	}, &clock)
+
+	// when
+	cache.Set("a", []byte("value"))
+	cache.Set("a", []byte("longer value"))
+	clock.set(110)
+	cache.Expire("a", time.Minute)
+	cache.Delete("a")
+	cache.Set("b", []byte("value"))
+	cache.Reset()
+
+	// then
+	hash := cache.hash.Sum64("a")
+	assertEqual(t, []IndexEvent{
+		{Op: IndexSet, Key: "a", Hash: hash, Size: 5, Timestamp: 100},
+		{Op: IndexSet, Key: "a", Hash: hash, Size: 12, Timestamp: 100},
+		{Op: IndexTouch, Key: "a", Hash: hash, Size: 12, Timestamp: 110},
+		{Op: IndexRemove, Key: "a", Hash: hash, Size: 12, Timestamp: 110, Reason: Deleted},
+		{Op: IndexSet, Key: "b", Hash: cache.hash.Sum64("b"), Size: 5, Timestamp: 110},
+		{Op: IndexReset},
+	}, events)
+}
+
+func TestIndexerReceivesShardAndKeysOfKeyStore(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var events []IndexEvent
+	cache, _ := New(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		EntryFormat:        EntryFormatV2,
+		OmitEntryKeys:      true,
+		SeparateKeyStore:   true,
+		Indexer: IndexerFunc(func(event IndexEvent) {
+			events = append(events, event)
+		}),
+	})
+
+	// when
+	cache.Set("key", []byte("value"))
+
+	// then
+	assertEqual(t, "key", events[0].Key)
+	assertEqual(t, int(cache.shardIndex(cache.hash.Sum64("key"))), events[0].Shard)
+}
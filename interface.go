@@ -0,0 +1,54 @@
+package bigcache
+
+// Reader is the set of operations which do not mutate the cache. Subsystems which must never write
+// to the cache can be given a Reader, e.g. a view returned by BigCache.ReaderView.
+type Reader interface {
+	// Get reads entry for the key, it returns an ErrEntryNotFound when no entry exists for the given key
+	Get(key string) ([]byte, error)
+	// Len returns the number of entries in the cache
+	Len() int
+	// Stats returns cache's statistics
+	Stats() Stats
+}
+
+// Writer is the set of operations mutating entries of the cache
+type Writer interface {
+	// Set saves entry under the key
+	Set(key string, entry []byte) error
+	// Delete removes the key, it returns an ErrEntryNotFound when no entry exists for the given key
+	Delete(key string) error
+}
+
+// Interface is the set of operations shared by the embedded cache and remote implementations like the
+// HTTP client, so applications and tests can swap them and wrap them with generic middleware.
+type Interface interface {
+	Reader
+	Writer
+	// Close releases resources held by the cache
+	Close() error
+}
+
+var _ Interface = (*BigCache)(nil)
+
+// readerView hides mutating methods of the cache, so it cannot be type asserted back to BigCache
+type readerView struct {
+	cache *BigCache
+}
+
+// ReaderView returns a read-only view of the cache. Unlike passing the cache as a Reader,
+// the view cannot be converted back to BigCache, so writes are prevented at compile time.
+func (c *BigCache) ReaderView() Reader {
+	return readerView{cache: c}
+}
+
+func (v readerView) Get(key string) ([]byte, error) {
+	return v.cache.Get(key)
+}
+
+func (v readerView) Len() int {
+	return v.cache.Len()
+}
+
+func (v readerView) Stats() Stats {
+	return v.cache.Stats()
+}
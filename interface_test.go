@@ -0,0 +1,28 @@
+package bigcache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReaderView(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(5*time.Second))
+	defer cache.Close()
+	view := cache.ReaderView()
+
+	// when
+	cache.Set("key", []byte("value"))
+	entry, err := view.Get("key")
+
+	// then
+	noError(t, err)
+	assertEqual(t, []byte("value"), entry)
+	assertEqual(t, 1, view.Len())
+	assertEqual(t, int64(1), view.Stats().Hits)
+	_, writable := view.(Writer)
+	assertEqual(t, false, writable)
+}
@@ -0,0 +1,35 @@
+//go:build go1.23
+// +build go1.23
+
+package bigcache
+
+import "iter"
+
+// All returns an iterator over keys and entries of the cache for range-over-func loops, e.g.
+// for key, entry := range cache.All(). Entries are read one by one like with Iterator, so the loop body
+// may call the cache. Entries written or removed during the loop may or may not be visited.
+func (c *BigCache) All() iter.Seq2[string, []byte] {
+	return func(yield func(string, []byte) bool) {
+		iterator := c.Iterator()
+		for iterator.SetNext() {
+			info, err := iterator.Value()
+			if err != nil {
+				continue
+			}
+			if !yield(info.Key(), info.Value()) {
+				return
+			}
+		}
+	}
+}
+
+// Keys returns an iterator over keys of the cache, see All
+func (c *BigCache) Keys() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for key := range c.All() {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
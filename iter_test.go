@@ -0,0 +1,57 @@
+//go:build go1.23
+// +build go1.23
+
+package bigcache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAll(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)))
+	}
+
+	// when
+	entries := make(map[string]string)
+	for key, entry := range cache.All() {
+		entries[key] = string(entry)
+	}
+
+	// then
+	assertEqual(t, 100, len(entries))
+	assertEqual(t, "value42", entries["key42"])
+}
+
+func TestAllStopsEarly(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+
+	// when
+	visited := 0
+	for key := range cache.Keys() {
+		visited++
+		cache.Delete(key)
+		if visited == 10 {
+			break
+		}
+	}
+
+	// then
+	assertEqual(t, 10, visited)
+	assertEqual(t, 90, cache.Len())
+}
@@ -24,6 +24,7 @@ type EntryInfo struct {
 	hash      uint64
 	key       string
 	value     []byte
+	sequence  uint64
 	err       error
 }
 
@@ -37,7 +38,7 @@ func (e EntryInfo) Hash() uint64 {
 	return e.hash
 }
 
-// Timestamp returns entry's timestamp (time of insertion)
+// Timestamp returns entry's timestamp (time of insertion) in units of Config.TimestampPrecision, seconds by default
 func (e EntryInfo) Timestamp() uint64 {
 	return e.timestamp
 }
@@ -47,6 +48,11 @@ func (e EntryInfo) Value() []byte {
 	return e.value
 }
 
+// Sequence returns sequence number of the write of the entry in its shard, it is 0 unless Config.EntrySequence is set
+func (e EntryInfo) Sequence() uint64 {
+	return e.sequence
+}
+
 // EntryInfoIterator allows to iterate over entries in the cache
 type EntryInfoIterator struct {
 	mutex            sync.Mutex
@@ -115,8 +121,9 @@ func (it *EntryInfoIterator) setCurrentEntry() bool {
 		it.currentEntryInfo = EntryInfo{
 			timestamp: readTimestampFromEntry(entry),
 			hash:      readHashFromEntry(entry),
-			key:       readKeyFromEntry(entry),
+			key:       it.cache.shards[it.currentShard].entryKeyWithLock(entry),
 			value:     readEntry(entry),
+			sequence:  readSequenceFromEntry(entry),
 			err:       err,
 		}
 	}
@@ -144,3 +151,42 @@ func (it *EntryInfoIterator) Value() (EntryInfo, error) {
 
 	return it.currentEntryInfo, it.currentEntryInfo.err
 }
+
+// ForEach calls fn for every entry of the cache, shard by shard in the order of insertion, until it returns false.
+// A shard is read locked while its entries are visited, so fn must be quick and must not write to the cache.
+// Entry and value of info reference memory of the cache, they are valid only until fn returns and must not be modified.
+// Unlike Iterator, no copies of hashed keys and entries are made.
+func (c *BigCache) ForEach(fn func(key string, entry []byte, info EntryInfo) bool) {
+	for _, shard := range c.shards {
+		if !shard.forEach(fn) {
+			return
+		}
+	}
+}
+
+// forEach calls fn for live entries of the shard, it returns false when fn stopped the iteration
+func (s *cacheShard) forEach(fn func(key string, entry []byte, info EntryInfo) bool) bool {
+	next := true
+	s.lock.RLock()
+	s.entries.Iterate(func(index int, wrappedEntry []byte) bool {
+		hash := readHashFromEntry(wrappedEntry)
+		if hash == 0 || s.hashmap[hash] != uint64(index) {
+			// deleted or overwritten entry
+			return true
+		}
+		if s.verifyChecksum && !isValidEntryChecksum(wrappedEntry) {
+			return true
+		}
+		info := EntryInfo{
+			timestamp: readTimestampFromEntry(wrappedEntry),
+			hash:      hash,
+			key:       s.entryKey(wrappedEntry),
+			value:     readEntryWithoutCopy(wrappedEntry),
+			sequence:  readSequenceFromEntry(wrappedEntry),
+		}
+		next = fn(info.key, info.value, info)
+		return next
+	})
+	s.lock.RUnlock()
+	return next
+}
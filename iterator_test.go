@@ -163,6 +163,7 @@ func TestEntriesIteratorParallelAdd(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
+	defer bc.Close()
 
 	wg := sync.WaitGroup{}
 	wg.Add(1)
@@ -266,3 +267,62 @@ func TestParallelSetAndIteration(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestForEach(t *testing.T) {
+	t.Parallel()
+
+	// given
+	keysCount := 1000
+	cache, _ := New(context.Background(), Config{
+		Shards:             8,
+		LifeWindow:         6 * time.Second,
+		MaxEntriesInWindow: 1,
+		MaxEntrySize:       256,
+	})
+	for i := 0; i < keysCount; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)))
+	}
+	cache.Set("key1", []byte("updated"))
+	cache.Delete("key2")
+
+	// when
+	entries := make(map[string]string)
+	cache.ForEach(func(key string, entry []byte, info EntryInfo) bool {
+		assertEqual(t, key, info.Key())
+		assertEqual(t, entry, info.Value())
+		entries[key] = string(entry)
+		return true
+	})
+
+	// then
+	assertEqual(t, keysCount-1, len(entries))
+	assertEqual(t, "value0", entries["key0"])
+	assertEqual(t, "updated", entries["key1"])
+	_, found := entries["key2"]
+	assertEqual(t, false, found)
+}
+
+func TestForEachStopsEarly(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             8,
+		LifeWindow:         6 * time.Second,
+		MaxEntriesInWindow: 1,
+		MaxEntrySize:       256,
+	})
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+
+	// when
+	visited := 0
+	cache.ForEach(func(key string, entry []byte, info EntryInfo) bool {
+		visited++
+		return visited < 10
+	})
+
+	// then
+	assertEqual(t, 10, visited)
+}
@@ -0,0 +1,45 @@
+package bigcache
+
+import "sync"
+
+// KeyedMutex provides striped locks of keys hashed with the Hasher and Config.KeyNormalizer of the cache,
+// e.g. to let a single goroutine load the value of a missed key while others wait for it. Distinct keys
+// may share a lock, so a goroutine must not lock more than a single key at a time. The locks are separate
+// from locks of the shards, holding them does not block operations of the cache.
+type KeyedMutex struct {
+	cache    *BigCache
+	perShard bool
+	mask     uint64
+	locks    []sync.Mutex
+}
+
+// NewKeyedMutex creates a KeyedMutex of stripes locks rounded up to a power of two, 0 means one lock
+// per shard of the cache, so keys share locks as they share shards
+func (c *BigCache) NewKeyedMutex(stripes int) *KeyedMutex {
+	if stripes <= 0 {
+		return &KeyedMutex{cache: c, perShard: true, locks: make([]sync.Mutex, len(c.shards))}
+	}
+	size := 1
+	for size < stripes {
+		size <<= 1
+	}
+	return &KeyedMutex{cache: c, mask: uint64(size - 1), locks: make([]sync.Mutex, size)}
+}
+
+// Lock locks the key, it blocks until the lock is available
+func (m *KeyedMutex) Lock(key string) {
+	m.lock(key).Lock()
+}
+
+// Unlock unlocks the key, it is a run-time error if the key is not locked
+func (m *KeyedMutex) Unlock(key string) {
+	m.lock(key).Unlock()
+}
+
+func (m *KeyedMutex) lock(key string) *sync.Mutex {
+	hashedKey := m.cache.hash.Sum64(m.cache.normalizeKey(key))
+	if m.perShard {
+		return &m.locks[m.cache.shardIndex(hashedKey)]
+	}
+	return &m.locks[hashedKey&m.mask]
+}
@@ -0,0 +1,84 @@
+package bigcache
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeyedMutexExcludesHoldersOfKey(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	mutex := cache.NewKeyedMutex(0)
+	var holders, maxHolders int32
+	var wg sync.WaitGroup
+
+	// when
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				mutex.Lock("key")
+				if held := atomic.AddInt32(&holders, 1); held > atomic.LoadInt32(&maxHolders) {
+					atomic.StoreInt32(&maxHolders, held)
+				}
+				atomic.AddInt32(&holders, -1)
+				mutex.Unlock("key")
+			}
+		}()
+	}
+	wg.Wait()
+
+	// then
+	assertEqual(t, int32(1), maxHolders)
+}
+
+func TestKeyedMutexLocksNormalizedKeys(t *testing.T) {
+	t.Parallel()
+
+	// given
+	config := DefaultConfig(time.Minute)
+	config.KeyNormalizer = strings.ToLower
+	cache, _ := New(context.Background(), config)
+	defer cache.Close()
+	mutex := cache.NewKeyedMutex(1024)
+	var locked int32
+
+	// when
+	mutex.Lock("KEY")
+	go func() {
+		mutex.Lock("key")
+		atomic.StoreInt32(&locked, 1)
+		mutex.Unlock("key")
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// then
+	assertEqual(t, int32(0), atomic.LoadInt32(&locked))
+	mutex.Unlock("KEY")
+	waitFor(t, func() bool { return atomic.LoadInt32(&locked) == 1 })
+}
+
+func TestKeyedMutexStripes(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{Shards: 16, LifeWindow: time.Minute, MaxEntriesInWindow: 10, MaxEntrySize: 256})
+
+	// when
+	perShard := cache.NewKeyedMutex(0)
+	striped := cache.NewKeyedMutex(100)
+
+	// then
+	assertEqual(t, 16, len(perShard.locks))
+	assertEqual(t, 128, len(striped.locks))
+	hashedKey := cache.hash.Sum64("key")
+	assertEqual(t, &perShard.locks[cache.shardIndex(hashedKey)], perShard.lock("key"))
+}
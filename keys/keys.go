@@ -0,0 +1,99 @@
+// Package keys builds cache keys in pooled buffers without allocations, as formatting them with fmt.Sprintf
+// is a visible fraction of CPU of heavy users. Built keys feed methods of BigCache taking keys as bytes:
+//
+//	key := keys.Uint64("user", id)
+//	entry, err := cache.GetBytesKey(key.Bytes())
+//	key.Release()
+package keys
+
+import (
+	"strconv"
+	"sync"
+)
+
+// Separator is put between parts of keys
+const Separator = ':'
+
+const (
+	initialKeyCapacity = 64
+	// maxPooledCapacity is the capacity above which buffers are not returned to the pool,
+	// so a few huge keys do not keep memory
+	maxPooledCapacity = 4096
+)
+
+var pool = sync.Pool{
+	New: func() interface{} {
+		return &Key{buf: make([]byte, 0, initialKeyCapacity)}
+	},
+}
+
+// Key is a cache key built in a pooled buffer. It must not be used after Release.
+type Key struct {
+	buf []byte
+}
+
+// New returns an empty key from the pool
+func New() *Key {
+	k := pool.Get().(*Key)
+	k.buf = k.buf[:0]
+	return k
+}
+
+// Join returns a key of the parts separated with Separator
+func Join(parts ...string) *Key {
+	k := New()
+	for _, part := range parts {
+		k.Append(part)
+	}
+	return k
+}
+
+// Uint64 returns a key of the prefix and the decimal id separated with Separator, e.g. user:42
+func Uint64(prefix string, id uint64) *Key {
+	return New().Append(prefix).AppendUint64(id)
+}
+
+// Append adds the part to the key, after Separator unless the key is empty
+func (k *Key) Append(part string) *Key {
+	k.separate()
+	k.buf = append(k.buf, part...)
+	return k
+}
+
+// AppendUint64 adds the decimal id to the key, after Separator unless the key is empty
+func (k *Key) AppendUint64(id uint64) *Key {
+	k.separate()
+	k.buf = strconv.AppendUint(k.buf, id, 10)
+	return k
+}
+
+// AppendInt64 adds the decimal id to the key, after Separator unless the key is empty
+func (k *Key) AppendInt64(id int64) *Key {
+	k.separate()
+	k.buf = strconv.AppendInt(k.buf, id, 10)
+	return k
+}
+
+func (k *Key) separate() {
+	if len(k.buf) > 0 {
+		k.buf = append(k.buf, Separator)
+	}
+}
+
+// Bytes returns the key, it references the pooled buffer and is valid until Release
+func (k *Key) Bytes() []byte {
+	return k.buf
+}
+
+// String returns a copy of the key
+func (k *Key) String() string {
+	return string(k.buf)
+}
+
+// Release returns the buffer of the key to the pool
+func (k *Key) Release() {
+	if cap(k.buf) > maxPooledCapacity {
+		return
+	}
+	pool.Put(k)
+}
@@ -0,0 +1,92 @@
+package keys
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+func TestJoin(t *testing.T) {
+	key := Join("user", "42", "profile")
+	defer key.Release()
+
+	if got := key.String(); got != "user:42:profile" {
+		t.Errorf("Join() = %q, want user:42:profile", got)
+	}
+}
+
+func TestUint64(t *testing.T) {
+	key := Uint64("user", 42)
+	defer key.Release()
+
+	if got := string(key.Bytes()); got != "user:42" {
+		t.Errorf("Uint64() = %q, want user:42", got)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	key := New().Append("order").AppendInt64(-7).AppendUint64(3)
+	defer key.Release()
+
+	if got := key.String(); got != "order:-7:3" {
+		t.Errorf("Append() = %q, want order:-7:3", got)
+	}
+}
+
+func TestReusedKeyIsEmpty(t *testing.T) {
+	Join("a", "b").Release()
+	key := New()
+	defer key.Release()
+
+	if len(key.Bytes()) != 0 {
+		t.Errorf("New() = %q, want empty key", key.Bytes())
+	}
+}
+
+func TestNoAllocations(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool drops items with the race detector")
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		key := Uint64("user", 1234567)
+		key.Append("profile")
+		key.Release()
+		key = Join("session", "abc")
+		key.Release()
+	})
+
+	if allocs != 0 {
+		t.Errorf("AllocsPerRun() = %v, want 0", allocs)
+	}
+}
+
+func TestFeedsBytesKeyMethods(t *testing.T) {
+	cache, _ := bigcache.New(context.Background(), bigcache.DefaultConfig(time.Minute))
+	defer cache.Close()
+	key := Uint64("user", 42)
+	cache.SetBytesKey(key.Bytes(), []byte("value"))
+	key.Release()
+
+	entry, err := cache.Get("user:42")
+	if err != nil || string(entry) != "value" {
+		t.Errorf("Get() = %q, %v, want value", entry, err)
+	}
+}
+
+func BenchmarkUint64(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		key := Uint64("user", uint64(i))
+		key.Release()
+	}
+}
+
+func BenchmarkSprintf(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = fmt.Sprintf("user:%d", i)
+	}
+}
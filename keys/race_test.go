@@ -0,0 +1,7 @@
+//go:build race
+// +build race
+
+package keys
+
+// raceEnabled is set when tests run with the race detector, which makes sync.Pool drop items randomly
+const raceEnabled = true
@@ -0,0 +1,119 @@
+package bigcache
+
+// keyStoreMinGarbage is the number of bytes of removed keys below which the arena of a key store is not compacted
+const keyStoreMinGarbage = 4096
+
+// keyStore keeps keys of entries written without them, see Config.SeparateKeyStore. Keys are appended to
+// a single byte arena and indexed by their hash with offset and length packed in a pointer-free map,
+// so, like the hashmap of a shard, it is not scanned by the garbage collector. It is guarded by the shard lock.
+type keyStore struct {
+	arena []byte
+	// index maps hash to offset of the key in the arena shifted left by 16 bits and its length
+	index map[uint64]uint64
+	// garbage is the number of bytes of removed keys which are still in the arena
+	garbage int
+}
+
+func newKeyStore(capacity int) *keyStore {
+	return &keyStore{index: make(map[uint64]uint64, capacity)}
+}
+
+// put stores the key of the hash, replacing the previous one
+func (k *keyStore) put(hashedKey uint64, key string) {
+	k.remove(hashedKey)
+	k.index[hashedKey] = uint64(len(k.arena))<<16 | uint64(len(key))
+	k.arena = append(k.arena, key...)
+}
+
+// get returns the key of the hash, it is empty when none is stored
+func (k *keyStore) get(hashedKey uint64) string {
+	location, ok := k.index[hashedKey]
+	if !ok {
+		return ""
+	}
+	offset, length := location>>16, location&0xFFFF
+	return string(k.arena[offset : offset+length])
+}
+
+// remove forgets the key of the hash and compacts the arena when most of it is taken by removed keys
+func (k *keyStore) remove(hashedKey uint64) {
+	location, ok := k.index[hashedKey]
+	if !ok {
+		return
+	}
+	delete(k.index, hashedKey)
+	k.garbage += int(location & 0xFFFF)
+	if k.garbage > keyStoreMinGarbage && k.garbage > len(k.arena)/2 {
+		k.compact()
+	}
+}
+
+// compact copies live keys to a new arena
+func (k *keyStore) compact() {
+	arena := make([]byte, 0, len(k.arena)-k.garbage)
+	for hashedKey, location := range k.index {
+		offset, length := location>>16, location&0xFFFF
+		k.index[hashedKey] = uint64(len(arena))<<16 | length
+		arena = append(arena, k.arena[offset:offset+length]...)
+	}
+	k.arena = arena
+	k.garbage = 0
+}
+
+// reset removes all keys
+func (k *keyStore) reset() {
+	k.arena = nil
+	k.index = make(map[uint64]uint64)
+	k.garbage = 0
+}
+
+// size returns an estimate of bytes taken by the arena and the index
+func (k *keyStore) size() int {
+	// a map entry takes its key and value and about 2 bytes of bucket metadata
+	return cap(k.arena) + len(k.index)*18
+}
+
+// storeKey saves the key of the entry written without it, it has to be called with the write lock held
+func (s *cacheShard) storeKey(hashedKey uint64, key string) {
+	if s.keys != nil {
+		s.keys.put(hashedKey, key)
+	}
+}
+
+// forgetKey removes the key of the removed entry, it has to be called with the write lock held
+func (s *cacheShard) forgetKey(hashedKey uint64) {
+	if s.keys != nil {
+		s.keys.remove(hashedKey)
+	}
+}
+
+// entryKey returns the key of the live entry, read from the key store when the entry was written without it.
+// It has to be called with the shard lock held.
+func (s *cacheShard) entryKey(wrappedEntry []byte) string {
+	if s.keys != nil && !hasKeyInEntry(wrappedEntry) {
+		return s.keys.get(readHashFromEntry(wrappedEntry))
+	}
+	return readKeyFromEntry(wrappedEntry)
+}
+
+// entryKeyWithLock is entryKey for a copy of the entry read without the lock
+func (s *cacheShard) entryKeyWithLock(wrappedEntry []byte) string {
+	if s.keys == nil || hasKeyInEntry(wrappedEntry) {
+		return readKeyFromEntry(wrappedEntry)
+	}
+	s.lock.RLock()
+	key := s.keys.get(readHashFromEntry(wrappedEntry))
+	s.lock.RUnlock()
+	return key
+}
+
+// keyStoreBytes returns the size of the key store of the shard
+func (s *cacheShard) keyStoreBytes() int {
+	if s.keys == nil {
+		return 0
+	}
+	s.lock.RLock()
+	size := s.keys.size()
+	s.lock.RUnlock()
+	return size
+}
@@ -0,0 +1,131 @@
+package bigcache
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyStorePutGetRemove(t *testing.T) {
+	t.Parallel()
+
+	// given
+	keys := newKeyStore(0)
+
+	// when
+	keys.put(1, "first")
+	keys.put(2, "second")
+	keys.put(1, "replaced")
+	keys.remove(2)
+
+	// then
+	assertEqual(t, "replaced", keys.get(1))
+	assertEqual(t, "", keys.get(2))
+	assertEqual(t, len("first")+len("second"), keys.garbage)
+}
+
+func TestKeyStoreCompactsRemovedKeys(t *testing.T) {
+	t.Parallel()
+
+	// given
+	keys := newKeyStore(0)
+	key := strings.Repeat("k", 1024)
+	for i := uint64(0); i < 10; i++ {
+		keys.put(i, key)
+	}
+
+	// when
+	for i := uint64(0); i < 9; i++ {
+		keys.remove(i)
+	}
+
+	// then
+	assertEqual(t, true, len(keys.arena) < 10*len(key))
+	assertEqual(t, len(key), len(keys.arena)-keys.garbage)
+	assertEqual(t, key, keys.get(9))
+}
+
+func newKeyLessCache(t *testing.T, separateKeyStore bool) *BigCache {
+	cache, err := New(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 16,
+		MaxEntrySize:       256,
+		EntryFormat:        EntryFormatV2,
+		OmitEntryKeys:      true,
+		SeparateKeyStore:   separateKeyStore,
+	})
+	noError(t, err)
+	t.Cleanup(func() { cache.Close() })
+	return cache
+}
+
+func iteratedKeys(cache *BigCache) []string {
+	var keys []string
+	iterator := cache.Iterator()
+	for iterator.SetNext() {
+		info, _ := iterator.Value()
+		keys = append(keys, info.Key())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestSeparateKeyStoreListsKeysOfKeyLessEntries(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache := newKeyLessCache(t, true)
+	cache.Set("a", []byte("1"))
+	cache.Set("b", []byte("2"))
+	cache.Set("c", []byte("3"))
+
+	// when
+	cache.Delete("b")
+	var forEachKeys []string
+	cache.ForEach(func(key string, entry []byte, info EntryInfo) bool {
+		forEachKeys = append(forEachKeys, key)
+		return true
+	})
+	sort.Strings(forEachKeys)
+
+	// then
+	assertEqual(t, []string{"a", "c"}, iteratedKeys(cache))
+	assertEqual(t, []string{"a", "c"}, forEachKeys)
+	assertEqual(t, true, cache.Stats().KeyStoreBytes > 0)
+	value, err := cache.Get("a")
+	noError(t, err)
+	assertEqual(t, []byte("1"), value)
+}
+
+func TestKeyLessEntriesAreListedWithoutKeysWithoutKeyStore(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache := newKeyLessCache(t, false)
+	cache.Set("a", []byte("1"))
+
+	// when
+	keys := iteratedKeys(cache)
+
+	// then
+	assertEqual(t, []string{""}, keys)
+	assertEqual(t, int64(0), cache.Stats().KeyStoreBytes)
+}
+
+func TestResetClearsKeyStore(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache := newKeyLessCache(t, true)
+	cache.Set("a", []byte("1"))
+
+	// when
+	cache.Reset()
+	cache.Set("b", []byte("2"))
+
+	// then
+	assertEqual(t, []string{"b"}, iteratedKeys(cache))
+}
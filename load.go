@@ -0,0 +1,112 @@
+package bigcache
+
+import (
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// GetOrLoad reads entry for the key, calling load and saving its result when no entry exists or it expired.
+// To protect the source from stampedes when many keys share a TTL, entries are reloaded probabilistically
+// before they expire (XFetch): the probability grows as expiration approaches and with how long the previous
+// load took, scaled by Config.EarlyExpirationBeta. When an early reload fails, the cached entry is returned.
+// Loaded entries are saved like with Set, a read-only cache and writes shed under overload return them
+// without saving. With Config.SpillStore, missed keys are read from the store before load is called.
+func (c *BigCache) GetOrLoad(key string, load func() ([]byte, error)) ([]byte, error) {
+	key = c.normalizeKey(key)
+	if err := c.checkKeyLength(key); err != nil {
+		return nil, err
+	}
+	hashedKey := c.hash.Sum64(key)
+	shard := c.getShard(hashedKey)
+	entry, reload, err := shard.getOrReload(key, hashedKey, c.currentConfig().earlyExpirationBeta())
+	if err != nil && err != ErrEntryNotFound && err != ErrEntryDeleted {
+		return nil, c.recoverShard(hashedKey, err)
+	}
+	if err == nil && !reload {
+		return entry.value, nil
+	}
+	if err == ErrEntryNotFound && c.spiller != nil {
+		if spilled, spillErr := c.getSpilled(key, hashedKey); spillErr == nil {
+			return spilled, nil
+		}
+	}
+
+	start := time.Now()
+	loaded, loadErr := load()
+	if loadErr != nil {
+		if err == nil && !shard.isExpiredEntry(entry, uint64(shard.clock.Epoch())) {
+			return entry.value, nil
+		}
+		return nil, loadErr
+	}
+	if c.admit(LowPriority) != nil {
+		return loaded, nil
+	}
+	err = shard.setLoaded(key, hashedKey, loaded, time.Since(start))
+	return loaded, c.recoverShard(hashedKey, err)
+}
+
+// loadedEntry is an entry read by getOrReload
+type loadedEntry struct {
+	value     []byte
+	timestamp uint64
+	// lifeWindow of the shard when the entry was read, it can be changed with SetLifeWindow
+	lifeWindow uint64
+}
+
+// getOrReload reads the entry and decides whether it should be reloaded early
+func (s *cacheShard) getOrReload(key string, hashedKey uint64, beta float64) (loadedEntry, bool, error) {
+	currentTimestamp := uint64(s.clock.Epoch())
+	s.lock.RLock()
+	wrappedEntry, err := s.getWrappedEntry(hashedKey)
+	if err != nil {
+		s.lock.RUnlock()
+		return loadedEntry{}, false, err
+	}
+	if !compareKeyFromEntry(wrappedEntry, key) {
+		s.lock.RUnlock()
+		s.collision()
+		return loadedEntry{}, false, ErrEntryNotFound
+	}
+	entry := loadedEntry{
+		value:      readEntry(wrappedEntry),
+		timestamp:  readTimestampFromEntry(wrappedEntry),
+		lifeWindow: s.lifeWindow,
+	}
+	cost := s.loadCosts[hashedKey]
+	s.lock.RUnlock()
+	s.hit(hashedKey, len(entry.value))
+
+	if s.isExpiredEntry(entry, currentTimestamp) {
+		return entry, true, nil
+	}
+	// reload when currentTimestamp - cost * beta * ln(rand) reaches expiration
+	gap := float64(cost) / float64(s.timestampUnit) * beta * -math.Log(rand.Float64())
+	return entry, float64(currentTimestamp)+gap >= float64(entry.timestamp+entry.lifeWindow), nil
+}
+
+// isExpiredEntry reports whether the entry read by getOrReload is expired
+func (s *cacheShard) isExpiredEntry(entry loadedEntry, currentTimestamp uint64) bool {
+	return currentTimestamp > entry.timestamp && currentTimestamp-entry.timestamp > entry.lifeWindow
+}
+
+// setLoaded saves the loaded entry with the duration of its load
+func (s *cacheShard) setLoaded(key string, hashedKey uint64, entry []byte, cost time.Duration) error {
+	currentTimestamp := uint64(s.clock.Epoch())
+
+	if err := s.lock.lockWithTimeout(); err != nil {
+		atomic.AddInt64(&s.stats.LockTimeouts, 1)
+		return err
+	}
+	err := s.setWithoutLock(currentTimestamp, key, hashedKey, entry)
+	if err == nil {
+		if s.loadCosts == nil {
+			s.loadCosts = make(map[uint64]int64)
+		}
+		s.loadCosts[hashedKey] = int64(cost)
+	}
+	s.lock.Unlock()
+	return err
+}
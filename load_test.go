@@ -0,0 +1,186 @@
+package bigcache
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrLoadLoadsMissingEntry(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	loads := 0
+	load := func() ([]byte, error) {
+		loads++
+		return []byte("value"), nil
+	}
+
+	// when
+	first, firstErr := cache.GetOrLoad("key", load)
+	second, secondErr := cache.GetOrLoad("key", load)
+
+	// then
+	noError(t, firstErr)
+	noError(t, secondErr)
+	assertEqual(t, []byte("value"), first)
+	assertEqual(t, []byte("value"), second)
+	assertEqual(t, 1, loads)
+}
+
+func TestGetOrLoadReloadsExpiredEntry(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}, &clock)
+	cache.Set("key", []byte("old"))
+	clock.set(5)
+
+	// when
+	entry, err := cache.GetOrLoad("key", func() ([]byte, error) {
+		return []byte("new"), nil
+	})
+
+	// then
+	noError(t, err)
+	assertEqual(t, []byte("new"), entry)
+	cached, _ := cache.Get("key")
+	assertEqual(t, []byte("new"), cached)
+}
+
+func TestGetOrLoadReloadsEarlyProportionallyToLoadCost(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:              1,
+		LifeWindow:          time.Minute,
+		MaxEntriesInWindow:  10,
+		MaxEntrySize:        256,
+		EarlyExpirationBeta: 1e9,
+	})
+	cache.GetOrLoad("key", func() ([]byte, error) {
+		time.Sleep(10 * time.Millisecond)
+		return []byte("old"), nil
+	})
+
+	// when
+	entry, err := cache.GetOrLoad("key", func() ([]byte, error) {
+		return []byte("new"), nil
+	})
+
+	// then
+	noError(t, err)
+	assertEqual(t, []byte("new"), entry)
+}
+
+func TestGetOrLoadReturnsCachedEntryWhenEarlyReloadFails(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:              1,
+		LifeWindow:          time.Minute,
+		MaxEntriesInWindow:  10,
+		MaxEntrySize:        256,
+		EarlyExpirationBeta: 1e9,
+	})
+	cache.GetOrLoad("key", func() ([]byte, error) {
+		time.Sleep(10 * time.Millisecond)
+		return []byte("old"), nil
+	})
+	failure := errors.New("failure")
+
+	// when
+	entry, err := cache.GetOrLoad("key", func() ([]byte, error) {
+		return nil, failure
+	})
+	_, missErr := cache.GetOrLoad("other", func() ([]byte, error) {
+		return nil, failure
+	})
+
+	// then
+	noError(t, err)
+	assertEqual(t, []byte("old"), entry)
+	assertEqual(t, failure, missErr)
+}
+
+func TestGetOrLoadForgetsCostOfOverwrittenEntry(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	})
+	cache.GetOrLoad("key", func() ([]byte, error) {
+		return []byte("value"), nil
+	})
+
+	// when
+	cache.Set("key", []byte("other"))
+
+	// then
+	assertEqual(t, 0, len(cache.shards[0].loadCosts))
+}
+
+func TestGetOrLoadDoesNotSaveShedWrites(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		SetBudget:          100,
+		ShedWindow:         time.Hour,
+	})
+	defer cache.Close()
+	atomic.StoreUint64(&cache.shedder.dropProbability, math.Float64bits(1))
+
+	// when
+	value, err := cache.GetOrLoad("key", func() ([]byte, error) {
+		return []byte("value"), nil
+	})
+
+	// then
+	noError(t, err)
+	assertEqual(t, []byte("value"), value)
+	assertEqual(t, 0, cache.Len())
+	assertEqual(t, int64(1), cache.Stats().ShedWrites)
+}
+
+func TestGetOrLoadRestoresSpilledEntry(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := newSpillingCache(t, &systemClock{})
+	cache.Set("spilled", blob('a', 400*1024))
+	cache.Set("second", blob('b', 400*1024))
+	cache.Set("third", blob('c', 400*1024))
+	waitFor(t, func() bool { return cache.Stats().Spilled == 2 })
+
+	// when
+	entry, err := cache.GetOrLoad("spilled", func() ([]byte, error) {
+		return nil, errors.New("load must not be called")
+	})
+
+	// then
+	noError(t, err)
+	assertEqual(t, blob('a', 400*1024), entry)
+	assertEqual(t, int64(1), cache.Stats().SpillHits)
+}
@@ -0,0 +1,94 @@
+package bigcache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LockWaitBuckets are upper bounds of buckets of ShardStats.LockWaitHistogram,
+// the last bucket of the histogram counts longer waits
+var LockWaitBuckets = [...]time.Duration{time.Microsecond, 10 * time.Microsecond, 100 * time.Microsecond, time.Millisecond, 10 * time.Millisecond}
+
+// shardLock is a RWMutex measuring how long acquisitions wait when statsEnabled is set
+type shardLock struct {
+	// counters are accessed atomically, they come first to be 64-bit aligned on 32-bit platforms
+	acquisitions int64
+	waitTime     int64
+	histogram    [len(LockWaitBuckets) + 1]int64
+	sync.RWMutex
+	statsEnabled bool
+	// timeout of acquisitions by lockWithTimeout and rLockWithTimeout, 0 means no timeout
+	timeout time.Duration
+}
+
+func (l *shardLock) Lock() {
+	if !l.statsEnabled {
+		l.RWMutex.Lock()
+		return
+	}
+	start := time.Now()
+	l.RWMutex.Lock()
+	l.record(time.Since(start))
+}
+
+func (l *shardLock) RLock() {
+	if !l.statsEnabled {
+		l.RWMutex.RLock()
+		return
+	}
+	start := time.Now()
+	l.RWMutex.RLock()
+	l.record(time.Since(start))
+}
+
+// lockWithTimeout acquires the write lock, it returns ErrLockTimeout when the timeout of the lock passed first
+func (l *shardLock) lockWithTimeout() error {
+	if l.timeout <= 0 {
+		l.Lock()
+		return nil
+	}
+	if !l.tryLockFor(l.timeout) {
+		return ErrLockTimeout
+	}
+	return nil
+}
+
+// rLockWithTimeout acquires the read lock, it returns ErrLockTimeout when the timeout of the lock passed first
+func (l *shardLock) rLockWithTimeout() error {
+	if l.timeout <= 0 {
+		l.RLock()
+		return nil
+	}
+	if !l.tryRLockFor(l.timeout) {
+		return ErrLockTimeout
+	}
+	return nil
+}
+
+func (l *shardLock) record(wait time.Duration) {
+	atomic.AddInt64(&l.acquisitions, 1)
+	atomic.AddInt64(&l.waitTime, int64(wait))
+	bucket := 0
+	for bucket < len(LockWaitBuckets) && wait > LockWaitBuckets[bucket] {
+		bucket++
+	}
+	atomic.AddInt64(&l.histogram[bucket], 1)
+}
+
+// stats fills lock statistics of the shard
+func (l *shardLock) stats(s *ShardStats) {
+	s.LockAcquisitions = atomic.LoadInt64(&l.acquisitions)
+	s.LockWaitTime = time.Duration(atomic.LoadInt64(&l.waitTime))
+	for i := range l.histogram {
+		s.LockWaitHistogram[i] = atomic.LoadInt64(&l.histogram[i])
+	}
+}
+
+func (l *shardLock) resetStats() {
+	atomic.StoreInt64(&l.acquisitions, 0)
+	atomic.StoreInt64(&l.waitTime, 0)
+	for i := range l.histogram {
+		atomic.StoreInt64(&l.histogram[i], 0)
+	}
+}
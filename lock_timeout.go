@@ -0,0 +1,42 @@
+//go:build go1.18
+// +build go1.18
+
+package bigcache
+
+import "time"
+
+// maxLockBackoff is the longest pause between attempts to acquire a lock with a timeout
+const maxLockBackoff = time.Millisecond
+
+// tryLockFor acquires the write lock, giving up after timeout
+func (l *shardLock) tryLockFor(timeout time.Duration) bool {
+	return l.tryFor(timeout, l.RWMutex.TryLock)
+}
+
+// tryRLockFor acquires the read lock, giving up after timeout
+func (l *shardLock) tryRLockFor(timeout time.Duration) bool {
+	return l.tryFor(timeout, l.RWMutex.TryRLock)
+}
+
+// tryFor calls try with a growing pause between attempts until it succeeds or timeout passes
+func (l *shardLock) tryFor(timeout time.Duration, try func() bool) bool {
+	start := time.Now()
+	backoff := time.Microsecond
+	for !try() {
+		wait := time.Since(start)
+		if wait >= timeout {
+			return false
+		}
+		if backoff > timeout-wait {
+			backoff = timeout - wait
+		}
+		time.Sleep(backoff)
+		if backoff < maxLockBackoff {
+			backoff *= 2
+		}
+	}
+	if l.statsEnabled {
+		l.record(time.Since(start))
+	}
+	return true
+}
@@ -0,0 +1,18 @@
+//go:build !go1.18
+// +build !go1.18
+
+package bigcache
+
+import "time"
+
+// tryLockFor acquires the write lock, locks cannot be tried before Go 1.18 so it blocks regardless of timeout
+func (l *shardLock) tryLockFor(time.Duration) bool {
+	l.Lock()
+	return true
+}
+
+// tryRLockFor acquires the read lock, locks cannot be tried before Go 1.18 so it blocks regardless of timeout
+func (l *shardLock) tryRLockFor(time.Duration) bool {
+	l.RLock()
+	return true
+}
@@ -0,0 +1,67 @@
+//go:build go1.18
+// +build go1.18
+
+package bigcache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLockTimeout(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		LockTimeout:        10 * time.Millisecond,
+	})
+	noError(t, cache.Set("key", []byte("value")))
+	cache.shards[0].lock.Lock()
+
+	// when
+	start := time.Now()
+	_, getErr := cache.Get("key")
+	setErr := cache.Set("key", []byte("other"))
+	waited := time.Since(start)
+	cache.shards[0].lock.Unlock()
+
+	// then
+	assertEqual(t, ErrLockTimeout, getErr)
+	assertEqual(t, ErrLockTimeout, setErr)
+	if waited < 20*time.Millisecond || waited > time.Second {
+		t.Errorf("Expected to wait for two timeouts, waited %v", waited)
+	}
+	assertEqual(t, int64(2), cache.Stats().LockTimeouts)
+	entry, err := cache.Get("key")
+	noError(t, err)
+	assertEqual(t, []byte("value"), entry)
+}
+
+func TestLockTimeoutSharesReadLock(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		LockTimeout:        10 * time.Millisecond,
+	})
+	cache.Set("key", []byte("value"))
+	cache.shards[0].lock.RLock()
+
+	// when
+	entry, err := cache.Get("key")
+	cache.shards[0].lock.RUnlock()
+
+	// then
+	noError(t, err)
+	assertEqual(t, []byte("value"), entry)
+	assertEqual(t, int64(0), cache.Stats().LockTimeouts)
+}
@@ -0,0 +1,161 @@
+package bigcache
+
+import (
+	"runtime/debug"
+	"runtime/metrics"
+	"time"
+
+	"github.com/allegro/bigcache/v3/queue"
+)
+
+// runtimeMemoryLimitRatio is the fraction of the Go runtime memory limit targeted when SoftMemoryLimit is -1
+const runtimeMemoryLimitRatio = 0.9
+
+// readRuntimeMemory returns memory mapped by the Go runtime and not released to the operating system,
+// which is what the runtime memory limit applies to, and the limit which is 0 when it is not set or unknown
+func readRuntimeMemory() (used uint64, limit uint64) {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+		{Name: "/gc/gomemlimit:bytes"},
+	}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() == metrics.KindUint64 && samples[1].Value.Kind() == metrics.KindUint64 {
+		used = samples[0].Value.Uint64() - samples[1].Value.Uint64()
+	}
+	// math.MaxInt64 means no limit
+	if samples[2].Value.Kind() == metrics.KindUint64 && samples[2].Value.Uint64() < 1<<63-1 {
+		limit = samples[2].Value.Uint64()
+	}
+	return used, limit
+}
+
+// memoryMonitor trims the cache when memory of the process exceeds the soft limit
+type memoryMonitor struct {
+	cache *BigCache
+	// target is the soft limit in bytes, negative means a fraction of the runtime memory limit
+	target int64
+	read   func() (used uint64, limit uint64)
+}
+
+func newMemoryMonitor(cache *BigCache) *memoryMonitor {
+	target := int64(cache.config.SoftMemoryLimit) * 1024 * 1024
+	if cache.config.SoftMemoryLimit < 0 {
+		target = -1
+	}
+	return &memoryMonitor{cache: cache, target: target, read: readRuntimeMemory}
+}
+
+// check trims the cache by the memory above the target, it returns the number of bytes released by queues
+func (m *memoryMonitor) check() int {
+	used, limit := m.read()
+	target := uint64(m.target)
+	if m.target < 0 {
+		if limit == 0 {
+			return 0
+		}
+		target = uint64(float64(limit) * runtimeMemoryLimitRatio)
+	}
+	if used <= target {
+		return 0
+	}
+	released := m.cache.trim(int(used - target))
+	if released > 0 {
+		// return memory of replaced queues before the next check, so it is not trimmed again
+		debug.FreeOSMemory()
+	}
+	if m.cache.isVerbose() {
+		newLogger(m.cache.config.Logger).Printf("Memory %d bytes above soft limit of %d bytes, released %d bytes", used, target, released)
+	}
+	return released
+}
+
+// Shrink moves live entries of every shard to a queue just big enough to hold them, so memory of the old
+// queues can be released. Queues which would not shrink by at least a quarter and queues split into
+// TimeSegments are kept. It returns the number of bytes queues shrank by.
+func (c *BigCache) Shrink() int {
+	released := 0
+	for i, shard := range c.shards {
+		released += shard.trim(0)
+		c.recoverShardIndex(uint64(i), nil)
+	}
+	return released
+}
+
+// trim evicts the oldest entries of all shards until bytes are freed, every shard frees its part
+// proportionally to its size. Queues are compacted then, it returns the number of bytes they shrank by.
+func (c *BigCache) trim(bytes int) int {
+	used := make([]int, len(c.shards))
+	total := 0
+	for i, shard := range c.shards {
+		used[i], _, _ = shard.memoryUsage()
+		total += used[i]
+	}
+	if total == 0 {
+		return 0
+	}
+	released := 0
+	for i, shard := range c.shards {
+		if used[i] > 0 {
+			released += shard.trim(int(float64(bytes) * float64(used[i]) / float64(total)))
+		}
+	}
+	return released
+}
+
+// trim evicts the oldest entries with NoSpace reason until bytes of the queue are freed and compacts it,
+// it returns the number of bytes the queue shrank by
+func (s *cacheShard) trim(bytes int) int {
+	s.lock.Lock()
+	capacity := s.entries.Capacity()
+	for limit := s.entries.Len(); bytes > 0 && limit > 0; limit-- {
+		oldest, err := s.entries.Peek()
+		if err != nil {
+			break
+		}
+		bytes -= len(oldest)
+		s.removeOldestEntry(NoSpace)
+	}
+	s.compactWithoutLock()
+	released := capacity - s.entries.Capacity()
+	s.lock.Unlock()
+	return released
+}
+
+// compactWithoutLock moves live entries to a new queue just big enough to hold them, so memory of the old
+// queue can be released. It is skipped for time segments, whose memory is released when they are dropped,
+// and when the queue would not shrink at least by a quarter unless it exceeds the maximum shard size.
+func (s *cacheShard) compactWithoutLock() {
+	if _, ok := s.segments(); ok {
+		return
+	}
+	old := s.queue()
+	capacity := max(s.initialBytes, old.UsedBytes()-min(s.deadBytes, old.UsedBytes())+1)
+	oversized := s.maxBytes > 0 && old.Capacity() > s.maxBytes
+	if oversized {
+		capacity = min(capacity, s.maxBytes)
+	} else if capacity > old.Capacity()*3/4 {
+		return
+	}
+	start := time.Now()
+	compacted := queue.NewLazyBytesQueue(capacity, s.maxBytes, s.isVerbose())
+	old.Iterate(func(index int, wrappedEntry []byte) bool {
+		hash := readHashFromEntry(wrappedEntry)
+		if hash == 0 || s.hashmap[hash] != uint64(index) {
+			return true
+		}
+		if newIndex, err := compacted.Push(wrappedEntry); err == nil {
+			s.hashmap[hash] = uint64(newIndex)
+		} else {
+			s.removeEntry(wrappedEntry, hash, NoSpace)
+		}
+		return true
+	})
+	s.deadBytes = 0
+	if s.recovering != nil {
+		s.recovering.entryQueue = compacted
+	} else {
+		s.entries = compacted
+	}
+	s.queueResized(old.Capacity(), compacted.Capacity(), start)
+}
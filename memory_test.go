@@ -0,0 +1,164 @@
+package bigcache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTrimEvictsOldestEntriesAndCompactsQueue(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var reasons []RemoveReason
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		OnRemoveWithReason: func(key string, entry []byte, reason RemoveReason) {
+			reasons = append(reasons, reason)
+		},
+	})
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), blob('a', 100))
+	}
+	capacity := cache.Capacity()
+
+	// when
+	released := cache.trim(capacity / 2)
+
+	// then
+	assertEqual(t, capacity-cache.Capacity(), released)
+	if released <= 0 {
+		t.Errorf("Expected queue to shrink, capacity was %d and is %d", capacity, cache.Capacity())
+	}
+	if len(reasons) == 0 || cache.Len() != 100-len(reasons) {
+		t.Errorf("Expected oldest entries to be evicted, %d evicted and %d left", len(reasons), cache.Len())
+	}
+	for _, reason := range reasons {
+		assertEqual(t, NoSpace, reason)
+	}
+	_, err := cache.Get("key0")
+	assertEqual(t, ErrEntryNotFound, err)
+	value, err := cache.Get("key99")
+	noError(t, err)
+	assertEqual(t, blob('a', 100), value)
+	assertEqual(t, 0, len(cache.Verify()))
+}
+
+func TestShrinkKeepsLiveEntries(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var evicted int
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		OnRemoveWithReason: func(key string, entry []byte, reason RemoveReason) {
+			if reason != Deleted {
+				evicted++
+			}
+		},
+	})
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), blob('a', 100))
+	}
+	for i := 0; i < 90; i++ {
+		cache.Delete(fmt.Sprintf("key%d", i))
+	}
+	capacity := cache.Capacity()
+
+	// when
+	released := cache.Shrink()
+
+	// then
+	assertEqual(t, capacity-cache.Capacity(), released)
+	if released <= 0 {
+		t.Errorf("Expected queue to shrink, capacity was %d and is %d", capacity, cache.Capacity())
+	}
+	assertEqual(t, 0, evicted)
+	assertEqual(t, 10, cache.Len())
+	value, err := cache.Get("key99")
+	noError(t, err)
+	assertEqual(t, blob('a', 100), value)
+	assertEqual(t, 0, len(cache.Verify()))
+}
+
+func TestMemoryMonitorTrimsAboveSoftLimit(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	})
+	for i := 0; i < 400; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), blob('a', 100))
+	}
+	monitor := &memoryMonitor{cache: cache, target: 1 << 20, read: func() (uint64, uint64) {
+		return 1<<20 + 20*1024, 0
+	}}
+
+	// when
+	monitor.check()
+
+	// then
+	if cache.Len() >= 400 {
+		t.Errorf("Expected entries to be evicted, %d left", cache.Len())
+	}
+	assertEqual(t, 0, len(cache.Verify()))
+}
+
+func TestMemoryMonitorKeepsEntriesBelowSoftLimit(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	})
+	cache.Set("key", []byte("value"))
+	below := &memoryMonitor{cache: cache, target: 1 << 20, read: func() (uint64, uint64) {
+		return 1 << 19, 0
+	}}
+	noLimit := &memoryMonitor{cache: cache, target: -1, read: func() (uint64, uint64) {
+		return 1 << 30, 0
+	}}
+
+	// when
+	below.check()
+	noLimit.check()
+
+	// then
+	assertEqual(t, 1, cache.Len())
+}
+
+func TestMemoryMonitorTargetsRuntimeMemoryLimit(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	})
+	cache.Set("key", []byte("value"))
+	monitor := &memoryMonitor{cache: cache, target: -1, read: func() (uint64, uint64) {
+		return 95, 100
+	}}
+
+	// when
+	monitor.check()
+
+	// then
+	assertEqual(t, 0, cache.Len())
+}
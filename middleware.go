@@ -0,0 +1,196 @@
+package bigcache
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	rawValue        = 0 // Header of values stored uncompressed by CompressionMiddleware
+	compressedValue = 1 // Header of values stored compressed by CompressionMiddleware
+)
+
+// ErrInvalidCompressedValue is returned by CompressionMiddleware when a read value was not written by it
+var ErrInvalidCompressedValue = errors.New("value was not written by compression middleware")
+
+// Middleware decorates a cache with a cross-cutting feature
+type Middleware func(next Interface) Interface
+
+// Wrap decorates the cache with middlewares. The first middleware is the outermost one,
+// so it sees calls first and results last.
+func Wrap(cache Interface, mws ...Middleware) Interface {
+	for i := len(mws) - 1; i >= 0; i-- {
+		cache = mws[i](cache)
+	}
+	return cache
+}
+
+// aroundCache calls around for every Get, Set and Delete, which has to call the operation exactly once
+type aroundCache struct {
+	Interface
+	around func(operation string, key string, call func() error) error
+}
+
+func (c *aroundCache) Get(key string) (entry []byte, err error) {
+	err = c.around("Get", key, func() error {
+		entry, err = c.Interface.Get(key)
+		return err
+	})
+	return entry, err
+}
+
+func (c *aroundCache) Set(key string, entry []byte) error {
+	return c.around("Set", key, func() error {
+		return c.Interface.Set(key, entry)
+	})
+}
+
+func (c *aroundCache) Delete(key string) error {
+	return c.around("Delete", key, func() error {
+		return c.Interface.Delete(key)
+	})
+}
+
+// MetricsMiddleware reports name, duration and result of every Get, Set and Delete to observe,
+// e.g. to feed Prometheus histograms.
+func MetricsMiddleware(observe func(operation string, duration time.Duration, err error)) Middleware {
+	return func(next Interface) Interface {
+		return &aroundCache{Interface: next, around: func(operation string, key string, call func() error) error {
+			start := time.Now()
+			err := call()
+			observe(operation, time.Since(start), err)
+			return err
+		}}
+	}
+}
+
+// TracingMiddleware starts a span for every Get, Set and Delete, finish is called with the result
+// of the operation. It allows plugging in any tracing library.
+func TracingMiddleware(start func(operation string, key string) (finish func(err error))) Middleware {
+	return func(next Interface) Interface {
+		return &aroundCache{Interface: next, around: func(operation string, key string, call func() error) error {
+			finish := start(operation, key)
+			err := call()
+			finish(err)
+			return err
+		}}
+	}
+}
+
+// LoggingMiddleware writes every Get, Set and Delete with its duration and error to the logger
+func LoggingMiddleware(logger Logger) Middleware {
+	return func(next Interface) Interface {
+		return &aroundCache{Interface: next, around: func(operation string, key string, call func() error) error {
+			start := time.Now()
+			err := call()
+			logger.Printf("%s %q took %s, error: %v", operation, key, time.Since(start), err)
+			return err
+		}}
+	}
+}
+
+// SingleflightMiddleware makes concurrent Gets of the same key share a single call to the cache,
+// which protects slow remote caches from bursts of identical reads. Callers get copies of the entry.
+func SingleflightMiddleware() Middleware {
+	return func(next Interface) Interface {
+		return &singleflightCache{Interface: next, calls: make(map[string]*flight)}
+	}
+}
+
+type flight struct {
+	wg    sync.WaitGroup
+	entry []byte
+	err   error
+}
+
+type singleflightCache struct {
+	Interface
+	lock  sync.Mutex
+	calls map[string]*flight
+}
+
+func (c *singleflightCache) Get(key string) ([]byte, error) {
+	c.lock.Lock()
+	if f, ok := c.calls[key]; ok {
+		c.lock.Unlock()
+		f.wg.Wait()
+		if f.err != nil {
+			return nil, f.err
+		}
+		return append([]byte(nil), f.entry...), nil
+	}
+	f := &flight{}
+	f.wg.Add(1)
+	c.calls[key] = f
+	c.lock.Unlock()
+
+	f.entry, f.err = c.Interface.Get(key)
+	c.lock.Lock()
+	delete(c.calls, key)
+	c.lock.Unlock()
+	f.wg.Done()
+
+	if f.err != nil {
+		return nil, f.err
+	}
+	return append([]byte(nil), f.entry...), nil
+}
+
+// CompressionMiddleware stores entries of at least minSize bytes compressed with deflate, when it
+// makes them smaller. Entries are prefixed with a header byte, so all of them have to be written
+// through the middleware, Get returns ErrInvalidCompressedValue for others.
+func CompressionMiddleware(minSize int) Middleware {
+	return func(next Interface) Interface {
+		return &compressionCache{Interface: next, minSize: minSize}
+	}
+}
+
+type compressionCache struct {
+	Interface
+	minSize int
+}
+
+func (c *compressionCache) Get(key string) ([]byte, error) {
+	entry, err := c.Interface.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(entry) == 0 {
+		return nil, ErrInvalidCompressedValue
+	}
+	switch entry[0] {
+	case rawValue:
+		return entry[1:], nil
+	case compressedValue:
+		reader := flate.NewReader(bytes.NewReader(entry[1:]))
+		defer reader.Close()
+		value, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, ErrInvalidCompressedValue
+		}
+		return value, nil
+	default:
+		return nil, ErrInvalidCompressedValue
+	}
+}
+
+func (c *compressionCache) Set(key string, entry []byte) error {
+	if len(entry) >= c.minSize {
+		var buf bytes.Buffer
+		buf.WriteByte(compressedValue)
+		writer, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+		writer.Write(entry)
+		writer.Close()
+		if buf.Len() < len(entry)+1 {
+			return c.Interface.Set(key, buf.Bytes())
+		}
+	}
+	value := make([]byte, len(entry)+1)
+	value[0] = rawValue
+	copy(value[1:], entry)
+	return c.Interface.Set(key, value)
+}
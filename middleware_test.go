@@ -0,0 +1,307 @@
+package bigcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowCache counts Gets and delays them, so concurrent calls overlap
+type slowCache struct {
+	Interface
+	gets int32
+}
+
+func (c *slowCache) Get(key string) ([]byte, error) {
+	atomic.AddInt32(&c.gets, 1)
+	time.Sleep(50 * time.Millisecond)
+	return c.Interface.Get(key)
+}
+
+func TestWrapOrder(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	var calls []string
+	record := func(name string) Middleware {
+		return TracingMiddleware(func(operation string, key string) func(err error) {
+			calls = append(calls, name+" start")
+			return func(err error) {
+				calls = append(calls, name+" finish")
+			}
+		})
+	}
+
+	// when
+	wrapped := Wrap(cache, record("outer"), record("inner"))
+	wrapped.Set("key", []byte("value"))
+
+	// then
+	assertEqual(t, []string{"outer start", "inner start", "inner finish", "outer finish"}, calls)
+	assertEqual(t, 1, wrapped.Len())
+}
+
+func TestMetricsAndLoggingMiddleware(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	var buf bytes.Buffer
+	var operations []string
+	var errs []error
+	wrapped := Wrap(cache,
+		MetricsMiddleware(func(operation string, duration time.Duration, err error) {
+			operations = append(operations, operation)
+			errs = append(errs, err)
+		}),
+		LoggingMiddleware(log.New(&buf, "", 0)))
+
+	// when
+	wrapped.Set("key", []byte("value"))
+	wrapped.Get("key")
+	wrapped.Delete("missing")
+
+	// then
+	assertEqual(t, []string{"Set", "Get", "Delete"}, operations)
+	assertEqual(t, []error{nil, nil, ErrEntryNotFound}, errs)
+	assertEqual(t, 3, strings.Count(buf.String(), "\n"))
+	assertEqual(t, true, strings.Contains(buf.String(), `Delete "missing"`))
+}
+
+func TestSingleflightMiddleware(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	cache.Set("key", []byte("value"))
+	slow := &slowCache{Interface: cache}
+	wrapped := Wrap(slow, SingleflightMiddleware())
+
+	// when
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entry, err := wrapped.Get("key")
+			noError(t, err)
+			assertEqual(t, []byte("value"), entry)
+		}()
+	}
+	wg.Wait()
+
+	// then
+	assertEqual(t, int32(1), atomic.LoadInt32(&slow.gets))
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	wrapped := Wrap(cache, CompressionMiddleware(64))
+	big := bytes.Repeat([]byte("a"), 1024)
+
+	// when
+	wrapped.Set("big", big)
+	wrapped.Set("small", []byte("value"))
+	cache.Set("raw", []byte("value"))
+
+	// then
+	entry, _ := wrapped.Get("big")
+	assertEqual(t, big, entry)
+	stored, _ := cache.Get("big")
+	assertEqual(t, true, len(stored) < len(big))
+	entry, _ = wrapped.Get("small")
+	assertEqual(t, []byte("value"), entry)
+	_, err := wrapped.Get("raw")
+	assertEqual(t, ErrInvalidCompressedValue, err)
+}
+
+func TestChunkingMiddleware(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             8,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 100,
+		MaxEntrySize:       1024,
+		HardMaxCacheSize:   1,
+	})
+	wrapped := Wrap(cache, ChunkingMiddleware(32*1024))
+	big := blob('a', 512*1024)
+
+	// when
+	err := cache.Set("unchunked", big)
+	chunkedErr := wrapped.Set("big", big)
+	wrapped.Set("small", []byte("value"))
+
+	// then
+	assertEqual(t, ErrEntryExceedsShardCapacity, err)
+	noError(t, chunkedErr)
+	entry, err := wrapped.Get("big")
+	noError(t, err)
+	assertEqual(t, big, entry)
+	entry, _ = wrapped.Get("small")
+	assertEqual(t, []byte("value"), entry)
+	assertEqual(t, 16+1+1, cache.Len())
+
+	// when
+	wrapped.Set("big", blob('b', 64*1024))
+
+	// then
+	entry, _ = wrapped.Get("big")
+	assertEqual(t, blob('b', 64*1024), entry)
+	assertEqual(t, 2+1+1, cache.Len())
+
+	// when
+	wrapped.Delete("big")
+
+	// then
+	assertEqual(t, 1, cache.Len())
+	cache.Set("raw", []byte("value"))
+	_, err = wrapped.Get("raw")
+	assertEqual(t, ErrInvalidChunkedValue, err)
+}
+
+func TestChunkingMiddlewareMissingChunk(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	wrapped := Wrap(cache, ChunkingMiddleware(4))
+	wrapped.Set("key", []byte("chunked value"))
+	var chunkKey string
+	iterator := cache.Iterator()
+	for iterator.SetNext() {
+		info, _ := iterator.Value()
+		if info.Key() != "key" {
+			chunkKey = info.Key()
+		}
+	}
+
+	// when
+	cache.Delete(chunkKey)
+	_, err := wrapped.Get("key")
+
+	// then
+	assertEqual(t, ErrEntryNotFound, err)
+}
+
+func TestDeduplicationMiddleware(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	wrapped := Wrap(cache, DeduplicationMiddleware(16))
+	shared := blob('a', 1024)
+
+	// when
+	for i := 0; i < 10; i++ {
+		wrapped.Set(fmt.Sprintf("user%d", i), shared)
+	}
+	wrapped.Set("small", []byte("value"))
+
+	// then
+	for i := 0; i < 10; i++ {
+		entry, err := wrapped.Get(fmt.Sprintf("user%d", i))
+		noError(t, err)
+		assertEqual(t, shared, entry)
+	}
+	entry, _ := wrapped.Get("small")
+	assertEqual(t, []byte("value"), entry)
+	// keys, small value, shared value and its reference count
+	assertEqual(t, 10+1+2, cache.Len())
+
+	// when
+	for i := 0; i < 9; i++ {
+		wrapped.Delete(fmt.Sprintf("user%d", i))
+	}
+	wrapped.Set("user9", blob('b', 1024))
+
+	// then
+	entry, _ = wrapped.Get("user9")
+	assertEqual(t, blob('b', 1024), entry)
+	assertEqual(t, 1+1+2, cache.Len())
+
+	// when
+	wrapped.Set("user9", []byte("unique"))
+
+	// then
+	assertEqual(t, 2, cache.Len())
+	cache.Set("raw", []byte("value"))
+	_, err := wrapped.Get("raw")
+	assertEqual(t, ErrInvalidSharedValue, err)
+}
+
+func TestDeduplicationMiddlewareEvictedValue(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	wrapped := Wrap(cache, DeduplicationMiddleware(4))
+	value := []byte("shared value")
+	wrapped.Set("a", value)
+	wrapped.Set("b", value)
+	cache.Delete(contentKey(sha256.Sum256(value)))
+
+	// when
+	_, err := wrapped.Get("a")
+	restoreErr := wrapped.Set("a", value)
+
+	// then
+	assertEqual(t, ErrEntryNotFound, err)
+	noError(t, restoreErr)
+	entry, err := wrapped.Get("b")
+	noError(t, err)
+	assertEqual(t, value, entry)
+}
+
+func TestDeduplicationMiddlewareConcurrentWritesOfKey(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	wrapped := Wrap(cache, DeduplicationMiddleware(4))
+	value := []byte("shared value")
+	wrapped.Set("b", value)
+	var wg sync.WaitGroup
+
+	// when
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				wrapped.Set("a", value)
+				wrapped.Delete("a")
+			}
+		}()
+	}
+	wg.Wait()
+
+	// then
+	entry, err := wrapped.Get("b")
+	noError(t, err)
+	assertEqual(t, value, entry)
+	assertEqual(t, uint32(1), wrapped.(*dedupCache).refs(sha256.Sum256(value)))
+	wrapped.Delete("b")
+	assertEqual(t, 0, cache.Len())
+}
@@ -0,0 +1,55 @@
+package bigcache
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// staleEntry is an entry of another value version than Config.ValueVersion read by Get
+type staleEntry struct {
+	index     uint64
+	timestamp uint64
+	version   uint8
+	value     []byte
+}
+
+// migrate converts the value of the stale entry with Config.ValueMigrator outside the shard lock and replaces
+// the entry keeping its timestamp, unless the key was written meanwhile. Entries which cannot be migrated
+// are removed and reported as not found.
+func (s *cacheShard) migrate(key string, hashedKey uint64, stale staleEntry) ([]byte, error) {
+	value, version := stale.value, stale.version
+	var err error
+	// every step has to change the version, so a migrator returning the same one cannot loop forever
+	for steps := 0; version != s.valueVersion && err == nil; steps++ {
+		previous := version
+		if value, version, err = s.valueMigrator(version, value); err == nil && (version == previous || steps == 255) {
+			err = fmt.Errorf("migration of version %d did not reach version %d", previous, s.valueVersion)
+		}
+	}
+
+	s.lock.Lock()
+	current := s.hashmap[hashedKey] == stale.index
+	if err != nil {
+		if current {
+			if wrappedEntry, getErr := s.entries.Get(int(stale.index)); getErr == nil {
+				s.deleteEntry(wrappedEntry, hashedKey)
+			}
+		}
+		s.lock.Unlock()
+		atomic.AddInt64(&s.stats.MigrationErrors, 1)
+		if s.isVerbose() {
+			s.logger.Printf("Migration of key %q from version %d failed: %v", key, stale.version, err)
+		}
+		s.miss()
+		return nil, ErrEntryNotFound
+	}
+	if current {
+		err = s.setWithoutLock(stale.timestamp, key, hashedKey, value)
+	}
+	s.lock.Unlock()
+	if err == nil {
+		atomic.AddInt64(&s.stats.Migrations, 1)
+	}
+	s.hit(hashedKey, len(value))
+	return value, nil
+}
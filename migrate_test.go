@@ -0,0 +1,111 @@
+package bigcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// deployVersion restores the snapshot of the cache into a new one with the value version and migrator
+func deployVersion(t *testing.T, snapshot []byte, version uint8, migrator func(uint8, []byte) ([]byte, uint8, error)) *BigCache {
+	cache, err := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		EntryFormat:        EntryFormatV2,
+		ValueVersion:       version,
+		ValueMigrator:      migrator,
+	})
+	noError(t, err)
+	if snapshot != nil {
+		_, err = cache.ReadFrom(bytes.NewReader(snapshot))
+		noError(t, err)
+	}
+	return cache
+}
+
+func TestValueMigratorMigratesEntriesOfOlderVersions(t *testing.T) {
+	t.Parallel()
+
+	// given
+	old := deployVersion(t, nil, 1, nil)
+	old.Set("key", []byte("value"))
+	var snapshot bytes.Buffer
+	old.WriteTo(&snapshot)
+	var calls []uint8
+	cache := deployVersion(t, snapshot.Bytes(), 3, func(version uint8, value []byte) ([]byte, uint8, error) {
+		calls = append(calls, version)
+		return append(value, fmt.Sprintf("+%d", version+1)...), version + 1, nil
+	})
+	cache.Set("fresh", []byte("value"))
+
+	// when
+	migrated, err := cache.Get("key")
+	again, againErr := cache.Get("key")
+	fresh, _ := cache.Get("fresh")
+
+	// then
+	noError(t, err)
+	noError(t, againErr)
+	assertEqual(t, []byte("value+2+3"), migrated)
+	assertEqual(t, migrated, again)
+	assertEqual(t, []byte("value"), fresh)
+	assertEqual(t, []uint8{1, 2}, calls)
+	assertEqual(t, int64(1), cache.Stats().Migrations)
+	assertEqual(t, entryTimestamps(old)["key"], entryTimestamps(cache)["key"])
+}
+
+func TestValueMigratorFailureRemovesEntry(t *testing.T) {
+	t.Parallel()
+
+	// given
+	old := deployVersion(t, nil, 1, nil)
+	old.Set("key", []byte("value"))
+	var snapshot bytes.Buffer
+	old.WriteTo(&snapshot)
+	cache := deployVersion(t, snapshot.Bytes(), 2, func(version uint8, value []byte) ([]byte, uint8, error) {
+		return nil, 0, errors.New("unknown encoding")
+	})
+
+	// when
+	_, err := cache.Get("key")
+
+	// then
+	assertEqual(t, ErrEntryNotFound, err)
+	assertEqual(t, 0, cache.Len())
+	assertEqual(t, int64(1), cache.Stats().MigrationErrors)
+}
+
+func TestValueMigratorMustChangeVersion(t *testing.T) {
+	t.Parallel()
+
+	// given
+	old := deployVersion(t, nil, 1, nil)
+	old.Set("key", []byte("value"))
+	var snapshot bytes.Buffer
+	old.WriteTo(&snapshot)
+	cache := deployVersion(t, snapshot.Bytes(), 2, func(version uint8, value []byte) ([]byte, uint8, error) {
+		return value, version, nil
+	})
+
+	// when
+	_, err := cache.Get("key")
+
+	// then
+	assertEqual(t, ErrEntryNotFound, err)
+	assertEqual(t, int64(1), cache.Stats().MigrationErrors)
+}
+
+func entryTimestamps(cache *BigCache) map[string]uint64 {
+	timestamps := map[string]uint64{}
+	iterator := cache.Iterator()
+	for iterator.SetNext() {
+		entry, _ := iterator.Value()
+		timestamps[entry.Key()] = entry.Timestamp()
+	}
+	return timestamps
+}
@@ -0,0 +1,81 @@
+package bigcache
+
+import "sync/atomic"
+
+// MissKind tells why Get did not find a key, see Config.OnMiss
+type MissKind int
+
+const (
+	// MissNeverSeen means the key was not removed recently, it was never set or its removal was forgotten
+	MissNeverSeen = MissKind(0)
+	// MissExpired means the entry of the key expired
+	MissExpired = MissKind(Expired)
+	// MissEvicted means the entry of the key was evicted because there was no space left
+	MissEvicted = MissKind(NoSpace)
+	// MissDeleted means the key was deleted
+	MissDeleted = MissKind(Deleted)
+)
+
+// removalSketch remembers why keys were removed recently. It is a direct-mapped table of hashes with
+// the reason packed in their two lowest bits, a removal overwrites the oldest removal of its slot,
+// so reasons of keys removed long ago are forgotten. Slots are accessed atomically, they are written
+// with the write lock of the shard held and read without it.
+type removalSketch struct {
+	slots []uint64
+	mask  uint64
+}
+
+func newRemovalSketch(entries int) *removalSketch {
+	size := minimumSketchWidth
+	for size < entries {
+		size *= 2
+	}
+	return &removalSketch{slots: make([]uint64, size), mask: uint64(size - 1)}
+}
+
+// add remembers the reason of the removal of the hash
+func (r *removalSketch) add(hashedKey uint64, reason RemoveReason) {
+	atomic.StoreUint64(&r.slots[hashedKey&r.mask], hashedKey&^3|uint64(reason))
+}
+
+// kind returns why the hash was removed, MissNeverSeen when its removal is not remembered
+func (r *removalSketch) kind(hashedKey uint64) MissKind {
+	slot := atomic.LoadUint64(&r.slots[hashedKey&r.mask])
+	if slot == 0 || slot&^3 != hashedKey&^3 {
+		return MissNeverSeen
+	}
+	return MissKind(slot & 3)
+}
+
+// rememberRemoval records the reason of the removal of the hash, it has to be called with the write lock held
+func (s *cacheShard) rememberRemoval(hashedKey uint64, reason RemoveReason) {
+	if s.removals != nil {
+		s.removals.add(hashedKey, reason)
+	}
+}
+
+// missKind classifies the miss of the hash. An entry still stored is expired, e.g. found by ExpireOnGet.
+func (s *cacheShard) missKind(hashedKey uint64) MissKind {
+	kind := MissNeverSeen
+	s.lock.RLock()
+	if itemIndex := s.hashmap[hashedKey]; itemIndex != 0 {
+		if wrappedEntry, err := s.entries.Get(int(itemIndex)); err == nil && s.isExpired(wrappedEntry, uint64(s.clock.Epoch())) {
+			kind = MissExpired
+		}
+	}
+	if kind == MissNeverSeen && s.isTombstoned(hashedKey) {
+		kind = MissDeleted
+	}
+	if kind == MissNeverSeen {
+		kind = s.removals.kind(hashedKey)
+	}
+	s.lock.RUnlock()
+	return kind
+}
+
+// missed calls Config.OnMiss when reading the key failed because it was not found
+func (c *BigCache) missed(key string, hashedKey uint64, err error) {
+	if c.config.OnMiss != nil && (err == ErrEntryNotFound || err == ErrEntryDeleted) {
+		c.config.OnMiss(key, c.getShard(hashedKey).missKind(hashedKey))
+	}
+}
@@ -0,0 +1,88 @@
+package bigcache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestOnMissClassifiesMisses(t *testing.T) {
+	t.Parallel()
+
+	// given
+	misses := make(map[string]MissKind)
+	clock := mockedClock{value: 0}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		MaxEntries:         2,
+		OnMiss: func(key string, kind MissKind) {
+			misses[key] = kind
+		},
+	}, &clock)
+	cache.Set("expired", []byte("value"))
+	clock.set(5)
+	cache.Set("evicted", []byte("value"))
+	cache.Set("deleted", []byte("value"))
+	cache.Delete("deleted")
+	cache.Set("a", []byte("value"))
+	cache.Set("b", []byte("value"))
+
+	// when
+	for _, key := range []string{"expired", "evicted", "deleted", "unknown", "a"} {
+		cache.Get(key)
+	}
+
+	// then
+	assertEqual(t, map[string]MissKind{
+		"expired": MissExpired,
+		"evicted": MissEvicted,
+		"deleted": MissDeleted,
+		"unknown": MissNeverSeen,
+	}, misses)
+}
+
+func TestOnMissClassifiesEntriesExpiredOnGet(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var missed MissKind
+	clock := mockedClock{value: 0}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		ExpireOnGet:        true,
+		OnMiss: func(key string, kind MissKind) {
+			missed = kind
+		},
+	}, &clock)
+	cache.Set("key", []byte("value"))
+	clock.set(5)
+
+	// when
+	_, err := cache.Get("key")
+
+	// then
+	assertEqual(t, ErrEntryNotFound, err)
+	assertEqual(t, MissExpired, missed)
+}
+
+func TestRemovalSketchForgetsOverwrittenSlots(t *testing.T) {
+	t.Parallel()
+
+	// given
+	sketch := newRemovalSketch(0)
+
+	// when
+	sketch.add(1<<10|5, NoSpace)
+	sketch.add(2<<10|5, Deleted)
+
+	// then
+	assertEqual(t, MissNeverSeen, sketch.kind(1<<10|5))
+	assertEqual(t, MissDeleted, sketch.kind(2<<10|5))
+	assertEqual(t, MissNeverSeen, sketch.kind(7))
+}
@@ -0,0 +1,64 @@
+package bigcache
+
+import (
+	"sync"
+	"time"
+)
+
+// poisonByte fills entries lent by Get with Config.NoCopyGetDebug once their memory may be reused
+const poisonByte = 0xA5
+
+// lentEntries tracks entries returned by Get with Config.NoCopyGetDebug until the next write to the shard
+type lentEntries struct {
+	lock    sync.Mutex
+	entries [][]byte
+}
+
+// lend remembers the entry, it is called with the shard read lock held
+func (l *lentEntries) lend(entry []byte) {
+	l.lock.Lock()
+	l.entries = append(l.entries, entry)
+	l.lock.Unlock()
+}
+
+// poison fills lent entries with poisonByte and forgets them, it is called with the shard write lock held
+func (l *lentEntries) poison() {
+	l.lock.Lock()
+	for _, entry := range l.entries {
+		for i := range entry {
+			entry[i] = poisonByte
+		}
+	}
+	l.entries = nil
+	l.lock.Unlock()
+}
+
+// readLentEntry reads entry returned by Get, it references the queue with Config.NoCopyGet
+func (s *cacheShard) readLentEntry(wrappedEntry []byte) []byte {
+	if !s.noCopyGet {
+		return readEntry(wrappedEntry)
+	}
+	if s.lent == nil {
+		return readEntryWithoutCopy(wrappedEntry)
+	}
+	entry := readEntry(wrappedEntry)
+	s.lent.lend(entry)
+	return entry
+}
+
+// push pushes the wrapped entry to the queue, entries lent by Get are poisoned first as it may reuse their memory
+func (s *cacheShard) push(w []byte) (int, error) {
+	if s.lent != nil {
+		s.lent.poison()
+	}
+	var start time.Time
+	if s.onQueueResize != nil {
+		start = time.Now()
+	}
+	from := s.entries.Capacity()
+	index, err := s.entries.Push(w)
+	if to := s.entries.Capacity(); to != from {
+		s.queueResized(from, to, start)
+	}
+	return index, err
+}
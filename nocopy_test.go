@@ -0,0 +1,59 @@
+package bigcache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNoCopyGet(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		NoCopyGet:          true,
+	})
+	cache.Set("key", []byte("value"))
+
+	// when
+	first, _ := cache.Get("key")
+	second, _ := cache.Get("key")
+
+	// then
+	assertEqual(t, []byte("value"), first)
+	assertEqual(t, &first[0], &second[0])
+}
+
+func TestNoCopyGetDebugPoisonsEntriesOnWrite(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		NoCopyGet:          true,
+		NoCopyGetDebug:     true,
+	})
+	cache.Set("key", []byte("value"))
+	entry, _ := cache.Get("key")
+
+	// when
+	cache.Set("other", []byte("value"))
+
+	// then
+	assertEqual(t, []byte{poisonByte, poisonByte, poisonByte, poisonByte, poisonByte}, entry)
+	current, _ := cache.Get("key")
+	assertEqual(t, []byte("value"), current)
+
+	// when
+	cache.Reset()
+
+	// then
+	assertEqual(t, []byte{poisonByte, poisonByte, poisonByte, poisonByte, poisonByte}, current)
+}
@@ -0,0 +1,133 @@
+//go:build !bigcache_nohttp
+// +build !bigcache_nohttp
+
+package bigcache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultOriginTimeout = time.Second
+
+// OriginConfig configures OriginMiddleware
+type OriginConfig struct {
+	// URL of the origin, every {key} is replaced with the path escaped key, e.g. http://origin/items/{key}
+	URL string
+	// Timeout of a single request to the origin. Default value is 1 second.
+	Timeout time.Duration
+	// Header is sent with every request to the origin, e.g. authorization
+	Header http.Header
+	// Client sends requests to the origin. Default value is a client with Timeout.
+	Client *http.Client
+}
+
+// OriginMiddleware turns the cache into a read-through HTTP cache: Gets of missing keys fetch the entry from
+// the origin and cache it. Entries are cached for max-age (or s-maxage) of the Cache-Control response header
+// when the cache supports Expire, and are not cached at all for no-store, no-cache, private or zero max-age.
+// Get returns ErrEntryNotFound when the origin responds 404. Place SingleflightMiddleware before it
+// to fetch concurrently missed keys only once.
+func OriginMiddleware(config OriginConfig) Middleware {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultOriginTimeout
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: config.Timeout}
+	}
+	return func(next Interface) Interface {
+		return &originCache{Interface: next, config: config}
+	}
+}
+
+type originCache struct {
+	Interface
+	config OriginConfig
+}
+
+func (c *originCache) Get(key string) ([]byte, error) {
+	entry, err := c.Interface.Get(key)
+	if err != ErrEntryNotFound {
+		return entry, err
+	}
+	entry, ttl, err := c.fetch(key)
+	if err != nil {
+		return nil, err
+	}
+	if ttl != 0 {
+		c.store(key, entry, ttl)
+	}
+	return entry, nil
+}
+
+// store caches the entry, negative ttl means the default lifetime of the cache
+func (c *originCache) store(key string, entry []byte, ttl time.Duration) {
+	if c.Interface.Set(key, entry) != nil || ttl < 0 {
+		return
+	}
+	if expirer, ok := c.Interface.(interface {
+		Expire(key string, ttl time.Duration) error
+	}); ok {
+		expirer.Expire(key, ttl)
+	}
+}
+
+// fetch reads entry from the origin with its time to live, zero when it must not be cached
+func (c *originCache) fetch(key string) ([]byte, time.Duration, error) {
+	request, err := http.NewRequest(http.MethodGet, strings.Replace(c.config.URL, "{key}", url.PathEscape(key), -1), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	for name, values := range c.config.Header {
+		request.Header[name] = values
+	}
+	response, err := c.config.Client.Do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, 0, ErrEntryNotFound
+	default:
+		return nil, 0, fmt.Errorf("origin responded with status %d", response.StatusCode)
+	}
+	entry, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	return entry, cacheControlTTL(response.Header.Get("Cache-Control")), nil
+}
+
+// cacheControlTTL returns time to live from Cache-Control header, zero when the response must not be cached
+// and -1 when the header does not limit it
+func cacheControlTTL(header string) time.Duration {
+	ttl, shared := time.Duration(-1), false
+	for _, directive := range strings.Split(header, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		name, value := directive, ""
+		if i := strings.Index(directive, "="); i >= 0 {
+			name, value = directive[:i], strings.Trim(directive[i+1:], `"`)
+		}
+		switch name {
+		case "no-store", "no-cache", "private":
+			return 0
+		case "max-age", "s-maxage":
+			if shared && name == "max-age" {
+				continue
+			}
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds < 0 {
+				return 0
+			}
+			ttl, shared = time.Duration(seconds)*time.Second, name == "s-maxage"
+		}
+	}
+	return ttl
+}
@@ -0,0 +1,87 @@
+//go:build !bigcache_nohttp
+// +build !bigcache_nohttp
+
+package bigcache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOriginMiddleware(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var requests int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("Authorization") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/items/short":
+			w.Header().Set("Cache-Control", "public, max-age=10")
+		case "/items/private":
+			w.Header().Set("Cache-Control", "private")
+		case "/items/missing":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("value of " + r.URL.Path))
+	}))
+	defer origin.Close()
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	wrapped := Wrap(cache, OriginMiddleware(OriginConfig{
+		URL:    origin.URL + "/items/{key}",
+		Header: http.Header{"Authorization": []string{"token"}},
+	}))
+
+	// when
+	entry, err := wrapped.Get("short")
+
+	// then
+	noError(t, err)
+	assertEqual(t, []byte("value of /items/short"), entry)
+	ttl, _ := cache.TTL("short")
+	assertEqual(t, 10*time.Second, ttl)
+	wrapped.Get("short")
+	assertEqual(t, int32(1), atomic.LoadInt32(&requests))
+
+	// when
+	wrapped.Get("default")
+	wrapped.Get("private")
+	_, err = wrapped.Get("missing")
+
+	// then
+	assertEqual(t, ErrEntryNotFound, err)
+	ttl, _ = cache.TTL("default")
+	assertEqual(t, time.Minute, ttl)
+	_, err = cache.Get("private")
+	assertEqual(t, ErrEntryNotFound, err)
+	assertEqual(t, int32(4), atomic.LoadInt32(&requests))
+}
+
+func TestCacheControlTTL(t *testing.T) {
+	t.Parallel()
+
+	for header, want := range map[string]time.Duration{
+		"":                       -1,
+		"public":                 -1,
+		"max-age=60":             time.Minute,
+		"max-age=\"5\"":          5 * time.Second,
+		"s-maxage=5, max-age=60": 5 * time.Second,
+		"max-age=60, S-MAXAGE=5": 5 * time.Second,
+		"max-age=0":              0,
+		"max-age=60, no-store":   0,
+		"no-cache":               0,
+		"max-age=invalid":        0,
+	} {
+		assertEqual(t, want, cacheControlTTL(header))
+	}
+}
@@ -0,0 +1,473 @@
+package bigcache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// EvictionPolicy decides which entries are evicted when a shard has no space left for a new entry.
+// Expired entries are always removed regardless of the policy.
+type EvictionPolicy int
+
+const (
+	// FIFO evicts the oldest entries first. It is the default policy.
+	FIFO = EvictionPolicy(0)
+	// SLRU is a segmented LRU. New entries land in the probation segment and are promoted to
+	// the protected segment when they are read. When space is needed, protected entries get
+	// a second chance: they are demoted to probation and reinserted instead of being evicted.
+	// It is more resistant to scans than FIFO, at the cost of copying reinserted entries.
+	SLRU = EvictionPolicy(1)
+	// ARC is an adaptive replacement cache. It keeps recently and frequently read entries in
+	// separate segments and remembers keys of recently evicted entries, using hits on them to
+	// tune the target size of both segments, so it self-tunes between recency and frequency.
+	ARC = EvictionPolicy(2)
+	// LFU keeps frequently accessed entries longer. Accesses are counted in a compact sketch of 4-bit counters
+	// which are halved periodically, so the frequency decays exponentially. When space is needed, the oldest
+	// entry accessed at least twice recently is reinserted instead of evicted, until it reaches the head
+	// of the queue again without being read.
+	LFU = EvictionPolicy(3)
+)
+
+// OnFullPolicy decides what happens to a new entry when a shard reached its HardMaxCacheSize or MaxEntries
+type OnFullPolicy int
+
+const (
+	// EvictOldest makes room for the new entry by evicting entries chosen by EvictionPolicy. It is the default.
+	EvictOldest = OnFullPolicy(0)
+	// RejectWrite refuses the new entry with ErrShardFull, so no live entry is ever lost.
+	// It fits caches holding data that must not be lost, e.g. deduplication windows. Expired entries are still removed.
+	RejectWrite = OnFullPolicy(1)
+)
+
+const defaultSLRUProtectedRatio = 0.8
+
+// evictionPolicy tracks entries of a single shard. Methods are called with the shard write lock held,
+// except onAccess which is called without any shard lock, so implementations have to synchronize themselves.
+// Policies returning true from usesFrequency get decayed access frequency of entries from a sketch kept by the shard.
+type evictionPolicy interface {
+	onAdd(hashedKey uint64)
+	onAccess(hashedKey uint64)
+	onRemove(hashedKey uint64, reason RemoveReason)
+	// reinsert reports whether the oldest entry should be moved to the tail of the queue instead of evicted,
+	// frequency is the estimated number of recent accesses of the entry, at most 15
+	reinsert(hashedKey uint64, frequency uint8) bool
+	usesFrequency() bool
+	reset()
+	stats() SegmentStats
+}
+
+func newEvictionPolicy(config Config) evictionPolicy {
+	if config.NewPolicy != nil {
+		return newCustomPolicy(config.NewPolicy)
+	}
+	switch config.EvictionPolicy {
+	case SLRU:
+		ratio := config.SLRUProtectedRatio
+		if ratio == 0 {
+			ratio = defaultSLRUProtectedRatio
+		}
+		return newSLRUPolicy(ratio)
+	case ARC:
+		return newARCPolicy()
+	case LFU:
+		return newLFUPolicy()
+	default:
+		return nil
+	}
+}
+
+type slruSegment uint8
+
+const (
+	probationSegment = slruSegment(0)
+	protectedSegment = slruSegment(1)
+)
+
+type slruPolicy struct {
+	lock           sync.Mutex
+	segments       map[uint64]slruSegment
+	protectedRatio float64
+	protected      int
+	promotions     int64
+	demotions      int64
+}
+
+func newSLRUPolicy(protectedRatio float64) *slruPolicy {
+	return &slruPolicy{
+		segments:       make(map[uint64]slruSegment),
+		protectedRatio: protectedRatio,
+	}
+}
+
+func (p *slruPolicy) onAdd(hashedKey uint64) {
+	p.lock.Lock()
+	if _, ok := p.segments[hashedKey]; !ok {
+		p.segments[hashedKey] = probationSegment
+	}
+	p.lock.Unlock()
+}
+
+func (p *slruPolicy) onAccess(hashedKey uint64) {
+	p.lock.Lock()
+	segment, ok := p.segments[hashedKey]
+	if ok && segment == probationSegment && float64(p.protected+1) <= p.protectedRatio*float64(len(p.segments)) {
+		p.segments[hashedKey] = protectedSegment
+		p.protected++
+		p.promotions++
+	}
+	p.lock.Unlock()
+}
+
+func (p *slruPolicy) onRemove(hashedKey uint64, reason RemoveReason) {
+	p.lock.Lock()
+	if segment, ok := p.segments[hashedKey]; ok {
+		if segment == protectedSegment {
+			p.protected--
+		}
+		delete(p.segments, hashedKey)
+	}
+	p.lock.Unlock()
+}
+
+func (p *slruPolicy) reinsert(hashedKey uint64, frequency uint8) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.segments[hashedKey] != protectedSegment {
+		return false
+	}
+	p.segments[hashedKey] = probationSegment
+	p.protected--
+	p.demotions++
+	return true
+}
+
+func (p *slruPolicy) usesFrequency() bool {
+	return false
+}
+
+func (p *slruPolicy) reset() {
+	p.lock.Lock()
+	p.segments = make(map[uint64]slruSegment)
+	p.protected = 0
+	p.lock.Unlock()
+}
+
+func (p *slruPolicy) stats() SegmentStats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return SegmentStats{
+		ProbationEntries: int64(len(p.segments) - p.protected),
+		ProtectedEntries: int64(p.protected),
+		Promotions:       p.promotions,
+		Demotions:        p.demotions,
+	}
+}
+
+// arcPolicy adapts ARC to the FIFO queue. Instead of picking a victim from the tail of one of
+// the lists, entries of the list which is below its target size get reinserted when they reach
+// the head of the queue, until an entry of the list above its target is found.
+type arcPolicy struct {
+	lock sync.Mutex
+	// resident entries, true for entries which were read at least twice (T2), false otherwise (T1)
+	resident map[uint64]bool
+	frequent int
+	// target size of T1
+	target int
+	// keys of entries recently evicted from T1 (B1) and T2 (B2)
+	recentGhosts   ghostList
+	frequentGhosts ghostList
+	promotions     int64
+}
+
+func newARCPolicy() *arcPolicy {
+	return &arcPolicy{
+		resident:       make(map[uint64]bool),
+		recentGhosts:   newGhostList(),
+		frequentGhosts: newGhostList(),
+	}
+}
+
+func (p *arcPolicy) onAdd(hashedKey uint64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.resident[hashedKey]; ok {
+		return
+	}
+	switch {
+	case p.recentGhosts.remove(hashedKey):
+		p.target = min(p.target+max(p.frequentGhosts.len()/max(p.recentGhosts.len(), 1), 1), len(p.resident)+1)
+		p.resident[hashedKey] = true
+		p.frequent++
+	case p.frequentGhosts.remove(hashedKey):
+		p.target = max(p.target-max(p.recentGhosts.len()/max(p.frequentGhosts.len(), 1), 1), 0)
+		p.resident[hashedKey] = true
+		p.frequent++
+	default:
+		p.resident[hashedKey] = false
+	}
+}
+
+func (p *arcPolicy) onAccess(hashedKey uint64) {
+	p.lock.Lock()
+	if frequent, ok := p.resident[hashedKey]; ok && !frequent {
+		p.resident[hashedKey] = true
+		p.frequent++
+		p.promotions++
+	}
+	p.lock.Unlock()
+}
+
+func (p *arcPolicy) onRemove(hashedKey uint64, reason RemoveReason) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	frequent, ok := p.resident[hashedKey]
+	if !ok {
+		return
+	}
+	delete(p.resident, hashedKey)
+	if frequent {
+		p.frequent--
+	}
+	if reason != NoSpace {
+		return
+	}
+	// ghost lists together remember at most as many keys as there are resident entries
+	limit := max(len(p.resident), 1)
+	if frequent {
+		p.frequentGhosts.push(hashedKey, limit)
+	} else {
+		p.recentGhosts.push(hashedKey, limit)
+	}
+}
+
+func (p *arcPolicy) reinsert(hashedKey uint64, frequency uint8) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	frequent, ok := p.resident[hashedKey]
+	if !ok {
+		return false
+	}
+	recent := len(p.resident) - p.frequent
+	if frequent {
+		return recent > 0 && recent > p.target
+	}
+	return p.frequent > 0 && recent <= p.target
+}
+
+func (p *arcPolicy) usesFrequency() bool {
+	return false
+}
+
+func (p *arcPolicy) reset() {
+	p.lock.Lock()
+	p.resident = make(map[uint64]bool)
+	p.frequent = 0
+	p.target = 0
+	p.recentGhosts = newGhostList()
+	p.frequentGhosts = newGhostList()
+	p.lock.Unlock()
+}
+
+func (p *arcPolicy) stats() SegmentStats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return SegmentStats{
+		ProbationEntries: int64(len(p.resident) - p.frequent),
+		ProtectedEntries: int64(p.frequent),
+		GhostEntries:     int64(p.recentGhosts.len() + p.frequentGhosts.len()),
+		Promotions:       p.promotions,
+	}
+}
+
+// lfuPolicy reinserts frequently accessed entries. An entry is reinserted once and then evicted,
+// unless it was accessed in the meantime, so eviction always makes progress.
+type lfuPolicy struct {
+	lock       sync.Mutex
+	reinserted map[uint64]struct{}
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{
+		reinserted: make(map[uint64]struct{}),
+	}
+}
+
+func (p *lfuPolicy) onAdd(hashedKey uint64) {}
+
+func (p *lfuPolicy) onAccess(hashedKey uint64) {
+	p.lock.Lock()
+	delete(p.reinserted, hashedKey)
+	p.lock.Unlock()
+}
+
+func (p *lfuPolicy) onRemove(hashedKey uint64, reason RemoveReason) {
+	p.lock.Lock()
+	delete(p.reinserted, hashedKey)
+	p.lock.Unlock()
+}
+
+func (p *lfuPolicy) reinsert(hashedKey uint64, frequency uint8) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.reinserted[hashedKey]; ok || frequency < 2 {
+		return false
+	}
+	p.reinserted[hashedKey] = struct{}{}
+	return true
+}
+
+func (p *lfuPolicy) usesFrequency() bool {
+	return true
+}
+
+func (p *lfuPolicy) reset() {
+	p.lock.Lock()
+	p.reinserted = make(map[uint64]struct{})
+	p.lock.Unlock()
+}
+
+func (p *lfuPolicy) stats() SegmentStats {
+	return SegmentStats{}
+}
+
+// Policy is a pluggable eviction policy, every shard uses its own instance created with Config.NewPolicy.
+// Entries are identified by hashes of their keys. Methods are called with the shard lock held,
+// except OnAccess which is called without any shard lock, so implementations have to synchronize themselves.
+type Policy interface {
+	// OnAdd is called when an entry is written
+	OnAdd(hashedKey uint64)
+	// OnAccess is called when an entry is read
+	OnAccess(hashedKey uint64)
+	// OnRemove is called when an entry is removed, including victims evicted by the policy
+	OnRemove(hashedKey uint64, reason RemoveReason)
+	// Victim is called when space is needed for a new entry. It returns the entry to evict, or false
+	// to evict the oldest entry. Space of a victim other than the oldest entry is reclaimed once the victim
+	// reaches the head of the queue, until then the oldest entries are moved to the tail.
+	Victim() (hashedKey uint64, ok bool)
+}
+
+// FIFOPolicy evicts the oldest entries first, it behaves like the default FIFO EvictionPolicy
+type FIFOPolicy struct{}
+
+// NewFIFOPolicy creates FIFOPolicy, it is meant to be embedded by policies overriding some of its methods
+func NewFIFOPolicy() Policy {
+	return FIFOPolicy{}
+}
+
+// OnAdd does nothing
+func (FIFOPolicy) OnAdd(hashedKey uint64) {}
+
+// OnAccess does nothing
+func (FIFOPolicy) OnAccess(hashedKey uint64) {}
+
+// OnRemove does nothing
+func (FIFOPolicy) OnRemove(hashedKey uint64, reason RemoveReason) {}
+
+// Victim always chooses the oldest entry
+func (FIFOPolicy) Victim() (uint64, bool) {
+	return 0, false
+}
+
+// customPolicy adapts Policy to the queue, the victim is evicted while the oldest entry is reinserted
+type customPolicy struct {
+	newPolicy func() Policy
+	// lock guards policy replaced by reset, which onAccess reads without the shard lock
+	lock   sync.RWMutex
+	policy Policy
+	evict  func(hashedKey uint64) bool
+	// queueLen and hasDead report the number of entries in the queue and whether any of them is dead
+	queueLen func() int
+	hasDead  func() bool
+	// rotations is the number of oldest entries which may still be moved to the tail before a new victim is chosen
+	rotations int
+}
+
+func newCustomPolicy(newPolicy func() Policy) *customPolicy {
+	return &customPolicy{
+		newPolicy: newPolicy,
+		policy:    newPolicy(),
+	}
+}
+
+func (p *customPolicy) onAdd(hashedKey uint64) {
+	p.policy.OnAdd(hashedKey)
+}
+
+func (p *customPolicy) onAccess(hashedKey uint64) {
+	p.lock.RLock()
+	policy := p.policy
+	p.lock.RUnlock()
+	policy.OnAccess(hashedKey)
+}
+
+func (p *customPolicy) onRemove(hashedKey uint64, reason RemoveReason) {
+	p.policy.OnRemove(hashedKey, reason)
+}
+
+func (p *customPolicy) reinsert(hashedKey uint64, frequency uint8) bool {
+	// space of evicted victims is reclaimed once they reach the head, a new victim is not chosen until then
+	if p.rotations > 0 && p.hasDead() {
+		p.rotations--
+		return true
+	}
+	victim, ok := p.policy.Victim()
+	if !ok || victim == hashedKey || !p.evict(victim) {
+		return false
+	}
+	p.rotations = p.queueLen()
+	return true
+}
+
+func (p *customPolicy) usesFrequency() bool {
+	return false
+}
+
+func (p *customPolicy) reset() {
+	policy := p.newPolicy()
+	p.lock.Lock()
+	p.policy = policy
+	p.lock.Unlock()
+	p.rotations = 0
+}
+
+func (p *customPolicy) stats() SegmentStats {
+	return SegmentStats{}
+}
+
+// ghostList is a bounded FIFO set of keys
+type ghostList struct {
+	order    *list.List
+	elements map[uint64]*list.Element
+}
+
+func newGhostList() ghostList {
+	return ghostList{
+		order:    list.New(),
+		elements: make(map[uint64]*list.Element),
+	}
+}
+
+func (g ghostList) push(hashedKey uint64, limit int) {
+	if _, ok := g.elements[hashedKey]; ok {
+		return
+	}
+	g.elements[hashedKey] = g.order.PushBack(hashedKey)
+	for g.order.Len() > limit {
+		oldest := g.order.Front()
+		g.order.Remove(oldest)
+		delete(g.elements, oldest.Value.(uint64))
+	}
+}
+
+func (g ghostList) remove(hashedKey uint64) bool {
+	element, ok := g.elements[hashedKey]
+	if ok {
+		g.order.Remove(element)
+		delete(g.elements, hashedKey)
+	}
+	return ok
+}
+
+func (g ghostList) len() int {
+	return g.order.Len()
+}
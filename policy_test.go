@@ -0,0 +1,399 @@
+package bigcache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSLRUKeepsAccessedEntriesDuringScan(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		policy  EvictionPolicy
+		evicted bool
+	}{
+		{policy: FIFO, evicted: true},
+		{policy: SLRU, evicted: false},
+		{policy: ARC, evicted: false},
+		{policy: LFU, evicted: false},
+	} {
+		t.Run(fmt.Sprintf("policy %d", tc.policy), func(t *testing.T) {
+			// given
+			cache, _ := New(context.Background(), Config{
+				Shards:             1,
+				LifeWindow:         time.Minute,
+				MaxEntriesInWindow: 10,
+				MaxEntrySize:       1024,
+				HardMaxCacheSize:   1,
+				EvictionPolicy:     tc.policy,
+			})
+			value := blob('a', 1024)
+			cache.Set("hot", value)
+			cache.Get("hot")
+
+			// when
+			for i := 0; i < 5000; i++ {
+				cache.Set(fmt.Sprintf("scan%d", i), value)
+				if i%500 == 0 {
+					cache.Get("hot")
+				}
+			}
+			_, err := cache.Get("hot")
+
+			// then
+			assertEqual(t, tc.evicted, err == ErrEntryNotFound)
+		})
+	}
+}
+
+func TestSLRUSegmentStats(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		EvictionPolicy:     SLRU,
+		SLRUProtectedRatio: 0.5,
+	})
+	for i := 0; i < 10; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+
+	// when
+	for i := 0; i < 10; i++ {
+		cache.Get(fmt.Sprintf("key%d", i))
+	}
+	cache.Delete("key0")
+
+	// then
+	assertEqual(t, SegmentStats{
+		ProbationEntries: 5,
+		ProtectedEntries: 4,
+		Promotions:       5,
+	}, cache.SegmentStats())
+
+	// when
+	cache.Reset()
+
+	// then
+	assertEqual(t, SegmentStats{Promotions: 5}, cache.SegmentStats())
+}
+
+func TestSLRUValidation(t *testing.T) {
+	t.Parallel()
+
+	// when
+	_, policyErr := New(context.Background(), Config{Shards: 1, EvictionPolicy: EvictionPolicy(100)})
+	_, ratioErr := New(context.Background(), Config{Shards: 1, EvictionPolicy: SLRU, SLRUProtectedRatio: 1})
+
+	// then
+	assertEqual(t, "EvictionPolicy is not supported", policyErr.Error())
+	assertEqual(t, "SLRUProtectedRatio must be >= 0 and < 1", ratioErr.Error())
+}
+
+func TestARCAdaptsToGhostHits(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       1024,
+		HardMaxCacheSize:   1,
+		EvictionPolicy:     ARC,
+	})
+	value := blob('a', 1024)
+	for i := 0; i < 2000; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), value)
+	}
+	// the most recently evicted key
+	evicted := 1999
+	for ; evicted >= 0; evicted-- {
+		if _, err := cache.shards[0].getEntry(cache.hash.Sum64(fmt.Sprintf("key%d", evicted))); err != nil {
+			break
+		}
+	}
+	ghosts := cache.SegmentStats().GhostEntries
+
+	// when
+	cache.Set(fmt.Sprintf("key%d", evicted), value)
+
+	// then
+	stats := cache.SegmentStats()
+	assertEqual(t, ghosts-1, stats.GhostEntries)
+	assertEqual(t, int64(1), stats.ProtectedEntries)
+	assertEqual(t, uint32(1), uint32(cache.shards[0].policy.(*arcPolicy).target))
+}
+
+// lruPolicy is a custom policy evicting the least recently used entry
+type lruPolicy struct {
+	FIFOPolicy
+	lock     sync.Mutex
+	order    *list.List
+	elements map[uint64]*list.Element
+}
+
+func newLRUPolicy() Policy {
+	return &lruPolicy{order: list.New(), elements: make(map[uint64]*list.Element)}
+}
+
+func (p *lruPolicy) OnAdd(hashedKey uint64) {
+	p.OnAccess(hashedKey)
+}
+
+func (p *lruPolicy) OnAccess(hashedKey uint64) {
+	p.lock.Lock()
+	if element, ok := p.elements[hashedKey]; ok {
+		p.order.MoveToBack(element)
+	} else {
+		p.elements[hashedKey] = p.order.PushBack(hashedKey)
+	}
+	p.lock.Unlock()
+}
+
+func (p *lruPolicy) OnRemove(hashedKey uint64, reason RemoveReason) {
+	p.lock.Lock()
+	if element, ok := p.elements[hashedKey]; ok {
+		p.order.Remove(element)
+		delete(p.elements, hashedKey)
+	}
+	p.lock.Unlock()
+}
+
+func (p *lruPolicy) Victim() (uint64, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if oldest := p.order.Front(); oldest != nil {
+		return oldest.Value.(uint64), true
+	}
+	return 0, false
+}
+
+func TestCustomPolicyChoosesVictim(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var evicted []string
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		MaxEntries:         3,
+		NewPolicy:          newLRUPolicy,
+		OnRemoveWithReason: func(key string, entry []byte, reason RemoveReason) {
+			evicted = append(evicted, key)
+		},
+	})
+	cache.Set("a", []byte("1"))
+	cache.Set("b", []byte("2"))
+	cache.Set("c", []byte("3"))
+	cache.Get("a")
+
+	// when
+	cache.Set("d", []byte("4"))
+
+	// then
+	assertEqual(t, []string{"b"}, evicted)
+	_, err := cache.Get("a")
+	noError(t, err)
+	assertEqual(t, 3, cache.Len())
+}
+
+func TestCustomPolicyKeepsAccessedEntryWhenOutOfSpace(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       1024,
+		HardMaxCacheSize:   1,
+		NewPolicy:          newLRUPolicy,
+	})
+	value := blob('a', 1024)
+	cache.Set("hot", value)
+
+	// when
+	for i := 0; i < 5000; i++ {
+		cache.Set(fmt.Sprintf("scan%d", i), value)
+		if i%100 == 0 {
+			cache.Get("hot")
+		}
+	}
+
+	// then
+	_, err := cache.Get("hot")
+	noError(t, err)
+	assertEqual(t, 0, len(cache.Verify()))
+	assertEqual(t, cache.Len(), cache.shards[0].policy.(*customPolicy).policy.(*lruPolicy).order.Len())
+}
+
+func TestCustomPolicyEvictsSingleVictimPerSet(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       1024,
+		HardMaxCacheSize:   1,
+		NewPolicy:          newLRUPolicy,
+	})
+	defer cache.Close()
+	value := blob('a', 1024)
+	keys := 0
+	for ; cache.Stats().Evictions == 0; keys++ {
+		cache.Set(fmt.Sprintf("key%d", keys), value)
+	}
+	// the oldest half of the queue is the most recently used one
+	for i := 0; i < keys/2; i++ {
+		cache.Get(fmt.Sprintf("key%d", i))
+	}
+	evictions := cache.Stats().Evictions
+
+	// when
+	noError(t, cache.Set("new", value))
+
+	// then
+	assertEqual(t, int64(1), cache.Stats().Evictions-evictions)
+	assertEqual(t, 0, len(cache.Verify()))
+}
+
+func TestCustomPolicyResetWhileReading(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		NewPolicy:          newLRUPolicy,
+	})
+	cache.Set("key", []byte("value"))
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				cache.Get("key")
+			}
+		}
+	}()
+
+	// when
+	for i := 0; i < 1000; i++ {
+		cache.Reset()
+		cache.Set("key", []byte("value"))
+	}
+	close(done)
+	wg.Wait()
+
+	// then
+	assertEqual(t, 1, cache.Len())
+	assertEqual(t, 0, len(cache.Verify()))
+}
+
+func TestCustomPolicyValidation(t *testing.T) {
+	t.Parallel()
+
+	// when
+	_, err := New(context.Background(), Config{Shards: 1, EvictionPolicy: SLRU, NewPolicy: NewFIFOPolicy})
+
+	// then
+	assertEqual(t, "EvictionPolicy must be FIFO when NewPolicy is set", err.Error())
+}
+
+func TestRejectWriteWhenMaxEntriesReached(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var removed []string
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		MaxEntries:         2,
+		OnFullPolicy:       RejectWrite,
+		OnRemove: func(key string, entry []byte) {
+			removed = append(removed, key)
+		},
+	})
+	cache.Set("a", []byte("1"))
+	cache.Set("b", []byte("2"))
+
+	// when
+	err := cache.Set("c", []byte("3"))
+	overwriteErr := cache.Set("a", []byte("4"))
+
+	// then
+	assertEqual(t, ErrShardFull, err)
+	noError(t, overwriteErr)
+	assertEqual(t, 0, len(removed))
+	assertEqual(t, 2, cache.Len())
+	entry, _ := cache.Get("a")
+	assertEqual(t, []byte("4"), entry)
+	_, err = cache.Get("c")
+	assertEqual(t, ErrEntryNotFound, err)
+}
+
+func TestRejectWriteWhenOutOfSpace(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         10 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       1024,
+		HardMaxCacheSize:   1,
+		OnFullPolicy:       RejectWrite,
+	}, &clock)
+	value := blob('a', 1024)
+	var stored int
+	for i := 0; i < 2000; i++ {
+		if cache.Set(fmt.Sprintf("key%d", i), value) != nil {
+			break
+		}
+		stored++
+	}
+
+	// when
+	err := cache.Set("key0", blob('b', 1024))
+
+	// then
+	assertEqual(t, ErrShardFull, err)
+	assertEqual(t, stored, cache.Len())
+	entry, _ := cache.Get("key0")
+	assertEqual(t, value, entry)
+	assertEqual(t, 0, len(cache.Verify()))
+
+	// when
+	cache.Delete("key0")
+	cache.Delete("key1")
+	deletedErr := cache.Set("fresh", value)
+	clock.set(20)
+	expiredErr := cache.Set("fresher", value)
+
+	// then
+	noError(t, deletedErr)
+	noError(t, expiredErr)
+}
@@ -0,0 +1,136 @@
+package bigcache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultPrefetchWorkers   = 4
+	defaultPrefetchQueueSize = 1024
+)
+
+// prefetchRequest is a key queued by Prefetch with the context of its load
+type prefetchRequest struct {
+	ctx context.Context
+	key string
+}
+
+// prefetcher loads keys queued by Prefetch with Config.Loader on a pool of workers
+type prefetcher struct {
+	// dropped and failed are accessed atomically, they come first to be 64-bit aligned on 32-bit platforms
+	dropped  int64
+	failed   int64
+	cache    *BigCache
+	requests chan prefetchRequest
+
+	lock sync.Mutex
+	// inFlight holds keys which are queued or being loaded
+	inFlight map[string]struct{}
+}
+
+func newPrefetcher(cache *BigCache) *prefetcher {
+	return &prefetcher{
+		cache:    cache,
+		requests: make(chan prefetchRequest, cache.config.prefetchQueueSize()),
+		inFlight: make(map[string]struct{}),
+	}
+}
+
+// Prefetch warms the keys in the background with Config.Loader, without blocking the caller.
+// Keys which are cached and not expired, or queued or being loaded already are skipped. When the queue of
+// Config.PrefetchQueueSize keys is full, keys are dropped and counted in Stats.PrefetchDropped.
+// Loads are called with ctx, keys still queued when it is done are not loaded. Failed loads are counted
+// in Stats.PrefetchErrors. It returns ErrPrefetchDisabled when Config.Loader is not set.
+func (c *BigCache) Prefetch(ctx context.Context, keys []string) error {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	if c.prefetcher == nil {
+		return ErrPrefetchDisabled
+	}
+	for _, key := range keys {
+		key = c.normalizeKey(key)
+		if c.checkKeyLength(key) != nil {
+			continue
+		}
+		hashedKey := c.hash.Sum64(key)
+		if c.getShard(hashedKey).isCached(key, hashedKey) {
+			continue
+		}
+		c.prefetcher.enqueue(prefetchRequest{ctx: ctx, key: key})
+	}
+	return nil
+}
+
+// enqueue queues the request unless its key is in flight, dropping it when the queue is full
+func (p *prefetcher) enqueue(request prefetchRequest) {
+	p.lock.Lock()
+	if _, ok := p.inFlight[request.key]; ok {
+		p.lock.Unlock()
+		return
+	}
+	select {
+	case p.requests <- request:
+		p.inFlight[request.key] = struct{}{}
+	default:
+		atomic.AddInt64(&p.dropped, 1)
+	}
+	p.lock.Unlock()
+}
+
+// work loads queued keys until the cache is closed
+func (p *prefetcher) work(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-p.cache.close:
+			return
+		case request := <-p.requests:
+			p.load(request)
+		}
+	}
+}
+
+// load calls the loader for the key and saves its result, unless the context is done or the key got cached meanwhile
+func (p *prefetcher) load(request prefetchRequest) {
+	c := p.cache
+	hashedKey := c.hash.Sum64(request.key)
+	shard := c.getShard(hashedKey)
+	if request.ctx.Err() == nil && !shard.isCached(request.key, hashedKey) {
+		start := time.Now()
+		entry, err := c.config.Loader(request.ctx, request.key)
+		if err == nil {
+			err = c.admit(LowPriority)
+		}
+		if err == nil {
+			err = c.recoverShard(hashedKey, shard.setLoaded(request.key, hashedKey, entry, time.Since(start)))
+		}
+		if err != nil {
+			atomic.AddInt64(&p.failed, 1)
+			if c.isVerbose() {
+				newLogger(c.config.Logger).Printf("Prefetch of key %q failed: %v", request.key, err)
+			}
+		}
+	}
+	p.lock.Lock()
+	delete(p.inFlight, request.key)
+	p.lock.Unlock()
+}
+
+// isCached reports whether the shard holds a not expired entry of the key, without counting hits or misses
+func (s *cacheShard) isCached(key string, hashedKey uint64) bool {
+	currentTimestamp := uint64(s.clock.Epoch())
+	s.lock.RLock()
+	cached := false
+	if itemIndex := s.hashmap[hashedKey]; itemIndex != 0 {
+		wrappedEntry, err := s.entries.Get(int(itemIndex))
+		cached = err == nil && compareKeyFromEntry(wrappedEntry, key) &&
+			(s.lifeWindow == 0 || !s.isExpired(wrappedEntry, currentTimestamp))
+	}
+	s.lock.RUnlock()
+	return cached
+}
@@ -0,0 +1,189 @@
+package bigcache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func prefetchConfig(loader func(ctx context.Context, key string) ([]byte, error)) Config {
+	return Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		Loader:             loader,
+	}
+}
+
+// waitForPrefetch waits until no keys are queued or being loaded
+func waitForPrefetch(t *testing.T, cache *BigCache) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		cache.prefetcher.lock.Lock()
+		inFlight := len(cache.prefetcher.inFlight)
+		cache.prefetcher.lock.Unlock()
+		if inFlight == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("prefetch did not finish")
+}
+
+func TestPrefetchLoadsKeys(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), prefetchConfig(func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("value of " + key), nil
+	}))
+	defer cache.Close()
+
+	// when
+	noError(t, cache.Prefetch(context.Background(), []string{"a", "b"}))
+	waitForPrefetch(t, cache)
+
+	// then
+	entry, err := cache.Get("a")
+	noError(t, err)
+	assertEqual(t, []byte("value of a"), entry)
+	entry, err = cache.Get("b")
+	noError(t, err)
+	assertEqual(t, []byte("value of b"), entry)
+}
+
+func TestPrefetchSkipsCachedKeys(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var loads int64
+	cache, _ := New(context.Background(), prefetchConfig(func(ctx context.Context, key string) ([]byte, error) {
+		atomic.AddInt64(&loads, 1)
+		return []byte("loaded"), nil
+	}))
+	defer cache.Close()
+	cache.Set("a", []byte("cached"))
+
+	// when
+	noError(t, cache.Prefetch(context.Background(), []string{"a"}))
+	waitForPrefetch(t, cache)
+
+	// then
+	entry, _ := cache.Get("a")
+	assertEqual(t, []byte("cached"), entry)
+	assertEqual(t, int64(0), atomic.LoadInt64(&loads))
+}
+
+func TestPrefetchDeduplicatesInFlightKeys(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var loads int64
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	cache, _ := New(context.Background(), prefetchConfig(func(ctx context.Context, key string) ([]byte, error) {
+		atomic.AddInt64(&loads, 1)
+		started <- struct{}{}
+		<-release
+		return []byte("loaded"), nil
+	}))
+	defer cache.Close()
+
+	// when
+	noError(t, cache.Prefetch(context.Background(), []string{"a"}))
+	<-started
+	noError(t, cache.Prefetch(context.Background(), []string{"a", "a"}))
+	close(release)
+	waitForPrefetch(t, cache)
+
+	// then
+	assertEqual(t, int64(1), atomic.LoadInt64(&loads))
+}
+
+func TestPrefetchDropsKeysWhenQueueIsFull(t *testing.T) {
+	t.Parallel()
+
+	// given
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	config := prefetchConfig(func(ctx context.Context, key string) ([]byte, error) {
+		started <- struct{}{}
+		<-release
+		return []byte("loaded"), nil
+	})
+	config.PrefetchWorkers = 1
+	config.PrefetchQueueSize = 1
+	cache, _ := New(context.Background(), config)
+	defer cache.Close()
+	noError(t, cache.Prefetch(context.Background(), []string{"a"}))
+	<-started
+
+	// when
+	noError(t, cache.Prefetch(context.Background(), []string{"b", "c"}))
+	close(release)
+	waitForPrefetch(t, cache)
+
+	// then
+	assertEqual(t, int64(1), cache.Stats().PrefetchDropped)
+	_, err := cache.Get("b")
+	noError(t, err)
+	_, err = cache.Get("c")
+	assertEqual(t, ErrEntryNotFound, err)
+}
+
+func TestPrefetchCountsErrors(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), prefetchConfig(func(ctx context.Context, key string) ([]byte, error) {
+		return nil, errors.New("load failed")
+	}))
+	defer cache.Close()
+
+	// when
+	noError(t, cache.Prefetch(context.Background(), []string{"a"}))
+	waitForPrefetch(t, cache)
+
+	// then
+	assertEqual(t, int64(1), cache.Stats().PrefetchErrors)
+	_, err := cache.Get("a")
+	assertEqual(t, ErrEntryNotFound, err)
+}
+
+func TestPrefetchSkipsKeysOfDoneContext(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var loads int64
+	cache, _ := New(context.Background(), prefetchConfig(func(ctx context.Context, key string) ([]byte, error) {
+		atomic.AddInt64(&loads, 1)
+		return []byte("loaded"), nil
+	}))
+	defer cache.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// when
+	noError(t, cache.Prefetch(ctx, []string{"a"}))
+	waitForPrefetch(t, cache)
+
+	// then
+	assertEqual(t, int64(0), atomic.LoadInt64(&loads))
+}
+
+func TestPrefetchDisabled(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), prefetchConfig(nil))
+
+	// when
+	err := cache.Prefetch(context.Background(), []string{"a"})
+
+	// then
+	assertEqual(t, ErrPrefetchDisabled, err)
+}
@@ -12,6 +12,8 @@ const (
 	minimumHeaderSize = 17 // 1 byte blobsize + timestampSizeInBytes + hashSizeInBytes
 	// Bytes before left margin are not used. Zero index means element does not exist in queue, useful while reading slice from index
 	leftMarginIndex = 1
+	// Size of memory page written by Touch
+	pageSize = 4096
 )
 
 var (
@@ -34,11 +36,14 @@ type BytesQueue struct {
 	rightMargin  int
 	headerBuffer []byte
 	verbose      bool
+	// wraps counts pushes which moved tail back to the beginning of the queue
+	wraps int
 }
 
 // getNeededSize returns the number of bytes an entry of length need in the queue
 func getNeededSize(length int) int {
 	// 实际需要的字节数为 header + length
+	length += 2 * guardSize
 	var header int
 	switch {
 	// 1 byte for header, length <= 126
@@ -75,8 +80,41 @@ func NewBytesQueue(capacity int, maxCapacity int, verbose bool) *BytesQueue {
 	}
 }
 
+// NewLazyBytesQueue initializes new bytes queue which allocates its bytes array on the first push,
+// so queues which are never written to do not consume memory.
+func NewLazyBytesQueue(capacity int, maxCapacity int, verbose bool) *BytesQueue {
+	return &BytesQueue{
+		capacity:     capacity,
+		maxCapacity:  maxCapacity,
+		headerBuffer: make([]byte, binary.MaxVarintLen32),
+		tail:         leftMarginIndex,
+		head:         leftMarginIndex,
+		rightMargin:  leftMarginIndex,
+		verbose:      verbose,
+	}
+}
+
+// Touch allocates bytes array of a lazy queue and writes to every memory page of it,
+// so the memory is backed by the operating system before the first push instead of during it.
+func (q *BytesQueue) Touch() {
+	q.allocateArray()
+	for i := 0; i < len(q.array); i += pageSize {
+		q.array[i] = 0
+	}
+}
+
+// allocateArray allocates bytes array of a lazy queue if it was not allocated yet
+func (q *BytesQueue) allocateArray() {
+	if q.array == nil {
+		q.array = make([]byte, q.capacity)
+	}
+}
+
 // Reset removes all entries from queue
 func (q *BytesQueue) Reset() {
+	if debug && q.array != nil {
+		poison(q.array[leftMarginIndex:])
+	}
 	// Just reset indexes
 	q.tail = leftMarginIndex
 	q.head = leftMarginIndex
@@ -89,12 +127,17 @@ func (q *BytesQueue) Reset() {
 // Returns index for pushed data or error if maximum size queue limit is reached
 func (q *BytesQueue) Push(entry []byte) (int, error) {
 	neededSize := getNeededSize(len(entry))
+	q.allocateArray()
 
 	if !q.canInsertAfterTail(neededSize) {
 		if q.canInsertBeforeHead(neededSize) {
 			// 后端插入不了，但是 前端能插入，直接将tail 移动到leftMarginIndex，也就是移动到队列的最开始
 			q.tail = leftMarginIndex
-		} else if q.capacity+neededSize >= q.maxCapacity && q.maxCapacity > 0 {
+			q.wraps++
+		} else if int64(q.capacity)+int64(neededSize) >= int64(q.maxCapacity) && q.maxCapacity > 0 {
+			return -1, errFullQueue
+		} else if int64(q.capacity)+int64(neededSize) > MaxCapacity {
+			// the queue cannot grow beyond the limit of the platform, old entries have to be popped instead
 			return -1, errFullQueue
 		} else {
 			// 扩容
@@ -116,19 +159,47 @@ func (q *BytesQueue) allocateAdditionalMemory(minimum int) {
 	// 扩容开始时间
 	start := time.Now()
 
+	// Sizes are computed with 64-bit integers so doubling does not overflow int on 32-bit platforms
+	capacity := int64(q.capacity)
+
 	// 1. 确保新容量至少比 minimum 大
-	if q.capacity < minimum {
-		q.capacity += minimum
+	if capacity < int64(minimum) {
+		capacity += int64(minimum)
 	}
 
 	// 2. 将容量翻倍，避免频繁的扩容
-	q.capacity *= 2
+	if capacity > MaxCapacity/2 {
+		capacity = MaxCapacity
+	} else {
+		capacity *= 2
+	}
 
 	// 3. 确保新容量不超过maxCapacity
-	if q.maxCapacity > 0 && q.capacity > q.maxCapacity {
-		q.capacity = q.maxCapacity
+	if q.maxCapacity > 0 && capacity > int64(q.maxCapacity) {
+		capacity = int64(q.maxCapacity)
 	}
 
+	q.capacity = int(capacity)
+	q.reallocate(start)
+}
+
+// EnsureCapacity grows the queue to at least capacity bytes, bounded by its maximum capacity, keeping its entries.
+// It allocates the final size upfront, e.g. before a known bulk load, so pushes do not pause to grow the queue.
+func (q *BytesQueue) EnsureCapacity(capacity int) {
+	if q.maxCapacity > 0 && capacity > q.maxCapacity {
+		capacity = q.maxCapacity
+	}
+	if capacity <= q.capacity {
+		q.allocateArray()
+		return
+	}
+	start := time.Now()
+	q.capacity = capacity
+	q.reallocate(start)
+}
+
+// reallocate moves entries to a new bytes array of the queue capacity, started is the time growing began at
+func (q *BytesQueue) reallocate(start time.Time) {
 	// 4. 保存旧数组指针，用于后续数据迁移
 	oldArray := q.array
 
@@ -155,6 +226,7 @@ func (q *BytesQueue) allocateAdditionalMemory(minimum int) {
 		}
 		// else: 如果tail > head 数据已经连续不需要进行处理
 	}
+	poison(oldArray)
 	// 7. 表级队列容量不满
 	q.full = false
 	// 8. 若使用verbose模式，打印扩容耗时和新容量信息
@@ -166,8 +238,14 @@ func (q *BytesQueue) push(data []byte, len int) {
 	headerEntrySize := binary.PutUvarint(q.headerBuffer, uint64(len))
 	// 将headerEntrySize字节写入到 array中
 	q.copy(q.headerBuffer, headerEntrySize)
+	if guardSize > 0 {
+		q.copy(guard, guardSize)
+	}
 	// 将data 写入到 array中
-	q.copy(data, len-headerEntrySize)
+	q.copy(data, len-headerEntrySize-2*guardSize)
+	if guardSize > 0 {
+		q.copy(guard, guardSize)
+	}
 
 	if q.tail > q.head {
 		q.rightMargin = q.tail
@@ -194,6 +272,10 @@ func (q *BytesQueue) Pop() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if debug {
+		data = append([]byte(nil), data...)
+		poison(q.array[q.head : q.head+blockSize])
+	}
 
 	// Move the head forward by the size of the block that was just read
 	q.head += blockSize
@@ -232,11 +314,140 @@ func (q *BytesQueue) CheckGet(index int) error {
 	return q.peekCheckErr(index)
 }
 
+// Iterate calls fn for every entry in the queue from the oldest to the newest one,
+// passing the index of the entry and its data. Iteration stops when fn returns false.
+// Data passed to fn references the queue memory and must not be retained or modified.
+func (q *BytesQueue) Iterate(fn func(index int, data []byte) bool) {
+	index := q.head
+	for i := 0; i < q.count; i++ {
+		data, blockSize, err := q.peek(index)
+		if err != nil {
+			return
+		}
+		if !fn(index, data) {
+			return
+		}
+		index += blockSize
+		if index == q.rightMargin {
+			index = leftMarginIndex
+		}
+	}
+}
+
+// Verify checks consistency of head, tail and right margin with the entries stored in the queue.
+// It walks over all entries, so it is meant for debugging only.
+func (q *BytesQueue) Verify() error {
+	if q.array == nil {
+		if q.count != 0 {
+			return fmt.Errorf("queue has %d entries but no allocated memory", q.count)
+		}
+		return nil
+	}
+	if q.capacity != len(q.array) {
+		return fmt.Errorf("capacity %d does not match allocated %d bytes", q.capacity, len(q.array))
+	}
+	if q.head < leftMarginIndex || q.tail < leftMarginIndex || q.rightMargin < leftMarginIndex {
+		return fmt.Errorf("head %d, tail %d or right margin %d before left margin", q.head, q.tail, q.rightMargin)
+	}
+	if q.head > q.rightMargin || q.tail > q.rightMargin || q.rightMargin > q.capacity {
+		return fmt.Errorf("head %d or tail %d beyond right margin %d or right margin beyond capacity %d",
+			q.head, q.tail, q.rightMargin, q.capacity)
+	}
+	index := q.head
+	for i := 0; i < q.count; i++ {
+		if i > 0 && index == q.rightMargin {
+			index = leftMarginIndex
+		}
+		blockSize, n := binary.Uvarint(q.array[index:])
+		if n <= 0 || int(blockSize) < n || index+int(blockSize) > q.rightMargin {
+			return fmt.Errorf("entry %d at index %d has invalid size %d", i, index, blockSize)
+		}
+		index += int(blockSize)
+	}
+	if index != q.tail && !(index == q.rightMargin && q.tail == leftMarginIndex) {
+		return fmt.Errorf("%d entries from head %d end at %d instead of tail %d", q.count, q.head, index, q.tail)
+	}
+	return nil
+}
+
+// Geometry describes positions of pointers in a queue, it is used for debugging
+type Geometry struct {
+	Head        int  `json:"head"`
+	Tail        int  `json:"tail"`
+	RightMargin int  `json:"right_margin"`
+	Capacity    int  `json:"capacity"`
+	Count       int  `json:"count"`
+	Full        bool `json:"full"`
+	Wraps       int  `json:"wraps"`
+}
+
+// Geometry returns current positions of pointers in the queue
+func (q *BytesQueue) Geometry() Geometry {
+	return Geometry{
+		Head:        q.head,
+		Tail:        q.tail,
+		RightMargin: q.rightMargin,
+		Capacity:    q.capacity,
+		Count:       q.count,
+		Full:        q.full,
+		Wraps:       q.wraps,
+	}
+}
+
 // Capacity returns the numbers of allocated bytes for queue
 func (q *BytesQueue) Capacity() int {
 	return q.capacity
 }
 
+// SetMaxCapacity changes the size the queue can grow to, 0 means no limit.
+// Memory already allocated above a lower limit is kept until the queue is replaced.
+func (q *BytesQueue) SetMaxCapacity(maxCapacity int) {
+	q.maxCapacity = maxCapacity
+}
+
+// UsedBytes returns the number of bytes taken by entries between head and tail, including their length headers
+// and fillers written when the queue grew
+func (q *BytesQueue) UsedBytes() int {
+	if q.count == 0 {
+		return 0
+	}
+	if q.tail > q.head {
+		return q.tail - q.head
+	}
+	return q.rightMargin - q.head + q.tail - leftMarginIndex
+}
+
+// FreeBytes returns the number of bytes new entries can take before the queue has to grow.
+// When the queue wrapped, only the space between tail and head is free, bytes after the right margin
+// are reclaimed once head wraps too.
+func (q *BytesQueue) FreeBytes() int {
+	switch {
+	case q.full:
+		return 0
+	case q.count == 0:
+		return q.capacity - leftMarginIndex
+	case q.tail >= q.head:
+		return q.capacity - q.tail + q.head - leftMarginIndex
+	default:
+		return q.head - q.tail
+	}
+}
+
+// RightMargin returns the index the entries end at before the queue wraps to its beginning
+func (q *BytesQueue) RightMargin() int {
+	return q.rightMargin
+}
+
+// Fits reports whether an entry of the length can be pushed once all entries are popped.
+// Bigger entries are never stored, no matter how many others are removed.
+func (q *BytesQueue) Fits(length int) bool {
+	if q.maxCapacity <= 0 {
+		return true
+	}
+	neededSize := getNeededSize(length)
+	return neededSize <= q.capacity-leftMarginIndex || q.capacity+neededSize < q.maxCapacity
+}
+
 // Len returns the number of elements in the queue
 func (q *BytesQueue) Len() int {
 	return q.count
@@ -265,7 +476,10 @@ func (q *BytesQueue) peek(index int) ([]byte, int, error) {
 
 	// [size][entry]， n 代表size的长度
 	blockSize, n := binary.Uvarint(q.array[index:])
-	return q.array[index+n : index+int(blockSize)], int(blockSize), nil
+	if debug {
+		q.verifyBlock(index, blockSize, n)
+	}
+	return q.array[index+n+guardSize : index+int(blockSize)-guardSize], int(blockSize), nil
 
 }
 
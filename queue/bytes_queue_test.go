@@ -3,6 +3,7 @@ package queue
 import (
 	"bytes"
 	"fmt"
+	"math/rand"
 	"path"
 	"reflect"
 	"runtime"
@@ -44,6 +45,93 @@ func TestLen(t *testing.T) {
 	assertEqual(t, queue.Len(), 1)
 }
 
+func TestUsedAndFreeBytes(t *testing.T) {
+	t.Parallel()
+	skipInDebug(t)
+
+	// given
+	queue := NewBytesQueue(25, 0, false)
+	entry := []byte("hello")
+	assertEqual(t, 0, queue.UsedBytes())
+	assertEqual(t, 24, queue.FreeBytes())
+
+	// when
+	for i := 0; i < 4; i++ {
+		queue.Push(entry)
+	}
+
+	// then
+	assertEqual(t, 24, queue.UsedBytes())
+	assertEqual(t, 0, queue.FreeBytes())
+	assertEqual(t, 25, queue.RightMargin())
+
+	// when
+	queue.Pop()
+	queue.Push(entry)
+
+	// then
+	assertEqual(t, 7, queue.Geometry().Tail)
+	assertEqual(t, 24, queue.UsedBytes())
+	assertEqual(t, 0, queue.FreeBytes())
+
+	// when
+	queue.Pop()
+
+	// then
+	assertEqual(t, 18, queue.UsedBytes())
+	assertEqual(t, 6, queue.FreeBytes())
+	assertEqual(t, 25, queue.RightMargin())
+}
+
+func TestWraps(t *testing.T) {
+	t.Parallel()
+	skipInDebug(t)
+
+	// given
+	queue := NewBytesQueue(25, 25, false)
+	entry := []byte("hello")
+	for i := 0; i < 4; i++ {
+		queue.Push(entry)
+	}
+
+	// when
+	queue.Pop()
+	queue.Push(entry)
+	queue.Pop()
+	queue.Push(entry)
+
+	// then
+	assertEqual(t, 1, queue.Geometry().Wraps)
+	assertEqual(t, 13, queue.Geometry().Tail)
+	assertEqual(t, 13, queue.Geometry().Head)
+}
+
+func TestFits(t *testing.T) {
+	t.Parallel()
+	skipInDebug(t)
+
+	// given
+	queue := NewBytesQueue(10, 20, false)
+	growing := NewBytesQueue(10, 30, false)
+	unlimited := NewBytesQueue(10, 0, false)
+
+	// then
+	assertEqual(t, true, queue.Fits(8))
+	assertEqual(t, false, queue.Fits(9))
+	assertEqual(t, true, growing.Fits(15))
+	assertEqual(t, true, unlimited.Fits(100))
+
+	// when
+	_, err := queue.Push(make([]byte, 8))
+	_, growingErr := growing.Push(make([]byte, 15))
+	_, fullErr := queue.Push(make([]byte, 9))
+
+	// then
+	noError(t, err)
+	noError(t, growingErr)
+	assertEqual(t, errFullQueue, fullErr)
+}
+
 func TestPeek(t *testing.T) {
 	t.Parallel()
 
@@ -67,12 +155,14 @@ func TestPeek(t *testing.T) {
 	// then
 	assertEqual(t, err, err2)
 	noError(t, err)
-	assertEqual(t, pop(queue), read)
+	// debug builds poison the peeked memory when the entry is popped
 	assertEqual(t, entry, read)
+	assertEqual(t, entry, pop(queue))
 }
 
 func TestResetFullQueue(t *testing.T) {
 	t.Parallel()
+	skipInDebug(t)
 
 	// given
 	queue := NewBytesQueue(10, 20, false)
@@ -122,8 +212,9 @@ func TestReset(t *testing.T) {
 
 	// then
 	noError(t, err)
-	assertEqual(t, pop(queue), read)
+	// debug builds poison the peeked memory when the entry is popped
 	assertEqual(t, entry, read)
+	assertEqual(t, entry, pop(queue))
 
 	// when
 	read, err = queue.Peek()
@@ -135,6 +226,7 @@ func TestReset(t *testing.T) {
 
 func TestReuseAvailableSpace(t *testing.T) {
 	t.Parallel()
+	skipInDebug(t)
 
 	// given
 	queue := NewBytesQueue(100, 0, false)
@@ -152,6 +244,7 @@ func TestReuseAvailableSpace(t *testing.T) {
 
 func TestAllocateAdditionalSpace(t *testing.T) {
 	t.Parallel()
+	skipInDebug(t)
 
 	// given
 	queue := NewBytesQueue(11, 0, false)
@@ -166,6 +259,7 @@ func TestAllocateAdditionalSpace(t *testing.T) {
 
 func TestAllocateAdditionalSpaceForInsufficientFreeFragmentedSpaceWhereHeadIsBeforeTail(t *testing.T) {
 	t.Parallel()
+	skipInDebug(t)
 
 	// given
 	queue := NewBytesQueue(25, 0, false)
@@ -184,6 +278,7 @@ func TestAllocateAdditionalSpaceForInsufficientFreeFragmentedSpaceWhereHeadIsBef
 
 func TestUnchangedEntriesIndexesAfterAdditionalMemoryAllocationWhereHeadIsBeforeTail(t *testing.T) {
 	t.Parallel()
+	skipInDebug(t)
 
 	// given
 	queue := NewBytesQueue(25, 0, false)
@@ -202,6 +297,7 @@ func TestUnchangedEntriesIndexesAfterAdditionalMemoryAllocationWhereHeadIsBefore
 
 func TestAllocateAdditionalSpaceForInsufficientFreeFragmentedSpaceWhereTailIsBeforeHead(t *testing.T) {
 	t.Parallel()
+	skipInDebug(t)
 
 	// given
 	queue := NewBytesQueue(100, 0, false)
@@ -226,6 +322,7 @@ func TestAllocateAdditionalSpaceForInsufficientFreeFragmentedSpaceWhereTailIsBef
 
 func TestAllocateAdditionalSpaceForInsufficientFreeFragmentedSpaceWhereTailIsBeforeHead128(t *testing.T) {
 	t.Parallel()
+	skipInDebug(t)
 
 	// given
 	queue := NewBytesQueue(200, 0, false)
@@ -268,8 +365,75 @@ func TestUnchangedEntriesIndexesAfterAdditionalMemoryAllocationWhereTailIsBefore
 	assertEqual(t, blob('d', 40), get(queue, newestIndex))
 }
 
+func TestEnsureCapacity(t *testing.T) {
+	t.Parallel()
+
+	// given
+	queue := NewBytesQueue(100, 0, false)
+	queue.Push(blob('a', 70))
+	index, _ := queue.Push(blob('b', 10))
+	queue.Pop()
+	wrappedIndex, _ := queue.Push(blob('c', 30))
+
+	// when
+	queue.EnsureCapacity(1000)
+	newestIndex, _ := queue.Push(blob('d', 500))
+
+	// then
+	assertEqual(t, 1000, queue.Capacity())
+	assertEqual(t, blob('b', 10), get(queue, index))
+	assertEqual(t, blob('c', 30), get(queue, wrappedIndex))
+	assertEqual(t, blob('d', 500), get(queue, newestIndex))
+	assertEqual(t, 1000, queue.Capacity())
+
+	// when
+	queue.EnsureCapacity(10)
+
+	// then
+	assertEqual(t, 1000, queue.Capacity())
+}
+
+func TestEnsureCapacityOfLazyQueueWithLimit(t *testing.T) {
+	t.Parallel()
+
+	// given
+	queue := NewLazyBytesQueue(100, 500, false)
+
+	// when
+	queue.EnsureCapacity(1000)
+
+	// then
+	assertEqual(t, 500, queue.Capacity())
+	assertEqual(t, 500, len(queue.array))
+}
+
+func TestSetMaxCapacity(t *testing.T) {
+	t.Parallel()
+
+	// given
+	queue := NewBytesQueue(100, 100, false)
+	queue.Push(blob('a', 90))
+
+	// when
+	_, err := queue.Push(blob('b', 90))
+
+	// then
+	assertEqual(t, "queue is full, Maximum size limit reached", err.Error())
+
+	// when
+	queue.SetMaxCapacity(400)
+	index, err := queue.Push(blob('b', 90))
+
+	// then
+	noError(t, err)
+	assertEqual(t, blob('b', 90), get(queue, index))
+	assertEqual(t, true, queue.Capacity() > 100)
+	assertEqual(t, true, queue.Capacity() <= 400)
+}
+
 func TestAllocateAdditionalSpaceForValueBiggerThanInitQueue(t *testing.T) {
 	t.Parallel()
+	skipInDebug(t)
 
 	// given
 	queue := NewBytesQueue(11, 0, false)
@@ -284,6 +448,7 @@ func TestAllocateAdditionalSpaceForValueBiggerThanInitQueue(t *testing.T) {
 
 func TestAllocateAdditionalSpaceForValueBiggerThanQueue(t *testing.T) {
 	t.Parallel()
+	skipInDebug(t)
 
 	// given
 	queue := NewBytesQueue(21, 0, false)
@@ -303,6 +468,7 @@ func TestAllocateAdditionalSpaceForValueBiggerThanQueue(t *testing.T) {
 
 func TestPopWholeQueue(t *testing.T) {
 	t.Parallel()
+	skipInDebug(t)
 
 	// given
 	queue := NewBytesQueue(13, 0, false)
@@ -389,7 +555,8 @@ func TestMaxSizeLimit(t *testing.T) {
 	t.Parallel()
 
 	// given
-	queue := NewBytesQueue(30, 50, false)
+	// sizes include guard bytes of two entries added by debug builds
+	queue := NewBytesQueue(30+4*guardSize, 50+4*guardSize, false)
 
 	// when
 	queue.Push(blob('a', 25))
@@ -398,7 +565,7 @@ func TestMaxSizeLimit(t *testing.T) {
 	_, err := queue.Push(blob('c', 20))
 
 	// then
-	assertEqual(t, 50, capacity)
+	assertEqual(t, 50+4*guardSize, capacity)
 	assertEqual(t, "queue is full, Maximum size limit reached", err.Error())
 	assertEqual(t, blob('a', 25), pop(queue))
 	assertEqual(t, blob('b', 5), pop(queue))
@@ -408,7 +575,8 @@ func TestPushEntryAfterAllocateAdditionMemory(t *testing.T) {
 	t.Parallel()
 
 	// given
-	queue := NewBytesQueue(9, 20, true)
+	// sizes include guard bytes of two entries added by debug builds
+	queue := NewBytesQueue(9+4*guardSize, 20+8*guardSize, true)
 
 	// when
 	queue.Push([]byte("aaa"))
@@ -416,9 +584,9 @@ func TestPushEntryAfterAllocateAdditionMemory(t *testing.T) {
 	queue.Pop()
 
 	// allocate more memory
-	assertEqual(t, 9, queue.Capacity())
+	assertEqual(t, 9+4*guardSize, queue.Capacity())
 	queue.Push([]byte("c"))
-	assertEqual(t, 18, queue.Capacity())
+	assertEqual(t, 18+8*guardSize, queue.Capacity())
 
 	// push after allocate
 	_, err := queue.Push([]byte("d"))
@@ -449,6 +617,62 @@ func TestPushEntryAfterAllocateAdditionMemoryInFull(t *testing.T) {
 	noError(t, err)
 }
 
+func TestIterate(t *testing.T) {
+	t.Parallel()
+
+	// given
+	queue := NewBytesQueue(20, 0, false)
+	queue.Push(blob('a', 6))
+	queue.Push(blob('b', 6))
+	queue.Pop()
+	queue.Push(blob('c', 6)) // wraps around to the beginning of the queue
+
+	// when
+	var entries [][]byte
+	queue.Iterate(func(index int, data []byte) bool {
+		assertEqual(t, data, get(queue, index))
+		entries = append(entries, data)
+		return true
+	})
+
+	// then
+	assertEqual(t, [][]byte{blob('b', 6), blob('c', 6)}, entries)
+}
+
+func TestLazyAllocation(t *testing.T) {
+	t.Parallel()
+
+	// given
+	queue := NewLazyBytesQueue(100, 0, false)
+
+	// then
+	assertEqual(t, 0, len(queue.array))
+	assertEqual(t, 100, queue.Capacity())
+	_, err := queue.Peek()
+	assertEqual(t, "queue is empty", err.Error())
+
+	// when
+	index, _ := queue.Push(blob('a', 10))
+
+	// then
+	assertEqual(t, 100, len(queue.array))
+	assertEqual(t, blob('a', 10), get(queue, index))
+}
+
+func TestTouch(t *testing.T) {
+	t.Parallel()
+
+	// given
+	queue := NewLazyBytesQueue(3*pageSize, 0, false)
+
+	// when
+	queue.Touch()
+
+	// then
+	assertEqual(t, 3*pageSize, len(queue.array))
+	assertEqual(t, 3*pageSize, queue.Capacity())
+}
+
 func pop(queue *BytesQueue) []byte {
 	entry, err := queue.Pop()
 	if err != nil {
@@ -508,3 +732,36 @@ func objectsAreEqual(expected, actual interface{}) bool {
 	}
 	return bytes.Equal(exp, act)
 }
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	// given
+	queue := NewBytesQueue(64, 0, false)
+	rnd := rand.New(rand.NewSource(1))
+
+	// when
+	for i := 0; i < 10000; i++ {
+		if rnd.Intn(3) == 0 {
+			queue.Pop()
+		} else {
+			queue.Push(make([]byte, rnd.Intn(40)))
+		}
+
+		// then
+		noError(t, queue.Verify())
+	}
+
+	// when
+	queue.tail++
+
+	// then
+	assertEqual(t, true, queue.Verify() != nil)
+}
+
+// skipInDebug skips tests checking exact positions and sizes in the queue, which guard bytes of debug builds change
+func skipInDebug(t *testing.T) {
+	if debug {
+		t.Skip("guard bytes of debug builds change positions and sizes checked by the test")
+	}
+}
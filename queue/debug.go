@@ -0,0 +1,57 @@
+package queue
+
+import "fmt"
+
+// Builds with the bigcache_debug tag turn silent corruption of the queue into immediate panics: every entry
+// is surrounded by guard bytes verified whenever it is read, and memory of popped entries, reset queues and
+// arrays replaced by growing is overwritten with poison bytes. Entries read through an index pointing into
+// the middle of another entry or into freed memory, and slices of entries retained after they were freed,
+// are then easy to spot instead of returning garbage. Popped entries are copied before they are poisoned.
+// It is meant for tests only, entries take 2*guardSize more bytes and freeing them writes the whole region.
+
+const (
+	guardByte  = 0xA5
+	poisonByte = 0xDD
+)
+
+var guard = func() []byte {
+	b := make([]byte, guardSize)
+	for i := range b {
+		b[i] = guardByte
+	}
+	return b
+}()
+
+// poison overwrites freed memory in debug builds
+func poison(b []byte) {
+	if debug {
+		for i := range b {
+			b[i] = poisonByte
+		}
+	}
+}
+
+// verifyBlock panics when the block at index does not fit in the queue or its guards were overwritten,
+// blockSize and n are the size of the block and of its header
+func (q *BytesQueue) verifyBlock(index int, blockSize uint64, n int) {
+	if n <= 0 || blockSize < uint64(n+2*guardSize) || blockSize > uint64(len(q.array)-index) {
+		q.corrupted(index, fmt.Sprintf("invalid block size %d", blockSize))
+	}
+	end := index + int(blockSize)
+	for i := 0; i < guardSize; i++ {
+		if q.array[index+n+i] != guardByte {
+			q.corrupted(index, fmt.Sprintf("leading guard overwritten with %#x", q.array[index+n+i]))
+		}
+		if q.array[end-guardSize+i] != guardByte {
+			q.corrupted(index, fmt.Sprintf("trailing guard overwritten with %#x", q.array[end-guardSize+i]))
+		}
+	}
+}
+
+func (q *BytesQueue) corrupted(index int, reason string) {
+	poisoned := ""
+	if q.array[index] == poisonByte {
+		poisoned = ", index points into freed memory"
+	}
+	panic(fmt.Sprintf("queue: corrupted entry at index %d: %s%s, geometry %+v", index, reason, poisoned, q.Geometry()))
+}
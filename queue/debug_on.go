@@ -0,0 +1,10 @@
+//go:build bigcache_debug
+// +build bigcache_debug
+
+package queue
+
+// debug enables poisoning of freed memory and guard bytes around entries, see debug.go
+const debug = true
+
+// guardSize is the number of guard bytes written before and after every entry
+const guardSize = 4
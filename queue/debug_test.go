@@ -0,0 +1,89 @@
+//go:build bigcache_debug
+// +build bigcache_debug
+
+package queue
+
+import (
+	"strings"
+	"testing"
+)
+
+func assertPanics(t *testing.T, message string, fn func()) {
+	t.Helper()
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Errorf("expected panic containing %q", message)
+		} else if s, _ := r.(string); !strings.Contains(s, message) {
+			t.Errorf("expected panic containing %q, got %v", message, r)
+		}
+	}()
+	fn()
+}
+
+func TestGetFromMiddleOfEntryPanics(t *testing.T) {
+	t.Parallel()
+
+	// given
+	queue := NewBytesQueue(100, 0, false)
+	index, _ := queue.Push(blob('a', 20))
+
+	// then
+	assertPanics(t, "corrupted entry at index", func() { queue.Get(index + 3) })
+}
+
+func TestOverwrittenGuardPanics(t *testing.T) {
+	t.Parallel()
+
+	// given
+	queue := NewBytesQueue(100, 0, false)
+	index, _ := queue.Push(blob('a', 20))
+	entry := get(queue, index)
+
+	// when
+	entry = entry[:len(entry)+1]
+	entry[len(entry)-1] = 'b'
+
+	// then
+	assertPanics(t, "trailing guard overwritten", func() { queue.Get(index) })
+}
+
+func TestPoppedEntryIsCopiedAndPoisoned(t *testing.T) {
+	t.Parallel()
+
+	// given
+	queue := NewBytesQueue(100, 0, false)
+	index, _ := queue.Push(blob('a', 20))
+	queue.Push(blob('b', 20))
+	retained := get(queue, index)
+
+	// when
+	popped := pop(queue)
+
+	// then
+	assertEqual(t, blob('a', 20), popped)
+	assertEqual(t, blob(poisonByte, 20), retained)
+	assertPanics(t, "index points into freed memory", func() { queue.Get(index) })
+}
+
+func TestResetAndGrowingPoisonMemory(t *testing.T) {
+	t.Parallel()
+
+	// given
+	queue := NewBytesQueue(40, 0, false)
+	index, _ := queue.Push(blob('a', 20))
+	retained := get(queue, index)
+
+	// when
+	queue.Push(blob('b', 20))
+
+	// then
+	assertEqual(t, blob(poisonByte, 20), retained)
+	assertEqual(t, blob('a', 20), get(queue, index))
+
+	// when
+	queue.Reset()
+
+	// then
+	assertEqual(t, blob(poisonByte, queue.Capacity()-leftMarginIndex), queue.array[leftMarginIndex:])
+}
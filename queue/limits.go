@@ -0,0 +1,5 @@
+package queue
+
+// MaxCapacity is the biggest capacity of a queue in bytes. It is the biggest int of the platform,
+// as slices are indexed with ints, so it is limited to 2GB where they are 32 bits wide.
+const MaxCapacity = int64(^uint(0) >> 1)
@@ -0,0 +1,78 @@
+// Package ratelimit limits rate of events per key with counters stored in BigCache.
+package ratelimit
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+const (
+	keyPrefix = "ratelimit:"
+	// counterSize is the size of a stored counter: window number, events in it and in the previous window
+	counterSize = 24
+)
+
+// Limiter allows at most limit events per key in a window. Counters are modified atomically with
+// BigCache.Update, so a limiter can be shared by goroutines. The lifetime of the cache should be at
+// least two windows, otherwise counters are evicted before their windows end and limits are not enforced.
+type Limiter struct {
+	cache   *bigcache.BigCache
+	limit   int
+	window  time.Duration
+	sliding bool
+	now     func() time.Time
+}
+
+// NewFixedWindow returns limiter counting events in consecutive windows, it allows bursts of up to
+// twice the limit around the end of a window
+func NewFixedWindow(cache *bigcache.BigCache, limit int, window time.Duration) *Limiter {
+	return &Limiter{cache: cache, limit: limit, window: window, now: time.Now}
+}
+
+// NewSlidingWindow returns limiter estimating the number of events in the last window from counts
+// of the current and the previous fixed windows, which smooths bursts at window boundaries
+func NewSlidingWindow(cache *bigcache.BigCache, limit int, window time.Duration) *Limiter {
+	return &Limiter{cache: cache, limit: limit, window: window, sliding: true, now: time.Now}
+}
+
+// Allow records an event for the key and reports whether it is within the limit.
+// Rejected events are not counted.
+func (l *Limiter) Allow(key string) (bool, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN records n events for the key at once if all of them are within the limit
+func (l *Limiter) AllowN(key string, n int) (bool, error) {
+	now := l.now().UnixNano()
+	window := uint64(now / int64(l.window))
+	elapsed := float64(now%int64(l.window)) / float64(l.window)
+
+	var allowed bool
+	err := l.cache.Update(keyPrefix+key, func(old []byte, found bool) ([]byte, bool, error) {
+		var current, previous uint64
+		if found && len(old) == counterSize {
+			switch binary.LittleEndian.Uint64(old) {
+			case window:
+				current, previous = binary.LittleEndian.Uint64(old[8:]), binary.LittleEndian.Uint64(old[16:])
+			case window - 1:
+				previous = binary.LittleEndian.Uint64(old[8:])
+			}
+		}
+		count := float64(current)
+		if l.sliding {
+			count += float64(previous) * (1 - elapsed)
+		}
+		if count+float64(n) > float64(l.limit) {
+			return nil, false, nil
+		}
+		allowed = true
+		counter := make([]byte, counterSize)
+		binary.LittleEndian.PutUint64(counter, window)
+		binary.LittleEndian.PutUint64(counter[8:], current+uint64(n))
+		binary.LittleEndian.PutUint64(counter[16:], previous)
+		return counter, true, nil
+	})
+	return allowed, err
+}
@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+func newCache() *bigcache.BigCache {
+	cache, _ := bigcache.New(context.Background(), bigcache.DefaultConfig(time.Minute))
+	return cache
+}
+
+func TestFixedWindow(t *testing.T) {
+	t.Parallel()
+	now := time.Unix(100, 0)
+	limiter := NewFixedWindow(newCache(), 3, time.Second)
+	limiter.now = func() time.Time { return now }
+
+	for i, want := range []bool{true, true, true, false} {
+		if allowed, _ := limiter.Allow("user"); allowed != want {
+			t.Errorf("event %d: want: %v; got: %v", i, want, allowed)
+		}
+	}
+	if allowed, _ := limiter.Allow("other"); !allowed {
+		t.Errorf("limit of other key was used")
+	}
+
+	now = now.Add(time.Second)
+	if allowed, _ := limiter.AllowN("user", 3); !allowed {
+		t.Errorf("limit was not reset in the next window")
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	t.Parallel()
+	now := time.Unix(100, 0)
+	limiter := NewSlidingWindow(newCache(), 4, time.Second)
+	limiter.now = func() time.Time { return now }
+	limiter.AllowN("user", 4)
+
+	// half of the previous window still counts
+	now = now.Add(1500 * time.Millisecond)
+	if allowed, _ := limiter.AllowN("user", 2); !allowed {
+		t.Errorf("want 2 events allowed")
+	}
+	if allowed, _ := limiter.Allow("user"); allowed {
+		t.Errorf("want limit reached")
+	}
+
+	// previous window is forgotten after two windows
+	now = now.Add(2 * time.Second)
+	if allowed, _ := limiter.AllowN("user", 4); !allowed {
+		t.Errorf("want limit reset")
+	}
+}
+
+func TestConcurrentAllow(t *testing.T) {
+	t.Parallel()
+	limiter := NewFixedWindow(newCache(), 50, time.Second)
+	limiter.now = func() time.Time { return time.Unix(100, 0) }
+
+	var allowed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if ok, _ := limiter.Allow("user"); ok {
+					atomic.AddInt32(&allowed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 50 {
+		t.Errorf("want 50 allowed events; got: %d", allowed)
+	}
+}
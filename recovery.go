@@ -0,0 +1,131 @@
+package bigcache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// recoveringQueue converts panics of the wrapped queue, caused e.g. by corrupted indices, into ErrInternalCorruption
+// and remembers their cause. The shard is reset by BigCache once the failed operation released the shard lock.
+type recoveringQueue struct {
+	entryQueue
+	lock  sync.Mutex
+	cause interface{}
+}
+
+func (q *recoveringQueue) Push(entry []byte) (index int, err error) {
+	defer q.recover(&err)
+	return q.entryQueue.Push(entry)
+}
+
+// Pop, Peek and Get additionally validate entries, so malformed data read from a corrupted queue or index
+// fails the operation instead of panicking later, when the entry is parsed outside of the queue
+func (q *recoveringQueue) Pop() (data []byte, err error) {
+	defer q.recover(&err)
+	data, err = q.entryQueue.Pop()
+	return q.validate(data, err, "popped")
+}
+
+func (q *recoveringQueue) Peek() (data []byte, err error) {
+	defer q.recover(&err)
+	data, err = q.entryQueue.Peek()
+	return q.validate(data, err, "peeked")
+}
+
+func (q *recoveringQueue) Get(index int) (data []byte, err error) {
+	defer q.recover(&err)
+	data, err = q.entryQueue.Get(index)
+	return q.validate(data, err, fmt.Sprintf("at index %d", index))
+}
+
+// validate reports ErrInternalCorruption when the entry read without error is malformed.
+// Fillers written when the queue grew are zeroed and pass as entries without a key.
+func (q *recoveringQueue) validate(data []byte, err error, position string) ([]byte, error) {
+	if err == nil && !isValidEntry(data) {
+		q.corrupted("malformed entry " + position)
+		return nil, ErrInternalCorruption
+	}
+	return data, err
+}
+
+func (q *recoveringQueue) CheckGet(index int) (err error) {
+	defer q.recover(&err)
+	return q.entryQueue.CheckGet(index)
+}
+
+// Iterate stops at the first malformed entry, fn is not called with it
+func (q *recoveringQueue) Iterate(fn func(index int, data []byte) bool) {
+	var err error
+	defer q.recover(&err)
+	q.entryQueue.Iterate(func(index int, data []byte) bool {
+		if _, err := q.validate(data, nil, fmt.Sprintf("at index %d", index)); err != nil {
+			return false
+		}
+		return fn(index, data)
+	})
+}
+
+// recover has to be deferred, it stores the recovered panic and makes the operation fail
+func (q *recoveringQueue) recover(err *error) {
+	if r := recover(); r != nil {
+		q.corrupted(r)
+		*err = ErrInternalCorruption
+	}
+}
+
+func (q *recoveringQueue) corrupted(cause interface{}) {
+	q.lock.Lock()
+	if q.cause == nil {
+		q.cause = cause
+	}
+	q.lock.Unlock()
+}
+
+// takeCause returns cause of corruption found since the last call or nil
+func (q *recoveringQueue) takeCause() interface{} {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	cause := q.cause
+	q.cause = nil
+	return cause
+}
+
+// queue returns the queue of the shard without the recovering wrapper
+func (s *cacheShard) queue() entryQueue {
+	if s.recovering != nil {
+		return s.recovering.entryQueue
+	}
+	return s.entries
+}
+
+// segments returns the queue of the shard if it is split into time segments
+func (s *cacheShard) segments() (*segmentedQueue, bool) {
+	segments, ok := s.queue().(*segmentedQueue)
+	return segments, ok
+}
+
+// recoverShard resets the shard owning hashedKey if corruption was caught during the last operation and reports it to
+// Config.OnCorruption, the operation fails with ErrInternalCorruption then. Otherwise err is returned.
+// It must not be called while the shard lock is held.
+func (c *BigCache) recoverShard(hashedKey uint64, err error) error {
+	return c.recoverShardIndex(c.shardIndex(hashedKey), err)
+}
+
+// recoverShardIndex is recoverShard for the shard with index id
+func (c *BigCache) recoverShardIndex(id uint64, err error) error {
+	shard := c.shards[id]
+	if shard.recovering == nil {
+		return err
+	}
+	cause := shard.recovering.takeCause()
+	if cause == nil {
+		return err
+	}
+	shard.reset(c.currentConfig())
+	c.audit(WithAuditInfo(context.Background(), "bigcache", fmt.Sprintf("internal corruption: %v", cause)), "RecoverShard", int(id))
+	if c.config.OnCorruption != nil {
+		c.config.OnCorruption(int(id), cause)
+	}
+	return ErrInternalCorruption
+}
@@ -0,0 +1,89 @@
+package bigcache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRecoverPanicsOfCorruptedShard(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var corruptedShard int
+	var cause interface{}
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		RecoverPanics:      true,
+		OnCorruption: func(shard int, c interface{}) {
+			corruptedShard = shard
+			cause = c
+		},
+	})
+	cache.Set("key", []byte("value"))
+	cache.Set("other", []byte("value"))
+	shard := cache.shards[0]
+
+	for _, index := range []uint64{3, 20} {
+		// when
+		shard.hashmap[cache.hash.Sum64("key")] = index
+		cause = nil
+		entry, err := cache.Get("key")
+
+		// then
+		assertEqual(t, ErrInternalCorruption, err)
+		assertEqual(t, []byte(nil), entry)
+		assertEqual(t, 0, corruptedShard)
+		assertEqual(t, true, cause != nil)
+		assertEqual(t, 0, cache.Len())
+
+		// when
+		err = cache.Set("key", []byte("value"))
+		cache.Set("other", []byte("value"))
+
+		// then
+		noError(t, err)
+		entry, _ = cache.Get("key")
+		assertEqual(t, []byte("value"), entry)
+	}
+}
+
+func TestRecoverCorruptedHeadOfQueue(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var corruptions int
+	clock := mockedClock{value: 100}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		RecoverPanics:      true,
+		OnRemove:           func(key string, entry []byte) {},
+		OnCorruption: func(shard int, cause interface{}) {
+			corruptions++
+		},
+	}, &clock)
+	cache.Set("key", []byte("value"))
+	oldest, _ := cache.shards[0].queue().Peek()
+	// key length pointing past the entry
+	oldest[timestampSizeInBytes+hashSizeInBytes] = 0xff
+	clock.set(110)
+
+	// when
+	// the expired head is evicted to make room for the entry
+	err := cache.Set("other", []byte("value"))
+
+	// then
+	assertEqual(t, ErrInternalCorruption, err)
+	assertEqual(t, 1, corruptions)
+	assertEqual(t, 0, cache.Len())
+	noError(t, cache.Set("other", []byte("value")))
+	entry, err := cache.Get("other")
+	noError(t, err)
+	assertEqual(t, []byte("value"), entry)
+}
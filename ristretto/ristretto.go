@@ -0,0 +1,99 @@
+// Package ristretto offers the Get/Set/Del/Wait API of github.com/dgraph-io/ristretto on top of BigCache,
+// so projects can switch between the two caches behind one interface and compare them.
+package ristretto
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+// Cache is a ristretto compatible facade of BigCache. Keys may be strings, byte slices or integers,
+// values have to be byte slices or strings and are returned as byte slices. Writes are synchronous,
+// so Wait returns immediately, and costs are ignored as BigCache is bounded by memory size.
+type Cache struct {
+	cache *bigcache.BigCache
+}
+
+// New returns facade of the cache
+func New(cache *bigcache.BigCache) *Cache {
+	return &Cache{cache: cache}
+}
+
+// Get returns the value for the key and whether it was found
+func (c *Cache) Get(key interface{}) (interface{}, bool) {
+	k, ok := keyToString(key)
+	if !ok {
+		return nil, false
+	}
+	value, err := c.cache.Get(k)
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// Set stores the value for the key and reports whether it was stored. cost is ignored.
+func (c *Cache) Set(key, value interface{}, cost int64) bool {
+	return c.SetWithTTL(key, value, cost, 0)
+}
+
+// SetWithTTL stores the value for the key for ttl, zero ttl means the lifetime of the cache.
+// It reports whether the value was stored. cost is ignored.
+func (c *Cache) SetWithTTL(key, value interface{}, cost int64, ttl time.Duration) bool {
+	k, ok := keyToString(key)
+	if !ok {
+		return false
+	}
+	var entry []byte
+	switch v := value.(type) {
+	case []byte:
+		entry = v
+	case string:
+		entry = []byte(v)
+	default:
+		return false
+	}
+	if c.cache.Set(k, entry) != nil {
+		return false
+	}
+	if ttl > 0 {
+		return c.cache.Expire(k, ttl) == nil
+	}
+	return true
+}
+
+// Del removes the key
+func (c *Cache) Del(key interface{}) {
+	if k, ok := keyToString(key); ok {
+		c.cache.Delete(k)
+	}
+}
+
+// Wait returns immediately as writes are not buffered
+func (c *Cache) Wait() {}
+
+// Clear removes all entries
+func (c *Cache) Clear() {
+	c.cache.Reset()
+}
+
+// Close closes the cache
+func (c *Cache) Close() {
+	c.cache.Close()
+}
+
+// keyToString converts key types supported by ristretto, prefixing integers so they do not clash with strings
+func keyToString(key interface{}) (string, bool) {
+	switch k := key.(type) {
+	case string:
+		return k, true
+	case []byte:
+		return string(k), true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("\x00%d", k), true
+	default:
+		return "", false
+	}
+}
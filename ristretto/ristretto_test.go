@@ -0,0 +1,70 @@
+package ristretto
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+func newCache() *Cache {
+	cache, _ := bigcache.New(context.Background(), bigcache.DefaultConfig(time.Minute))
+	return New(cache)
+}
+
+func TestSetGetDel(t *testing.T) {
+	t.Parallel()
+	cache := newCache()
+
+	if !cache.Set("key", []byte("value"), 1) || !cache.Set(42, "answer", 1) {
+		t.Fatal("values were not stored")
+	}
+	cache.Wait()
+
+	if value, found := cache.Get("key"); !found || string(value.([]byte)) != "value" {
+		t.Errorf("want: value; got: %v, %v", value, found)
+	}
+	if value, found := cache.Get(uint64(42)); !found || string(value.([]byte)) != "answer" {
+		t.Errorf("want integer keys of any type to match; got: %v, %v", value, found)
+	}
+	if _, found := cache.Get("42"); found {
+		t.Errorf("integer key clashes with string key")
+	}
+
+	cache.Del("key")
+	if _, found := cache.Get("key"); found {
+		t.Errorf("value was found after Del")
+	}
+	cache.Clear()
+	if _, found := cache.Get(42); found {
+		t.Errorf("value was found after Clear")
+	}
+}
+
+func TestUnsupportedTypes(t *testing.T) {
+	t.Parallel()
+	cache := newCache()
+
+	if cache.Set("key", 42, 1) {
+		t.Errorf("want integer value rejected")
+	}
+	if cache.Set(3.14, "value", 1) {
+		t.Errorf("want float key rejected")
+	}
+	if _, found := cache.Get(3.14); found {
+		t.Errorf("want float key not found")
+	}
+}
+
+func TestSetWithTTL(t *testing.T) {
+	t.Parallel()
+	cache := newCache()
+
+	cache.SetWithTTL("key", "value", 1, 5*time.Second)
+
+	// cache clock may tick between the calls
+	if ttl, _ := cache.cache.TTL("key"); ttl < 4*time.Second || ttl > 5*time.Second {
+		t.Errorf("want ttl of 5s; got: %s", ttl)
+	}
+}
@@ -0,0 +1,63 @@
+package bigcache
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// Sample returns n entries picked at random with replacement, without iterating the whole cache.
+// Shards are picked with probability proportional to their number of entries and entries within a shard
+// using the randomized iteration order of its map, so the sample is approximately uniform. It is meant for
+// estimating composition of big caches, e.g. distribution of timestamps or average entry size.
+// It returns nil when the cache is empty.
+func (c *BigCache) Sample(n int) []EntryInfo {
+	if n <= 0 {
+		return nil
+	}
+	offsets := make([]int, len(c.shards))
+	total := 0
+	for i, shard := range c.shards {
+		total += shard.len()
+		offsets[i] = total
+	}
+	if total == 0 {
+		return nil
+	}
+
+	counts := make(map[int]int)
+	for i := 0; i < n; i++ {
+		// offsets are cumulative, so the first one above the drawn position belongs to the picked shard
+		counts[sort.SearchInts(offsets, rand.Intn(total)+1)]++
+	}
+	samples := make([]EntryInfo, 0, n)
+	for shard, count := range counts {
+		samples = c.shards[shard].sample(count, samples)
+	}
+	rand.Shuffle(len(samples), func(i, j int) {
+		samples[i], samples[j] = samples[j], samples[i]
+	})
+	return samples
+}
+
+// sample appends n randomly picked entries of the shard to samples
+func (s *cacheShard) sample(n int, samples []EntryInfo) []EntryInfo {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for i := 0; i < n; i++ {
+		// iteration over a map starts at a random position
+		for _, index := range s.hashmap {
+			wrappedEntry, err := s.entries.Get(int(index))
+			if err == nil {
+				samples = append(samples, EntryInfo{
+					timestamp: readTimestampFromEntry(wrappedEntry),
+					hash:      readHashFromEntry(wrappedEntry),
+					key:       s.entryKey(wrappedEntry),
+					value:     readEntry(wrappedEntry),
+					sequence:  readSequenceFromEntry(wrappedEntry),
+				})
+			}
+			break
+		}
+	}
+	return samples
+}
@@ -0,0 +1,37 @@
+package bigcache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSample(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             8,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 1000,
+		MaxEntrySize:       256,
+	})
+
+	// when
+	empty := cache.Sample(10)
+	for i := 0; i < 1000; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)))
+	}
+	samples := cache.Sample(500)
+
+	// then
+	assertEqual(t, 0, len(empty))
+	assertEqual(t, 500, len(samples))
+	distinct := make(map[string]bool)
+	for _, sample := range samples {
+		assertEqual(t, []byte("value"+sample.Key()[len("key"):]), sample.Value())
+		distinct[sample.Key()] = true
+	}
+	assertEqual(t, true, len(distinct) > 100)
+}
@@ -0,0 +1,342 @@
+package bigcache
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/allegro/bigcache/v3/queue"
+)
+
+const (
+	segmentSlotBits = 5 // Number of index bits used for segment slot
+	segmentSlotMask = 1<<segmentSlotBits - 1
+	maxTimeSegments = 1<<segmentSlotBits - 1 // One slot is kept for the window which is being expired
+)
+
+var errNoFreeSegment = errors.New("no free segment")
+
+// entryQueue stores wrapped entries of a shard
+type entryQueue interface {
+	Push(entry []byte) (int, error)
+	Pop() ([]byte, error)
+	Peek() ([]byte, error)
+	Get(index int) ([]byte, error)
+	CheckGet(index int) error
+	Capacity() int
+	UsedBytes() int
+	FreeBytes() int
+	RightMargin() int
+	Geometry() queue.Geometry
+	Fits(length int) bool
+	EnsureCapacity(capacity int)
+	SetMaxCapacity(maxCapacity int)
+	Len() int
+	Reset()
+	Iterate(fn func(index int, data []byte) bool)
+	Verify() error
+}
+
+// segment is a queue holding entries written in a single time window
+type segment struct {
+	entries *queue.BytesQueue
+	newest  uint64
+	window  uint64
+	inUse   bool
+}
+
+// segmentedQueue splits entries into time windows, each of them stored in its own BytesQueue.
+// Once the newest entry of the oldest window expires, the whole window is dropped at once
+// instead of popping its entries one by one. Index of an entry holds the slot of its segment
+// in the lowest bits.
+type segmentedQueue struct {
+	segments    []segment
+	oldest      int // slot of the oldest segment in use
+	current     int // slot of the segment new entries are written to
+	used        int
+	windowWidth uint64
+	capacity    int
+	maxCapacity int
+	verbose     bool
+}
+
+func newSegmentedQueue(windows int, lifeWindow uint64, capacity int, maxCapacity int, verbose bool) *segmentedQueue {
+	slots := windows + 1
+	q := &segmentedQueue{
+		segments:    make([]segment, slots),
+		windowWidth: lifeWindow / uint64(windows),
+		capacity:    max(capacity/slots, 1),
+		maxCapacity: maxCapacity / slots,
+		verbose:     verbose,
+	}
+	q.open(0)
+	q.oldest = q.current
+	return q
+}
+
+// open starts new segment for the window, reusing memory of previously dropped ones
+func (q *segmentedQueue) open(window uint64) error {
+	if q.used == len(q.segments) {
+		return errNoFreeSegment
+	}
+	slot := q.current
+	if q.used > 0 {
+		slot = (q.current + 1) % len(q.segments)
+	}
+	s := &q.segments[slot]
+	if s.entries == nil {
+		s.entries = queue.NewLazyBytesQueue(q.capacity, q.maxCapacity, q.verbose)
+	}
+	s.inUse = true
+	s.newest = 0
+	s.window = window
+	q.current = slot
+	q.used++
+	return nil
+}
+
+// release frees the oldest segment, it is never called for the only segment in use
+func (q *segmentedQueue) release() {
+	s := &q.segments[q.oldest]
+	s.entries.Reset()
+	s.inUse = false
+	q.oldest = (q.oldest + 1) % len(q.segments)
+	q.used--
+}
+
+func (q *segmentedQueue) Push(entry []byte) (int, error) {
+	timestamp := readTimestampFromEntry(entry)
+	window := timestamp / q.windowWidth
+	current := &q.segments[q.current]
+
+	if window > current.window && current.entries.Len() > 0 {
+		if q.open(window) == nil {
+			current = &q.segments[q.current]
+		}
+	} else if current.entries.Len() == 0 {
+		current.window = window
+	}
+
+	index, err := current.entries.Push(entry)
+	if err != nil {
+		// current window is full, continue in the next one
+		if q.open(current.window) != nil {
+			return -1, err
+		}
+		current = &q.segments[q.current]
+		if index, err = current.entries.Push(entry); err != nil {
+			return -1, err
+		}
+	}
+	if timestamp > current.newest {
+		current.newest = timestamp
+	}
+	return index<<segmentSlotBits | q.current, nil
+}
+
+func (q *segmentedQueue) Pop() ([]byte, error) {
+	for {
+		s := &q.segments[q.oldest]
+		data, err := s.entries.Pop()
+		if err == nil || q.oldest == q.current {
+			if s.entries.Len() == 0 && q.oldest != q.current {
+				q.release()
+			}
+			return data, err
+		}
+		q.release()
+	}
+}
+
+func (q *segmentedQueue) Peek() ([]byte, error) {
+	slot := q.oldest
+	for {
+		data, err := q.segments[slot].entries.Peek()
+		if err == nil || slot == q.current {
+			return data, err
+		}
+		slot = (slot + 1) % len(q.segments)
+	}
+}
+
+func (q *segmentedQueue) Get(index int) ([]byte, error) {
+	s, offset, err := q.locate(index)
+	if err != nil {
+		return nil, err
+	}
+	return s.entries.Get(offset)
+}
+
+func (q *segmentedQueue) CheckGet(index int) error {
+	s, offset, err := q.locate(index)
+	if err != nil {
+		return err
+	}
+	return s.entries.CheckGet(offset)
+}
+
+func (q *segmentedQueue) locate(index int) (*segment, int, error) {
+	if index <= 0 {
+		return nil, 0, ErrEntryNotFound
+	}
+	s := &q.segments[index&segmentSlotMask]
+	if !s.inUse {
+		return nil, 0, ErrEntryNotFound
+	}
+	return s, index >> segmentSlotBits, nil
+}
+
+func (q *segmentedQueue) Capacity() int {
+	var capacity int
+	for i := range q.segments {
+		if q.segments[i].entries != nil {
+			capacity += q.segments[i].entries.Capacity()
+		}
+	}
+	return capacity
+}
+
+func (q *segmentedQueue) UsedBytes() int {
+	var used int
+	q.eachInUse(func(slot int, s *segment) bool {
+		used += s.entries.UsedBytes()
+		return true
+	})
+	return used
+}
+
+// FreeBytes returns the number of bytes new entries can take in the current segment before it grows
+func (q *segmentedQueue) FreeBytes() int {
+	return q.segments[q.current].entries.FreeBytes()
+}
+
+// RightMargin returns the right margin of the current segment
+func (q *segmentedQueue) RightMargin() int {
+	return q.segments[q.current].entries.RightMargin()
+}
+
+// Geometry returns positions of pointers in the current segment
+func (q *segmentedQueue) Geometry() queue.Geometry {
+	return q.segments[q.current].entries.Geometry()
+}
+
+// EnsureCapacity grows every segment, including ones opened later, to its part of the capacity
+func (q *segmentedQueue) EnsureCapacity(capacity int) {
+	capacity /= len(q.segments)
+	if q.maxCapacity > 0 {
+		capacity = min(capacity, q.maxCapacity)
+	}
+	q.capacity = max(q.capacity, capacity)
+	for i := range q.segments {
+		if q.segments[i].entries != nil {
+			q.segments[i].entries.EnsureCapacity(capacity)
+		}
+	}
+}
+
+// SetMaxCapacity splits the maximum capacity among segments, including ones opened later
+func (q *segmentedQueue) SetMaxCapacity(maxCapacity int) {
+	q.maxCapacity = maxCapacity / len(q.segments)
+	if q.maxCapacity > 0 {
+		q.capacity = min(q.capacity, q.maxCapacity)
+	}
+	for i := range q.segments {
+		if q.segments[i].entries != nil {
+			q.segments[i].entries.SetMaxCapacity(q.maxCapacity)
+		}
+	}
+}
+
+// Fits reports whether the entry fits into an emptied segment
+func (q *segmentedQueue) Fits(length int) bool {
+	return q.segments[q.current].entries.Fits(length)
+}
+
+func (q *segmentedQueue) Len() int {
+	var count int
+	q.eachInUse(func(slot int, s *segment) bool {
+		count += s.entries.Len()
+		return true
+	})
+	return count
+}
+
+func (q *segmentedQueue) Reset() {
+	for i := range q.segments {
+		if q.segments[i].entries != nil {
+			q.segments[i].entries.Reset()
+		}
+		q.segments[i].inUse = false
+	}
+	q.used = 0
+	q.open(0)
+	q.oldest = q.current
+}
+
+func (q *segmentedQueue) Iterate(fn func(index int, data []byte) bool) {
+	q.eachInUse(func(slot int, s *segment) bool {
+		next := true
+		s.entries.Iterate(func(index int, data []byte) bool {
+			next = fn(index<<segmentSlotBits|slot, data)
+			return next
+		})
+		return next
+	})
+}
+
+func (q *segmentedQueue) Verify() (err error) {
+	q.eachInUse(func(slot int, s *segment) bool {
+		if err = s.entries.Verify(); err != nil {
+			err = fmt.Errorf("segment %d: %w", slot, err)
+		}
+		return err == nil
+	})
+	return err
+}
+
+// touch records that timestamp of the entry has changed, so its segment is not dropped before it expires
+func (q *segmentedQueue) touch(index int, timestamp uint64) {
+	s, _, err := q.locate(index)
+	if err == nil && timestamp > s.newest {
+		s.newest = timestamp
+	}
+}
+
+// dropExpired drops the oldest segments in which all entries are expired, calling fn for each of their entries.
+// Returns number of dropped segments.
+func (q *segmentedQueue) dropExpired(currentTimestamp uint64, lifeWindow uint64, fn func(data []byte)) int {
+	dropped := 0
+	for {
+		s := &q.segments[q.oldest]
+		if s.entries.Len() == 0 {
+			if q.oldest == q.current {
+				return dropped
+			}
+			q.release()
+			continue
+		}
+		if currentTimestamp <= s.newest || currentTimestamp-s.newest <= lifeWindow {
+			return dropped
+		}
+		s.entries.Iterate(func(index int, data []byte) bool {
+			fn(data)
+			return true
+		})
+		dropped++
+		if q.oldest == q.current {
+			s.entries.Reset()
+			s.newest = 0
+			return dropped
+		}
+		q.release()
+	}
+}
+
+func (q *segmentedQueue) eachInUse(fn func(slot int, s *segment) bool) {
+	slot := q.oldest
+	for i := 0; i < q.used; i++ {
+		if !fn(slot, &q.segments[slot]) {
+			return
+		}
+		slot = (slot + 1) % len(q.segments)
+	}
+}
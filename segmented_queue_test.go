@@ -0,0 +1,165 @@
+package bigcache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTimeSegmentsDropWholeWindows(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 100}
+	var removed []string
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         10 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		TimeSegments:       5,
+		OnRemoveWithReason: func(key string, entry []byte, reason RemoveReason) {
+			assertEqual(t, Expired, reason)
+			removed = append(removed, key)
+		},
+	}, &clock)
+	segments := cache.shards[0].entries.(*segmentedQueue)
+
+	// when
+	cache.Set("a1", []byte("value"))
+	cache.Set("a2", []byte("value"))
+	clock.set(103)
+	cache.Set("b1", []byte("value"))
+	clock.set(111)
+	cache.cleanUp(uint64(clock.Epoch()))
+
+	// then
+	assertEqual(t, 1, segments.used)
+	assertEqual(t, []string{"a1", "a2"}, removed)
+	assertEqual(t, 1, cache.Len())
+
+	// when
+	clock.set(114)
+	cache.cleanUp(uint64(clock.Epoch()))
+
+	// then
+	assertEqual(t, 1, segments.used)
+	assertEqual(t, []string{"a1", "a2", "b1"}, removed)
+	assertEqual(t, 0, cache.Len())
+}
+
+func TestTimeSegmentsKeepEntriesAfterExpire(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 100}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         10 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		TimeSegments:       5,
+	}, &clock)
+	cache.Set("other", []byte("value"))
+	clock.set(101)
+	cache.Set("key", []byte("value"))
+
+	// when
+	clock.set(108)
+	cache.Expire("key", 10*time.Second)
+	clock.set(115)
+	cache.cleanUp(uint64(clock.Epoch()))
+
+	// then
+	value, err := cache.Get("key")
+	noError(t, err)
+	assertEqual(t, []byte("value"), value)
+	_, err = cache.Get("other")
+	assertEqual(t, ErrEntryNotFound, err)
+}
+
+func TestTimeSegmentsEvictOldestWhenFull(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 100}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         100 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       1024,
+		HardMaxCacheSize:   1,
+		TimeSegments:       3,
+	}, &clock)
+	value := blob('a', 1024)
+
+	// when
+	for i := 0; i < 3000; i++ {
+		if i%200 == 0 {
+			clock.set(clock.value + 25)
+		}
+		noError(t, cache.Set(fmt.Sprintf("key%d", i), value))
+	}
+
+	// then
+	_, err := cache.Get("key0")
+	assertEqual(t, ErrEntryNotFound, err)
+	read, err := cache.Get("key2999")
+	noError(t, err)
+	assertEqual(t, value, read)
+	if capacity := cache.Capacity(); capacity > 1024*1024 {
+		t.Errorf("capacity %d exceeds HardMaxCacheSize", capacity)
+	}
+}
+
+func TestTimeSegmentsSnapshotAndIterator(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 100}
+	config := Config{
+		Shards:             2,
+		LifeWindow:         10 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		TimeSegments:       2,
+	}
+	cache, _ := newBigCache(context.Background(), config, &clock)
+	for i := 0; i < 20; i++ {
+		clock.set(100 + int64(i))
+		cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+
+	// when
+	var buf bytes.Buffer
+	_, err := cache.WriteTo(&buf)
+	noError(t, err)
+	restored, _ := newBigCache(context.Background(), config, &clock)
+	_, restoreErr := restored.ReadFrom(&buf)
+
+	// then
+	noError(t, restoreErr)
+	assertEqual(t, cache.Len(), restored.Len())
+	count := 0
+	iterator := restored.Iterator()
+	for iterator.SetNext() {
+		_, err := iterator.Value()
+		noError(t, err)
+		count++
+	}
+	assertEqual(t, cache.Len(), count)
+}
+
+func TestTimeSegmentsValidation(t *testing.T) {
+	t.Parallel()
+
+	// when
+	_, tooManyErr := New(context.Background(), Config{Shards: 1, LifeWindow: time.Minute, TimeSegments: 32})
+	_, tooNarrowErr := New(context.Background(), Config{Shards: 1, LifeWindow: time.Second, TimeSegments: 2})
+
+	// then
+	assertEqual(t, "TimeSegments must be between 0 and 31", tooManyErr.Error())
+	assertEqual(t, "LifeWindow in seconds must be >= TimeSegments", tooNarrowErr.Error())
+}
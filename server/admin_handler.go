@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// middleware for admin routes, requests have to carry the admin token as a bearer token.
+func adminAuth(token string) service {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization := r.Header.Get("Authorization")
+			provided := strings.TrimPrefix(authorization, "Bearer ")
+			if token == "" || provided == authorization || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				w.WriteHeader(http.StatusUnauthorized)
+				log.Printf("unauthorized admin request to %s.", r.URL.Path)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// index for admin handle
+func adminIndexHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		action := r.URL.Path[len(adminPath):]
+		switch {
+		case action == "snapshot":
+			snapshotHandler(w, r)
+		case action == "config":
+			configHandler(w, r)
+		case action == "compact":
+			compactHandler(w, r)
+		case action == "shrink":
+			shrinkHandler(w, r)
+		case strings.HasPrefix(action, "reset-shard/"):
+			resetShardHandler(w, r, action[len("reset-shard/"):])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+// streams a snapshot of the whole cache, it can be restored with ReadFrom.
+func snapshotHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	n, err := cache.WriteTo(w)
+	if err != nil {
+		// headers are already sent, nothing more can be done.
+		log.Printf("cannot write snapshot: %s", err)
+		return
+	}
+	log.Printf("snapshot of %d bytes written.", n)
+}
+
+// empties a single shard.
+func resetShardHandler(w http.ResponseWriter, r *http.Request, id string) {
+	shard, err := strconv.Atoi(id)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("shard id must be a number."))
+		return
+	}
+	if err := cache.ResetShardContext(auditContext(r), shard); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	log.Printf("shard %d is successfully cleared", shard)
+	w.WriteHeader(http.StatusOK)
+}
+
+// removes dead entries of all shards.
+func compactHandler(w http.ResponseWriter, r *http.Request) {
+	processed := cache.Compact()
+	log.Printf("cache compacted, %d entries processed.", processed)
+	w.WriteHeader(http.StatusOK)
+}
+
+// releases memory of shard queues, with form value size in MB the cache size limit is lowered first,
+// evicting the oldest entries which do not fit.
+func shrinkHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if value := r.Form.Get("size"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err == nil {
+			err = cache.SetHardMaxCacheSizeContext(auditContext(r), size)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+	}
+	released := cache.Shrink()
+	log.Printf("cache shrunk by %d bytes.", released)
+	w.WriteHeader(http.StatusOK)
+}
+
+// changes the configuration of the running cache, with form values lifeWindow and cleanWindow
+// as durations, verbose as a bool and maxEntrySize in bytes. Values which are not sent are kept.
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	if err := updateConfig(r); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	log.Printf("config changed: %s", r.Form.Encode())
+	w.WriteHeader(http.StatusOK)
+}
+
+func updateConfig(r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	if value := r.Form.Get("lifeWindow"); value != "" {
+		lifeWindow, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		if err := cache.SetLifeWindow(lifeWindow); err != nil {
+			return err
+		}
+	}
+	if value := r.Form.Get("cleanWindow"); value != "" {
+		cleanWindow, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		if err := cache.SetCleanWindow(cleanWindow); err != nil {
+			return err
+		}
+	}
+	if value := r.Form.Get("verbose"); value != "" {
+		verbose, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		cache.SetVerbose(verbose)
+	}
+	if value := r.Form.Get("maxEntrySize"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		return cache.SetMaxEntrySize(size)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminRequiresToken(t *testing.T) {
+	t.Parallel()
+	handler := serviceLoader(adminIndexHandler(), adminAuth("secret"))
+
+	for _, authorization := range []string{"", "Bearer wrong", "secret"} {
+		req := httptest.NewRequest("POST", testBaseString+"/api/v1/admin/snapshot", nil)
+		req.Header.Set("Authorization", authorization)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != 401 {
+			t.Errorf("%q: want: 401; got: %d", authorization, rr.Code)
+		}
+	}
+}
+
+func TestAdminSnapshot(t *testing.T) {
+	t.Parallel()
+	cache.Set("snapshotKey", []byte("123"))
+	handler := serviceLoader(adminIndexHandler(), adminAuth("secret"))
+
+	req := httptest.NewRequest("POST", testBaseString+"/api/v1/admin/snapshot", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != 200 {
+		t.Errorf("want: 200; got: %d", rr.Code)
+	}
+	if !bytes.Contains(rr.Body.Bytes(), []byte("snapshotKey")) {
+		t.Errorf("snapshot does not contain stored key")
+	}
+}
+
+// not parallel, as resetting a shard removes keys stored by other tests
+func TestAdminResetShard(t *testing.T) {
+	handler := serviceLoader(adminIndexHandler(), adminAuth("secret"))
+
+	for path, want := range map[string]int{
+		"/api/v1/admin/reset-shard/0":    200,
+		"/api/v1/admin/reset-shard/4096": 400,
+		"/api/v1/admin/reset-shard/x":    400,
+		"/api/v1/admin/unknown":          404,
+	} {
+		req := httptest.NewRequest("POST", testBaseString+path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("%s: want: %d; got: %d", path, want, rr.Code)
+		}
+	}
+}
+
+func TestAdminCompact(t *testing.T) {
+	t.Parallel()
+	handler := serviceLoader(adminIndexHandler(), adminAuth("secret"))
+
+	req := httptest.NewRequest("POST", testBaseString+"/api/v1/admin/compact", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != 200 {
+		t.Errorf("want: 200; got: %d", rr.Code)
+	}
+}
+
+func TestAdminShrink(t *testing.T) {
+	t.Parallel()
+	handler := serviceLoader(adminIndexHandler(), adminAuth("secret"))
+
+	for query, want := range map[string]int{
+		"":        200,
+		"size=x":  400,
+		"size=-1": 400,
+	} {
+		req := httptest.NewRequest("POST", testBaseString+"/api/v1/admin/shrink?"+query, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("%s: want: %d; got: %d", query, want, rr.Code)
+		}
+	}
+}
+
+func TestAdminConfig(t *testing.T) {
+	t.Parallel()
+	handler := serviceLoader(adminIndexHandler(), adminAuth("secret"))
+
+	for query, want := range map[string]int{
+		"verbose=false&maxEntrySize=1024": 200,
+		"lifeWindow=x":                    400,
+		"cleanWindow=-1s":                 400,
+		"verbose=maybe":                   400,
+		"maxEntrySize=-1":                 400,
+	} {
+		req := httptest.NewRequest("POST", testBaseString+"/api/v1/admin/config?"+query, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("%s: want: %d; got: %d", query, want, rr.Code)
+		}
+	}
+}
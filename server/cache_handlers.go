@@ -1,10 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/allegro/bigcache/v3"
 )
 
 func cacheIndexHandler() http.Handler {
@@ -27,7 +35,7 @@ func cacheClearHandler() http.Handler {
 }
 
 func clearCache(w http.ResponseWriter, r *http.Request) {
-	if err := cache.Reset(); err != nil {
+	if err := cache.ResetContext(auditContext(r)); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.Printf("internal cache error: %s", err)
 	}
@@ -35,6 +43,23 @@ func clearCache(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// auditContext carries the client address and the reason given in X-Audit-Reason header to the audit log.
+func auditContext(r *http.Request) context.Context {
+	return bigcache.WithAuditInfo(r.Context(), r.RemoteAddr, r.Header.Get("X-Audit-Reason"))
+}
+
+// maxPooledEntryBuffer is the capacity above which buffers of big entries are not kept for reuse.
+const maxPooledEntryBuffer = 1 << 20
+
+// entryBuffers hold copies of entries served by getCacheHandler.
+var entryBuffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+func putEntryBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledEntryBuffer {
+		entryBuffers.Put(buf)
+	}
+}
+
 // handles get requests.
 func getCacheHandler(w http.ResponseWriter, r *http.Request) {
 	target := r.URL.Path[len(cachePath):]
@@ -44,7 +69,26 @@ func getCacheHandler(w http.ResponseWriter, r *http.Request) {
 		log.Print("empty request.")
 		return
 	}
-	entry, err := cache.Get(target)
+	// the digest stored with entries saves hashing the value for the ETag, it is used only when
+	// it is the same before and after the entry is copied, so it belongs to the copied value.
+	var digest uint64
+	hasDigest := false
+	if config.EntryDigest {
+		var err error
+		digest, err = cache.GetDigest(target)
+		hasDigest = err == nil
+	}
+	buf := entryBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer putEntryBuffer(buf)
+	// only a copy of the entry is made under the shard lock, the response is written after it is released,
+	// so a slow client does not block other requests to the shard.
+	var contentType string
+	err := cache.GetFnWithOptions(target, func(entry []byte, options bigcache.Options) error {
+		buf.Write(entry)
+		contentType = options.ContentType
+		return nil
+	})
 	if err != nil {
 		errMsg := (err).Error()
 		if strings.Contains(errMsg, "not found") {
@@ -56,7 +100,54 @@ func getCacheHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	w.Write(entry)
+
+	entry := buf.Bytes()
+	if hasDigest {
+		after, err := cache.GetDigest(target)
+		hasDigest = err == nil && after == digest
+	}
+	etag := digestETag(digest)
+	if !hasDigest {
+		etag = entryETag(entry)
+	}
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(entry)))
+	if _, err := w.Write(entry); err != nil {
+		log.Print(err)
+	}
+}
+
+// entryETag returns a strong entity tag derived from the content of the entry.
+func entryETag(entry []byte) string {
+	h := fnv.New64a()
+	h.Write(entry)
+	return digestETag(h.Sum64())
+}
+
+// digestETag returns a strong entity tag of the digest of an entry.
+func digestETag(digest uint64) string {
+	return fmt.Sprintf("\"%016x\"", digest)
+}
+
+// etagMatches checks If-None-Match header against the entity tag using weak comparison.
+func etagMatches(header string, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
 }
 
 func putCacheHandler(w http.ResponseWriter, r *http.Request) {
@@ -75,7 +166,8 @@ func putCacheHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := cache.Set(target, []byte(entry)); err != nil {
+	// content type of the request is stored with the entry and served back with it.
+	if err := cache.SetWithOptions(target, entry, bigcache.Options{ContentType: r.Header.Get("Content-Type")}); err != nil {
 		log.Print(err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
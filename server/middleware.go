@@ -1,8 +1,13 @@
 package main
 
 import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -27,3 +32,150 @@ func requestMetrics(l *log.Logger) service {
 		})
 	}
 }
+
+// middleware for gzip/deflate content negotiation. compressed request bodies are decompressed and
+// responses of at least minSize bytes are compressed when the client accepts it.
+func compression(minSize int) service {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+			case "", "identity":
+			case "gzip":
+				body, err := gzip.NewReader(r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					log.Printf("cannot decompress request body: %s", err)
+					return
+				}
+				r.Body = body
+			case "deflate":
+				body, err := zlib.NewReader(r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					log.Printf("cannot decompress request body: %s", err)
+					return
+				}
+				r.Body = body
+			default:
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+			r.Header.Del("Content-Encoding")
+
+			encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressResponseWriter{ResponseWriter: w, encoding: encoding, minSize: minSize}
+			h.ServeHTTP(cw, r)
+			cw.close()
+		})
+	}
+}
+
+// acceptedEncoding picks gzip or deflate from Accept-Encoding header, gzip is preferred.
+// codings refused with q=0 are not picked even when * accepts any other coding.
+func acceptedEncoding(header string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		coding, weight := part, 1.0
+		if i := strings.Index(part, ";"); i >= 0 {
+			coding = part[:i]
+			params := strings.TrimSpace(part[i+1:])
+			if strings.HasPrefix(params, "q=") {
+				if q, err := strconv.ParseFloat(params[2:], 64); err == nil {
+					weight = q
+				}
+			}
+		}
+		if coding = strings.ToLower(strings.TrimSpace(coding)); coding != "" {
+			accepted[coding] = weight > 0
+		}
+	}
+	for _, encoding := range []string{"gzip", "deflate"} {
+		ok, listed := accepted[encoding]
+		if !listed {
+			ok = accepted["*"]
+		}
+		if ok {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// weakETag turns the entity tag into a weak one, a compressed response is not byte for byte
+// the representation the strong tag was derived from.
+func weakETag(header http.Header) {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+// compressResponseWriter defers headers until the first write, when it is known whether the response
+// is big enough to be compressed.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	status   int
+	started  bool
+	writer   io.WriteCloser
+}
+
+func (w *compressResponseWriter) WriteHeader(status int) {
+	if !w.started && w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		w.start(len(b))
+	}
+	if w.writer != nil {
+		return w.writer.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressResponseWriter) start(size int) {
+	w.started = true
+	header := w.Header()
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil {
+		size = length
+	}
+	header.Add("Vary", "Accept-Encoding")
+	if size >= w.minSize && header.Get("Content-Encoding") == "" {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", w.encoding)
+		weakETag(header)
+		if w.encoding == "gzip" {
+			w.writer = gzip.NewWriter(w.ResponseWriter)
+		} else {
+			w.writer = zlib.NewWriter(w.ResponseWriter)
+		}
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *compressResponseWriter) close() {
+	if !w.started {
+		w.started = true
+		// a response without body, e.g. 304 Not Modified, carries the tag of the one it revalidates,
+		// which may have been compressed
+		weakETag(w.Header())
+		if w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+		return
+	}
+	if w.writer != nil {
+		if err := w.writer.Close(); err != nil {
+			log.Printf("cannot compress response: %s", err)
+		}
+	}
+}
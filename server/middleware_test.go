@@ -2,9 +2,13 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -45,3 +49,119 @@ func TestRequestMetrics(t *testing.T) {
 	}
 	t.Log(targetTestString)
 }
+
+func TestCompressionOfResponse(t *testing.T) {
+	cache.Set("compressedKey", bytes.Repeat([]byte("a"), 2048))
+	req := httptest.NewRequest("GET", testBaseString+"/api/v1/cache/compressedKey", nil)
+	req.Header.Set("Accept-Encoding", "deflate, gzip;q=0.5")
+	rr := httptest.NewRecorder()
+
+	serviceLoader(cacheIndexHandler(), compression(1024)).ServeHTTP(rr, req)
+	resp := rr.Result()
+
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("want: gzip; got: %q", resp.Header.Get("Content-Encoding"))
+	}
+	if resp.Header.Get("Content-Length") != "" {
+		t.Errorf("want no Content-Length; got: %s", resp.Header.Get("Content-Length"))
+	}
+	if etag := resp.Header.Get("ETag"); !strings.HasPrefix(etag, "W/") {
+		t.Errorf("want weak ETag; got: %q", etag)
+	}
+	body, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, _ := io.ReadAll(body)
+	if !bytes.Equal(value, bytes.Repeat([]byte("a"), 2048)) {
+		t.Errorf("decompressed body does not match the cached value")
+	}
+
+	revalidation := httptest.NewRequest("GET", testBaseString+"/api/v1/cache/compressedKey", nil)
+	revalidation.Header.Set("Accept-Encoding", "gzip")
+	revalidation.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	rr = httptest.NewRecorder()
+
+	serviceLoader(cacheIndexHandler(), compression(1024)).ServeHTTP(rr, revalidation)
+
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("want: 304; got: %d", rr.Code)
+	}
+	if etag := rr.Header().Get("ETag"); etag != resp.Header.Get("ETag") {
+		t.Errorf("want: %q; got: %q", resp.Header.Get("ETag"), etag)
+	}
+}
+
+func TestCompressionSkipsSmallResponses(t *testing.T) {
+	cache.Set("smallCompressedKey", []byte("123"))
+	req := httptest.NewRequest("GET", testBaseString+"/api/v1/cache/smallCompressedKey", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+
+	serviceLoader(cacheIndexHandler(), compression(1024)).ServeHTTP(rr, req)
+	resp := rr.Result()
+
+	if resp.Header.Get("Content-Encoding") != "" {
+		t.Errorf("want no Content-Encoding; got: %q", resp.Header.Get("Content-Encoding"))
+	}
+	if etag := resp.Header.Get("ETag"); strings.HasPrefix(etag, "W/") {
+		t.Errorf("want strong ETag; got: %q", etag)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != "123" {
+		t.Errorf("want: 123; got: %s", body)
+	}
+}
+
+func TestCompressionOfMissingKey(t *testing.T) {
+	req := httptest.NewRequest("GET", testBaseString+"/api/v1/cache/missingCompressedKey", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+
+	serviceLoader(cacheIndexHandler(), compression(0)).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("want: 404; got: %d", rr.Code)
+	}
+	if rr.Body.Len() != 0 {
+		t.Errorf("want empty body; got %d bytes", rr.Body.Len())
+	}
+}
+
+func TestCompressedRequestBody(t *testing.T) {
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	zw.Write([]byte("compressed"))
+	zw.Close()
+	req := httptest.NewRequest("PUT", testBaseString+"/api/v1/cache/compressedBodyKey", &b)
+	req.Header.Set("Content-Encoding", "deflate")
+	rr := httptest.NewRecorder()
+
+	serviceLoader(cacheIndexHandler(), compression(1024)).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Errorf("want: 201; got: %d", rr.Code)
+	}
+	if value, _ := cache.Get("compressedBodyKey"); string(value) != "compressed" {
+		t.Errorf("want: compressed; got: %s", value)
+	}
+}
+
+func TestAcceptedEncoding(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                         "",
+		"identity":                 "",
+		"deflate":                  "deflate",
+		"gzip, deflate":            "gzip",
+		"gzip;q=0, deflate":        "deflate",
+		"br, *;q=0.1":              "gzip",
+		"GZIP;q=0.8,deflate;":      "gzip",
+		"*, gzip;q=0":              "deflate",
+		"gzip;q=0, *":              "deflate",
+		"*;q=0, deflate":           "deflate",
+		"*, gzip;q=0, deflate;q=0": "",
+	} {
+		if got := acceptedEncoding(header); got != want {
+			t.Errorf("%q: want: %q; got: %q", header, want, got)
+		}
+	}
+}
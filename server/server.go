@@ -20,15 +20,21 @@ const (
 	// path to cache.
 	cachePath      = apiBasePath + "cache/"
 	statsPath      = apiBasePath + "stats"
+	lenPath        = apiBasePath + "len"
+	healthPath     = apiBasePath + "health"
 	cacheClearPath = apiBasePath + "cache/clear"
+	ttlPath        = apiBasePath + "ttl/"
+	adminPath      = apiBasePath + "admin/"
 	// server version.
 	version = "1.0.0"
 )
 
 var (
-	port    int
-	logfile string
-	ver     bool
+	port            int
+	logfile         string
+	ver             bool
+	compressMinSize int
+	adminToken      string
 
 	// cache-specific settings.
 	cache  *bigcache.BigCache
@@ -43,7 +49,12 @@ func init() {
 	flag.IntVar(&config.HardMaxCacheSize, "max", 8192, "Maximum amount of data in the cache in MB.")
 	flag.IntVar(&config.MaxEntrySize, "maxShardEntrySize", 500, "The maximum size of each object stored in a shard. Used only in initial memory allocation.")
 	flag.IntVar(&port, "port", 9090, "The port to listen on.")
+	flag.BoolVar(&config.ExpiryForecast, "expiryForecast", false, "Estimate entries expiring within the next minute, 5 minutes and hour, reported by the stats API.")
+	flag.DurationVar(&config.CanaryInterval, "canaryInterval", 0, "Interval of the self test of round trips through all shards reported by the health API, disabled when 0.")
+	flag.BoolVar(&config.EntryDigest, "entryDigest", false, "Store a digest of every value, used as its ETag instead of hashing the value on every read.")
+	flag.IntVar(&compressMinSize, "compressMinSize", 1024, "Minimum size of a response in bytes compressed when the client accepts gzip or deflate.")
 	flag.StringVar(&logfile, "logfile", "", "Location of the logfile.")
+	flag.StringVar(&adminToken, "adminToken", "", "Bearer token required by admin routes, they are disabled when empty.")
 	flag.BoolVar(&ver, "version", false, "Print server version.")
 }
 
@@ -67,6 +78,14 @@ func main() {
 		logger = log.New(f, "", log.LstdFlags)
 	}
 
+	if config.EntryDigest {
+		config.EntryFormat = bigcache.EntryFormatV2
+	}
+	config.OnAudit = bigcache.LogAudit(logger)
+	config.OnCanaryFailure = func(failure bigcache.CanaryFailure) {
+		logger.Printf("canary round trip through shard %d failed after %v: %v", failure.Shard, failure.RoundTrip, failure.Err)
+	}
+
 	var err error
 	cache, err = bigcache.New(context.Background(), config)
 	if err != nil {
@@ -77,8 +96,14 @@ func main() {
 
 	// let the middleware log.
 	http.Handle(cacheClearPath, serviceLoader(cacheClearHandler(), requestMetrics(logger)))
-	http.Handle(cachePath, serviceLoader(cacheIndexHandler(), requestMetrics(logger)))
+	http.Handle(cachePath, serviceLoader(cacheIndexHandler(), compression(compressMinSize), requestMetrics(logger)))
 	http.Handle(statsPath, serviceLoader(statsIndexHandler(), requestMetrics(logger)))
+	http.Handle(lenPath, serviceLoader(lenIndexHandler(), requestMetrics(logger)))
+	http.Handle(healthPath, serviceLoader(healthIndexHandler(), requestMetrics(logger)))
+	http.Handle(ttlPath, serviceLoader(ttlIndexHandler(), requestMetrics(logger)))
+	if adminToken != "" {
+		http.Handle(adminPath, serviceLoader(adminIndexHandler(), adminAuth(adminToken), requestMetrics(logger)))
+	}
 
 	logger.Printf("starting server on :%d", port)
 
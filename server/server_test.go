@@ -24,7 +24,7 @@ func testCacheSetup() {
 		MaxEntriesInWindow: 1000 * 10 * 60,
 		MaxEntrySize:       500,
 		Verbose:            true,
-		HardMaxCacheSize:   8192,
+		HardMaxCacheSize:   1024,
 		OnRemove:           nil,
 	})
 }
@@ -208,6 +208,27 @@ func TestGetStats(t *testing.T) {
 	}
 }
 
+func TestGetHealth(t *testing.T) {
+	t.Parallel()
+	var status bigcache.CanaryStatus
+
+	req := httptest.NewRequest("GET", testBaseString+"/api/v1/health", nil)
+	rr := httptest.NewRecorder()
+
+	healthIndexHandler().ServeHTTP(rr, req)
+	resp := rr.Result()
+
+	if resp.StatusCode != 200 {
+		t.Errorf("want: 200; got: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Errorf("error decoding canary status. error: %s", err)
+	}
+	if !status.Healthy {
+		t.Errorf("want: healthy; got: unhealthy")
+	}
+}
+
 func TestGetStatsIndex(t *testing.T) {
 	t.Parallel()
 	var testStats bigcache.Stats
@@ -273,6 +294,88 @@ func TestCacheIndexHandler(t *testing.T) {
 	}
 }
 
+func TestTTLIndexHandler(t *testing.T) {
+	if err := cache.Set("ttlKey", []byte("123")); err != nil {
+		t.Errorf("can't set key for testing. %s", err)
+	}
+	putreq := httptest.NewRequest("PUT", testBaseString+"/api/v1/ttl/ttlKey", bytes.NewBuffer([]byte("30")))
+	getreq := httptest.NewRequest("GET", testBaseString+"/api/v1/ttl/ttlKey", nil)
+	missreq := httptest.NewRequest("GET", testBaseString+"/api/v1/ttl/doesNotExist", nil)
+
+	putrr := httptest.NewRecorder()
+	getrr := httptest.NewRecorder()
+	missrr := httptest.NewRecorder()
+	testHandlers := ttlIndexHandler()
+
+	testHandlers.ServeHTTP(putrr, putreq)
+	resp := putrr.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("want: 200; got: %d.\n\tcan't set ttl.", resp.StatusCode)
+	}
+	testHandlers.ServeHTTP(getrr, getreq)
+	resp = getrr.Result()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Errorf("cannot deserialise test response: %s", err)
+	}
+	if string(body) != "30" && string(body) != "29" {
+		t.Errorf("want: 30; got: %s.\n\tcan't get ttl.", string(body))
+	}
+	testHandlers.ServeHTTP(missrr, missreq)
+	resp = missrr.Result()
+	if resp.StatusCode != 404 {
+		t.Errorf("want: 404; got: %d", resp.StatusCode)
+	}
+}
+
+func TestPutInvalidTTL(t *testing.T) {
+	t.Parallel()
+	req := httptest.NewRequest("PUT", testBaseString+"/api/v1/ttl/ttlKey", bytes.NewBuffer([]byte("soon")))
+	rr := httptest.NewRecorder()
+
+	putTTLHandler(rr, req)
+	resp := rr.Result()
+
+	if resp.StatusCode != 400 {
+		t.Errorf("want: 400; got: %d", resp.StatusCode)
+	}
+}
+
+func TestPutOverflowingTTL(t *testing.T) {
+	t.Parallel()
+	if err := cache.Set("overflowingTTLKey", []byte("123")); err != nil {
+		t.Errorf("can't set key for testing. %s", err)
+	}
+	req := httptest.NewRequest("PUT", testBaseString+"/api/v1/ttl/overflowingTTLKey", bytes.NewBuffer([]byte("9223372037")))
+	rr := httptest.NewRecorder()
+
+	putTTLHandler(rr, req)
+	resp := rr.Result()
+
+	if resp.StatusCode != 400 {
+		t.Errorf("want: 400; got: %d", resp.StatusCode)
+	}
+	if _, err := cache.Get("overflowingTTLKey"); err != nil {
+		t.Errorf("want entry to be kept; got: %v", err)
+	}
+}
+
+func TestPutTTLLongerThanLifeWindow(t *testing.T) {
+	t.Parallel()
+	if err := cache.Set("longTTLKey", []byte("123")); err != nil {
+		t.Errorf("can't set key for testing. %s", err)
+	}
+	req := httptest.NewRequest("PUT", testBaseString+"/api/v1/ttl/longTTLKey", bytes.NewBuffer([]byte("86400")))
+	rr := httptest.NewRecorder()
+
+	putTTLHandler(rr, req)
+	resp := rr.Result()
+
+	if resp.StatusCode != 400 {
+		t.Errorf("want: 400; got: %d", resp.StatusCode)
+	}
+}
+
 func TestInvalidPutWhenExceedShardCap(t *testing.T) {
 	t.Parallel()
 	req := httptest.NewRequest("PUT", testBaseString+"/api/v1/cache/putKey", bytes.NewBuffer(bytes.Repeat([]byte("a"), 8*1024*1024)))
@@ -304,3 +407,139 @@ type errReader int
 func (errReader) Read([]byte) (int, error) {
 	return 0, errors.New("test read error")
 }
+
+func TestPutAndGetKeyWithContentType(t *testing.T) {
+	t.Parallel()
+	req := httptest.NewRequest("PUT", testBaseString+"/api/v1/cache/jsonKey", bytes.NewBufferString(`{"a":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	putCacheHandler(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest("GET", testBaseString+"/api/v1/cache/jsonKey", nil)
+	rr := httptest.NewRecorder()
+	getCacheHandler(rr, req)
+	resp := rr.Result()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("want: application/json; got: %s", contentType)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != `{"a":1}` {
+		t.Errorf("want: {\"a\":1}; got: %s", body)
+	}
+}
+
+func TestGetKeyWithETag(t *testing.T) {
+	t.Parallel()
+	cache.Set("etagKey", []byte("123"))
+
+	req := httptest.NewRequest("GET", testBaseString+"/api/v1/cache/etagKey", nil)
+	rr := httptest.NewRecorder()
+	getCacheHandler(rr, req)
+	etag := rr.Result().Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("want ETag header")
+	}
+
+	req = httptest.NewRequest("GET", testBaseString+"/api/v1/cache/etagKey", nil)
+	req.Header.Set("If-None-Match", `"other", W/`+etag)
+	rr = httptest.NewRecorder()
+	getCacheHandler(rr, req)
+	resp := rr.Result()
+	if resp.StatusCode != 304 {
+		t.Errorf("want: 304; got: %d", resp.StatusCode)
+	}
+	if body, _ := io.ReadAll(resp.Body); len(body) != 0 {
+		t.Errorf("want empty body; got: %s", body)
+	}
+
+	cache.Set("etagKey", []byte("456"))
+	req = httptest.NewRequest("GET", testBaseString+"/api/v1/cache/etagKey", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	getCacheHandler(rr, req)
+	resp = rr.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("want: 200; got: %d", resp.StatusCode)
+	}
+	if resp.Header.Get("ETag") == etag {
+		t.Errorf("want ETag to change with the value")
+	}
+}
+
+// not parallel, as it replaces the cache used by other tests
+func TestGetKeyWithDigestETag(t *testing.T) {
+	previousCache, previousConfig := cache, config
+	defer func() {
+		cache, config = previousCache, previousConfig
+	}()
+	config = bigcache.Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		EntryFormat:        bigcache.EntryFormatV2,
+		EntryDigest:        true,
+	}
+	cache, _ = bigcache.New(context.Background(), config)
+	defer cache.Close()
+	cache.Set("digestKey", []byte("123"))
+
+	req := httptest.NewRequest("GET", testBaseString+"/api/v1/cache/digestKey", nil)
+	rr := httptest.NewRecorder()
+	getCacheHandler(rr, req)
+
+	digest, _ := cache.GetDigest("digestKey")
+	if etag := rr.Result().Header.Get("ETag"); etag != digestETag(digest) {
+		t.Errorf("want: %s; got: %s", digestETag(digest), etag)
+	}
+	if body, _ := io.ReadAll(rr.Result().Body); string(body) != "123" {
+		t.Errorf("want: 123; got: %s", body)
+	}
+}
+
+// blockingResponseWriter blocks writes of the body until release is closed.
+type blockingResponseWriter struct {
+	*httptest.ResponseRecorder
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingResponseWriter) Write(b []byte) (int, error) {
+	close(w.writing)
+	<-w.release
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestGetKeyDoesNotLockShardWhileWriting(t *testing.T) {
+	t.Parallel()
+	cache.Set("slowKey", []byte("123"))
+	w := &blockingResponseWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		writing:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		getCacheHandler(w, httptest.NewRequest("GET", testBaseString+"/api/v1/cache/slowKey", nil))
+		close(done)
+	}()
+	<-w.writing
+
+	set := make(chan error)
+	go func() {
+		set <- cache.Set("slowKey", []byte("456"))
+	}()
+	select {
+	case err := <-set:
+		if err != nil {
+			t.Errorf("cannot set key: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("write to the shard blocked by a slow client")
+	}
+	close(w.release)
+	<-done
+	if body := w.Body.String(); body != "123" {
+		t.Errorf("want: 123; got: %s", body)
+	}
+}
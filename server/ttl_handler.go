@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+// index for ttl handle
+func ttlIndexHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			getTTLHandler(w, r)
+		case http.MethodPut:
+			putTTLHandler(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// returns the remaining lifetime of an entry in seconds.
+func getTTLHandler(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Path[len(ttlPath):]
+	if target == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("can't get a ttl if there is no key."))
+		log.Print("empty request.")
+		return
+	}
+	ttl, err := cache.TTL(target)
+	if err != nil {
+		writeTTLError(w, target, err)
+		return
+	}
+	w.Write([]byte(strconv.FormatInt(int64(ttl/time.Second), 10)))
+}
+
+// sets the remaining lifetime of an entry, the body holds the number of seconds.
+func putTTLHandler(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Path[len(ttlPath):]
+	if target == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("can't set a ttl if there is no key."))
+		log.Print("empty request.")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	seconds, err := strconv.ParseInt(strings.TrimSpace(string(body)), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("ttl must be a number of seconds."))
+		log.Print(err)
+		return
+	}
+	// longer ttl would overflow time.Duration
+	if maxSeconds := int64(math.MaxInt64 / int64(time.Second)); seconds > maxSeconds || seconds < -maxSeconds {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("ttl is out of range."))
+		log.Printf("ttl of %ds is out of range.", seconds)
+		return
+	}
+
+	if err := cache.Expire(target, time.Duration(seconds)*time.Second); err != nil {
+		writeTTLError(w, target, err)
+		return
+	}
+	log.Printf("set ttl of \"%s\" to %ds.", target, seconds)
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeTTLError(w http.ResponseWriter, target string, err error) {
+	if errors.Is(err, bigcache.ErrEntryNotFound) {
+		log.Printf("%s not found.", target)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, bigcache.ErrTTLExceedsLifeWindow) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("ttl must not exceed the cache life window."))
+		log.Print(err)
+		return
+	}
+	log.Printf("internal cache error: %s", err)
+	w.WriteHeader(http.StatusInternalServerError)
+}
@@ -0,0 +1,111 @@
+// Package session stores web sessions in BigCache. Store implements the store interface of
+// github.com/alexedwards/scs, other session libraries can use it through Find, Commit and Delete.
+package session
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+const (
+	keyPrefix = "session:"
+	// expirySize is the size of the absolute expiry stored before session data
+	expirySize = 8
+)
+
+var (
+	// ErrSessionTooLarge is returned by Commit when session data is longer than the size limit of the store
+	ErrSessionTooLarge = errors.New("session is too large")
+	// ErrIdleTimeoutExceedsLifeWindow is returned by NewStore when sessions would expire before their idle timeout
+	ErrIdleTimeoutExceedsLifeWindow = errors.New("idle timeout exceeds life window of the cache")
+)
+
+// Store keeps sessions until their absolute expiry, or until they are idle for idleTimeout when it is set.
+// Every Find of a session extends its idle timeout.
+type Store struct {
+	cache       *bigcache.BigCache
+	idleTimeout time.Duration
+	maxSize     int
+	now         func() time.Time
+}
+
+// NewStore returns store of sessions in the cache. Zero idleTimeout disables sliding expiration and
+// zero maxSize disables the size limit of session data. It returns ErrIdleTimeoutExceedsLifeWindow
+// when idleTimeout is longer than the life window of the cache.
+func NewStore(cache *bigcache.BigCache, idleTimeout time.Duration, maxSize int) (*Store, error) {
+	if lifeWindow := cache.LifeWindow(); lifeWindow > 0 && idleTimeout > lifeWindow {
+		return nil, ErrIdleTimeoutExceedsLifeWindow
+	}
+	return &Store{cache: cache, idleTimeout: idleTimeout, maxSize: maxSize, now: time.Now}, nil
+}
+
+// Find returns data of the session with the token and whether it was found
+func (s *Store) Find(token string) ([]byte, bool, error) {
+	entry, err := s.cache.Get(keyPrefix + token)
+	if err == bigcache.ErrEntryNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if len(entry) < expirySize {
+		return nil, false, nil
+	}
+	expiry := time.Unix(0, int64(binary.LittleEndian.Uint64(entry)))
+	if !s.now().Before(expiry) {
+		return nil, false, s.Delete(token)
+	}
+	if s.idleTimeout > 0 {
+		// the session may be removed concurrently, rounded up ttl may exceed the life window
+		err := s.cache.Expire(keyPrefix+token, s.ttl(expiry))
+		if err == bigcache.ErrEntryNotFound {
+			return nil, false, nil
+		}
+		if err != nil && err != bigcache.ErrTTLExceedsLifeWindow {
+			return nil, false, err
+		}
+	}
+	return entry[expirySize:], true, nil
+}
+
+// Commit saves data of the session with the token, which expires at expiry
+func (s *Store) Commit(token string, data []byte, expiry time.Time) error {
+	if s.maxSize > 0 && len(data) > s.maxSize {
+		return ErrSessionTooLarge
+	}
+	entry := make([]byte, expirySize+len(data))
+	binary.LittleEndian.PutUint64(entry, uint64(expiry.UnixNano()))
+	copy(entry[expirySize:], data)
+	if err := s.cache.Set(keyPrefix+token, entry); err != nil {
+		return err
+	}
+	// a session outliving the life window of the cache is kept for the life window
+	if err := s.cache.Expire(keyPrefix+token, s.ttl(expiry)); err != bigcache.ErrTTLExceedsLifeWindow {
+		return err
+	}
+	return nil
+}
+
+// Delete removes the session with the token, it does nothing when the session does not exist
+func (s *Store) Delete(token string) error {
+	if err := s.cache.Delete(keyPrefix + token); err != bigcache.ErrEntryNotFound {
+		return err
+	}
+	return nil
+}
+
+// ttl returns lifetime of the session, limited by idle timeout. It is rounded up to whole seconds as
+// the cache has one second resolution and the absolute expiry is checked by Find anyway.
+func (s *Store) ttl(expiry time.Time) time.Duration {
+	ttl := expiry.Sub(s.now())
+	if s.idleTimeout > 0 && s.idleTimeout < ttl {
+		ttl = s.idleTimeout
+	}
+	if ttl <= 0 {
+		return 0
+	}
+	return (ttl + time.Second - 1).Truncate(time.Second)
+}
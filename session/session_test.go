@@ -0,0 +1,98 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+func newStore(idleTimeout time.Duration) (*Store, *bigcache.BigCache) {
+	cache, _ := bigcache.New(context.Background(), bigcache.DefaultConfig(time.Hour))
+	store, _ := NewStore(cache, idleTimeout, 16)
+	return store, cache
+}
+
+func TestCommitFindDelete(t *testing.T) {
+	t.Parallel()
+	store, _ := newStore(0)
+
+	if err := store.Commit("token", []byte("data"), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	data, found, err := store.Find("token")
+	if err != nil || !found || string(data) != "data" {
+		t.Errorf("want: data; got: %q, %v, %v", data, found, err)
+	}
+	if err := store.Delete("token"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := store.Find("token"); found {
+		t.Errorf("session was found after delete")
+	}
+	if err := store.Delete("token"); err != nil {
+		t.Errorf("want no error deleting missing session; got: %v", err)
+	}
+}
+
+func TestSizeLimit(t *testing.T) {
+	t.Parallel()
+	store, _ := newStore(0)
+
+	err := store.Commit("token", make([]byte, 17), time.Now().Add(time.Minute))
+
+	if err != ErrSessionTooLarge {
+		t.Errorf("want: %v; got: %v", ErrSessionTooLarge, err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	t.Parallel()
+	store, cache := newStore(10 * time.Second)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	store.Commit("idle", []byte("data"), now.Add(time.Minute))
+	store.Commit("short", []byte("data"), now.Add(3*time.Second))
+
+	// cache clock may tick between the calls
+	if ttl, _ := cache.TTL(keyPrefix + "idle"); ttl < 9*time.Second || ttl > 10*time.Second {
+		t.Errorf("want idle timeout of 10s; got: %s", ttl)
+	}
+	if ttl, _ := cache.TTL(keyPrefix + "short"); ttl < 2*time.Second || ttl > 3*time.Second {
+		t.Errorf("want ttl limited by expiry to 3s; got: %s", ttl)
+	}
+
+	now = now.Add(3 * time.Second)
+	if _, found, _ := store.Find("short"); found {
+		t.Errorf("session was found after its expiry")
+	}
+	if _, found, _ := store.Find("idle"); !found {
+		t.Errorf("session was not found before its expiry")
+	}
+}
+
+func TestIdleTimeoutLongerThanLifeWindow(t *testing.T) {
+	t.Parallel()
+	cache, _ := bigcache.New(context.Background(), bigcache.DefaultConfig(time.Minute))
+
+	_, err := NewStore(cache, time.Hour, 16)
+
+	if err != ErrIdleTimeoutExceedsLifeWindow {
+		t.Errorf("want: %v; got: %v", ErrIdleTimeoutExceedsLifeWindow, err)
+	}
+}
+
+func TestFindReturnsExpireError(t *testing.T) {
+	t.Parallel()
+	store, cache := newStore(10 * time.Second)
+	store.Commit("token", []byte("data"), time.Now().Add(time.Minute))
+	cache.SetReadOnly(true)
+
+	_, found, err := store.Find("token")
+
+	if found || err != bigcache.ErrReadOnly {
+		t.Errorf("want: %v; got: %v, %v", bigcache.ErrReadOnly, found, err)
+	}
+}
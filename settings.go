@@ -0,0 +1,173 @@
+package bigcache
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrInvalidConfig is returned by setters of the configuration of a running cache when the value is not allowed
+var ErrInvalidConfig = errors.New("invalid config")
+
+// SetLifeWindow changes the time after which entries expire. It applies to entries already stored, their
+// timestamps are kept, so a shorter window expires old entries on the next clean up. TombstoneTTL and TTLJitter
+// relative to LifeWindow follow the change. It returns ErrInvalidConfig when the window is not positive while
+// CleanWindow is set, or when entries are split into TimeSegments, which are sized by the window.
+func (c *BigCache) SetLifeWindow(lifeWindow time.Duration) error {
+	c.configLock.Lock()
+	defer c.configLock.Unlock()
+	config := c.config
+	config.LifeWindow = lifeWindow
+	switch {
+	case lifeWindow < 0:
+		return fmt.Errorf("%w: LifeWindow must be >= 0", ErrInvalidConfig)
+	case config.TimeSegments > 0:
+		return fmt.Errorf("%w: LifeWindow cannot be changed with TimeSegments", ErrInvalidConfig)
+	case config.lifeWindow() == 0 && c.CleanWindow() > 0:
+		return fmt.Errorf("%w: LifeWindow must be >= 1s when CleanWindow is set", ErrInvalidConfig)
+	}
+	c.config.LifeWindow = lifeWindow
+	atomic.StoreUint64(&c.lifeWindow, config.lifeWindow())
+	for _, shard := range c.shards {
+		shard.lock.Lock()
+		shard.lifeWindow = config.lifeWindow()
+		shard.maxTTLJitter = config.maximumTTLJitter()
+		shard.tombstoneTTL = config.tombstoneTTL()
+		shard.lock.Unlock()
+	}
+	return nil
+}
+
+// LifeWindow returns the current time after which entries expire
+func (c *BigCache) LifeWindow() time.Duration {
+	return time.Duration(atomic.LoadUint64(&c.lifeWindow)) * c.currentConfig().timestampUnit()
+}
+
+// SetCleanWindow changes the interval between clean ups of expired entries, 0 stops them.
+// It returns ErrInvalidConfig when the window is negative, or positive without LifeWindow.
+func (c *BigCache) SetCleanWindow(cleanWindow time.Duration) error {
+	if cleanWindow < 0 {
+		return fmt.Errorf("%w: CleanWindow must be >= 0", ErrInvalidConfig)
+	}
+	if cleanWindow > 0 && atomic.LoadUint64(&c.lifeWindow) == 0 {
+		return fmt.Errorf("%w: LifeWindow must be >= 1s when CleanWindow is set", ErrInvalidConfig)
+	}
+	atomic.StoreInt64(&c.cleanWindow, int64(cleanWindow))
+	for _, shard := range c.shards {
+		// without clean ups writes evict expired entries
+		shard.lock.Lock()
+		shard.cleanEnabled = cleanWindow > 0
+		shard.lock.Unlock()
+	}
+	if cleanWindow > 0 {
+		c.startCleanUp()
+	}
+	select {
+	case c.cleanWindowChanged <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// CleanWindow returns the current interval between clean ups, 0 means they are disabled
+func (c *BigCache) CleanWindow() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.cleanWindow))
+}
+
+// SetVerbose enables or disables logging of collisions, allocations and resizes
+func (c *BigCache) SetVerbose(verbose bool) {
+	atomic.StoreInt32(&c.verbose, boolToInt32(verbose))
+	for _, shard := range c.shards {
+		atomic.StoreInt32(&shard.verbose, boolToInt32(verbose))
+	}
+}
+
+// SetMaxEntrySize changes the expected maximum size of entries in bytes, which sizes buffers entries are
+// encoded in. Raising it for a cache storing bigger entries than expected at its creation saves reallocations
+// of the buffers. Sizes of shard queues are not changed. It returns ErrInvalidConfig when the size is negative.
+func (c *BigCache) SetMaxEntrySize(size int) error {
+	if size < 0 {
+		return fmt.Errorf("%w: MaxEntrySize must be >= 0", ErrInvalidConfig)
+	}
+	c.configLock.Lock()
+	defer c.configLock.Unlock()
+	c.config.MaxEntrySize = size
+	for _, shard := range c.shards {
+		shard.lock.Lock()
+		shard.entryBuffer = make([]byte, size+headersSizeInBytes)
+		shard.lock.Unlock()
+	}
+	return nil
+}
+
+// currentConfig returns a copy of the config with the changes made on the running cache,
+// shards are reset with it so they keep the changed values
+func (c *BigCache) currentConfig() Config {
+	c.configLock.RLock()
+	config := c.config
+	c.configLock.RUnlock()
+	return config
+}
+
+func (c *BigCache) isVerbose() bool {
+	return atomic.LoadInt32(&c.verbose) != 0
+}
+
+func (s *cacheShard) isVerbose() bool {
+	return atomic.LoadInt32(&s.verbose) != 0
+}
+
+// startCleanUp starts the loop removing expired entries unless it is running already
+func (c *BigCache) startCleanUp() {
+	c.cleanUpOnce.Do(func() {
+		go c.cleanUpLoop()
+	})
+}
+
+// cleanUpLoop removes expired entries every CleanWindow split into CleanPhases until the cache is closed,
+// the ticker is reset when the window is changed with SetCleanWindow
+func (c *BigCache) cleanUpLoop() {
+	phases, phase := c.currentConfig().cleanPhases(), 0
+	// cursors hold the shard every phase resumes from after a clean up stopped by MaxCleanupPause
+	cursors := make([]int, phases)
+	for i := range cursors {
+		cursors[i] = i
+	}
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	reset := func() {
+		ticker.Stop()
+		if window := c.CleanWindow(); window > 0 {
+			interval := window / time.Duration(phases)
+			if interval <= 0 {
+				interval = window
+			}
+			ticker.Reset(interval)
+		}
+	}
+	reset()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.cleanWindowChanged:
+			reset()
+		case t := <-ticker.C:
+			currentTimestamp := c.currentConfig().timestamp(t)
+			if c.config.MonotonicClock {
+				currentTimestamp = uint64(c.clock.Epoch())
+			}
+			var deadline time.Time
+			if c.config.MaxCleanupPause > 0 {
+				deadline = time.Now().Add(c.config.MaxCleanupPause)
+			}
+			if cursors[phase] = c.sweep(currentTimestamp, cursors[phase], phases, deadline); cursors[phase] >= len(c.shards) {
+				cursors[phase] = phase
+			}
+			phase = (phase + 1) % phases
+		case <-c.close:
+			return
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package bigcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSetLifeWindow(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}, &clock)
+	cache.Set("key", []byte("value"))
+
+	// when
+	err := cache.SetLifeWindow(10 * time.Second)
+	cache.cleanUp(11)
+
+	// then
+	noError(t, err)
+	assertEqual(t, 10*time.Second, cache.LifeWindow())
+	_, err = cache.Get("key")
+	assertEqual(t, ErrEntryNotFound, err)
+
+	// when
+	cache.Set("key", []byte("value"))
+	ttl, err := cache.TTL("key")
+
+	// then
+	noError(t, err)
+	assertEqual(t, 10*time.Second, ttl)
+}
+
+func TestSetLifeWindowInvalid(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	segmented, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		TimeSegments:       4,
+	})
+
+	// then
+	assertEqual(t, true, errors.Is(cache.SetLifeWindow(-1), ErrInvalidConfig))
+	assertEqual(t, true, errors.Is(cache.SetLifeWindow(0), ErrInvalidConfig))
+	assertEqual(t, true, errors.Is(segmented.SetLifeWindow(time.Hour), ErrInvalidConfig))
+	assertEqual(t, time.Minute, cache.LifeWindow())
+}
+
+func TestSetCleanWindow(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	})
+	defer cache.Close()
+
+	// when
+	err := cache.SetCleanWindow(20 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	// then
+	noError(t, err)
+	assertEqual(t, 20*time.Millisecond, cache.CleanWindow())
+	assertEqual(t, true, cache.ShardStats()[0].CleanUps > 0)
+
+	// when
+	err = cache.SetCleanWindow(0)
+	time.Sleep(20 * time.Millisecond)
+	cleanUps := cache.ShardStats()[0].CleanUps
+	time.Sleep(100 * time.Millisecond)
+
+	// then
+	noError(t, err)
+	assertEqual(t, cleanUps, cache.ShardStats()[0].CleanUps)
+	assertEqual(t, true, errors.Is(cache.SetCleanWindow(-1), ErrInvalidConfig))
+}
+
+func TestSetVerboseAndMaxEntrySize(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+
+	// when
+	cache.SetVerbose(false)
+	err := cache.SetMaxEntrySize(1024)
+
+	// then
+	noError(t, err)
+	assertEqual(t, false, cache.isVerbose())
+	assertEqual(t, false, cache.shards[0].isVerbose())
+	assertEqual(t, 1024+headersSizeInBytes, len(cache.shards[0].entryBuffer))
+	assertEqual(t, true, errors.Is(cache.SetMaxEntrySize(-1), ErrInvalidConfig))
+}
+
+func TestSettingsSurviveReset(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	noError(t, cache.SetMaxEntrySize(1024))
+	noError(t, cache.SetLifeWindow(time.Hour))
+
+	// when
+	cache.Reset()
+	cache.ResetShard(1)
+
+	// then
+	assertEqual(t, 1024, cache.config.MaxEntrySize)
+	assertEqual(t, time.Hour, cache.config.LifeWindow)
+	assertEqual(t, time.Hour, cache.LifeWindow())
+	for _, shard := range cache.shards {
+		assertEqual(t, 1024+headersSizeInBytes, len(shard.entryBuffer))
+	}
+}
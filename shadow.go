@@ -0,0 +1,104 @@
+package bigcache
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync/atomic"
+)
+
+// ShadowStats compares reads of sampled keys served by the cache and by its shadow
+type ShadowStats struct {
+	// Primary counts hits and misses of sampled keys in the wrapped cache
+	Primary Stats `json:"primary"`
+	// Shadow are statistics of the shadow cache
+	Shadow Stats `json:"shadow"`
+}
+
+// Shadow evaluates another configuration of the cache, e.g. with different LifeWindow, EvictionPolicy or size,
+// on a sample of production traffic. Gets, Sets and Deletes of sampled keys are mirrored to a shadow cache,
+// whose results are never returned, only counted. Keys are sampled by their hash, so all operations of a key
+// are either mirrored or not. Limits of the shadow configuration should be scaled down by the sample rate.
+type Shadow struct {
+	// hits and misses are accessed atomically, they come first to be 64-bit aligned on 32-bit platforms
+	hits      int64
+	misses    int64
+	cache     *BigCache
+	hasher    Hasher
+	threshold uint64
+}
+
+// NewShadow creates the shadow cache with the config, mirroring sampleRate (0-1] of keys
+func NewShadow(ctx context.Context, config Config, sampleRate float64) (*Shadow, error) {
+	if sampleRate <= 0 || sampleRate > 1 {
+		return nil, errors.New("sampleRate must be > 0 and <= 1")
+	}
+	cache, err := New(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	threshold := uint64(math.MaxUint64)
+	if sampleRate < 1 {
+		threshold = uint64(sampleRate * math.MaxUint64)
+	}
+	return &Shadow{cache: cache, hasher: newDefaultHasher(), threshold: threshold}, nil
+}
+
+// Middleware mirrors operations of sampled keys to the shadow cache
+func (s *Shadow) Middleware() Middleware {
+	return func(next Interface) Interface {
+		return &shadowedCache{Interface: next, shadow: s}
+	}
+}
+
+// Stats returns statistics of sampled keys
+func (s *Shadow) Stats() ShadowStats {
+	return ShadowStats{
+		Primary: Stats{
+			Hits:   atomic.LoadInt64(&s.hits),
+			Misses: atomic.LoadInt64(&s.misses),
+		},
+		Shadow: s.cache.Stats(),
+	}
+}
+
+// Close releases the shadow cache
+func (s *Shadow) Close() error {
+	return s.cache.Close()
+}
+
+func (s *Shadow) sampled(key string) bool {
+	return s.hasher.Sum64(key) <= s.threshold
+}
+
+type shadowedCache struct {
+	Interface
+	shadow *Shadow
+}
+
+func (c *shadowedCache) Get(key string) ([]byte, error) {
+	entry, err := c.Interface.Get(key)
+	if c.shadow.sampled(key) {
+		if err == nil {
+			atomic.AddInt64(&c.shadow.hits, 1)
+		} else if err == ErrEntryNotFound {
+			atomic.AddInt64(&c.shadow.misses, 1)
+		}
+		c.shadow.cache.GetFn(key, func([]byte) error { return nil })
+	}
+	return entry, err
+}
+
+func (c *shadowedCache) Set(key string, entry []byte) error {
+	if c.shadow.sampled(key) {
+		c.shadow.cache.Set(key, entry)
+	}
+	return c.Interface.Set(key, entry)
+}
+
+func (c *shadowedCache) Delete(key string) error {
+	if c.shadow.sampled(key) {
+		c.shadow.cache.Delete(key)
+	}
+	return c.Interface.Delete(key)
+}
@@ -0,0 +1,81 @@
+package bigcache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestShadowRecordsHypotheticalStats(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	shadow, _ := NewShadow(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		MaxEntries:         1,
+	}, 1)
+	defer shadow.Close()
+	shadowed := Wrap(cache, shadow.Middleware())
+
+	// when
+	shadowed.Set("a", []byte("1"))
+	shadowed.Set("b", []byte("2"))
+	shadowed.Get("a")
+	shadowed.Get("b")
+	shadowed.Get("c")
+	shadowed.Delete("b")
+
+	// then
+	stats := shadow.Stats()
+	assertEqual(t, int64(2), stats.Primary.Hits)
+	assertEqual(t, int64(1), stats.Primary.Misses)
+	assertEqual(t, int64(1), stats.Shadow.Hits)
+	assertEqual(t, int64(2), stats.Shadow.Misses)
+	assertEqual(t, 0, shadow.cache.Len())
+	value, err := shadowed.Get("a")
+	noError(t, err)
+	assertEqual(t, []byte("1"), value)
+}
+
+func TestShadowSamplesKeys(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	shadow, _ := NewShadow(context.Background(), DefaultConfig(time.Minute), 0.1)
+	defer shadow.Close()
+	shadowed := Wrap(cache, shadow.Middleware())
+
+	// when
+	for i := 0; i < 10000; i++ {
+		shadowed.Set(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+
+	// then
+	sampled := shadow.cache.Len()
+	assertEqual(t, true, sampled > 800 && sampled < 1200)
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		_, err := shadow.cache.Get(key)
+		assertEqual(t, shadow.sampled(key), err == nil)
+	}
+}
+
+func TestShadowValidation(t *testing.T) {
+	t.Parallel()
+
+	// when
+	_, rateErr := NewShadow(context.Background(), DefaultConfig(time.Minute), 0)
+	_, configErr := NewShadow(context.Background(), Config{Shards: 3}, 1)
+
+	// then
+	assertEqual(t, "sampleRate must be > 0 and <= 1", rateErr.Error())
+	assertEqual(t, "Shards number must be power of two", configErr.Error())
+}
@@ -1,9 +1,9 @@
 package bigcache
 
 import (
-	"errors"
-	"sync"
+	"math/rand"
 	"sync/atomic"
+	"time"
 
 	"github.com/allegro/bigcache/v3/queue"
 )
@@ -16,21 +16,106 @@ type Metadata struct {
 }
 
 type cacheShard struct {
+	// Fields accessed atomically come first to be 64-bit aligned on 32-bit platforms, lock holds such fields too
+	stats Stats
+	// cleanUps counts clean ups, cleanUpNanos and maxCleanUpNanos measure how long they held the lock,
+	// cleanUpYields counts clean ups stopped by Config.MaxCleanupPause
+	cleanUps        int64
+	cleanUpNanos    int64
+	maxCleanUpNanos int64
+	cleanUpYields   int64
+	lock            shardLock
+
 	hashmap     map[uint64]uint64
-	entries     queue.BytesQueue
-	lock        sync.RWMutex
+	entries     entryQueue
 	entryBuffer []byte
 	onRemove    onRemoveCallback
 
-	isVerbose    bool
+	// verbose is set when logging is enabled, accessed atomically as SetVerbose changes it
+	verbose      int32
 	statsEnabled bool
 	logger       Logger
 	clock        clock
 	lifeWindow   uint64
+	// timestampUnit is the duration of a single unit of entry timestamps
+	timestampUnit time.Duration
+	maxTTLJitter  uint64
+	jitterRand    *rand.Rand
 
 	hashmapStats map[uint64]uint32
-	stats        Stats
 	cleanEnabled bool
+
+	policy evictionPolicy
+	// frequency counts accesses of entries for policies using it
+	frequency      *frequencySketch
+	reinsertBuffer []byte
+	initialBytes   int
+	maxBytes       int
+	maxEntries     int
+	// rejectWrites refuses writes of a full shard instead of evicting its oldest entries
+	rejectWrites bool
+
+	entryFields    byte
+	verifyChecksum bool
+	// omitKeys writes entries in EntryFormatV2 without keys, even when no other optional fields are set
+	omitKeys bool
+	// sequence is the sequence number of the last entry written with Config.EntrySequence
+	sequence uint64
+	// keys of entries written without them, it is nil unless Config.SeparateKeyStore is set
+	keys *keyStore
+	// forecast counts live entries by their write time, it is nil unless Config.ExpiryForecast is set
+	forecast *expiryForecast
+	// removals remembers why keys were removed recently to classify misses, it is nil unless Config.OnMiss is set
+	removals *removalSketch
+	// valueVersion is stamped on written entries and valueMigrator migrates entries of other versions on Get
+	valueVersion  uint8
+	valueMigrator func(version uint8, old []byte) ([]byte, uint8, error)
+
+	// tombstones of soft deleted keys with the timestamp they expire at, created on first soft delete
+	tombstones        map[uint64]uint64
+	tombstoneTTL      uint64
+	tombstonesPruneAt int
+
+	// loadCosts holds duration of loads of entries written by GetOrLoad in nanoseconds, created on first such write
+	loadCosts map[uint64]int64
+
+	// deadBytes is the size of deleted and overwritten entries which still occupy the queue
+	deadBytes int
+	// liveBytes is the size of live entries, headerBytes the size of their headers
+	liveBytes   int
+	headerBytes int
+
+	// collectEvicted is set while setE collects entries removed by the write into evicted
+	collectEvicted bool
+	evicted        []EvictedEntry
+
+	// expiries stages events of expired entries, shared by all shards, it is nil unless enabled
+	expiries *expiryBuffer
+
+	// expireOnGet makes reads treat expired entries as not found, deleteExpiredOnGet makes get remove them
+	expireOnGet        bool
+	deleteExpiredOnGet bool
+
+	// noCopyGet makes get return entries referencing the queue
+	noCopyGet bool
+	// lent tracks entries returned by Get to be poisoned with Config.NoCopyGetDebug, it is nil otherwise
+	lent *lentEntries
+
+	// recovering wraps entries when panics are recovered, it is nil otherwise
+	recovering *recoveringQueue
+
+	// spiller writes entries evicted for space to Config.SpillStore, it is nil unless it is set
+	spiller *spiller
+
+	// onQueueResize reports changes of the queue capacity to Config.OnQueueResize, it is nil unless it is set
+	onQueueResize func(from, to int, took time.Duration)
+	// onIndex passes mutations of entries to Config.Indexer, it is nil unless it is set
+	onIndex func(event IndexEvent)
+
+	// readOnly rejects writes of entries with ErrReadOnly, dirty holds hashes of entries written while
+	// the cache is drained and is nil otherwise, both are guarded by lock
+	readOnly bool
+	dirty    map[uint64]struct{}
 }
 
 func (s *cacheShard) getWithInfo(key string, hashedKey uint64) (entry []byte, resp Response, err error) {
@@ -41,11 +126,11 @@ func (s *cacheShard) getWithInfo(key string, hashedKey uint64) (entry []byte, re
 		s.lock.RUnlock()
 		return nil, resp, err
 	}
-	if entryKey := readKeyFromEntry(wrappedEntry); key != entryKey {
+	if !compareKeyFromEntry(wrappedEntry, key) {
 		s.lock.RUnlock()
 		s.collision()
-		if s.isVerbose {
-			s.logger.Printf("Collision detected. Both %q and %q have the same hash %x", key, entryKey, hashedKey)
+		if s.isVerbose() {
+			s.logger.Printf("Collision detected. Both %q and %q have the same hash %x", key, readKeyFromEntry(wrappedEntry), hashedKey)
 		}
 		return nil, resp, ErrEntryNotFound
 	}
@@ -55,37 +140,155 @@ func (s *cacheShard) getWithInfo(key string, hashedKey uint64) (entry []byte, re
 		resp.EntryStatus = Expired
 	}
 	s.lock.RUnlock()
-	s.hit(hashedKey)
+	s.hit(hashedKey, len(entry))
 	return entry, resp, nil
 }
 
 func (s *cacheShard) get(key string, hashedKey uint64) ([]byte, error) {
-	s.lock.RLock()
-	wrappedEntry, err := s.getWrappedEntry(hashedKey)
+	if err := s.lock.rLockWithTimeout(); err != nil {
+		atomic.AddInt64(&s.stats.LockTimeouts, 1)
+		return nil, err
+	}
+	wrappedEntry, err := s.lookupWrappedEntry(hashedKey)
 	if err != nil {
 		s.lock.RUnlock()
 		return nil, err
 	}
-	if entryKey := readKeyFromEntry(wrappedEntry); key != entryKey {
+	if !compareKeyFromEntry(wrappedEntry, key) {
 		s.lock.RUnlock()
 		s.collision()
-		if s.isVerbose {
-			s.logger.Printf("Collision detected. Both %q and %q have the same hash %x", key, entryKey, hashedKey)
+		if s.isVerbose() {
+			s.logger.Printf("Collision detected. Both %q and %q have the same hash %x", key, readKeyFromEntry(wrappedEntry), hashedKey)
 		}
 		return nil, ErrEntryNotFound
 	}
-	entry := readEntry(wrappedEntry)
+	if s.expiredOnGet(wrappedEntry) {
+		s.lock.RUnlock()
+		if s.deleteExpiredOnGet {
+			s.deleteExpired(key, hashedKey)
+		}
+		return nil, ErrEntryNotFound
+	}
+	if s.valueMigrator != nil {
+		if version := readValueVersionFromEntry(wrappedEntry); version != s.valueVersion {
+			stale := staleEntry{
+				index:     s.hashmap[hashedKey],
+				timestamp: readTimestampFromEntry(wrappedEntry),
+				version:   version,
+				value:     readEntry(wrappedEntry),
+			}
+			s.lock.RUnlock()
+			return s.migrate(key, hashedKey, stale)
+		}
+	}
+	entry := s.readLentEntry(wrappedEntry)
 	s.lock.RUnlock()
-	s.hit(hashedKey)
+	s.hit(hashedKey, len(entry))
 
 	return entry, nil
 }
 
+func (s *cacheShard) getUnsafe(key string, hashedKey uint64) ([]byte, func(), error) {
+	s.lock.RLock()
+	wrappedEntry, err := s.getWrappedEntry(hashedKey)
+	if err != nil {
+		s.lock.RUnlock()
+		return nil, nil, err
+	}
+	if !compareKeyFromEntry(wrappedEntry, key) {
+		s.lock.RUnlock()
+		s.collision()
+		if s.isVerbose() {
+			s.logger.Printf("Collision detected. Both %q and %q have the same hash %x", key, readKeyFromEntry(wrappedEntry), hashedKey)
+		}
+		return nil, nil, ErrEntryNotFound
+	}
+
+	entry := readEntryWithoutCopy(wrappedEntry)
+	var released int32
+	release := func() {
+		if atomic.CompareAndSwapInt32(&released, 0, 1) {
+			s.lock.RUnlock()
+			s.hit(hashedKey, len(entry))
+		}
+	}
+	return entry, release, nil
+}
+
+// unlockOnPanic calls fn and calls unlock when fn panics, so a failing callback does not leave the shard locked
+func unlockOnPanic(unlock func(), fn func()) {
+	returned := false
+	defer func() {
+		if !returned {
+			unlock()
+		}
+	}()
+	fn()
+	returned = true
+}
+
+func (s *cacheShard) getFn(key string, hashedKey uint64, fn func(entry []byte) error) error {
+	s.lock.RLock()
+	wrappedEntry, err := s.getWrappedEntry(hashedKey)
+	if err != nil {
+		s.lock.RUnlock()
+		return err
+	}
+	if !compareKeyFromEntry(wrappedEntry, key) {
+		s.lock.RUnlock()
+		s.collision()
+		if s.isVerbose() {
+			s.logger.Printf("Collision detected. Both %q and %q have the same hash %x", key, readKeyFromEntry(wrappedEntry), hashedKey)
+		}
+		return ErrEntryNotFound
+	}
+	entry := readEntryWithoutCopy(wrappedEntry)
+	unlockOnPanic(s.lock.RUnlock, func() { err = fn(entry) })
+	s.lock.RUnlock()
+	s.hit(hashedKey, len(entry))
+	return err
+}
+
+// getWrappedFn calls fn with the wrapped entry of the key, holding the read lock
+func (s *cacheShard) getWrappedFn(key string, hashedKey uint64, fn func(wrappedEntry []byte) error) error {
+	s.lock.RLock()
+	wrappedEntry, err := s.getWrappedEntry(hashedKey)
+	if err != nil {
+		s.lock.RUnlock()
+		return err
+	}
+	if !compareKeyFromEntry(wrappedEntry, key) {
+		s.lock.RUnlock()
+		s.collision()
+		if s.isVerbose() {
+			s.logger.Printf("Collision detected. Both %q and %q have the same hash %x", key, readKeyFromEntry(wrappedEntry), hashedKey)
+		}
+		return ErrEntryNotFound
+	}
+	size := len(readEntryWithoutCopy(wrappedEntry))
+	unlockOnPanic(s.lock.RUnlock, func() { err = fn(wrappedEntry) })
+	s.lock.RUnlock()
+	s.hit(hashedKey, size)
+	return err
+}
+
 func (s *cacheShard) getWrappedEntry(hashedKey uint64) ([]byte, error) {
+	wrappedEntry, err := s.lookupWrappedEntry(hashedKey)
+	if err == nil && s.expiredOnGet(wrappedEntry) {
+		return nil, ErrEntryNotFound
+	}
+	return wrappedEntry, err
+}
+
+// lookupWrappedEntry returns the wrapped entry of the hash like getWrappedEntry, including expired ones
+func (s *cacheShard) lookupWrappedEntry(hashedKey uint64) ([]byte, error) {
 	itemIndex := s.hashmap[hashedKey]
 
 	if itemIndex == 0 {
 		s.miss()
+		if s.isTombstoned(hashedKey) {
+			return nil, ErrEntryDeleted
+		}
 		return nil, ErrEntryNotFound
 	}
 
@@ -94,6 +297,10 @@ func (s *cacheShard) getWrappedEntry(hashedKey uint64) ([]byte, error) {
 		s.miss()
 		return nil, err
 	}
+	if s.verifyChecksum && !isValidEntryChecksum(wrappedEntry) {
+		s.miss()
+		return nil, ErrEntryCorrupted
+	}
 
 	return wrappedEntry, err
 }
@@ -106,13 +313,13 @@ func (s *cacheShard) getValidWrapEntry(key string, hashedKey uint64) ([]byte, er
 
 	if !compareKeyFromEntry(wrappedEntry, key) {
 		s.collision()
-		if s.isVerbose {
+		if s.isVerbose() {
 			s.logger.Printf("Collision detected. Both %q and %q have the same hash %x", key, readKeyFromEntry(wrappedEntry), hashedKey)
 		}
 
 		return nil, ErrEntryNotFound
 	}
-	s.hitWithoutLock(hashedKey)
+	s.hitWithoutLock(hashedKey, len(readEntryWithoutCopy(wrappedEntry)))
 
 	return wrappedEntry, nil
 }
@@ -120,11 +327,126 @@ func (s *cacheShard) getValidWrapEntry(key string, hashedKey uint64) ([]byte, er
 func (s *cacheShard) set(key string, hashedKey uint64, entry []byte) error {
 	currentTimestamp := uint64(s.clock.Epoch())
 
+	if err := s.lock.lockWithTimeout(); err != nil {
+		atomic.AddInt64(&s.stats.LockTimeouts, 1)
+		return err
+	}
+	err := s.setWithoutLock(currentTimestamp, key, hashedKey, entry)
+	s.lock.Unlock()
+	return err
+}
+
+// setWithOptions saves the entry with the options stored in its extensible header
+func (s *cacheShard) setWithOptions(key string, hashedKey uint64, entry []byte, options Options) error {
+	currentTimestamp := uint64(s.clock.Epoch())
+
 	s.lock.Lock()
+	fields := s.entryFields
+	if !s.omitKeys {
+		fields |= entryFieldKey
+	}
+	w := wrapEntryWithFlags(s.entryTimestamp(currentTimestamp), hashedKey, key, entry, fields, options.ContentType, s.valueVersion, &s.entryBuffer)
+	err := s.setWrappedEntryWithoutLock(currentTimestamp, w, hashedKey)
+	s.lock.Unlock()
+	return err
+}
+
+// setWithSequence is set which returns the sequence number the entry was stamped with
+func (s *cacheShard) setWithSequence(key string, hashedKey uint64, entry []byte) (uint64, error) {
+	currentTimestamp := uint64(s.clock.Epoch())
+
+	s.lock.Lock()
+	err := s.setWithoutLock(currentTimestamp, key, hashedKey, entry)
+	var sequence uint64
+	if err == nil && s.entryFields&entryFieldSequence != 0 {
+		sequence = s.sequence
+	}
+	s.lock.Unlock()
+	return sequence, err
+}
+
+// setE is set which collects entries removed to make room for the new entry
+func (s *cacheShard) setE(key string, hashedKey uint64, entry []byte) ([]EvictedEntry, error) {
+	currentTimestamp := uint64(s.clock.Epoch())
+
+	s.lock.Lock()
+	s.collectEvicted = true
+	err := s.setWithoutLock(currentTimestamp, key, hashedKey, entry)
+	evicted := s.evicted
+	s.collectEvicted = false
+	s.evicted = nil
+	s.lock.Unlock()
+	return evicted, err
+}
+
+func (s *cacheShard) replace(key string, hashedKey uint64, entry []byte) error {
+	currentTimestamp := uint64(s.clock.Epoch())
+
+	s.lock.Lock()
+	if !s.containsWithoutLock(key, hashedKey) {
+		s.lock.Unlock()
+		return ErrEntryNotFound
+	}
+	err := s.setWithoutLock(currentTimestamp, key, hashedKey, entry)
+	s.lock.Unlock()
+	return err
+}
+
+func (s *cacheShard) update(key string, hashedKey uint64, fn func(old []byte, found bool) ([]byte, bool, error)) error {
+	currentTimestamp := uint64(s.clock.Epoch())
+
+	s.lock.Lock()
+	var old []byte
+	wrappedEntry, err := s.getValidWrapEntry(key, hashedKey)
+	if err == nil {
+		old = readEntryWithoutCopy(wrappedEntry)
+	} else if err != ErrEntryNotFound {
+		s.lock.Unlock()
+		return err
+	}
+
+	var entry []byte
+	var write bool
+	unlockOnPanic(s.lock.Unlock, func() { entry, write, err = fn(old, old != nil) })
+	if err != nil || !write {
+		s.lock.Unlock()
+		return err
+	}
+	err = s.setWithoutLock(currentTimestamp, key, hashedKey, entry)
+	s.lock.Unlock()
+	return err
+}
+
+// containsWithoutLock reports whether entry for the key is stored, without counting hits or misses
+func (s *cacheShard) containsWithoutLock(key string, hashedKey uint64) bool {
+	itemIndex := s.hashmap[hashedKey]
+	if itemIndex == 0 {
+		return false
+	}
+	wrappedEntry, err := s.entries.Get(int(itemIndex))
+	return err == nil && compareKeyFromEntry(wrappedEntry, key)
+}
+
+func (s *cacheShard) setWithoutLock(currentTimestamp uint64, key string, hashedKey uint64, entry []byte) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	w := s.wrapEntry(s.entryTimestamp(currentTimestamp), hashedKey, key, entry)
+	if !s.entries.Fits(len(w)) {
+		return ErrEntryExceedsShardCapacity
+	}
+	s.stampSequence(w)
+	if s.rejectWrites {
+		err := s.setOrRejectWithoutLock(currentTimestamp, w, hashedKey)
+		if err == nil {
+			s.storeKey(hashedKey, key)
+		}
+		return err
+	}
 
 	if previousIndex := s.hashmap[hashedKey]; previousIndex != 0 {
 		if previousEntry, err := s.entries.Get(int(previousIndex)); err == nil {
-			resetHashFromEntry(previousEntry)
+			s.markDead(previousEntry)
 			//remove hashkey
 			delete(s.hashmap, hashedKey)
 		}
@@ -135,48 +457,79 @@ func (s *cacheShard) set(key string, hashedKey uint64, entry []byte) error {
 			s.onEvict(oldestEntry, currentTimestamp, s.removeOldestEntry)
 		}
 	}
-
-	w := wrapEntry(currentTimestamp, hashedKey, key, entry, &s.entryBuffer)
+	s.evictForNewEntry(hashedKey)
 
 	for {
-		if index, err := s.entries.Push(w); err == nil {
+		if index, err := s.push(w); err == nil {
 			s.hashmap[hashedKey] = uint64(index)
-			s.lock.Unlock()
+			s.storeKey(hashedKey, key)
+			s.track(w)
+			delete(s.tombstones, hashedKey)
+			s.policyAdd(hashedKey)
 			return nil
 		}
 		if s.removeOldestEntry(NoSpace) != nil {
-			s.lock.Unlock()
-			return errors.New("entry is bigger than max shard size")
+			s.policyRemove(hashedKey, Deleted)
+			return ErrEntryExceedsShardCapacity
 		}
 	}
 }
 
 func (s *cacheShard) addNewWithoutLock(key string, hashedKey uint64, entry []byte) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
 	currentTimestamp := uint64(s.clock.Epoch())
+	w := s.wrapEntry(s.entryTimestamp(currentTimestamp), hashedKey, key, entry)
+	if !s.entries.Fits(len(w)) {
+		return ErrEntryExceedsShardCapacity
+	}
+	s.stampSequence(w)
+	if s.rejectWrites {
+		err := s.setOrRejectWithoutLock(currentTimestamp, w, hashedKey)
+		if err == nil {
+			s.storeKey(hashedKey, key)
+		}
+		return err
+	}
 
 	if !s.cleanEnabled {
 		if oldestEntry, err := s.entries.Peek(); err == nil {
 			s.onEvict(oldestEntry, currentTimestamp, s.removeOldestEntry)
 		}
 	}
-
-	w := wrapEntry(currentTimestamp, hashedKey, key, entry, &s.entryBuffer)
+	s.evictForNewEntry(hashedKey)
 
 	for {
-		if index, err := s.entries.Push(w); err == nil {
+		if index, err := s.push(w); err == nil {
 			s.hashmap[hashedKey] = uint64(index)
+			s.storeKey(hashedKey, key)
+			s.track(w)
+			delete(s.tombstones, hashedKey)
+			s.policyAdd(hashedKey)
 			return nil
 		}
 		if s.removeOldestEntry(NoSpace) != nil {
-			return errors.New("entry is bigger than max shard size")
+			return ErrEntryExceedsShardCapacity
 		}
 	}
 }
 
 func (s *cacheShard) setWrappedEntryWithoutLock(currentTimestamp uint64, w []byte, hashedKey uint64) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if !s.entries.Fits(len(w)) {
+		return ErrEntryExceedsShardCapacity
+	}
+	s.stampSequence(w)
+	if s.rejectWrites {
+		return s.setOrRejectWithoutLock(currentTimestamp, w, hashedKey)
+	}
+
 	if previousIndex := s.hashmap[hashedKey]; previousIndex != 0 {
 		if previousEntry, err := s.entries.Get(int(previousIndex)); err == nil {
-			resetHashFromEntry(previousEntry)
+			s.markDead(previousEntry)
 		}
 	}
 
@@ -185,16 +538,59 @@ func (s *cacheShard) setWrappedEntryWithoutLock(currentTimestamp uint64, w []byt
 			s.onEvict(oldestEntry, currentTimestamp, s.removeOldestEntry)
 		}
 	}
+	s.evictForNewEntry(hashedKey)
 
 	for {
-		if index, err := s.entries.Push(w); err == nil {
+		if index, err := s.push(w); err == nil {
 			s.hashmap[hashedKey] = uint64(index)
+			s.track(w)
+			delete(s.tombstones, hashedKey)
+			s.policyAdd(hashedKey)
 			return nil
 		}
 		if s.removeOldestEntry(NoSpace) != nil {
-			return errors.New("entry is bigger than max shard size")
+			return ErrEntryExceedsShardCapacity
+		}
+	}
+}
+
+// setOrRejectWithoutLock saves the wrapped entry only when it fits without evicting live entries,
+// expired and dead entries are still removed to make room. Entry of the key is kept when the write is rejected.
+func (s *cacheShard) setOrRejectWithoutLock(currentTimestamp uint64, w []byte, hashedKey uint64) error {
+	if !s.cleanEnabled {
+		if oldestEntry, err := s.entries.Peek(); err == nil {
+			s.onEvict(oldestEntry, currentTimestamp, s.removeOldestEntry)
+		}
+	}
+	previousIndex := s.hashmap[hashedKey]
+	if previousIndex == 0 && s.maxEntries > 0 && len(s.hashmap) >= s.maxEntries {
+		return ErrShardFull
+	}
+	index, err := s.push(w)
+	for err != nil {
+		oldestEntry, peekErr := s.entries.Peek()
+		if peekErr != nil {
+			return ErrShardFull
+		}
+		// space of deleted and overwritten entries is reclaimed as well
+		if readHashFromEntry(oldestEntry) == 0 {
+			s.removeOldestEntry(Deleted)
+		} else if !s.onEvict(oldestEntry, currentTimestamp, s.removeOldestEntry) {
+			return ErrShardFull
+		}
+		previousIndex = s.hashmap[hashedKey]
+		index, err = s.push(w)
+	}
+	if previousIndex != 0 {
+		if previousEntry, err := s.entries.Get(int(previousIndex)); err == nil {
+			s.markDead(previousEntry)
 		}
 	}
+	s.hashmap[hashedKey] = uint64(index)
+	s.track(w)
+	delete(s.tombstones, hashedKey)
+	s.policyAdd(hashedKey)
+	return nil
 }
 
 func (s *cacheShard) append(key string, hashedKey uint64, entry []byte) error {
@@ -213,7 +609,7 @@ func (s *cacheShard) append(key string, hashedKey uint64, entry []byte) error {
 
 	currentTimestamp := uint64(s.clock.Epoch())
 
-	w := appendToWrappedEntry(currentTimestamp, wrappedEntry, entry, &s.entryBuffer)
+	w := appendToWrappedEntry(s.entryTimestamp(currentTimestamp), wrappedEntry, entry, &s.entryBuffer)
 
 	err = s.setWrappedEntryWithoutLock(currentTimestamp, w, hashedKey)
 	s.lock.Unlock()
@@ -260,12 +656,7 @@ func (s *cacheShard) del(hashedKey uint64) error {
 			return err
 		}
 
-		delete(s.hashmap, hashedKey)
-		s.onRemove(wrappedEntry, Deleted)
-		if s.statsEnabled {
-			delete(s.hashmapStats, hashedKey)
-		}
-		resetHashFromEntry(wrappedEntry)
+		s.delWithoutLock(hashedKey, wrappedEntry)
 	}
 	s.lock.Unlock()
 
@@ -273,6 +664,187 @@ func (s *cacheShard) del(hashedKey uint64) error {
 	return nil
 }
 
+// delWithoutLock removes the live entry of the hash, it has to be called with the write lock held
+func (s *cacheShard) delWithoutLock(hashedKey uint64, wrappedEntry []byte) {
+	delete(s.hashmap, hashedKey)
+	s.forgetKey(hashedKey)
+	s.policyRemove(hashedKey, Deleted)
+	s.rememberRemoval(hashedKey, Deleted)
+	s.index(IndexRemove, wrappedEntry, Deleted)
+	s.onRemove(wrappedEntry, Deleted)
+	if s.statsEnabled {
+		delete(s.hashmapStats, hashedKey)
+	}
+	s.markDead(wrappedEntry)
+}
+
+func (s *cacheShard) deleteIf(key string, hashedKey uint64, pred func(entry []byte, info EntryInfo) bool) (bool, error) {
+	s.lock.Lock()
+	itemIndex := s.hashmap[hashedKey]
+	if itemIndex == 0 {
+		s.lock.Unlock()
+		s.delmiss()
+		return false, ErrEntryNotFound
+	}
+	wrappedEntry, err := s.entries.Get(int(itemIndex))
+	if err != nil || !compareKeyFromEntry(wrappedEntry, key) {
+		s.lock.Unlock()
+		s.delmiss()
+		if err == nil {
+			err = ErrEntryNotFound
+		}
+		return false, err
+	}
+
+	entry := readEntryWithoutCopy(wrappedEntry)
+	info := EntryInfo{
+		timestamp: readTimestampFromEntry(wrappedEntry),
+		hash:      hashedKey,
+		key:       key,
+		value:     entry,
+		sequence:  readSequenceFromEntry(wrappedEntry),
+	}
+	var matched bool
+	unlockOnPanic(s.lock.Unlock, func() { matched = pred(entry, info) })
+	if !matched {
+		s.lock.Unlock()
+		return false, nil
+	}
+	s.deleteEntry(wrappedEntry, hashedKey)
+	s.lock.Unlock()
+
+	s.delhit()
+	return true, nil
+}
+
+func (s *cacheShard) ttl(key string, hashedKey uint64) (time.Duration, error) {
+	currentTimestamp := uint64(s.clock.Epoch())
+	s.lock.RLock()
+	wrappedEntry, err := s.getWrappedEntry(hashedKey)
+	if err != nil {
+		s.lock.RUnlock()
+		return 0, err
+	}
+	if !compareKeyFromEntry(wrappedEntry, key) {
+		s.lock.RUnlock()
+		s.collision()
+		return 0, ErrEntryNotFound
+	}
+	expiresAt := readTimestampFromEntry(wrappedEntry) + s.lifeWindow
+	s.lock.RUnlock()
+
+	if currentTimestamp >= expiresAt {
+		return 0, nil
+	}
+	return time.Duration(expiresAt-currentTimestamp) * s.timestampUnit, nil
+}
+
+func (s *cacheShard) digest(key string, hashedKey uint64) (uint64, error) {
+	s.lock.RLock()
+	wrappedEntry, err := s.getWrappedEntry(hashedKey)
+	if err != nil {
+		s.lock.RUnlock()
+		return 0, err
+	}
+	if !compareKeyFromEntry(wrappedEntry, key) {
+		s.lock.RUnlock()
+		s.collision()
+		return 0, ErrEntryNotFound
+	}
+	digest, ok := readDigestFromEntry(wrappedEntry)
+	if !ok {
+		digest = xxh3(readEntryWithoutCopy(wrappedEntry))
+	}
+	s.lock.RUnlock()
+	return digest, nil
+}
+
+func (s *cacheShard) expire(key string, hashedKey uint64, ttl uint64) error {
+	currentTimestamp := uint64(s.clock.Epoch())
+	s.lock.Lock()
+	wrappedEntry, err := s.getValidWrapEntry(key, hashedKey)
+	if err != nil {
+		s.lock.Unlock()
+		return err
+	}
+	// a timestamp ahead of the clock would stop cleanUp at this entry
+	if s.lifeWindow > 0 && ttl > s.lifeWindow {
+		s.lock.Unlock()
+		return ErrTTLExceedsLifeWindow
+	}
+	// entry expires once currentTimestamp - timestamp > lifeWindow
+	timestamp := currentTimestamp + ttl
+	if timestamp >= s.lifeWindow {
+		timestamp -= s.lifeWindow
+	} else {
+		timestamp = 0
+	}
+	err = s.restamp(wrappedEntry, hashedKey, timestamp)
+	s.lock.Unlock()
+	return err
+}
+
+// restamp moves the live entry to the tail of the queue with the new timestamp, so that cleanUp, which stops
+// at the first entry which is not expired, is not held up by it. It has to be called with the write lock held.
+func (s *cacheShard) restamp(wrappedEntry []byte, hashedKey uint64, timestamp uint64) error {
+	if len(wrappedEntry) > len(s.entryBuffer) {
+		s.entryBuffer = make([]byte, len(wrappedEntry))
+	}
+	w := s.entryBuffer[:len(wrappedEntry)]
+	copy(w, wrappedEntry)
+	writeTimestampToEntry(w, timestamp)
+
+	s.untrack(wrappedEntry)
+	resetHashFromEntry(wrappedEntry)
+	s.deadBytes += len(wrappedEntry)
+	delete(s.hashmap, hashedKey)
+	// a dead copy at the head is popped right away, so that writes evicting the oldest expired entry do not stop at it
+	if oldestEntry, err := s.entries.Peek(); err == nil && &oldestEntry[0] == &wrappedEntry[0] {
+		s.removeOldestEntry(Deleted)
+	}
+
+	for {
+		if index, err := s.push(w); err == nil {
+			s.hashmap[hashedKey] = uint64(index)
+			headerSize, _ := readKeyBoundsFromEntry(w)
+			s.liveBytes += len(w)
+			s.headerBytes += headerSize
+			if s.forecast != nil {
+				s.forecast.add(timestamp, len(w))
+			}
+			s.index(IndexTouch, w, 0)
+			return nil
+		}
+		if s.removeOldestEntry(NoSpace) != nil {
+			s.policyRemove(hashedKey, Deleted)
+			return ErrEntryExceedsShardCapacity
+		}
+	}
+}
+
+// expiredOnGet reports whether the read entry is expired with ExpireOnGet, counting it as a miss
+func (s *cacheShard) expiredOnGet(wrappedEntry []byte) bool {
+	if !s.expireOnGet || s.lifeWindow == 0 || !s.isExpired(wrappedEntry, uint64(s.clock.Epoch())) {
+		return false
+	}
+	s.miss()
+	atomic.AddInt64(&s.stats.LazyExpirations, 1)
+	return true
+}
+
+// deleteExpired removes entry of the key if it is still expired, without counting hits or misses
+func (s *cacheShard) deleteExpired(key string, hashedKey uint64) {
+	currentTimestamp := uint64(s.clock.Epoch())
+	s.lock.Lock()
+	if itemIndex := s.hashmap[hashedKey]; itemIndex != 0 {
+		wrappedEntry, err := s.entries.Get(int(itemIndex))
+		if err == nil && compareKeyFromEntry(wrappedEntry, key) && s.isExpired(wrappedEntry, currentTimestamp) {
+			s.discardEntry(wrappedEntry, hashedKey, Expired)
+		}
+	}
+	s.lock.Unlock()
+}
+
 func (s *cacheShard) onEvict(oldestEntry []byte, currentTimestamp uint64, evict func(reason RemoveReason) error) bool {
 	if s.isExpired(oldestEntry, currentTimestamp) {
 		evict(Expired)
@@ -289,16 +861,94 @@ func (s *cacheShard) isExpired(oldestEntry []byte, currentTimestamp uint64) bool
 	return currentTimestamp-oldestTimestamp > s.lifeWindow
 }
 
-func (s *cacheShard) cleanUp(currentTimestamp uint64) {
+// entryTimestamp returns timestamp stamped on written entries, moved back by a random jitter if configured.
+// It has to be called with the write lock held.
+func (s *cacheShard) entryTimestamp(currentTimestamp uint64) uint64 {
+	if s.maxTTLJitter == 0 {
+		return currentTimestamp
+	}
+	jitter := uint64(s.jitterRand.Int63n(int64(s.maxTTLJitter) + 1))
+	if jitter > currentTimestamp {
+		return 0
+	}
+	return currentTimestamp - jitter
+}
+
+// evictForNewEntry removes the oldest entries until a new entry for the key fits in the maximum number of entries
+func (s *cacheShard) evictForNewEntry(hashedKey uint64) {
+	for s.maxEntries > 0 && len(s.hashmap) >= s.maxEntries {
+		if _, ok := s.hashmap[hashedKey]; ok {
+			return
+		}
+		if s.removeOldestEntry(NoSpace) != nil {
+			return
+		}
+	}
+}
+
+// stampSequence stores the next sequence number of the shard in the wrapped entry if it has room for it
+func (s *cacheShard) stampSequence(w []byte) {
+	if s.entryFields&entryFieldSequence != 0 && writeSequenceToEntry(w, s.sequence+1) {
+		s.sequence++
+	}
+}
+
+// wrapEntry wraps entry in the format configured for the shard
+func (s *cacheShard) wrapEntry(timestamp uint64, hashedKey uint64, key string, entry []byte) []byte {
+	if s.entryFields == 0 && !s.omitKeys {
+		return wrapEntry(timestamp, hashedKey, key, entry, &s.entryBuffer)
+	}
+	if s.valueVersion != 0 {
+		return wrapEntryWithFlags(timestamp, hashedKey, key, entry, s.entryFields, "", s.valueVersion, &s.entryBuffer)
+	}
+	return wrapEntryWithFields(timestamp, hashedKey, key, entry, s.entryFields, &s.entryBuffer)
+}
+
+// cleanUp removes expired entries of the shard. It stops once the deadline passes, unless it is zero,
+// and reports whether all expired entries were removed. Oldest entries are removed first, so the next
+// clean up continues where it stopped.
+func (s *cacheShard) cleanUp(currentTimestamp uint64, deadline time.Time) bool {
 	s.lock.Lock()
+	start := time.Now()
+	if segments, ok := s.segments(); ok {
+		segments.dropExpired(currentTimestamp, s.lifeWindow, s.removeDroppedEntry)
+	}
+	finished := true
 	for {
 		if oldestEntry, err := s.entries.Peek(); err != nil {
 			break
 		} else if evicted := s.onEvict(oldestEntry, currentTimestamp, s.removeOldestEntry); !evicted {
 			break
 		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			finished = false
+			atomic.AddInt64(&s.cleanUpYields, 1)
+			break
+		}
 	}
+	if finished {
+		s.pruneTombstones(currentTimestamp)
+	}
+	s.recordCleanUp(time.Since(start))
 	s.lock.Unlock()
+	return finished
+}
+
+// recordCleanUp counts the clean up which held the lock for elapsed time, it has to be called with the write lock held
+func (s *cacheShard) recordCleanUp(elapsed time.Duration) {
+	atomic.AddInt64(&s.cleanUps, 1)
+	atomic.AddInt64(&s.cleanUpNanos, int64(elapsed))
+	if int64(elapsed) > atomic.LoadInt64(&s.maxCleanUpNanos) {
+		atomic.StoreInt64(&s.maxCleanUpNanos, int64(elapsed))
+	}
+}
+
+// cleanUpStats fills statistics of clean ups of the shard
+func (s *cacheShard) cleanUpStats(stats *ShardStats) {
+	stats.CleanUps = atomic.LoadInt64(&s.cleanUps)
+	stats.CleanUpTime = time.Duration(atomic.LoadInt64(&s.cleanUpNanos))
+	stats.MaxCleanUpTime = time.Duration(atomic.LoadInt64(&s.maxCleanUpNanos))
+	stats.CleanUpYields = atomic.LoadInt64(&s.cleanUpYields)
 }
 
 func (s *cacheShard) getEntry(hashedKey uint64) ([]byte, error) {
@@ -333,23 +983,198 @@ func (s *cacheShard) removeOldestEntry(reason RemoveReason) error {
 		hash := readHashFromEntry(oldest)
 		if hash == 0 {
 			// entry has been explicitly deleted with resetHashFromEntry, ignore
+			s.reclaimDead(oldest)
 			return nil
 		}
-		delete(s.hashmap, hash)
-		s.onRemove(oldest, reason)
-		if s.statsEnabled {
-			delete(s.hashmapStats, hash)
+		if reason == NoSpace && s.policy != nil && s.policy.reinsert(hash, s.estimateFrequency(hash)) && s.reinsert(oldest, hash) {
+			return nil
 		}
+		s.removeEntry(oldest, hash, reason)
 		return nil
 	}
 	return err
 }
 
+// removeDroppedEntry removes entry of a dropped segment from the shard
+func (s *cacheShard) removeDroppedEntry(wrappedEntry []byte) {
+	if hash := readHashFromEntry(wrappedEntry); hash != 0 {
+		s.removeEntry(wrappedEntry, hash, Expired)
+	} else {
+		s.reclaimDead(wrappedEntry)
+	}
+}
+
+// markDead marks the live entry as deleted, its space is reclaimed once it is popped from the queue
+func (s *cacheShard) markDead(wrappedEntry []byte) {
+	s.untrack(wrappedEntry)
+	delete(s.loadCosts, readHashFromEntry(wrappedEntry))
+	resetHashFromEntry(wrappedEntry)
+	s.deadBytes += len(wrappedEntry)
+}
+
+// reclaimDead accounts for the popped dead entry. Fillers written when the queue grows have zero timestamp
+// and are never counted as dead.
+func (s *cacheShard) reclaimDead(wrappedEntry []byte) {
+	if readTimestampFromEntry(wrappedEntry) != 0 {
+		s.deadBytes = max(s.deadBytes-len(wrappedEntry), 0)
+	}
+}
+
+// track accounts for the entry pushed to the queue as live and counts it as written
+func (s *cacheShard) track(wrappedEntry []byte) {
+	headerSize, keyLength := readKeyBoundsFromEntry(wrappedEntry)
+	s.liveBytes += len(wrappedEntry)
+	s.headerBytes += headerSize
+	atomic.AddInt64(&s.stats.Sets, 1)
+	atomic.AddInt64(&s.stats.BytesWritten, int64(len(wrappedEntry)-headerSize-keyLength))
+	if s.forecast != nil {
+		s.forecast.add(readTimestampFromEntry(wrappedEntry), len(wrappedEntry))
+	}
+	if s.dirty != nil {
+		s.dirty[readHashFromEntry(wrappedEntry)] = struct{}{}
+	}
+	s.index(IndexSet, wrappedEntry, 0)
+}
+
+// untrack accounts for the live entry which is removed or marked dead
+func (s *cacheShard) untrack(wrappedEntry []byte) {
+	headerSize, _ := readKeyBoundsFromEntry(wrappedEntry)
+	s.liveBytes -= len(wrappedEntry)
+	s.headerBytes -= headerSize
+	if s.forecast != nil {
+		s.forecast.remove(readTimestampFromEntry(wrappedEntry), len(wrappedEntry))
+	}
+}
+
+// deleteEntry removes the live entry as deleted and marks its space dead
+func (s *cacheShard) deleteEntry(wrappedEntry []byte, hashedKey uint64) {
+	s.discardEntry(wrappedEntry, hashedKey, Deleted)
+}
+
+// evictVictim evicts the entry chosen by a custom policy, its space is reclaimed when it reaches the head of the queue.
+// It returns false when no entry exists for the hash.
+func (s *cacheShard) evictVictim(hashedKey uint64) bool {
+	itemIndex := s.hashmap[hashedKey]
+	if itemIndex == 0 {
+		return false
+	}
+	wrappedEntry, err := s.entries.Get(int(itemIndex))
+	if err != nil {
+		return false
+	}
+	s.discardEntry(wrappedEntry, hashedKey, NoSpace)
+	return true
+}
+
+// discardEntry removes the live entry and marks its space dead
+func (s *cacheShard) discardEntry(wrappedEntry []byte, hashedKey uint64, reason RemoveReason) {
+	s.removeEntry(wrappedEntry, hashedKey, reason)
+	resetHashFromEntry(wrappedEntry)
+	s.deadBytes += len(wrappedEntry)
+}
+
+func (s *cacheShard) removeEntry(wrappedEntry []byte, hash uint64, reason RemoveReason) {
+	s.untrack(wrappedEntry)
+	delete(s.loadCosts, hash)
+	if reason == NoSpace {
+		atomic.AddInt64(&s.stats.Evictions, 1)
+	}
+	if s.collectEvicted && reason != Deleted {
+		s.evicted = append(s.evicted, EvictedEntry{
+			Key:    readKeyFromEntry(wrappedEntry),
+			Value:  readEntry(wrappedEntry),
+			Reason: reason,
+		})
+	}
+	if s.expiries != nil && reason == Expired {
+		s.expiries.stage(wrappedEntry)
+	}
+	if s.spiller != nil && reason == NoSpace {
+		s.spiller.stage(wrappedEntry)
+	}
+	delete(s.hashmap, hash)
+	s.forgetKey(hash)
+	s.policyRemove(hash, reason)
+	s.rememberRemoval(hash, reason)
+	s.index(IndexRemove, wrappedEntry, reason)
+	s.onRemove(wrappedEntry, reason)
+	if s.statsEnabled {
+		delete(s.hashmapStats, hash)
+	}
+}
+
+// reinsert pushes the popped entry again to the tail of the queue, giving it a second chance.
+// It returns false when the entry is expired or there is no space for it.
+func (s *cacheShard) reinsert(wrappedEntry []byte, hashedKey uint64) bool {
+	if s.isExpired(wrappedEntry, uint64(s.clock.Epoch())) {
+		return false
+	}
+	// popped entry references queue memory which can be overwritten by push
+	if len(wrappedEntry) > len(s.reinsertBuffer) {
+		s.reinsertBuffer = make([]byte, len(wrappedEntry))
+	}
+	w := s.reinsertBuffer[:len(wrappedEntry)]
+	copy(w, wrappedEntry)
+	index, err := s.push(w)
+	if err != nil {
+		return false
+	}
+	s.hashmap[hashedKey] = uint64(index)
+	return true
+}
+
+// estimateFrequency returns decayed access frequency of the entry, 0 when it is not tracked
+func (s *cacheShard) estimateFrequency(hashedKey uint64) uint8 {
+	if s.frequency == nil {
+		return 0
+	}
+	return s.frequency.estimate(hashedKey)
+}
+
+func (s *cacheShard) policyAdd(hashedKey uint64) {
+	if s.policy != nil {
+		s.policy.onAdd(hashedKey)
+	}
+	if s.frequency != nil {
+		s.frequency.ensureCapacity(len(s.hashmap))
+		s.frequency.increment(hashedKey)
+	}
+}
+
+func (s *cacheShard) policyRemove(hashedKey uint64, reason RemoveReason) {
+	if s.policy != nil {
+		s.policy.onRemove(hashedKey, reason)
+	}
+}
+
 func (s *cacheShard) reset(config Config) {
 	s.lock.Lock()
 	s.hashmap = make(map[uint64]uint64, config.initialShardSize())
 	s.entryBuffer = make([]byte, config.MaxEntrySize+headersSizeInBytes)
+	if s.lent != nil {
+		s.lent.poison()
+	}
 	s.entries.Reset()
+	if s.policy != nil {
+		s.policy.reset()
+	}
+	if s.frequency != nil {
+		s.frequency.reset()
+	}
+	s.tombstones = nil
+	s.loadCosts = nil
+	if s.keys != nil {
+		s.keys.reset()
+	}
+	s.deadBytes = 0
+	s.liveBytes = 0
+	s.headerBytes = 0
+	if s.forecast != nil {
+		s.forecast.reset()
+	}
+	if s.onIndex != nil {
+		s.onIndex(IndexEvent{Op: IndexReset})
+	}
 	s.lock.Unlock()
 }
 
@@ -357,6 +1182,7 @@ func (s *cacheShard) resetStats() {
 	s.lock.Lock()
 	s.stats = Stats{}
 	s.lock.Unlock()
+	s.lock.resetStats()
 }
 
 func (s *cacheShard) len() int {
@@ -373,13 +1199,93 @@ func (s *cacheShard) capacity() int {
 	return res
 }
 
+// memoryUsage returns number of bytes taken by entries in the queue, by dead entries and by headers and padding
+func (s *cacheShard) memoryUsage() (used int, dead int, overhead int) {
+	s.lock.RLock()
+	used = s.entries.UsedBytes()
+	dead = min(s.deadBytes, used)
+	// length headers of queue entries and fillers written when the queue grew
+	padding := max(used-s.liveBytes-dead, 0)
+	overhead = s.headerBytes + padding
+	s.lock.RUnlock()
+	return used, dead, overhead
+}
+
+// queueResized counts the change of the queue capacity and reports it to Config.OnQueueResize,
+// start is the time the change began at, it can be zero when OnQueueResize is not set
+func (s *cacheShard) queueResized(from, to int, start time.Time) {
+	atomic.AddInt64(&s.stats.QueueResizes, 1)
+	if s.onQueueResize != nil {
+		s.onQueueResize(from, to, time.Since(start))
+	}
+}
+
+// preallocate grows the queue of the shard to bytes, bounded by the maximum shard size
+func (s *cacheShard) preallocate(bytes int) {
+	s.lock.Lock()
+	from, start := s.entries.Capacity(), time.Now()
+	s.entries.EnsureCapacity(bytes)
+	if to := s.entries.Capacity(); to != from {
+		s.queueResized(from, to, start)
+	}
+	s.lock.Unlock()
+}
+
+// resize changes the maximum size of the shard queue, 0 means no limit. Oldest entries not fitting
+// into a smaller size are evicted with NoSpace reason and the queue is compacted to release memory above it.
+// It returns the number of evicted entries.
+func (s *cacheShard) resize(maxBytes int) int {
+	s.lock.Lock()
+	s.maxBytes = maxBytes
+	s.entries.SetMaxCapacity(maxBytes)
+	evicted := 0
+	if _, segmented := s.segments(); !segmented && maxBytes > 0 && s.entries.Capacity() > maxBytes {
+		entries := len(s.hashmap)
+		for limit := s.entries.Len(); limit > 0 && s.entries.UsedBytes()-min(s.deadBytes, s.entries.UsedBytes()) >= maxBytes; limit-- {
+			if s.removeOldestEntry(NoSpace) != nil {
+				break
+			}
+		}
+		s.compactWithoutLock()
+		evicted = entries - len(s.hashmap)
+	}
+	s.lock.Unlock()
+	return evicted
+}
+
+// queueStats fills statistics of the shard queue, positions of its pointers and number of times it wrapped
+func (s *cacheShard) queueStats(stats *ShardStats) {
+	s.lock.RLock()
+	geometry := s.entries.Geometry()
+	stats.FreeBytes = s.entries.FreeBytes()
+	s.lock.RUnlock()
+	stats.RightMargin = geometry.RightMargin
+	stats.Head = geometry.Head
+	stats.Tail = geometry.Tail
+	stats.Wraps = geometry.Wraps
+}
+
+// initialSizeExceeded reports whether the queue grew to more than twice its initial size
+func (s *cacheShard) initialSizeExceeded() bool {
+	return s.capacity() > 2*s.initialBytes
+}
+
 func (s *cacheShard) getStats() Stats {
 	var stats = Stats{
-		Hits:       atomic.LoadInt64(&s.stats.Hits),
-		Misses:     atomic.LoadInt64(&s.stats.Misses),
-		DelHits:    atomic.LoadInt64(&s.stats.DelHits),
-		DelMisses:  atomic.LoadInt64(&s.stats.DelMisses),
-		Collisions: atomic.LoadInt64(&s.stats.Collisions),
+		Hits:            atomic.LoadInt64(&s.stats.Hits),
+		Misses:          atomic.LoadInt64(&s.stats.Misses),
+		DelHits:         atomic.LoadInt64(&s.stats.DelHits),
+		DelMisses:       atomic.LoadInt64(&s.stats.DelMisses),
+		Collisions:      atomic.LoadInt64(&s.stats.Collisions),
+		Evictions:       atomic.LoadInt64(&s.stats.Evictions),
+		LazyExpirations: atomic.LoadInt64(&s.stats.LazyExpirations),
+		LockTimeouts:    atomic.LoadInt64(&s.stats.LockTimeouts),
+		Migrations:      atomic.LoadInt64(&s.stats.Migrations),
+		MigrationErrors: atomic.LoadInt64(&s.stats.MigrationErrors),
+		Sets:            atomic.LoadInt64(&s.stats.Sets),
+		BytesWritten:    atomic.LoadInt64(&s.stats.BytesWritten),
+		BytesRead:       atomic.LoadInt64(&s.stats.BytesRead),
+		QueueResizes:    atomic.LoadInt64(&s.stats.QueueResizes),
 	}
 	return stats
 }
@@ -399,8 +1305,16 @@ func (s *cacheShard) getKeyMetadata(key uint64) Metadata {
 	}
 }
 
-func (s *cacheShard) hit(key uint64) {
+// hit counts a read of the key which returned a value of size bytes
+func (s *cacheShard) hit(key uint64, size int) {
 	atomic.AddInt64(&s.stats.Hits, 1)
+	atomic.AddInt64(&s.stats.BytesRead, int64(size))
+	if s.policy != nil {
+		s.policy.onAccess(key)
+	}
+	if s.frequency != nil {
+		s.frequency.increment(key)
+	}
 	if s.statsEnabled {
 		s.lock.Lock()
 		s.hashmapStats[key]++
@@ -408,8 +1322,15 @@ func (s *cacheShard) hit(key uint64) {
 	}
 }
 
-func (s *cacheShard) hitWithoutLock(key uint64) {
+func (s *cacheShard) hitWithoutLock(key uint64, size int) {
 	atomic.AddInt64(&s.stats.Hits, 1)
+	atomic.AddInt64(&s.stats.BytesRead, int64(size))
+	if s.policy != nil {
+		s.policy.onAccess(key)
+	}
+	if s.frequency != nil {
+		s.frequency.increment(key)
+	}
 	if s.statsEnabled {
 		s.hashmapStats[key]++
 	}
@@ -432,23 +1353,80 @@ func (s *cacheShard) collision() {
 }
 
 func initNewShard(config Config, callback onRemoveCallback, clock clock) *cacheShard {
-	bytesQueueInitialCapacity := config.initialShardSize() * config.MaxEntrySize
+	bytesQueueInitialCapacity := config.initialShardSizeInBytes()
 	maximumShardSizeInBytes := config.maximumShardSizeInBytes()
-	if maximumShardSizeInBytes > 0 && bytesQueueInitialCapacity > maximumShardSizeInBytes {
-		bytesQueueInitialCapacity = maximumShardSizeInBytes
-	}
-	return &cacheShard{
+	s := &cacheShard{
 		hashmap:      make(map[uint64]uint64, config.initialShardSize()),
 		hashmapStats: make(map[uint64]uint32, config.initialShardSize()),
-		entries:      *queue.NewBytesQueue(bytesQueueInitialCapacity, maximumShardSizeInBytes, config.Verbose),
+		entries:      newEntryQueue(config, bytesQueueInitialCapacity, maximumShardSizeInBytes),
+		initialBytes: bytesQueueInitialCapacity,
+		maxBytes:     maximumShardSizeInBytes,
+		maxEntries:   config.maximumShardEntries(),
 		entryBuffer:  make([]byte, config.MaxEntrySize+headersSizeInBytes),
 		onRemove:     callback,
+		lock:         shardLock{statsEnabled: config.LockStatsEnabled, timeout: config.LockTimeout},
+
+		verbose:       boolToInt32(config.Verbose),
+		logger:        newLogger(config.Logger),
+		clock:         clock,
+		lifeWindow:    config.lifeWindow(),
+		maxTTLJitter:  config.maximumTTLJitter(),
+		timestampUnit: config.timestampUnit(),
+		jitterRand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		statsEnabled:  config.StatsEnabled,
+		cleanEnabled:  config.CleanWindow > 0,
+		policy:        newEvictionPolicy(config),
+		rejectWrites:  config.OnFullPolicy == RejectWrite,
+
+		entryFields:    config.entryFields(),
+		verifyChecksum: config.EntryChecksum,
+		omitKeys:       config.OmitEntryKeys,
+		valueVersion:   config.ValueVersion,
+		valueMigrator:  config.ValueMigrator,
+
+		tombstoneTTL:       config.tombstoneTTL(),
+		noCopyGet:          config.NoCopyGet,
+		expireOnGet:        config.ExpireOnGet,
+		deleteExpiredOnGet: config.DeleteExpiredOnGet,
+	}
+	if config.NoCopyGet && config.NoCopyGetDebug {
+		s.lent = &lentEntries{}
+	}
+	if config.SeparateKeyStore {
+		s.keys = newKeyStore(config.initialShardSize())
+	}
+	if config.ExpiryForecast {
+		s.forecast = newExpiryForecast(config.timestampUnit())
+	}
+	if config.OnMiss != nil {
+		s.removals = newRemovalSketch(sketchEntries(config))
+	}
+	if custom, ok := s.policy.(*customPolicy); ok {
+		custom.evict = s.evictVictim
+		custom.queueLen = func() int { return s.entries.Len() }
+		custom.hasDead = func() bool { return s.deadBytes > 0 }
+	}
+	if s.policy != nil && s.policy.usesFrequency() {
+		s.frequency = newFrequencySketch(sketchEntries(config))
+	}
+	if config.RecoverPanics {
+		s.recovering = &recoveringQueue{entryQueue: s.entries}
+		s.entries = s.recovering
+	}
+	return s
+}
 
-		isVerbose:    config.Verbose,
-		logger:       newLogger(config.Logger),
-		clock:        clock,
-		lifeWindow:   uint64(config.LifeWindow.Seconds()),
-		statsEnabled: config.StatsEnabled,
-		cleanEnabled: config.CleanWindow > 0,
+func newEntryQueue(config Config, capacity int, maxCapacity int) entryQueue {
+	if config.TimeSegments > 0 {
+		q := newSegmentedQueue(config.TimeSegments, config.lifeWindow(), capacity, maxCapacity, config.Verbose)
+		if config.PreallocateShards {
+			q.segments[q.current].entries.Touch()
+		}
+		return q
+	}
+	q := queue.NewLazyBytesQueue(capacity, maxCapacity, config.Verbose)
+	if config.PreallocateShards {
+		q.Touch()
 	}
+	return q
 }
@@ -0,0 +1,86 @@
+package bigcache
+
+import (
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// Priority of a write decides whether it can be shed under overload
+type Priority uint8
+
+const (
+	// LowPriority writes are shed under overload, it is the priority of Set
+	LowPriority = Priority(0)
+	// HighPriority writes are always admitted
+	HighPriority = Priority(1)
+)
+
+// loadShedder drops low priority writes with the probability adjusted every ShedWindow
+// to the write rate and evictions in the window
+type loadShedder struct {
+	// writes and shed count writes in the current window, shedWrites all shed writes.
+	// Fields accessed atomically come first to be 64-bit aligned on 32-bit platforms.
+	writes     int64
+	shed       int64
+	shedWrites int64
+	// dropProbability holds bits of the float64 probability of shedding a low priority write
+	dropProbability uint64
+	cache           *BigCache
+	previous        Stats
+}
+
+func newLoadShedder(cache *BigCache) *loadShedder {
+	return &loadShedder{cache: cache}
+}
+
+// admit counts the write and reports whether it is admitted
+func (l *loadShedder) admit(priority Priority) bool {
+	atomic.AddInt64(&l.writes, 1)
+	if priority == HighPriority {
+		return true
+	}
+	probability := math.Float64frombits(atomic.LoadUint64(&l.dropProbability))
+	if probability == 0 || rand.Float64() >= probability {
+		return true
+	}
+	atomic.AddInt64(&l.shed, 1)
+	atomic.AddInt64(&l.shedWrites, 1)
+	return false
+}
+
+// check adjusts the probability of shedding to the window which has just ended and returns it
+func (l *loadShedder) check(window time.Duration) float64 {
+	writes := atomic.SwapInt64(&l.writes, 0)
+	admitted := writes - atomic.SwapInt64(&l.shed, 0)
+	stats := l.cache.Stats()
+	evictions := stats.Evictions - l.previous.Evictions
+	l.previous = stats
+
+	probability := 0.0
+	// writes include shed ones, so the rate is the offered load and admitted writes stay within the budget
+	if budget := float64(l.cache.config.SetBudget); budget > 0 {
+		if rate := float64(writes) / window.Seconds(); rate > budget {
+			probability = 1 - budget/rate
+		}
+	}
+	if threshold := l.cache.config.ShedEvictionRatio; threshold > 0 && admitted > 0 {
+		if ratio := float64(evictions) / float64(admitted); ratio > threshold {
+			probability = math.Max(probability, 1-threshold/ratio)
+		}
+	}
+	atomic.StoreUint64(&l.dropProbability, math.Float64bits(probability))
+	return probability
+}
+
+// admit reports ErrReadOnly when the cache is read-only and ErrWriteShed when the write of the priority is shed
+func (c *BigCache) admit(priority Priority) error {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	if c.shedder != nil && !c.shedder.admit(priority) {
+		return ErrWriteShed
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package bigcache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLoadShedderWithinBudget(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		SetBudget:          100,
+		ShedWindow:         time.Hour,
+	})
+
+	// when
+	for i := 0; i < 50; i++ {
+		noError(t, cache.Set(fmt.Sprintf("key%d", i), []byte("value")))
+	}
+
+	// then
+	assertEqual(t, 0.0, cache.shedder.check(time.Second))
+}
+
+func TestLoadShedderOverBudget(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		SetBudget:          100,
+		ShedWindow:         time.Hour,
+	})
+	for i := 0; i < 400; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+
+	// when
+	probability := cache.shedder.check(time.Second)
+
+	// then
+	assertEqual(t, 0.75, probability)
+
+	// when
+	shed := 0
+	for i := 0; i < 1000; i++ {
+		if err := cache.Set(fmt.Sprintf("key%d", i), []byte("value")); err == ErrWriteShed {
+			shed++
+		}
+	}
+
+	// then
+	if shed < 650 || shed > 850 {
+		t.Errorf("Expected about 750 shed writes, got %d", shed)
+	}
+	assertEqual(t, int64(shed), cache.Stats().ShedWrites)
+	for i := 0; i < 100; i++ {
+		noError(t, cache.SetWithOptions(fmt.Sprintf("key%d", i), []byte("value"), Options{Priority: HighPriority}))
+	}
+}
+
+func TestLoadShedderEvictionRatio(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		HardMaxCacheSize:   1,
+		ShedEvictionRatio:  0.5,
+		ShedWindow:         time.Hour,
+	})
+	for i := 0; i < 10000; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), blob('a', 200))
+	}
+	cache.shedder.check(time.Second)
+
+	// when
+	for i := 0; i < 10000; i++ {
+		cache.SetWithOptions(fmt.Sprintf("other%d", i), blob('a', 200), Options{Priority: HighPriority})
+	}
+	probability := cache.shedder.check(time.Second)
+
+	// then
+	if probability < 0.45 || probability > 0.55 {
+		t.Errorf("Expected shedding probability of about 0.5, got %f", probability)
+	}
+	assertEqual(t, ErrWriteShed, func() error {
+		for i := 0; i < 1000; i++ {
+			if err := cache.Set("key", blob('a', 200)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}())
+}
@@ -0,0 +1,11 @@
+// Package shm is an experimental cache whose queue of entries and index live in a named shared memory
+// segment, so several processes on one host (e.g. workers of a pre-fork server) share a single cache.
+// Every process maps the same file, usually placed in /dev/shm, with Open. Access is serialized by flock
+// of the file, which the kernel releases when a process dies while holding it, so a crashed process does
+// not leave the segment locked. The index holds a single entry per hash of keys, Set of a key colliding
+// with a live entry of another key fails with ErrKeyCollision.
+//
+// Entries are appended to a ring buffer and the oldest ones are evicted when it is full, in the same way
+// as in BigCache shards. Entries older than LifeWindow are not returned but only reclaimed by eviction.
+// The package is available on Unix systems only.
+package shm
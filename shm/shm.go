@@ -0,0 +1,408 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package shm
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+const (
+	magic = 0x62696763 // "bigc"
+	// version 1 segments were locked with a spin lock at offset 8, which is not used since
+	version = 2
+
+	// Offsets of the fields of the segment header
+	offMagic      = 0
+	offVersion    = 4
+	offSlots      = 16
+	offDataSize   = 24
+	offLifeWindow = 32
+	offHead       = 40
+	offTail       = 48
+	offUsed       = 56
+	offCount      = 64
+	headerSize    = 128
+
+	slotSize        = 16 // Hash and offset of an entry
+	entryHeaderSize = 22 // Size, timestamp, hash and length of the key
+	wrapMarker      = math.MaxUint32
+
+	// fnv64a offset basis and prime, see https://en.wikipedia.org/wiki/Fowler–Noll–Vo_hash_function#FNV-1a_hash
+	offset64 = 14695981039346656037
+	prime64  = 1099511628211
+)
+
+var (
+	// ErrEntryTooBig is returned when the entry does not fit in the segment
+	ErrEntryTooBig = errors.New("shm: entry is bigger than the segment")
+	// ErrKeyTooLong is returned when the key is longer than 65535 bytes
+	ErrKeyTooLong = errors.New("shm: key is too long")
+	// ErrKeyCollision is returned by Set when a live entry of another key with the same hash is stored
+	ErrKeyCollision = errors.New("shm: key collides with a stored key")
+	// ErrIncompatibleSegment is returned by Open when the segment was created with a different configuration
+	ErrIncompatibleSegment = errors.New("shm: segment was created with a different configuration")
+)
+
+// Config for a cache in shared memory. All processes sharing the segment must use the same configuration.
+type Config struct {
+	// Path of the file backing the segment, e.g. /dev/shm/bigcache. It is created when missing.
+	Path string
+	// Size of the ring buffer holding entries in bytes.
+	Size int
+	// Slots is the number of index slots, must be a power of two and at least 4.
+	// At most 3/4 of slots are used, the oldest entries are evicted when more keys are stored.
+	Slots int
+	// LifeWindow after which entries are not returned. 0 disables expiration.
+	LifeWindow time.Duration
+}
+
+// Cache is a handle to a cache in shared memory. It is safe for concurrent use by goroutines of one
+// process and by other processes which opened the same segment.
+type Cache struct {
+	file *os.File
+	fd   int
+	// mutex serializes goroutines of the process, as flock is held by the open file and only excludes
+	// other handles and processes
+	mutex    sync.Mutex
+	mem      []byte
+	index    []byte
+	data     []byte
+	slotMask uint64
+	maxCount uint64
+	now      func() int64
+}
+
+// Open maps the segment at config.Path, creating and initializing it when it does not exist yet.
+func Open(config Config) (*Cache, error) {
+	if config.Path == "" {
+		return nil, errors.New("shm: Path must be set")
+	}
+	if config.Size <= 0 {
+		return nil, errors.New("shm: Size must be > 0")
+	}
+	if config.Slots < 4 || config.Slots&(config.Slots-1) != 0 {
+		return nil, errors.New("shm: Slots must be a power of two and >= 4")
+	}
+	if config.LifeWindow < 0 {
+		return nil, errors.New("shm: LifeWindow must be >= 0")
+	}
+
+	file, err := os.OpenFile(config.Path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	c, err := mapSegment(file, config)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func mapSegment(file *os.File, config Config) (*Cache, error) {
+	fd := int(file.Fd())
+	// Creation and initialization of the segment are serialized between processes with flock
+	if err := syscall.Flock(fd, syscall.LOCK_EX); err != nil {
+		return nil, err
+	}
+	defer syscall.Flock(fd, syscall.LOCK_UN)
+
+	length := headerSize + config.Slots*slotSize + config.Size
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		if err := file.Truncate(int64(length)); err != nil {
+			return nil, err
+		}
+	} else if info.Size() != int64(length) {
+		return nil, ErrIncompatibleSegment
+	}
+
+	mem, err := syscall.Mmap(fd, 0, length, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cache{
+		file:     file,
+		fd:       fd,
+		mem:      mem,
+		index:    mem[headerSize : headerSize+config.Slots*slotSize],
+		data:     mem[headerSize+config.Slots*slotSize:],
+		slotMask: uint64(config.Slots - 1),
+		maxCount: uint64(config.Slots / 4 * 3),
+		now:      func() int64 { return time.Now().UnixNano() },
+	}
+
+	if binary.LittleEndian.Uint32(mem[offMagic:]) != magic {
+		binary.LittleEndian.PutUint32(mem[offVersion:], version)
+		c.setField(offSlots, uint64(config.Slots))
+		c.setField(offDataSize, uint64(config.Size))
+		c.setField(offLifeWindow, uint64(config.LifeWindow))
+		binary.LittleEndian.PutUint32(mem[offMagic:], magic)
+	} else if binary.LittleEndian.Uint32(mem[offVersion:]) != version ||
+		c.field(offSlots) != uint64(config.Slots) ||
+		c.field(offDataSize) != uint64(config.Size) ||
+		c.field(offLifeWindow) != uint64(config.LifeWindow) {
+		syscall.Munmap(mem)
+		return nil, ErrIncompatibleSegment
+	}
+	return c, nil
+}
+
+// Close unmaps the segment. Entries stay in the segment until its file is removed.
+func (c *Cache) Close() error {
+	if err := syscall.Munmap(c.mem); err != nil {
+		return err
+	}
+	c.mem, c.index, c.data = nil, nil, nil
+	return c.file.Close()
+}
+
+// Get reads entry for the key.
+// It returns an ErrEntryNotFound when no entry exists for the given key or it is older than LifeWindow.
+func (c *Cache) Get(key string) ([]byte, error) {
+	hash := hashKey(key)
+	c.lock()
+	i, found := c.find(hash)
+	if !found {
+		c.unlock()
+		return nil, bigcache.ErrEntryNotFound
+	}
+	entry := c.entryAt(c.slotOffset(i))
+	storedKey := entryKey(entry)
+	if string(storedKey) != key || c.expired(entry) {
+		c.unlock()
+		return nil, bigcache.ErrEntryNotFound
+	}
+	value := append([]byte(nil), entry[entryHeaderSize+len(storedKey):]...)
+	c.unlock()
+	return value, nil
+}
+
+// Set saves entry under the key, evicting the oldest entries when the segment or the index is full.
+func (c *Cache) Set(key string, entry []byte) error {
+	if len(key) > math.MaxUint16 {
+		return ErrKeyTooLong
+	}
+	size := uint64(entryHeaderSize + len(key) + len(entry))
+	if size > uint64(len(c.data)) || size >= wrapMarker {
+		return ErrEntryTooBig
+	}
+	hash := hashKey(key)
+
+	c.lock()
+	if i, found := c.find(hash); found {
+		// the index holds a single entry per hash, a live entry of another key is kept
+		if stored := c.entryAt(c.slotOffset(i)); string(entryKey(stored)) != key && !c.expired(stored) {
+			c.unlock()
+			return ErrKeyCollision
+		}
+		c.removeSlot(i)
+	}
+	for c.field(offCount) >= c.maxCount {
+		c.evictOldest()
+	}
+	offset := c.allocate(size)
+
+	w := c.data[offset : offset+size]
+	binary.LittleEndian.PutUint32(w, uint32(size))
+	binary.LittleEndian.PutUint64(w[4:], uint64(c.now()))
+	binary.LittleEndian.PutUint64(w[12:], hash)
+	binary.LittleEndian.PutUint16(w[20:], uint16(len(key)))
+	copy(w[entryHeaderSize:], key)
+	copy(w[entryHeaderSize+len(key):], entry)
+	c.setField(offTail, offset+size)
+	c.setField(offUsed, c.field(offUsed)+size)
+
+	i, _ := c.find(hash)
+	binary.LittleEndian.PutUint64(c.index[i*slotSize:], hash)
+	binary.LittleEndian.PutUint64(c.index[i*slotSize+8:], offset)
+	c.setField(offCount, c.field(offCount)+1)
+	c.unlock()
+	return nil
+}
+
+// Delete removes the key. It returns an ErrEntryNotFound when no entry exists for the given key.
+func (c *Cache) Delete(key string) error {
+	hash := hashKey(key)
+	c.lock()
+	i, found := c.find(hash)
+	if found {
+		found = string(entryKey(c.entryAt(c.slotOffset(i)))) == key
+	}
+	if !found {
+		c.unlock()
+		return bigcache.ErrEntryNotFound
+	}
+	c.removeSlot(i)
+	c.unlock()
+	return nil
+}
+
+// Len returns the number of entries in the index, including ones older than LifeWindow.
+func (c *Cache) Len() int {
+	c.lock()
+	count := c.field(offCount)
+	c.unlock()
+	return int(count)
+}
+
+// Reset removes all entries from the segment.
+func (c *Cache) Reset() {
+	c.lock()
+	for i := range c.index {
+		c.index[i] = 0
+	}
+	c.setField(offHead, 0)
+	c.setField(offTail, 0)
+	c.setField(offUsed, 0)
+	c.setField(offCount, 0)
+	c.unlock()
+}
+
+// lock takes flock of the segment file, which the kernel releases when the process holding it dies
+func (c *Cache) lock() {
+	c.mutex.Lock()
+	for syscall.Flock(c.fd, syscall.LOCK_EX) == syscall.EINTR {
+	}
+}
+
+func (c *Cache) unlock() {
+	syscall.Flock(c.fd, syscall.LOCK_UN)
+	c.mutex.Unlock()
+}
+
+func (c *Cache) field(offset int) uint64 {
+	return binary.LittleEndian.Uint64(c.mem[offset:])
+}
+
+func (c *Cache) setField(offset int, value uint64) {
+	binary.LittleEndian.PutUint64(c.mem[offset:], value)
+}
+
+func (c *Cache) entryAt(offset uint64) []byte {
+	size := uint64(binary.LittleEndian.Uint32(c.data[offset:]))
+	return c.data[offset : offset+size]
+}
+
+// entryKey returns the key stored in the entry
+func entryKey(entry []byte) []byte {
+	keyLength := int(binary.LittleEndian.Uint16(entry[20:]))
+	return entry[entryHeaderSize : entryHeaderSize+keyLength]
+}
+
+func (c *Cache) expired(entry []byte) bool {
+	lifeWindow := int64(c.field(offLifeWindow))
+	return lifeWindow > 0 && c.now()-int64(binary.LittleEndian.Uint64(entry[4:])) > lifeWindow
+}
+
+// allocate returns the offset at which size bytes can be written, evicting the oldest entries when needed.
+// Entries which do not fit before the end of the ring buffer are written at its beginning and the skipped
+// space is marked so that eviction wraps around as well.
+func (c *Cache) allocate(size uint64) uint64 {
+	dataSize := uint64(len(c.data))
+	for {
+		head, tail, used := c.field(offHead), c.field(offTail), c.field(offUsed)
+		if used == 0 {
+			head, tail = 0, 0
+			c.setField(offHead, 0)
+			c.setField(offTail, 0)
+		}
+		if used == 0 || tail > head {
+			if tail+size <= dataSize {
+				return tail
+			}
+			if dataSize-tail >= 4 {
+				binary.LittleEndian.PutUint32(c.data[tail:], wrapMarker)
+			}
+			c.setField(offTail, 0)
+			continue
+		}
+		if tail+size <= head {
+			return tail
+		}
+		c.evictOldest()
+	}
+}
+
+// evictOldest removes the entry at the head of the ring buffer, and its slot when the index still points at it.
+func (c *Cache) evictOldest() {
+	dataSize := uint64(len(c.data))
+	head := c.field(offHead)
+	if dataSize-head < 4 || binary.LittleEndian.Uint32(c.data[head:]) == wrapMarker {
+		head = 0
+	}
+	size := uint64(binary.LittleEndian.Uint32(c.data[head:]))
+	hash := binary.LittleEndian.Uint64(c.data[head+12:])
+	if i, found := c.find(hash); found && c.slotOffset(i) == head {
+		c.removeSlot(i)
+	}
+	c.setField(offHead, head+size)
+	c.setField(offUsed, c.field(offUsed)-size)
+}
+
+// find returns the slot holding the hash, or the empty slot where it belongs when it is not indexed.
+func (c *Cache) find(hash uint64) (uint64, bool) {
+	for i := hash & c.slotMask; ; i = (i + 1) & c.slotMask {
+		switch binary.LittleEndian.Uint64(c.index[i*slotSize:]) {
+		case 0:
+			return i, false
+		case hash:
+			return i, true
+		}
+	}
+}
+
+func (c *Cache) slotOffset(i uint64) uint64 {
+	return binary.LittleEndian.Uint64(c.index[i*slotSize+8:])
+}
+
+// removeSlot clears the slot and shifts following slots of the probe sequence back, so lookups
+// never stop at a gap in front of their hash.
+func (c *Cache) removeSlot(i uint64) {
+	for j := (i + 1) & c.slotMask; ; j = (j + 1) & c.slotMask {
+		hash := binary.LittleEndian.Uint64(c.index[j*slotSize:])
+		if hash == 0 {
+			break
+		}
+		home := hash & c.slotMask
+		var between bool
+		if i <= j {
+			between = i < home && home <= j
+		} else {
+			between = i < home || home <= j
+		}
+		if !between {
+			copy(c.index[i*slotSize:(i+1)*slotSize], c.index[j*slotSize:(j+1)*slotSize])
+			i = j
+		}
+	}
+	for k := i * slotSize; k < (i+1)*slotSize; k++ {
+		c.index[k] = 0
+	}
+	c.setField(offCount, c.field(offCount)-1)
+}
+
+// hashKey returns fnv64a hash of the key, 0 marks empty slots so it is never returned.
+func hashKey(key string) uint64 {
+	var hash uint64 = offset64
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= prime64
+	}
+	if hash == 0 {
+		return 1
+	}
+	return hash
+}
@@ -0,0 +1,344 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package shm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+func testConfig(t *testing.T) Config {
+	return Config{
+		Path:  filepath.Join(t.TempDir(), "cache"),
+		Size:  4096,
+		Slots: 64,
+	}
+}
+
+func open(t *testing.T, config Config) *Cache {
+	c, err := Open(config)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestSetGetAcrossHandles(t *testing.T) {
+	t.Parallel()
+
+	// given
+	config := testConfig(t)
+	first := open(t, config)
+	second := open(t, config)
+
+	// when
+	if err := first.Set("key", []byte("value")); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	value, err := second.Get("key")
+
+	// then
+	if err != nil || string(value) != "value" {
+		t.Errorf("Get() = %q, %v, want value", value, err)
+	}
+	if second.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", second.Len())
+	}
+}
+
+func TestOverwriteAndDelete(t *testing.T) {
+	t.Parallel()
+
+	// given
+	c := open(t, testConfig(t))
+	c.Set("key", []byte("first"))
+	c.Set("key", []byte("second"))
+
+	// when
+	value, err := c.Get("key")
+
+	// then
+	if err != nil || string(value) != "second" {
+		t.Errorf("Get() = %q, %v, want second", value, err)
+	}
+	if c.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", c.Len())
+	}
+	if err := c.Delete("key"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if _, err := c.Get("key"); !errors.Is(err, bigcache.ErrEntryNotFound) {
+		t.Errorf("Get() after Delete error = %v, want ErrEntryNotFound", err)
+	}
+	if err := c.Delete("key"); !errors.Is(err, bigcache.ErrEntryNotFound) {
+		t.Errorf("second Delete() error = %v, want ErrEntryNotFound", err)
+	}
+}
+
+func TestEvictsOldestEntries(t *testing.T) {
+	t.Parallel()
+
+	// given
+	config := testConfig(t)
+	config.Size = 1000
+	c := open(t, config)
+	value := make([]byte, 100)
+
+	// when
+	for i := 0; i < 100; i++ {
+		if err := c.Set(fmt.Sprintf("key-%d", i), value); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+
+	// then
+	if _, err := c.Get("key-0"); !errors.Is(err, bigcache.ErrEntryNotFound) {
+		t.Errorf("Get(key-0) error = %v, want ErrEntryNotFound", err)
+	}
+	for i := 93; i < 100; i++ {
+		if _, err := c.Get(fmt.Sprintf("key-%d", i)); err != nil {
+			t.Errorf("Get(key-%d) error = %v", i, err)
+		}
+	}
+	if c.Len() > 1000/(entryHeaderSize+6+100) {
+		t.Errorf("Len() = %d, more entries than fit in the segment", c.Len())
+	}
+}
+
+func TestEvictsWhenIndexIsFull(t *testing.T) {
+	t.Parallel()
+
+	// given
+	config := testConfig(t)
+	config.Slots = 8
+	c := open(t, config)
+
+	// when
+	for i := 0; i < 20; i++ {
+		c.Set(fmt.Sprintf("key-%d", i), []byte("v"))
+	}
+
+	// then
+	if c.Len() != 6 {
+		t.Errorf("Len() = %d, want 6", c.Len())
+	}
+	for i := 14; i < 20; i++ {
+		if _, err := c.Get(fmt.Sprintf("key-%d", i)); err != nil {
+			t.Errorf("Get(key-%d) error = %v", i, err)
+		}
+	}
+}
+
+func TestLifeWindow(t *testing.T) {
+	t.Parallel()
+
+	// given
+	config := testConfig(t)
+	config.LifeWindow = time.Second
+	c := open(t, config)
+	now := time.Now().UnixNano()
+	c.now = func() int64 { return now }
+	c.Set("key", []byte("value"))
+
+	// when
+	now += int64(2 * time.Second)
+	_, err := c.Get("key")
+
+	// then
+	if !errors.Is(err, bigcache.ErrEntryNotFound) {
+		t.Errorf("Get() error = %v, want ErrEntryNotFound", err)
+	}
+}
+
+func TestEntryTooBig(t *testing.T) {
+	t.Parallel()
+
+	// given
+	c := open(t, testConfig(t))
+
+	// when
+	err := c.Set("key", make([]byte, 4096))
+
+	// then
+	if !errors.Is(err, ErrEntryTooBig) {
+		t.Errorf("Set() error = %v, want ErrEntryTooBig", err)
+	}
+}
+
+func TestIncompatibleSegment(t *testing.T) {
+	t.Parallel()
+
+	// given
+	config := testConfig(t)
+	open(t, config)
+	config.LifeWindow = time.Minute
+
+	// when
+	_, err := Open(config)
+
+	// then
+	if !errors.Is(err, ErrIncompatibleSegment) {
+		t.Errorf("Open() error = %v, want ErrIncompatibleSegment", err)
+	}
+}
+
+func TestOpenValidation(t *testing.T) {
+	t.Parallel()
+
+	for _, config := range []Config{
+		{Size: 1, Slots: 4},
+		{Path: "cache", Size: 0, Slots: 4},
+		{Path: "cache", Size: 1, Slots: 6},
+		{Path: "cache", Size: 1, Slots: 2},
+		{Path: "cache", Size: 1, Slots: 4, LifeWindow: -1},
+	} {
+		if _, err := Open(config); err == nil {
+			t.Errorf("Open(%+v) error = nil", config)
+		}
+	}
+}
+
+func TestConcurrentHandles(t *testing.T) {
+	t.Parallel()
+
+	// given
+	config := testConfig(t)
+	config.Size = 256 * 1024
+	config.Slots = 1024
+	handles := []*Cache{open(t, config), open(t, config)}
+	var wg sync.WaitGroup
+
+	// when
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			c := handles[w%len(handles)]
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("key-%d-%d", w, i%50)
+				c.Set(key, []byte(key))
+				if value, err := c.Get(key); err == nil && string(value) != key {
+					t.Errorf("Get(%s) = %q", key, value)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// then
+	if handles[0].Len() != 200 {
+		t.Errorf("Len() = %d, want 200", handles[0].Len())
+	}
+}
+
+func TestSharedBetweenProcesses(t *testing.T) {
+	t.Parallel()
+
+	// given
+	config := testConfig(t)
+	c := open(t, config)
+	c.Set("parent", []byte("hello"))
+
+	// when
+	cmd := exec.Command(os.Args[0], "-test.run=TestHelperProcess")
+	cmd.Env = append(os.Environ(), "SHM_HELPER_PATH="+config.Path)
+	out, err := cmd.CombinedOutput()
+
+	// then
+	if err != nil {
+		t.Fatalf("helper process error = %v: %s", err, out)
+	}
+	value, err := c.Get("child")
+	if err != nil || string(value) != "hello" {
+		t.Errorf("Get(child) = %q, %v, want hello", value, err)
+	}
+}
+
+func TestLockOfDeadProcessIsReleased(t *testing.T) {
+	t.Parallel()
+
+	// given
+	config := testConfig(t)
+	c := open(t, config)
+	cmd := exec.Command(os.Args[0], "-test.run=TestHelperProcess")
+	cmd.Env = append(os.Environ(), "SHM_HELPER_PATH="+config.Path, "SHM_HELPER_DIE=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("helper process error = %v: %s", err, out)
+	}
+
+	// when
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Set("key", []byte("value"))
+	}()
+
+	// then
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Set() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("segment is still locked by the dead process")
+	}
+}
+
+func TestSetDoesNotEvictCollidingKey(t *testing.T) {
+	t.Parallel()
+
+	// given
+	c := open(t, testConfig(t))
+	c.Set("key", []byte("value"))
+	// another key with the same hash, which would have to be found by brute force otherwise
+	i, _ := c.find(hashKey("key"))
+	copy(entryKey(c.entryAt(c.slotOffset(i))), "abc")
+
+	// when
+	err := c.Set("key", []byte("other"))
+
+	// then
+	if !errors.Is(err, ErrKeyCollision) {
+		t.Errorf("Set() error = %v, want ErrKeyCollision", err)
+	}
+	if c.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", c.Len())
+	}
+	if _, err := c.Get("key"); !errors.Is(err, bigcache.ErrEntryNotFound) {
+		t.Errorf("Get() error = %v, want ErrEntryNotFound", err)
+	}
+}
+
+// TestHelperProcess runs in a child process started by TestSharedBetweenProcesses and TestLockOfDeadProcessIsReleased.
+func TestHelperProcess(t *testing.T) {
+	path := os.Getenv("SHM_HELPER_PATH")
+	if path == "" {
+		return
+	}
+	c, err := Open(Config{Path: path, Size: 4096, Slots: 64})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if os.Getenv("SHM_HELPER_DIE") != "" {
+		// the process dies holding the lock
+		c.lock()
+		os.Exit(0)
+	}
+	defer c.Close()
+	value, err := c.Get("parent")
+	if err != nil {
+		t.Fatalf("Get(parent) error = %v", err)
+	}
+	if err := c.Set("child", value); err != nil {
+		t.Fatalf("Set(child) error = %v", err)
+	}
+}
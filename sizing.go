@@ -0,0 +1,75 @@
+package bigcache
+
+import (
+	"fmt"
+	"runtime"
+)
+
+const (
+	shardsPerProc          = 16   // Shards per GOMAXPROCS chosen by DefaultFor, so goroutines rarely contend for a shard
+	maxDefaultShards       = 4096 // Maximum number of shards chosen by DefaultFor
+	minEntriesPerShard     = 256  // Number of entries below which DefaultFor halves the number of shards
+	hashmapBytesPerEntry   = 24   // Estimate of bytes taken by an entry of the hashmap of a shard
+	defaultExpectedEntries = 1000 * 10 * 60
+)
+
+// DefaultFor returns a config for a cache taking about targetBytes with entries, keys and values together,
+// of about expectedEntrySize bytes, together with the reasoning behind every choice. Shards scale with
+// GOMAXPROCS as long as every shard holds enough entries, the target bounds HardMaxCacheSize after
+// the estimated size of hashmaps is set aside and queues start at a quarter of their maximum size.
+// Entries do not expire, set LifeWindow and CleanWindow to expire them. A non-positive target means no limit
+// and a non-positive entry size means the size of DefaultConfig.
+func DefaultFor(targetBytes int, expectedEntrySize int) (Config, []string) {
+	config := DefaultConfig(0)
+	config.CleanWindow = 0
+	var reasons []string
+	reason := func(format string, args ...interface{}) {
+		reasons = append(reasons, fmt.Sprintf(format, args...))
+	}
+
+	if expectedEntrySize <= 0 {
+		expectedEntrySize = config.MaxEntrySize
+		reason("MaxEntrySize: %d, the default as the expected entry size is not set", expectedEntrySize)
+	} else {
+		reason("MaxEntrySize: %d, the expected entry size", expectedEntrySize)
+	}
+	config.MaxEntrySize = expectedEntrySize
+
+	entries := defaultExpectedEntries
+	if targetBytes > 0 {
+		entries = max(targetBytes/(expectedEntrySize+headersSizeInBytes+hashmapBytesPerEntry), 1)
+		reason("MaxEntriesInWindow: %d, entries of %d bytes with %d bytes of headers and %d bytes of hashmap fit in %d bytes",
+			entries, expectedEntrySize, headersSizeInBytes, hashmapBytesPerEntry, targetBytes)
+	} else {
+		reason("MaxEntriesInWindow: %d, the default as the target size is not set", entries)
+	}
+	config.MaxEntriesInWindow = entries
+
+	procs := runtime.GOMAXPROCS(0)
+	shards := 1
+	for shards < procs*shardsPerProc && shards < maxDefaultShards {
+		shards *= 2
+	}
+	reason("Shards: %d for %d GOMAXPROCS, %d per proc rounded up to a power of two, at most %d",
+		shards, procs, shardsPerProc, maxDefaultShards)
+	if shards > 1 && entries/shards < minEntriesPerShard {
+		for shards > 1 && entries/shards < minEntriesPerShard {
+			shards /= 2
+		}
+		reason("Shards: %d, lowered so every shard holds at least %d entries", shards, minEntriesPerShard)
+	}
+	config.Shards = shards
+
+	if targetBytes > 0 {
+		queueBytes := targetBytes - entries*hashmapBytesPerEntry
+		config.HardMaxCacheSize = max(queueBytes>>20, 1)
+		reason("HardMaxCacheSize: %d MB, the target without %d bytes of hashmaps", config.HardMaxCacheSize, entries*hashmapBytesPerEntry)
+		config.InitialShardBytes = max(config.maximumShardSizeInBytes()/4, expectedEntrySize+headersSizeInBytes)
+		reason("InitialShardBytes: %d, a quarter of the maximum size of a shard, queues grow when they fill up",
+			config.InitialShardBytes)
+	} else {
+		reason("HardMaxCacheSize: 0, no limit as the target size is not set")
+	}
+	reason("LifeWindow: 0, entries do not expire until they are evicted for space, set LifeWindow and CleanWindow to expire them")
+	return config, reasons
+}
@@ -0,0 +1,57 @@
+package bigcache
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDefaultForSizesCacheForTarget(t *testing.T) {
+	t.Parallel()
+
+	// when
+	config, reasons := DefaultFor(256<<20, 1024)
+	cache, err := New(context.Background(), config)
+
+	// then
+	noError(t, err)
+	defer cache.Close()
+	assertEqual(t, true, isPowerOfTwo(config.Shards))
+	assertEqual(t, true, config.Shards <= max(runtime.GOMAXPROCS(0)*shardsPerProc*2, 1))
+	assertEqual(t, 1024, config.MaxEntrySize)
+	assertEqual(t, 256<<20/(1024+headersSizeInBytes+hashmapBytesPerEntry), config.MaxEntriesInWindow)
+	assertEqual(t, true, config.HardMaxCacheSize > 240 && config.HardMaxCacheSize < 256)
+	assertEqual(t, config.maximumShardSizeInBytes()/4, config.InitialShardBytes)
+	for _, reason := range reasons {
+		assertEqual(t, true, strings.Contains(reason, ": "))
+	}
+}
+
+func TestDefaultForLowersShardsOfSmallCaches(t *testing.T) {
+	t.Parallel()
+
+	// when
+	config, reasons := DefaultFor(1<<20, 1000)
+	cache, err := New(context.Background(), config)
+
+	// then
+	noError(t, err)
+	defer cache.Close()
+	assertEqual(t, true, config.MaxEntriesInWindow/config.Shards >= minEntriesPerShard)
+	noError(t, cache.Set("key", make([]byte, 900)))
+	assertEqual(t, true, strings.HasPrefix(reasons[len(reasons)-1], "LifeWindow: 0"))
+}
+
+func TestDefaultForWithoutTarget(t *testing.T) {
+	t.Parallel()
+
+	// when
+	config, _ := DefaultFor(0, 0)
+	_, err := New(context.Background(), config)
+
+	// then
+	noError(t, err)
+	assertEqual(t, 0, config.HardMaxCacheSize)
+	assertEqual(t, DefaultConfig(0).MaxEntrySize, config.MaxEntrySize)
+}
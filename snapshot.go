@@ -0,0 +1,421 @@
+package bigcache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	snapshotMagic          = 0x42435348 // "BCSH"
+	snapshotVersion        = 3
+	snapshotHeaderSize     = 5 // magic + version
+	snapshotUnitSize       = 8 // Timestamp unit in nanoseconds stored after header since version 2
+	snapshotRecordSizeSize = 4 // Number of bytes used for size of a single record
+	// snapshotRecordHeaderSize is the size, crc32 of the size and crc32 of the entry of a record since version 3
+	snapshotRecordHeaderSize = snapshotRecordSizeSize + 8
+)
+
+// RestoreTimestamps decides timestamps of entries restored from a snapshot
+type RestoreTimestamps int
+
+const (
+	// RestoreKeepAge keeps original timestamps, so entries expire as if the cache was never restarted.
+	// It is the default.
+	RestoreKeepAge = RestoreTimestamps(0)
+	// RestoreAsFresh stamps entries with the time of the restore, so they live for a whole LifeWindow
+	RestoreAsFresh = RestoreTimestamps(1)
+)
+
+// RestoreOptions configure ReadFromWithOptions and ReadShardFromWithOptions
+type RestoreOptions struct {
+	// Timestamps decides timestamps of restored entries. Default value is RestoreKeepAge.
+	Timestamps RestoreTimestamps
+	// MaxAge drops entries written longer ago than it according to their original timestamps, e.g. LifeWindow
+	// to drop entries which expired while the cache was down. Default value is 0 which means no limit.
+	MaxAge time.Duration
+	// KeyPrefixes restores only entries which keys start with one of them, e.g. namespaces of keys.
+	// Default value is nil which means entries of all keys.
+	KeyPrefixes []string
+	// Filter restores only entries of keys it returns true for, after KeyPrefixes are checked.
+	// Default value is nil which means entries of all keys.
+	Filter func(key string) bool
+	// SkipCorrupted restores what can be read from a damaged snapshot instead of failing with ErrInvalidSnapshot:
+	// records which checksums do not match are skipped, a damaged or truncated tail of a shard ends its restore.
+	// Damages are listed in RestoreReport. Default value is false.
+	SkipCorrupted bool
+}
+
+// RestoreReport describes the result of restoring a snapshot
+type RestoreReport struct {
+	// Restored is a number of entries stored in the cache
+	Restored int `json:"restored"`
+	// Filtered is a number of entries not restored because of MaxAge, KeyPrefixes or Filter of RestoreOptions
+	Filtered int `json:"filtered"`
+	// Skipped is a number of damaged records skipped with RestoreOptions.SkipCorrupted
+	Skipped int `json:"skipped"`
+	// BytesRead is a number of bytes read from the snapshot
+	BytesRead int64 `json:"bytes_read"`
+	// DiscardedBytes is a number of bytes of skipped records and damaged tails of shards which were not restored
+	DiscardedBytes int64 `json:"discarded_bytes"`
+	// Damages lists damaged places of the snapshot in the order they were found
+	Damages []SnapshotDamage `json:"damages,omitempty"`
+}
+
+// SnapshotDamage describes a damaged place of a snapshot
+type SnapshotDamage struct {
+	// Shard is the index of the shard section of the snapshot, 0 for snapshots of single shards
+	Shard int `json:"shard"`
+	// Offset is the position of the damaged record in the snapshot
+	Offset int64 `json:"offset"`
+	// Reason tells what is wrong with the record
+	Reason string `json:"reason"`
+}
+
+// damaged records the damage of the record at the offset, which bytes read so far are discarded, and returns err
+func (r *RestoreReport) damaged(shard int, offset int64, reason string, err error) error {
+	r.Damages = append(r.Damages, SnapshotDamage{Shard: shard, Offset: offset, Reason: reason})
+	r.DiscardedBytes += r.BytesRead - offset
+	return err
+}
+
+// resync discards the stream up to the header of the next shard, it returns an error when the stream ended
+func (r *RestoreReport) resync(br *bufio.Reader) error {
+	for {
+		header, err := br.Peek(4)
+		if err != nil {
+			n, _ := br.Discard(len(header))
+			r.BytesRead += int64(n)
+			r.DiscardedBytes += int64(n)
+			return err
+		}
+		if binary.LittleEndian.Uint32(header) == snapshotMagic {
+			return nil
+		}
+		br.Discard(1)
+		r.BytesRead++
+		r.DiscardedBytes++
+	}
+}
+
+// isSnapshotDamage reports whether the restore failed because the snapshot is damaged or truncated
+func isSnapshotDamage(err error) bool {
+	return errors.Is(err, ErrInvalidSnapshot) || err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// filtersKeys reports whether entries are restored depending on their keys
+func (o RestoreOptions) filtersKeys() bool {
+	return len(o.KeyPrefixes) > 0 || o.Filter != nil
+}
+
+// restoresKey reports whether the entry of the key is restored
+func (o RestoreOptions) restoresKey(key string) bool {
+	if len(o.KeyPrefixes) > 0 {
+		matched := false
+		for _, prefix := range o.KeyPrefixes {
+			if strings.HasPrefix(key, prefix) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return o.Filter == nil || o.Filter(key)
+}
+
+var (
+	// ErrInvalidSnapshot is returned when a snapshot stream cannot be decoded
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+	// ErrInvalidShardIndex is returned when shard index is out of range
+	ErrInvalidShardIndex = errors.New("shard index out of range")
+)
+
+// WriteShardTo writes all entries of a single shard to w in the order of insertion.
+// Shards are independent of each other, so a snapshot can be written with one goroutine per shard,
+// e.g. to separate files or tar stream members. The shard is read locked only while its entries are copied
+// to memory, so a slow writer does not block writes to it.
+func (c *BigCache) WriteShardTo(shard int, w io.Writer) (int64, error) {
+	if shard < 0 || shard >= len(c.shards) {
+		return 0, ErrInvalidShardIndex
+	}
+	return c.shards[shard].writeTo(w)
+}
+
+// ReadShardFrom restores entries written by WriteShardTo, keeping their original timestamps.
+// Entries are stored in the shard owning their key, so when the snapshot was taken with the same
+// number of shards all of them land in the given shard and shards can be restored in parallel
+// without contention. Entries already present in the cache are overwritten.
+// The reader is not buffered, wrap it with bufio.Reader when reading from a file.
+func (c *BigCache) ReadShardFrom(shard int, r io.Reader) (int64, error) {
+	return c.ReadShardFromWithOptions(shard, r, RestoreOptions{})
+}
+
+// ReadShardFromWithOptions is ReadShardFrom which rebases timestamps and filters entries with options
+func (c *BigCache) ReadShardFromWithOptions(shard int, r io.Reader, options RestoreOptions) (int64, error) {
+	report, err := c.RestoreShardFrom(shard, r, options)
+	return report.BytesRead, err
+}
+
+// RestoreShardFrom is ReadShardFromWithOptions which reports what was restored and which damages were found
+func (c *BigCache) RestoreShardFrom(shard int, r io.Reader, options RestoreOptions) (RestoreReport, error) {
+	if err := c.writable(); err != nil {
+		return RestoreReport{}, err
+	}
+	var report RestoreReport
+	if shard < 0 || shard >= len(c.shards) {
+		return report, ErrInvalidShardIndex
+	}
+	err := c.readShardFrom(r, shard, options, &report)
+	if options.SkipCorrupted && isSnapshotDamage(err) {
+		err = nil
+	}
+	return report, err
+}
+
+// WriteTo writes all shards to w one after another. It implements io.WriterTo.
+func (c *BigCache) WriteTo(w io.Writer) (int64, error) {
+	var header [4]byte
+	binary.LittleEndian.PutUint32(header[:], uint32(len(c.shards)))
+	n, err := w.Write(header[:])
+	written := int64(n)
+	if err != nil {
+		return written, err
+	}
+	for _, shard := range c.shards {
+		n, err := shard.writeTo(w)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ReadFrom restores a snapshot written by WriteTo. It implements io.ReaderFrom.
+// The snapshot can be restored into a cache with a different number of shards.
+func (c *BigCache) ReadFrom(r io.Reader) (int64, error) {
+	return c.ReadFromWithOptions(r, RestoreOptions{})
+}
+
+// ReadFromWithOptions is ReadFrom which rebases timestamps and filters entries with options, so entries
+// which should be gone already, or which belong to other namespaces, are not restored
+func (c *BigCache) ReadFromWithOptions(r io.Reader, options RestoreOptions) (int64, error) {
+	report, err := c.RestoreFrom(r, options)
+	return report.BytesRead, err
+}
+
+// RestoreFrom is ReadFromWithOptions which reports what was restored and which damages were found.
+// With RestoreOptions.SkipCorrupted, a shard which tail is damaged is followed by the next shard found
+// in the stream, so a damage loses entries of a single shard at most.
+func (c *BigCache) RestoreFrom(r io.Reader, options RestoreOptions) (RestoreReport, error) {
+	if err := c.writable(); err != nil {
+		return RestoreReport{}, err
+	}
+	var report RestoreReport
+	br := bufio.NewReader(r)
+	var header [4]byte
+	n, err := io.ReadFull(br, header[:])
+	report.BytesRead += int64(n)
+	if err != nil {
+		return report, err
+	}
+	shards := int(binary.LittleEndian.Uint32(header[:]))
+	for i := 0; i < shards; i++ {
+		err := c.readShardFrom(br, i, options, &report)
+		if err == nil {
+			continue
+		}
+		if !options.SkipCorrupted || !isSnapshotDamage(err) {
+			return report, err
+		}
+		if err = report.resync(br); err != nil {
+			// the stream ended, there are no more shards to restore
+			return report, nil
+		}
+	}
+	return report, nil
+}
+
+// readShardFrom restores entries of a single shard section of a snapshot into the report.
+// Damages are recorded in the report, errors of damages satisfy isSnapshotDamage.
+func (c *BigCache) readShardFrom(r io.Reader, shard int, options RestoreOptions, report *RestoreReport) error {
+	read := func(p []byte) error {
+		n, err := io.ReadFull(r, p)
+		report.BytesRead += int64(n)
+		return err
+	}
+	offset := report.BytesRead
+	var header [snapshotRecordHeaderSize]byte
+	if err := read(header[:snapshotHeaderSize]); err != nil {
+		return report.damaged(shard, offset, "truncated header", err)
+	}
+	if binary.LittleEndian.Uint32(header[:]) != snapshotMagic {
+		return report.damaged(shard, offset, "invalid magic", ErrInvalidSnapshot)
+	}
+	// snapshots of version 1 were written with timestamps in seconds, records have checksums since version 3
+	unit := uint64(time.Second)
+	version := header[4]
+	switch version {
+	case 1:
+	case 2, snapshotVersion:
+		var unitHeader [snapshotUnitSize]byte
+		if err := read(unitHeader[:]); err != nil {
+			return report.damaged(shard, offset, "truncated header", err)
+		}
+		unit = binary.LittleEndian.Uint64(unitHeader[:])
+		if unit == 0 {
+			return report.damaged(shard, offset, "invalid timestamp unit", ErrInvalidSnapshot)
+		}
+	default:
+		return report.damaged(shard, offset, fmt.Sprintf("unsupported version %d", version),
+			fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, version))
+	}
+	recordHeaderSize := snapshotRecordSizeSize
+	if version >= snapshotVersion {
+		recordHeaderSize = snapshotRecordHeaderSize
+	}
+	cacheUnit := uint64(c.currentConfig().timestampUnit())
+	maxAge := uint64(options.MaxAge) / cacheUnit
+	if options.MaxAge > 0 && maxAge == 0 {
+		maxAge = 1
+	}
+
+	var buffer []byte
+	for {
+		offset = report.BytesRead
+		if err := read(header[:recordHeaderSize]); err != nil {
+			return report.damaged(shard, offset, "truncated record header", err)
+		}
+		size := int(binary.LittleEndian.Uint32(header[:]))
+		if recordHeaderSize == snapshotRecordHeaderSize &&
+			binary.LittleEndian.Uint32(header[snapshotRecordSizeSize:]) != crc32.Checksum(header[:snapshotRecordSizeSize], checksumTable) {
+			// the size cannot be trusted, so the rest of the shard cannot be read
+			return report.damaged(shard, offset, "record header checksum mismatch", ErrInvalidSnapshot)
+		}
+		if size == 0 {
+			return nil
+		}
+		if size < headersSizeInBytes {
+			return report.damaged(shard, offset, fmt.Sprintf("record size %d too small", size), ErrInvalidSnapshot)
+		}
+		if size > cap(buffer) {
+			// the buffer grows with data actually read, so a damaged size does not allocate more than the snapshot holds
+			grown := bytes.NewBuffer(buffer[:0])
+			n, err := io.CopyN(grown, r, int64(size))
+			report.BytesRead += n
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return report.damaged(shard, offset, "truncated record", err)
+			}
+			buffer = grown.Bytes()
+		} else if err := read(buffer[:size]); err != nil {
+			return report.damaged(shard, offset, "truncated record", err)
+		}
+		wrappedEntry := buffer[:size]
+		reason := ""
+		if recordHeaderSize == snapshotRecordHeaderSize &&
+			binary.LittleEndian.Uint32(header[snapshotRecordSizeSize+4:]) != crc32.Checksum(wrappedEntry, checksumTable) {
+			reason = "record checksum mismatch"
+		} else if !isValidEntry(wrappedEntry) {
+			reason = "malformed entry"
+		}
+		if reason != "" {
+			if !options.SkipCorrupted {
+				return report.damaged(shard, offset, reason, ErrInvalidSnapshot)
+			}
+			report.damaged(shard, offset, reason, nil)
+			report.Skipped++
+			continue
+		}
+		if unit != cacheUnit {
+			writeTimestampToEntry(wrappedEntry, readTimestampFromEntry(wrappedEntry)*unit/cacheUnit)
+		}
+		if !c.restoresEntry(wrappedEntry, options, maxAge) {
+			report.Filtered++
+			continue
+		}
+		if options.Timestamps == RestoreAsFresh {
+			writeTimestampToEntry(wrappedEntry, uint64(c.clock.Epoch()))
+		}
+
+		// hash is recomputed, so snapshots can be restored with a different Hasher
+		hashedKey := readHashFromEntry(wrappedEntry)
+		if hasKeyInEntry(wrappedEntry) {
+			hashedKey = c.hash.Sum64(readKeyFromEntry(wrappedEntry))
+			binary.LittleEndian.PutUint64(wrappedEntry[timestampSizeInBytes:], hashedKey)
+		}
+		if err := c.getShard(hashedKey).setWrappedEntry(wrappedEntry, hashedKey); err != nil {
+			return err
+		}
+		report.Restored++
+	}
+}
+
+// restoresEntry reports whether the entry passes MaxAge and filters of keys of the options.
+// Entries written without keys are not restored when keys are filtered.
+func (c *BigCache) restoresEntry(wrappedEntry []byte, options RestoreOptions, maxAge uint64) bool {
+	if maxAge > 0 {
+		currentTimestamp := uint64(c.clock.Epoch())
+		if timestamp := readTimestampFromEntry(wrappedEntry); currentTimestamp > timestamp && currentTimestamp-timestamp > maxAge {
+			return false
+		}
+	}
+	if options.filtersKeys() {
+		return hasKeyInEntry(wrappedEntry) && options.restoresKey(readKeyFromEntry(wrappedEntry))
+	}
+	return true
+}
+
+// writeTo copies entries of the shard to memory under the read lock and writes them to w once it is released,
+// so a slow writer, e.g. an HTTP client, does not block writes to the shard
+func (s *cacheShard) writeTo(w io.Writer) (int64, error) {
+	var header [snapshotHeaderSize + snapshotUnitSize]byte
+	binary.LittleEndian.PutUint32(header[:], snapshotMagic)
+	header[4] = snapshotVersion
+	binary.LittleEndian.PutUint64(header[snapshotHeaderSize:], uint64(s.timestampUnit))
+
+	s.lock.RLock()
+	buffer := bytes.NewBuffer(make([]byte, 0, len(header)+s.entries.UsedBytes()+(s.entries.Len()+1)*snapshotRecordHeaderSize))
+	buffer.Write(header[:])
+	s.entries.Iterate(func(index int, wrappedEntry []byte) bool {
+		if readHashFromEntry(wrappedEntry) == 0 {
+			// entry has been deleted or overwritten
+			return true
+		}
+		buffer.Write(snapshotRecordHeader(&header, wrappedEntry))
+		buffer.Write(wrappedEntry)
+		return true
+	})
+	s.lock.RUnlock()
+
+	buffer.Write(snapshotRecordHeader(&header, nil))
+	n, err := w.Write(buffer.Bytes())
+	return int64(n), err
+}
+
+// snapshotRecordHeader encodes the size of the entry with checksums of the size and the entry into the header,
+// a record of an empty entry ends a shard
+func snapshotRecordHeader(header *[snapshotHeaderSize + snapshotUnitSize]byte, wrappedEntry []byte) []byte {
+	binary.LittleEndian.PutUint32(header[:], uint32(len(wrappedEntry)))
+	binary.LittleEndian.PutUint32(header[snapshotRecordSizeSize:], crc32.Checksum(header[:snapshotRecordSizeSize], checksumTable))
+	binary.LittleEndian.PutUint32(header[snapshotRecordSizeSize+4:], crc32.Checksum(wrappedEntry, checksumTable))
+	return header[:snapshotRecordHeaderSize]
+}
+
+func (s *cacheShard) setWrappedEntry(wrappedEntry []byte, hashedKey uint64) error {
+	currentTimestamp := uint64(s.clock.Epoch())
+	s.lock.Lock()
+	err := s.setWrappedEntryWithoutLock(currentTimestamp, wrappedEntry, hashedKey)
+	s.lock.Unlock()
+	return err
+}
@@ -0,0 +1,49 @@
+//go:build go1.18
+// +build go1.18
+
+package bigcache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func FuzzRestoreFrom(f *testing.F) {
+	cache, _ := New(context.Background(), Config{
+		Shards:             2,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	})
+	for i := 0; i < 10; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)))
+	}
+	var buf bytes.Buffer
+	cache.WriteTo(&buf)
+	f.Add(buf.Bytes())
+	f.Add(buf.Bytes()[:buf.Len()/2])
+	f.Add([]byte("not a snapshot"))
+
+	f.Fuzz(func(t *testing.T, snapshot []byte) {
+		restored, _ := New(context.Background(), Config{
+			Shards:             2,
+			LifeWindow:         time.Minute,
+			MaxEntriesInWindow: 10,
+			MaxEntrySize:       256,
+			HardMaxCacheSize:   1,
+		})
+		defer restored.Close()
+
+		report, err := restored.RestoreFrom(bytes.NewReader(snapshot), RestoreOptions{SkipCorrupted: true})
+
+		if err != nil && isSnapshotDamage(err) && len(snapshot) >= 4 {
+			t.Fatalf("damage not recovered: %v", err)
+		}
+		if report.BytesRead > int64(len(snapshot)) || report.DiscardedBytes > report.BytesRead {
+			t.Fatalf("inconsistent report: %+v", report)
+		}
+	})
+}
@@ -0,0 +1,247 @@
+package bigcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const defaultSnapshotPartSize = 8 << 20
+
+// ErrSnapshotNotFound is returned by LoadSnapshot when the store has no snapshot of the name
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// SnapshotStore persists snapshots saved by SaveSnapshot, e.g. in a local directory or an object storage,
+// so containers with ephemeral disks can restore a warm cache after a deployment. Implementations must be
+// safe for concurrent use.
+type SnapshotStore interface {
+	// Create returns a writer of the snapshot. The snapshot becomes visible when the writer is closed,
+	// it is discarded when the writer is aborted.
+	Create(ctx context.Context, name string) (SnapshotWriter, error)
+	// Open returns a reader of the snapshot, an error wrapping ErrSnapshotNotFound when it does not exist
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+// SnapshotWriter writes a snapshot created by SnapshotStore
+type SnapshotWriter interface {
+	io.Writer
+	// Close publishes the written snapshot
+	Close() error
+	// Abort discards the written data, the previous snapshot of the name is kept
+	Abort() error
+}
+
+// SaveSnapshot writes all shards to the store under the name, as WriteTo does.
+// The snapshot replaces the previous one of the name only when it was written completely.
+func (c *BigCache) SaveSnapshot(ctx context.Context, store SnapshotStore, name string) (int64, error) {
+	w, err := store.Create(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	written, err := c.WriteTo(&contextWriter{ctx: ctx, w: w})
+	if err != nil {
+		w.Abort()
+		return written, err
+	}
+	return written, w.Close()
+}
+
+// LoadSnapshot restores the snapshot of the name from the store, as ReadFromWithOptions does
+func (c *BigCache) LoadSnapshot(ctx context.Context, store SnapshotStore, name string, options RestoreOptions) (int64, error) {
+	r, err := store.Open(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	return c.ReadFromWithOptions(&contextReader{ctx: ctx, r: r}, options)
+}
+
+// contextWriter stops writing once the context is done
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w *contextWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// contextReader stops reading once the context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// DirSnapshotStore keeps snapshots as files in a local directory. A snapshot is written to a temporary file
+// and renamed over the previous one when it is complete, so a crash never leaves a truncated snapshot.
+type DirSnapshotStore struct {
+	// Dir is the directory of snapshots, it must exist
+	Dir string
+}
+
+// Create creates a temporary file in the directory
+func (s DirSnapshotStore) Create(ctx context.Context, name string) (SnapshotWriter, error) {
+	f, err := os.CreateTemp(s.Dir, name+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &fileSnapshotWriter{file: f, path: filepath.Join(s.Dir, name)}, nil
+}
+
+// Open opens the snapshot file
+func (s DirSnapshotStore) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(s.Dir, name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+	}
+	return f, err
+}
+
+// fileSnapshotWriter writes a temporary file which is renamed to path when it is closed
+type fileSnapshotWriter struct {
+	file *os.File
+	path string
+}
+
+func (w *fileSnapshotWriter) Write(p []byte) (int, error) {
+	return w.file.Write(p)
+}
+
+func (w *fileSnapshotWriter) Close() error {
+	if err := w.file.Sync(); err != nil {
+		w.Abort()
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		os.Remove(w.file.Name())
+		return err
+	}
+	return os.Rename(w.file.Name(), w.path)
+}
+
+func (w *fileSnapshotWriter) Abort() error {
+	w.file.Close()
+	return os.Remove(w.file.Name())
+}
+
+// ObjectStorage is the subset of an object storage API used by ObjectSnapshotStore, e.g. a thin adapter
+// of an S3 client. GCS and other storages exposing the S3 compatible API can be adapted in the same way.
+type ObjectStorage interface {
+	// CreateMultipartUpload starts an upload of the object and returns its id
+	CreateMultipartUpload(ctx context.Context, key string) (uploadID string, err error)
+	// UploadPart uploads the part of the upload, numbered from 1, and returns its ETag.
+	// The data is reused when it returns, so it must not be retained.
+	UploadPart(ctx context.Context, key, uploadID string, partNumber int, data []byte) (etag string, err error)
+	// CompleteMultipartUpload publishes the object assembled from the parts identified by their ETags in order
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, etags []string) error
+	// AbortMultipartUpload discards the upload and its parts
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+	// GetObject returns a reader of the object, an error wrapping ErrSnapshotNotFound when it does not exist
+	GetObject(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// ObjectSnapshotStore streams snapshots to an object storage with multipart uploads, so only a single part
+// is held in memory regardless of the size of the cache.
+type ObjectSnapshotStore struct {
+	// Storage of the objects
+	Storage ObjectStorage
+	// Prefix is prepended to names of snapshots to form keys of objects, e.g. "caches/"
+	Prefix string
+	// PartSize is the size of uploaded parts in bytes, S3 requires at least 5MB for all parts but the last one.
+	// Default value is 0 which means 8MB.
+	PartSize int
+}
+
+// Create starts a multipart upload of the snapshot
+func (s ObjectSnapshotStore) Create(ctx context.Context, name string) (SnapshotWriter, error) {
+	key := s.Prefix + name
+	uploadID, err := s.Storage.CreateMultipartUpload(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	partSize := s.PartSize
+	if partSize <= 0 {
+		partSize = defaultSnapshotPartSize
+	}
+	return &objectSnapshotWriter{
+		ctx:      ctx,
+		storage:  s.Storage,
+		key:      key,
+		uploadID: uploadID,
+		part:     make([]byte, 0, partSize),
+	}, nil
+}
+
+// Open returns a reader of the snapshot object
+func (s ObjectSnapshotStore) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return s.Storage.GetObject(ctx, s.Prefix+name)
+}
+
+// objectSnapshotWriter buffers a part and uploads it once it is full
+type objectSnapshotWriter struct {
+	ctx      context.Context
+	storage  ObjectStorage
+	key      string
+	uploadID string
+	part     []byte
+	etags    []string
+}
+
+func (w *objectSnapshotWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(w.part[len(w.part):cap(w.part)], p)
+		w.part = w.part[:len(w.part)+n]
+		written += n
+		p = p[n:]
+		if len(w.part) == cap(w.part) {
+			if err := w.upload(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// upload uploads the buffered part
+func (w *objectSnapshotWriter) upload() error {
+	etag, err := w.storage.UploadPart(w.ctx, w.key, w.uploadID, len(w.etags)+1, w.part)
+	if err != nil {
+		return err
+	}
+	w.etags = append(w.etags, etag)
+	w.part = w.part[:0]
+	return nil
+}
+
+func (w *objectSnapshotWriter) Close() error {
+	// the last part can be smaller, an empty one is uploaded only when nothing was written
+	if len(w.part) > 0 || len(w.etags) == 0 {
+		if err := w.upload(); err != nil {
+			w.Abort()
+			return err
+		}
+	}
+	if err := w.storage.CompleteMultipartUpload(w.ctx, w.key, w.uploadID, w.etags); err != nil {
+		w.Abort()
+		return err
+	}
+	return nil
+}
+
+func (w *objectSnapshotWriter) Abort() error {
+	return w.storage.AbortMultipartUpload(w.ctx, w.key, w.uploadID)
+}
@@ -0,0 +1,187 @@
+package bigcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryObjectStorage keeps objects and uploads in memory
+type memoryObjectStorage struct {
+	lock    sync.Mutex
+	objects map[string][]byte
+	uploads map[string][][]byte
+	failAt  int
+}
+
+func newMemoryObjectStorage() *memoryObjectStorage {
+	return &memoryObjectStorage{objects: make(map[string][]byte), uploads: make(map[string][][]byte)}
+}
+
+func (s *memoryObjectStorage) CreateMultipartUpload(ctx context.Context, key string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	uploadID := fmt.Sprintf("%s-%d", key, len(s.uploads))
+	s.uploads[uploadID] = nil
+	return uploadID, nil
+}
+
+func (s *memoryObjectStorage) UploadPart(ctx context.Context, key, uploadID string, partNumber int, data []byte) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if partNumber == s.failAt {
+		return "", errors.New("upload failed")
+	}
+	s.uploads[uploadID] = append(s.uploads[uploadID], append([]byte(nil), data...))
+	return fmt.Sprintf("etag-%d", partNumber), nil
+}
+
+func (s *memoryObjectStorage) CompleteMultipartUpload(ctx context.Context, key, uploadID string, etags []string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	parts := s.uploads[uploadID]
+	if len(parts) != len(etags) {
+		return errors.New("missing parts")
+	}
+	s.objects[key] = bytes.Join(parts, nil)
+	delete(s.uploads, uploadID)
+	return nil
+}
+
+func (s *memoryObjectStorage) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	s.lock.Lock()
+	delete(s.uploads, uploadID)
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *memoryObjectStorage) GetObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	object, ok := s.objects[key]
+	if !ok {
+		return nil, ErrSnapshotNotFound
+	}
+	return io.NopCloser(bytes.NewReader(object)), nil
+}
+
+func newSnapshotTestCache(t *testing.T) *BigCache {
+	cache, err := New(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 100,
+		MaxEntrySize:       256,
+	})
+	noError(t, err)
+	return cache
+}
+
+func TestDirSnapshotStore(t *testing.T) {
+	t.Parallel()
+
+	// given
+	store := DirSnapshotStore{Dir: t.TempDir()}
+	cache := newSnapshotTestCache(t)
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)))
+	}
+
+	// when
+	written, err := cache.SaveSnapshot(context.Background(), store, "warm")
+	noError(t, err)
+	restored := newSnapshotTestCache(t)
+	read, err := restored.LoadSnapshot(context.Background(), store, "warm", RestoreOptions{})
+
+	// then
+	noError(t, err)
+	assertEqual(t, written, read)
+	assertEqual(t, 100, restored.Len())
+	value, _ := restored.Get("key42")
+	assertEqual(t, []byte("value42"), value)
+	files, _ := os.ReadDir(store.Dir)
+	assertEqual(t, 1, len(files))
+}
+
+func TestDirSnapshotStoreMissingSnapshot(t *testing.T) {
+	t.Parallel()
+
+	// given
+	store := DirSnapshotStore{Dir: t.TempDir()}
+	cache := newSnapshotTestCache(t)
+
+	// when
+	_, err := cache.LoadSnapshot(context.Background(), store, "missing", RestoreOptions{})
+
+	// then
+	assertEqual(t, true, errors.Is(err, ErrSnapshotNotFound))
+}
+
+func TestSaveSnapshotStopsWhenContextIsDone(t *testing.T) {
+	t.Parallel()
+
+	// given
+	store := DirSnapshotStore{Dir: t.TempDir()}
+	cache := newSnapshotTestCache(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// when
+	_, err := cache.SaveSnapshot(ctx, store, "warm")
+
+	// then
+	assertEqual(t, context.Canceled, err)
+	files, _ := os.ReadDir(store.Dir)
+	assertEqual(t, 0, len(files))
+}
+
+func TestObjectSnapshotStoreUploadsParts(t *testing.T) {
+	t.Parallel()
+
+	// given
+	storage := newMemoryObjectStorage()
+	store := ObjectSnapshotStore{Storage: storage, Prefix: "caches/", PartSize: 256}
+	cache := newSnapshotTestCache(t)
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)))
+	}
+
+	// when
+	written, err := cache.SaveSnapshot(context.Background(), store, "warm")
+	noError(t, err)
+	restored := newSnapshotTestCache(t)
+	_, err = restored.LoadSnapshot(context.Background(), store, "warm", RestoreOptions{})
+
+	// then
+	noError(t, err)
+	assertEqual(t, int(written), len(storage.objects["caches/warm"]))
+	assertEqual(t, 100, restored.Len())
+	value, _ := restored.Get("key42")
+	assertEqual(t, []byte("value42"), value)
+}
+
+func TestObjectSnapshotStoreAbortsFailedUpload(t *testing.T) {
+	t.Parallel()
+
+	// given
+	storage := newMemoryObjectStorage()
+	storage.failAt = 2
+	store := ObjectSnapshotStore{Storage: storage, PartSize: 256}
+	cache := newSnapshotTestCache(t)
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)))
+	}
+
+	// when
+	_, err := cache.SaveSnapshot(context.Background(), store, "warm")
+
+	// then
+	assertEqual(t, errors.New("upload failed"), err)
+	assertEqual(t, 0, len(storage.objects))
+	assertEqual(t, 0, len(storage.uploads))
+}
@@ -0,0 +1,452 @@
+package bigcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSnapshotWriteAndRead(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 100}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         10 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}, &clock)
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)))
+	}
+	cache.Delete("key0")
+	cache.Set("key1", []byte("updated"))
+
+	// when
+	var buf bytes.Buffer
+	_, err := cache.WriteTo(&buf)
+	noError(t, err)
+
+	restoredClock := mockedClock{value: 105}
+	restored, _ := newBigCache(context.Background(), Config{
+		Shards:             16,
+		LifeWindow:         10 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}, &restoredClock)
+	_, err = restored.ReadFrom(&buf)
+	noError(t, err)
+
+	// then
+	assertEqual(t, 99, restored.Len())
+	_, err = restored.Get("key0")
+	assertEqual(t, ErrEntryNotFound, err)
+	value, _ := restored.Get("key1")
+	assertEqual(t, []byte("updated"), value)
+	value, _ = restored.Get("key42")
+	assertEqual(t, []byte("value42"), value)
+
+	iterator := restored.Iterator()
+	for iterator.SetNext() {
+		entry, err := iterator.Value()
+		noError(t, err)
+		assertEqual(t, uint64(100), entry.Timestamp())
+	}
+}
+
+func TestSnapshotShardsInParallel(t *testing.T) {
+	t.Parallel()
+
+	// given
+	config := Config{
+		Shards:             8,
+		LifeWindow:         10 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}
+	cache, _ := New(context.Background(), config)
+	for i := 0; i < 1000; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+
+	// when
+	buffers := make([]bytes.Buffer, config.Shards)
+	var wg sync.WaitGroup
+	for i := range buffers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := cache.WriteShardTo(i, &buffers[i])
+			noError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	restored, _ := New(context.Background(), config)
+	for i := range buffers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := restored.ReadShardFrom(i, &buffers[i])
+			noError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	// then
+	assertEqual(t, 1000, restored.Len())
+	for i := 0; i < config.Shards; i++ {
+		assertEqual(t, cache.shards[i].len(), restored.shards[i].len())
+	}
+}
+
+// writerFunc adapts a function to io.Writer
+type writerFunc func(p []byte) (int, error)
+
+func (fn writerFunc) Write(p []byte) (int, error) {
+	return fn(p)
+}
+
+func TestSnapshotDoesNotLockShardWhileWriting(t *testing.T) {
+	t.Parallel()
+
+	// given
+	config := DefaultConfig(time.Minute)
+	config.Shards = 1
+	cache, _ := New(context.Background(), config)
+	defer cache.Close()
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), blob('a', 1024))
+	}
+	set := make(chan error, 1)
+	var once sync.Once
+	writer := writerFunc(func(p []byte) (int, error) {
+		once.Do(func() {
+			go func() { set <- cache.Set("key0", []byte("value")) }()
+			select {
+			case err := <-set:
+				noError(t, err)
+			case <-time.After(time.Second):
+				t.Error("shard was locked while the snapshot was written")
+			}
+		})
+		return len(p), nil
+	})
+
+	// when
+	_, err := cache.WriteShardTo(0, writer)
+
+	// then
+	noError(t, err)
+}
+
+func TestSnapshotRestoresEntriesOfOtherFormat(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         10 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		EntryFormat:        EntryFormatV2,
+		EntryChecksum:      true,
+	})
+	for i := 0; i < 10; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)))
+	}
+
+	// when
+	var buf bytes.Buffer
+	_, err := cache.WriteTo(&buf)
+	noError(t, err)
+
+	restored, _ := New(context.Background(), Config{
+		Shards:             2,
+		LifeWindow:         10 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	})
+	_, err = restored.ReadFrom(&buf)
+	noError(t, err)
+
+	// then
+	assertEqual(t, 10, restored.Len())
+	value, _ := restored.Get("key7")
+	assertEqual(t, []byte("value7"), value)
+
+	// when
+	restored.Set("key7", []byte("updated"))
+
+	// then
+	value, _ = restored.Get("key7")
+	assertEqual(t, []byte("updated"), value)
+}
+
+func TestSnapshotInvalidInput(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Second))
+	defer cache.Close()
+
+	// when
+	_, err := cache.ReadShardFrom(0, bytes.NewReader([]byte("not a snapshot")))
+	_, shardErr := cache.WriteShardTo(len(cache.shards), &bytes.Buffer{})
+
+	// then
+	assertEqual(t, ErrInvalidSnapshot, err)
+	assertEqual(t, ErrInvalidShardIndex, shardErr)
+}
+
+func TestSnapshotConvertsTimestampPrecision(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 100}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         10 * time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}, &clock)
+	cache.Set("key", []byte("value"))
+	var buf bytes.Buffer
+	cache.WriteShardTo(0, &buf)
+	snapshot := buf.Bytes()
+	snapshots := map[string][]byte{"v1": legacySnapshot(snapshot, 1), "v2": legacySnapshot(snapshot, 2), "v3": snapshot}
+
+	for name, snapshot := range snapshots {
+		t.Run(name, func(t *testing.T) {
+			restoredClock := mockedClock{value: 104000}
+			restored, _ := newBigCache(context.Background(), Config{
+				Shards:             1,
+				LifeWindow:         10 * time.Second,
+				MaxEntriesInWindow: 10,
+				MaxEntrySize:       256,
+				TimestampPrecision: time.Millisecond,
+			}, &restoredClock)
+
+			// when
+			_, err := restored.ReadShardFrom(0, bytes.NewReader(snapshot))
+
+			// then
+			noError(t, err)
+			ttl, _ := restored.TTL("key")
+			assertEqual(t, 6*time.Second, ttl)
+		})
+	}
+}
+
+func TestSnapshotRestoreOptions(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 100}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	}, &clock)
+	cache.Set("user:old", []byte("value"))
+	cache.Set("session:old", []byte("value"))
+	clock.set(150)
+	cache.Set("user:new", []byte("value"))
+	cache.Set("session:new", []byte("value"))
+	var buf bytes.Buffer
+	cache.WriteTo(&buf)
+	snapshot := buf.Bytes()
+
+	for _, tc := range []struct {
+		name       string
+		options    RestoreOptions
+		keys       []string
+		timestamps []uint64
+	}{
+		{
+			name:       "keep age",
+			options:    RestoreOptions{},
+			keys:       []string{"session:new", "session:old", "user:new", "user:old"},
+			timestamps: []uint64{150, 100, 150, 100},
+		},
+		{
+			name:       "as fresh",
+			options:    RestoreOptions{Timestamps: RestoreAsFresh},
+			keys:       []string{"session:new", "session:old", "user:new", "user:old"},
+			timestamps: []uint64{160, 160, 160, 160},
+		},
+		{
+			name:       "max age",
+			options:    RestoreOptions{MaxAge: 30 * time.Second},
+			keys:       []string{"session:new", "user:new"},
+			timestamps: []uint64{150, 150},
+		},
+		{
+			name:       "key prefixes",
+			options:    RestoreOptions{KeyPrefixes: []string{"user:"}},
+			keys:       []string{"user:new", "user:old"},
+			timestamps: []uint64{150, 100},
+		},
+		{
+			name:       "filter",
+			options:    RestoreOptions{Filter: func(key string) bool { return key != "user:old" }},
+			keys:       []string{"session:new", "session:old", "user:new"},
+			timestamps: []uint64{150, 100, 150},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			restoredClock := mockedClock{value: 160}
+			restored, _ := newBigCache(context.Background(), Config{
+				Shards:             4,
+				LifeWindow:         time.Minute,
+				MaxEntriesInWindow: 10,
+				MaxEntrySize:       256,
+			}, &restoredClock)
+
+			// when
+			_, err := restored.ReadFromWithOptions(bytes.NewReader(snapshot), tc.options)
+
+			// then
+			noError(t, err)
+			timestamps := map[string]uint64{}
+			iterator := restored.Iterator()
+			for iterator.SetNext() {
+				entry, err := iterator.Value()
+				noError(t, err)
+				timestamps[entry.Key()] = entry.Timestamp()
+			}
+			want := map[string]uint64{}
+			for i, key := range tc.keys {
+				want[key] = tc.timestamps[i]
+			}
+			assertEqual(t, want, timestamps)
+		})
+	}
+}
+
+// legacySnapshot converts the snapshot of a single shard to the older version
+func legacySnapshot(snapshot []byte, version byte) []byte {
+	legacy := append([]byte{}, snapshot[:snapshotHeaderSize]...)
+	legacy[4] = version
+	// version 1 snapshots have no timestamp unit after the header
+	if version > 1 {
+		legacy = append(legacy, snapshot[snapshotHeaderSize:snapshotHeaderSize+snapshotUnitSize]...)
+	}
+	// records before version 3 have no checksums
+	for records := snapshot[snapshotHeaderSize+snapshotUnitSize:]; len(records) > 0; {
+		size := int(binary.LittleEndian.Uint32(records))
+		legacy = append(legacy, records[:snapshotRecordSizeSize]...)
+		legacy = append(legacy, records[snapshotRecordHeaderSize:snapshotRecordHeaderSize+size]...)
+		records = records[snapshotRecordHeaderSize+size:]
+	}
+	return legacy
+}
+
+func TestSnapshotSkipsCorruptedRecords(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	})
+	for i := 0; i < 3; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)))
+	}
+	var buf bytes.Buffer
+	cache.WriteShardTo(0, &buf)
+	snapshot := buf.Bytes()
+	firstRecord := snapshotHeaderSize + snapshotUnitSize
+	secondRecord := firstRecord + snapshotRecordHeaderSize + int(binary.LittleEndian.Uint32(snapshot[firstRecord:]))
+	snapshot[len(snapshot)-snapshotRecordHeaderSize-1] ^= 0xFF
+
+	// when
+	restored, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer restored.Close()
+	_, strictErr := restored.RestoreShardFrom(0, bytes.NewReader(snapshot), RestoreOptions{})
+	report, err := restored.RestoreShardFrom(0, bytes.NewReader(snapshot), RestoreOptions{SkipCorrupted: true})
+
+	// then
+	assertEqual(t, ErrInvalidSnapshot, strictErr)
+	noError(t, err)
+	assertEqual(t, 2, report.Restored)
+	assertEqual(t, 1, report.Skipped)
+	assertEqual(t, int64(len(snapshot)), report.BytesRead)
+	assertEqual(t, int64(secondRecord-firstRecord), report.DiscardedBytes)
+	assertEqual(t, []SnapshotDamage{{Shard: 0, Offset: int64(secondRecord + secondRecord - firstRecord), Reason: "record checksum mismatch"}}, report.Damages)
+	_, err = restored.Get("key2")
+	assertEqual(t, ErrEntryNotFound, err)
+}
+
+func TestSnapshotStopsAtTruncatedTail(t *testing.T) {
+	t.Parallel()
+
+	// given
+	config := DefaultConfig(time.Minute)
+	config.Shards = 1
+	cache, _ := New(context.Background(), config)
+	defer cache.Close()
+	cache.Set("key", []byte("value"))
+	var buf bytes.Buffer
+	cache.WriteShardTo(0, &buf)
+	snapshot := buf.Bytes()[:buf.Len()-snapshotRecordHeaderSize-2]
+
+	// when
+	restored, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer restored.Close()
+	_, strictErr := restored.RestoreShardFrom(0, bytes.NewReader(snapshot), RestoreOptions{})
+	report, err := restored.RestoreShardFrom(0, bytes.NewReader(snapshot), RestoreOptions{SkipCorrupted: true})
+
+	// then
+	assertEqual(t, io.ErrUnexpectedEOF, strictErr)
+	noError(t, err)
+	assertEqual(t, 0, report.Restored)
+	assertEqual(t, int64(len(snapshot)-snapshotHeaderSize-snapshotUnitSize), report.DiscardedBytes)
+	assertEqual(t, "truncated record", report.Damages[0].Reason)
+}
+
+func TestSnapshotResumesAfterDamagedShard(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 100,
+		MaxEntrySize:       256,
+	})
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)))
+	}
+	var buf bytes.Buffer
+	cache.WriteTo(&buf)
+	snapshot := buf.Bytes()
+	// the size of the first record of the first shard no longer matches its checksum
+	snapshot[4+snapshotHeaderSize+snapshotUnitSize] ^= 0xFF
+
+	// when
+	restored, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer restored.Close()
+	_, strictErr := restored.RestoreFrom(bytes.NewReader(snapshot), RestoreOptions{})
+	restored.Reset()
+	report, err := restored.RestoreFrom(bytes.NewReader(snapshot), RestoreOptions{SkipCorrupted: true})
+
+	// then
+	assertEqual(t, ErrInvalidSnapshot, strictErr)
+	noError(t, err)
+	assertEqual(t, 100-cache.shards[0].len(), report.Restored)
+	assertEqual(t, 100-cache.shards[0].len(), restored.Len())
+	assertEqual(t, int64(len(snapshot)), report.BytesRead)
+	assertEqual(t, []SnapshotDamage{{Shard: 0, Offset: 4 + snapshotHeaderSize + snapshotUnitSize, Reason: "record header checksum mismatch"}}, report.Damages)
+}
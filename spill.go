@@ -0,0 +1,185 @@
+package bigcache
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	defaultSpillQueueSize = 1024
+	// spillHeaderSize is the size of the timestamp stored in front of every spilled entry
+	spillHeaderSize = 8
+)
+
+// SpillStore is a secondary store, e.g. on disk, which keeps entries evicted from the cache for space,
+// see Config.SpillStore. Implementations must be safe for concurrent use, package spill provides one
+// backed by a log-structured file.
+type SpillStore interface {
+	// Get returns the value stored for the key, ErrEntryNotFound when there is none
+	Get(key string) ([]byte, error)
+	// Set stores the value for the key, replacing the previous one
+	Set(key string, value []byte) error
+	// Delete removes the value of the key, it is not an error when there is none
+	Delete(key string) error
+}
+
+// spilledEntry is an evicted entry waiting to be written to the store
+type spilledEntry struct {
+	key   string
+	value []byte
+}
+
+// spiller writes entries evicted for space to Config.SpillStore on a single worker, so the last eviction
+// of a key is written last, and reads them back on misses
+type spiller struct {
+	// spilled, hits, dropped and failed are accessed atomically, they come first to be 64-bit aligned
+	// on 32-bit platforms
+	spilled int64
+	hits    int64
+	dropped int64
+	failed  int64
+	store   SpillStore
+	entries chan *spilledEntry
+	logger  Logger
+	verbose bool
+
+	// storeLock orders writes of the worker with deletes, so a deleted key is not written back
+	storeLock sync.Mutex
+	// pending holds entries which are queued and not written yet, they are read from it on misses
+	pendingLock sync.Mutex
+	pending     map[string]*spilledEntry
+}
+
+func newSpiller(config Config) *spiller {
+	return &spiller{
+		store:   config.SpillStore,
+		entries: make(chan *spilledEntry, config.spillQueueSize()),
+		logger:  newLogger(config.Logger),
+		verbose: config.Verbose,
+		pending: make(map[string]*spilledEntry),
+	}
+}
+
+// stage queues the evicted entry to be written, it is dropped when the queue is full.
+// It is called with the shard lock held, so it never waits for the store.
+func (s *spiller) stage(wrappedEntry []byte) {
+	entry := readEntry(wrappedEntry)
+	value := make([]byte, spillHeaderSize+len(entry))
+	binary.LittleEndian.PutUint64(value, readTimestampFromEntry(wrappedEntry))
+	copy(value[spillHeaderSize:], entry)
+	spilled := &spilledEntry{key: readKeyFromEntry(wrappedEntry), value: value}
+
+	s.pendingLock.Lock()
+	select {
+	case s.entries <- spilled:
+		s.pending[spilled.key] = spilled
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+	s.pendingLock.Unlock()
+}
+
+// work writes queued entries until the cache is closed
+func (s *spiller) work(done <-chan struct{}, close <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-close:
+			return
+		case entry := <-s.entries:
+			s.write(entry)
+		}
+	}
+}
+
+// write stores the entry unless it was deleted or evicted again meanwhile
+func (s *spiller) write(entry *spilledEntry) {
+	s.storeLock.Lock()
+	s.pendingLock.Lock()
+	current := s.pending[entry.key] == entry
+	s.pendingLock.Unlock()
+	if current {
+		if err := s.store.Set(entry.key, entry.value); err != nil {
+			atomic.AddInt64(&s.failed, 1)
+			if s.verbose {
+				s.logger.Printf("Spilling key %q failed: %v", entry.key, err)
+			}
+		} else {
+			atomic.AddInt64(&s.spilled, 1)
+		}
+		s.pendingLock.Lock()
+		if s.pending[entry.key] == entry {
+			delete(s.pending, entry.key)
+		}
+		s.pendingLock.Unlock()
+	}
+	s.storeLock.Unlock()
+}
+
+// get returns the spilled entry of the key with its timestamp
+func (s *spiller) get(key string) ([]byte, uint64, error) {
+	s.pendingLock.Lock()
+	entry, ok := s.pending[key]
+	s.pendingLock.Unlock()
+	var value []byte
+	if ok {
+		value = entry.value
+	} else {
+		var err error
+		if value, err = s.store.Get(key); err != nil {
+			if err != ErrEntryNotFound {
+				atomic.AddInt64(&s.failed, 1)
+			}
+			return nil, 0, ErrEntryNotFound
+		}
+	}
+	if len(value) < spillHeaderSize {
+		atomic.AddInt64(&s.failed, 1)
+		return nil, 0, ErrEntryNotFound
+	}
+	return value[spillHeaderSize:], binary.LittleEndian.Uint64(value), nil
+}
+
+// delete removes the key from the queue and from the store
+func (s *spiller) delete(key string) {
+	s.storeLock.Lock()
+	s.pendingLock.Lock()
+	delete(s.pending, key)
+	s.pendingLock.Unlock()
+	if err := s.store.Delete(key); err != nil {
+		atomic.AddInt64(&s.failed, 1)
+	}
+	s.storeLock.Unlock()
+}
+
+// getSpilled reads the key missed by the shard from the spill store and restores it to the shard
+func (c *BigCache) getSpilled(key string, hashedKey uint64) ([]byte, error) {
+	entry, timestamp, err := c.spiller.get(key)
+	if err != nil {
+		return nil, err
+	}
+	// a read-only cache serves the spilled entry without restoring it
+	if err := c.getShard(hashedKey).restore(key, hashedKey, entry, timestamp); err != nil && err != ErrReadOnly {
+		return nil, c.recoverShard(hashedKey, err)
+	}
+	atomic.AddInt64(&c.spiller.hits, 1)
+	return entry, nil
+}
+
+// restore saves the spilled entry with the timestamp it was written at, so it expires as it would have
+// in the shard. It returns ErrEntryNotFound when the entry expired meanwhile and does not overwrite the key
+// when it was set again.
+func (s *cacheShard) restore(key string, hashedKey uint64, entry []byte, timestamp uint64) error {
+	currentTimestamp := uint64(s.clock.Epoch())
+	s.lock.Lock()
+	var err error
+	if s.lifeWindow != 0 && currentTimestamp > timestamp && currentTimestamp-timestamp > s.lifeWindow {
+		err = ErrEntryNotFound
+	} else if s.hashmap[hashedKey] == 0 {
+		err = s.setWithoutLock(timestamp, key, hashedKey, entry)
+	}
+	s.lock.Unlock()
+	return err
+}
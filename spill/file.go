@@ -0,0 +1,256 @@
+// Package spill provides File, a bigcache.SpillStore keeping entries evicted from the cache in
+// a log-structured file on disk. Sets and deletes are appended to the file and an index of keys
+// is kept in memory. When the file grows beyond MaxSize it is compacted: the oldest records are
+// dropped until live ones take at most half of MaxSize, the rest is rewritten to a new file.
+// The index is rebuilt from the file by Open, so spilled entries survive restarts.
+package spill
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+const (
+	// recordHeaderSize is the size of the checksum, key length and value length of a record
+	recordHeaderSize = 12
+	// tombstone is the value length of a record deleting the key
+	tombstone = math.MaxUint32
+)
+
+var (
+	// ErrEntryTooBig is returned when the record of the entry takes more than half of MaxSize
+	ErrEntryTooBig = errors.New("spill: entry is bigger than half of MaxSize")
+	// ErrCorruptedRecord is returned by Get when the record of the key does not match its checksum
+	ErrCorruptedRecord = errors.New("spill: corrupted record")
+)
+
+// Config of a spill file
+type Config struct {
+	// Path of the file, it is created when missing
+	Path string
+	// MaxSize of the file in bytes, it is compacted when it grows beyond
+	MaxSize int64
+}
+
+var _ bigcache.SpillStore = (*File)(nil)
+
+// File is a spill store in a log-structured file, it is safe for concurrent use
+type File struct {
+	lock    sync.RWMutex
+	file    *os.File
+	path    string
+	maxSize int64
+	index   map[string]record
+	// size of the file and live bytes of records in the index
+	size int64
+	live int64
+}
+
+// record is the location of the latest record of a key
+type record struct {
+	offset int64
+	size   int64
+}
+
+// Open opens the file at config.Path and indexes its records. A truncated or corrupted record at the end,
+// e.g. left by a crash, and everything after it is discarded.
+func Open(config Config) (*File, error) {
+	if config.Path == "" {
+		return nil, errors.New("spill: Path must be set")
+	}
+	if config.MaxSize <= 0 {
+		return nil, errors.New("spill: MaxSize must be > 0")
+	}
+	file, err := os.OpenFile(config.Path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{file: file, path: config.Path, maxSize: config.MaxSize, index: make(map[string]record)}
+	if err := f.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// load indexes records of the file and truncates it after the last valid one
+func (f *File) load() error {
+	reader := bufio.NewReader(io.NewSectionReader(f.file, 0, math.MaxInt64))
+	header := make([]byte, recordHeaderSize)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			break
+		}
+		keyLength := binary.LittleEndian.Uint32(header[4:])
+		valueLength := binary.LittleEndian.Uint32(header[8:])
+		bodyLength := int64(keyLength)
+		if valueLength != tombstone {
+			bodyLength += int64(valueLength)
+		}
+		body := make([]byte, bodyLength)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			break
+		}
+		if checksum(header, body) != binary.LittleEndian.Uint32(header) {
+			break
+		}
+		key := string(body[:keyLength])
+		size := recordHeaderSize + bodyLength
+		f.forget(key)
+		if valueLength != tombstone {
+			f.index[key] = record{offset: f.size, size: size}
+			f.live += size
+		}
+		f.size += size
+	}
+	return f.file.Truncate(f.size)
+}
+
+// Get returns the value of the key, bigcache.ErrEntryNotFound when it is not stored
+func (f *File) Get(key string) ([]byte, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	r, ok := f.index[key]
+	if !ok {
+		return nil, bigcache.ErrEntryNotFound
+	}
+	buffer := make([]byte, r.size)
+	if _, err := f.file.ReadAt(buffer, r.offset); err != nil {
+		return nil, err
+	}
+	header, body := buffer[:recordHeaderSize], buffer[recordHeaderSize:]
+	if checksum(header, body) != binary.LittleEndian.Uint32(header) {
+		return nil, ErrCorruptedRecord
+	}
+	return body[len(key):], nil
+}
+
+// Set appends the record of the value, compacting the file when it grows beyond MaxSize
+func (f *File) Set(key string, value []byte) error {
+	size := int64(recordHeaderSize + len(key) + len(value))
+	if size > f.maxSize/2 {
+		return ErrEntryTooBig
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.append(key, value, uint32(len(value))); err != nil {
+		return err
+	}
+	f.forget(key)
+	f.index[key] = record{offset: f.size - size, size: size}
+	f.live += size
+	if f.size > f.maxSize {
+		return f.compact()
+	}
+	return nil
+}
+
+// Delete appends a tombstone of the key when it is stored
+func (f *File) Delete(key string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if _, ok := f.index[key]; !ok {
+		return nil
+	}
+	if err := f.append(key, nil, tombstone); err != nil {
+		return err
+	}
+	f.forget(key)
+	if f.size > f.maxSize {
+		return f.compact()
+	}
+	return nil
+}
+
+// Len returns the number of stored keys
+func (f *File) Len() int {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return len(f.index)
+}
+
+// Close closes the file, records are kept on disk
+func (f *File) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.file.Close()
+}
+
+// append writes the record at the end of the file
+func (f *File) append(key string, value []byte, valueLength uint32) error {
+	buffer := make([]byte, recordHeaderSize+len(key)+len(value))
+	binary.LittleEndian.PutUint32(buffer[4:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(buffer[8:], valueLength)
+	copy(buffer[recordHeaderSize:], key)
+	copy(buffer[recordHeaderSize+len(key):], value)
+	binary.LittleEndian.PutUint32(buffer, checksum(buffer[:recordHeaderSize], buffer[recordHeaderSize:]))
+	if _, err := f.file.WriteAt(buffer, f.size); err != nil {
+		return err
+	}
+	f.size += int64(len(buffer))
+	return nil
+}
+
+// forget removes the key from the index
+func (f *File) forget(key string) {
+	if r, ok := f.index[key]; ok {
+		f.live -= r.size
+		delete(f.index, key)
+	}
+}
+
+// compact drops the oldest records until live ones take at most half of MaxSize
+// and rewrites them to a new file which replaces the current one
+func (f *File) compact() error {
+	keys := make([]string, 0, len(f.index))
+	for key := range f.index {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return f.index[keys[i]].offset < f.index[keys[j]].offset })
+	for len(keys) > 0 && f.live > f.maxSize/2 {
+		f.forget(keys[0])
+		keys = keys[1:]
+	}
+
+	compacted, err := os.OpenFile(f.path+".compact", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	index := make(map[string]record, len(keys))
+	writer := bufio.NewWriter(compacted)
+	var size int64
+	for _, key := range keys {
+		r := f.index[key]
+		if _, err := io.Copy(writer, io.NewSectionReader(f.file, r.offset, r.size)); err != nil {
+			compacted.Close()
+			return err
+		}
+		index[key] = record{offset: size, size: r.size}
+		size += r.size
+	}
+	if err := writer.Flush(); err != nil {
+		compacted.Close()
+		return err
+	}
+	if err := os.Rename(compacted.Name(), f.path); err != nil {
+		compacted.Close()
+		return err
+	}
+	f.file.Close()
+	f.file, f.index, f.size = compacted, index, size
+	return nil
+}
+
+func checksum(header []byte, body []byte) uint32 {
+	crc := crc32.ChecksumIEEE(header[4:])
+	return crc32.Update(crc, crc32.IEEETable, body)
+}
@@ -0,0 +1,122 @@
+package spill
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+func open(t *testing.T, config Config) *File {
+	f, err := Open(config)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestSetGetDelete(t *testing.T) {
+	t.Parallel()
+
+	// given
+	f := open(t, Config{Path: filepath.Join(t.TempDir(), "spill"), MaxSize: 1 << 20})
+
+	// when
+	f.Set("key", []byte("first"))
+	f.Set("key", []byte("second"))
+	f.Set("other", []byte("value"))
+	f.Delete("other")
+	value, err := f.Get("key")
+	_, deletedErr := f.Get("other")
+
+	// then
+	if err != nil || string(value) != "second" {
+		t.Errorf("Get() = %q, %v, want second", value, err)
+	}
+	if deletedErr != bigcache.ErrEntryNotFound {
+		t.Errorf("Get() of deleted key error = %v, want ErrEntryNotFound", deletedErr)
+	}
+	if f.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", f.Len())
+	}
+}
+
+func TestOpenRestoresRecordsAndDiscardsTornTail(t *testing.T) {
+	t.Parallel()
+
+	// given
+	config := Config{Path: filepath.Join(t.TempDir(), "spill"), MaxSize: 1 << 20}
+	f := open(t, config)
+	f.Set("key", []byte("value"))
+	f.Set("deleted", []byte("value"))
+	f.Delete("deleted")
+	f.Close()
+	file, _ := os.OpenFile(config.Path, os.O_WRONLY|os.O_APPEND, 0600)
+	file.Write([]byte{1, 2, 3, 4, 5})
+	file.Close()
+
+	// when
+	reopened := open(t, config)
+	value, err := reopened.Get("key")
+	reopened.Set("next", []byte("value"))
+	next, nextErr := reopened.Get("next")
+
+	// then
+	if err != nil || string(value) != "value" {
+		t.Errorf("Get() = %q, %v, want value", value, err)
+	}
+	if nextErr != nil || string(next) != "value" {
+		t.Errorf("Get() of key set after reopen = %q, %v, want value", next, nextErr)
+	}
+	if reopened.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", reopened.Len())
+	}
+}
+
+func TestCompactionDropsOldestRecords(t *testing.T) {
+	t.Parallel()
+
+	// given
+	config := Config{Path: filepath.Join(t.TempDir(), "spill"), MaxSize: 4096}
+	f := open(t, config)
+
+	// when
+	for i := 0; i < 100; i++ {
+		if err := f.Set(strconv.Itoa(i), make([]byte, 100)); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+
+	// then
+	info, _ := os.Stat(config.Path)
+	if info.Size() > config.MaxSize {
+		t.Errorf("file size = %d, want at most %d", info.Size(), config.MaxSize)
+	}
+	if _, err := f.Get("0"); err != bigcache.ErrEntryNotFound {
+		t.Errorf("Get() of the oldest key error = %v, want ErrEntryNotFound", err)
+	}
+	if value, err := f.Get("99"); err != nil || len(value) != 100 {
+		t.Errorf("Get() of the newest key = %d bytes, %v, want 100 bytes", len(value), err)
+	}
+	if reopened := open(t, config); reopened.Len() != f.Len() {
+		t.Errorf("Len() after reopen = %d, want %d", reopened.Len(), f.Len())
+	}
+}
+
+func TestSetRejectsEntryBiggerThanHalfOfMaxSize(t *testing.T) {
+	t.Parallel()
+
+	// given
+	f := open(t, Config{Path: filepath.Join(t.TempDir(), "spill"), MaxSize: 1024})
+
+	// when
+	err := f.Set("key", make([]byte, 1024))
+
+	// then
+	if err != ErrEntryTooBig {
+		t.Errorf("Set() error = %v, want ErrEntryTooBig", err)
+	}
+}
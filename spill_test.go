@@ -0,0 +1,115 @@
+package bigcache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mapSpillStore struct {
+	lock    sync.Mutex
+	entries map[string][]byte
+}
+
+func newMapSpillStore() *mapSpillStore {
+	return &mapSpillStore{entries: make(map[string][]byte)}
+}
+
+func (s *mapSpillStore) Get(key string) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if value, ok := s.entries[key]; ok {
+		return value, nil
+	}
+	return nil, ErrEntryNotFound
+}
+
+func (s *mapSpillStore) Set(key string, value []byte) error {
+	s.lock.Lock()
+	s.entries[key] = value
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *mapSpillStore) Delete(key string) error {
+	s.lock.Lock()
+	delete(s.entries, key)
+	s.lock.Unlock()
+	return nil
+}
+
+func newSpillingCache(t *testing.T, clock clock) (*BigCache, *mapSpillStore) {
+	store := newMapSpillStore()
+	cache, err := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 4,
+		MaxEntrySize:       256 * 1024,
+		HardMaxCacheSize:   1,
+		SpillStore:         store,
+	}, clock)
+	noError(t, err)
+	t.Cleanup(func() { cache.Close() })
+	return cache, store
+}
+
+func TestEvictedEntriesAreSpilledAndRestoredOnMiss(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := newSpillingCache(t, &systemClock{})
+	cache.Set("spilled", blob('a', 400*1024))
+	cache.Set("second", blob('b', 400*1024))
+	cache.Set("third", blob('c', 400*1024))
+	waitFor(t, func() bool { return cache.Stats().Spilled == 2 })
+
+	// when
+	entry, err := cache.Get("spilled")
+
+	// then
+	noError(t, err)
+	assertEqual(t, blob('a', 400*1024), entry)
+	assertEqual(t, int64(1), cache.Stats().SpillHits)
+}
+
+func TestExpiredSpilledEntriesAreNotRestored(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	cache, _ := newSpillingCache(t, &clock)
+	cache.Set("spilled", blob('a', 400*1024))
+	cache.Set("second", blob('b', 400*1024))
+	cache.Set("third", blob('c', 400*1024))
+	waitFor(t, func() bool { return cache.Stats().Spilled == 2 })
+
+	// when
+	clock.set(61)
+	_, err := cache.Get("spilled")
+
+	// then
+	assertEqual(t, ErrEntryNotFound, err)
+	assertEqual(t, int64(0), cache.Stats().SpillHits)
+}
+
+func TestDeleteRemovesSpilledEntries(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, store := newSpillingCache(t, &systemClock{})
+	cache.Set("spilled", blob('a', 400*1024))
+	cache.Set("second", blob('b', 400*1024))
+	cache.Set("third", blob('c', 400*1024))
+	waitFor(t, func() bool { return cache.Stats().Spilled == 2 })
+
+	// when
+	err := cache.Delete("spilled")
+	_, getErr := cache.Get("spilled")
+
+	// then
+	noError(t, err)
+	assertEqual(t, ErrEntryNotFound, getErr)
+	_, storeErr := store.Get("spilled")
+	assertEqual(t, ErrEntryNotFound, storeErr)
+}
@@ -0,0 +1,136 @@
+// Package sqlcache caches results of database/sql queries in BigCache.
+package sqlcache
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/gob"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+func init() {
+	// values returned by drivers besides the basic types registered by gob
+	gob.Register(time.Time{})
+}
+
+// DB runs queries, it is implemented by *sql.DB, *sql.Tx and *sql.Conn
+type DB interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Result holds rows read by a query. Values are stored as returned by the driver: nil, int64, float64,
+// bool, []byte, string or time.Time.
+type Result struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// Cache caches results of queries keyed by the normalized query and its arguments
+type Cache struct {
+	// generation is a part of every key, changing it invalidates all cached results at once.
+	// It is accessed atomically and comes first to be 64-bit aligned on 32-bit platforms.
+	generation uint64
+	cache      *bigcache.BigCache
+	db         DB
+	ttl        time.Duration
+	// OnInvalidate is called after cached results were invalidated, e.g. to invalidate other instances.
+	// query is empty when all results were invalidated.
+	OnInvalidate func(query string, args []interface{})
+}
+
+// New returns cache of query results of db, zero ttl means the lifetime of the cache
+func New(cache *bigcache.BigCache, db DB, ttl time.Duration) *Cache {
+	return &Cache{cache: cache, db: db, ttl: ttl}
+}
+
+// Query returns result of the query, reading it from the database only when it is not cached
+func (c *Cache) Query(ctx context.Context, query string, args ...interface{}) (*Result, error) {
+	key := c.key(query, args)
+	if entry, err := c.cache.Get(key); err == nil {
+		var result Result
+		if gob.NewDecoder(bytes.NewReader(entry)).Decode(&result) == nil {
+			return &result, nil
+		}
+	}
+
+	result, err := c.query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if gob.NewEncoder(&buf).Encode(result) == nil && c.cache.Set(key, buf.Bytes()) == nil && c.ttl > 0 {
+		c.cache.Expire(key, c.ttl)
+	}
+	return result, nil
+}
+
+// Exec runs a statement modifying the database and invalidates all cached results when it succeeds
+func (c *Cache) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	result, err := c.db.ExecContext(ctx, query, args...)
+	if err == nil {
+		c.InvalidateAll()
+	}
+	return result, err
+}
+
+// Invalidate removes cached result of the query
+func (c *Cache) Invalidate(query string, args ...interface{}) {
+	c.cache.Delete(c.key(query, args))
+	if c.OnInvalidate != nil {
+		c.OnInvalidate(query, args)
+	}
+}
+
+// InvalidateAll makes all cached results stale, they are evicted from the cache once they expire
+func (c *Cache) InvalidateAll() {
+	atomic.AddUint64(&c.generation, 1)
+	if c.OnInvalidate != nil {
+		c.OnInvalidate("", nil)
+	}
+}
+
+func (c *Cache) query(ctx context.Context, query string, args []interface{}) (*Result, error) {
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &Result{}
+	if result.Columns, err = rows.Columns(); err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		row := make([]interface{}, len(result.Columns))
+		dest := make([]interface{}, len(row))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, rows.Err()
+}
+
+// key returns cache key of the query with whitespace collapsed and typed arguments
+func (c *Cache) key(query string, args []interface{}) string {
+	var b strings.Builder
+	b.WriteString("sql:")
+	b.WriteString(strconv.FormatUint(atomic.LoadUint64(&c.generation), 10))
+	b.WriteByte(0)
+	b.WriteString(strings.Join(strings.Fields(query), " "))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "\x00%T:%v", arg, arg)
+	}
+	return b.String()
+}
@@ -0,0 +1,101 @@
+package sqlcache
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+// queries counts queries run by testDriver
+var queries int32
+
+// testDriver answers every query with a single row holding the query argument and its name
+type testDriver struct{}
+
+func (testDriver) Open(name string) (driver.Conn, error) { return testConn{}, nil }
+
+type testConn struct{}
+
+func (testConn) Prepare(query string) (driver.Stmt, error) { return testStmt{}, nil }
+func (testConn) Close() error                              { return nil }
+func (testConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+type testStmt struct{}
+
+func (testStmt) Close() error  { return nil }
+func (testStmt) NumInput() int { return -1 }
+func (testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+func (testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	atomic.AddInt32(&queries, 1)
+	return &testRows{values: []driver.Value{args[0], []byte("name"), time.Unix(0, 0).UTC()}}, nil
+}
+
+type testRows struct {
+	values []driver.Value
+	read   bool
+}
+
+func (r *testRows) Columns() []string { return []string{"id", "name", "created"} }
+func (r *testRows) Close() error      { return nil }
+func (r *testRows) Next(dest []driver.Value) error {
+	if r.read {
+		return io.EOF
+	}
+	r.read = true
+	copy(dest, r.values)
+	return nil
+}
+
+func init() {
+	sql.Register("sqlcache-test", testDriver{})
+}
+
+func TestQueryCachesResults(t *testing.T) {
+	db, _ := sql.Open("sqlcache-test", "")
+	defer db.Close()
+	cache, _ := bigcache.New(context.Background(), bigcache.DefaultConfig(time.Minute))
+	results := New(cache, db, 10*time.Second)
+	var invalidated []string
+	results.OnInvalidate = func(query string, args []interface{}) {
+		invalidated = append(invalidated, query)
+	}
+	start := atomic.LoadInt32(&queries)
+
+	first, err := results.Query(context.Background(), "SELECT * FROM users WHERE id = ?", int64(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := results.Query(context.Background(), "SELECT *\n\tFROM users  WHERE id = ?", int64(1))
+	results.Query(context.Background(), "SELECT * FROM users WHERE id = ?", int64(2))
+
+	if got := atomic.LoadInt32(&queries) - start; got != 2 {
+		t.Errorf("want 2 queries; got: %d", got)
+	}
+	if len(second.Rows) != 1 || second.Rows[0][0] != int64(1) || string(second.Rows[0][1].([]byte)) != "name" ||
+		!second.Rows[0][2].(time.Time).Equal(time.Unix(0, 0)) {
+		t.Errorf("cached result does not match the read one: %v and %v", first.Rows, second.Rows)
+	}
+	if len(second.Columns) != 3 || second.Columns[1] != "name" {
+		t.Errorf("want columns id, name, created; got: %v", second.Columns)
+	}
+
+	results.Invalidate("SELECT * FROM users WHERE id = ?", int64(1))
+	results.Query(context.Background(), "SELECT * FROM users WHERE id = ?", int64(1))
+	results.Exec(context.Background(), "DELETE FROM users")
+	results.Query(context.Background(), "SELECT * FROM users WHERE id = ?", int64(2))
+
+	if got := atomic.LoadInt32(&queries) - start; got != 4 {
+		t.Errorf("want 4 queries after invalidation; got: %d", got)
+	}
+	if len(invalidated) != 2 || invalidated[1] != "" {
+		t.Errorf("want invalidation of the query and all results; got: %q", invalidated)
+	}
+}
@@ -1,6 +1,10 @@
 package bigcache
 
-// Stats stores cache statistics
+import "time"
+
+// Stats stores cache statistics. Counters grow until ResetStats is called, use Sub to get their change
+// over an interval. UsedBytes, DeadBytes, OverheadBytes, KeyStoreBytes, Fragmentation, InitialSizeExceeded,
+// MaxCleanUpTime, ExpiringEntries and ExpiringBytes describe the current state instead.
 type Stats struct {
 	// Hits is a number of successfully found keys
 	Hits int64 `json:"hits"`
@@ -12,4 +16,160 @@ type Stats struct {
 	DelMisses int64 `json:"delete_misses"`
 	// Collisions is a number of happened key-collisions
 	Collisions int64 `json:"collisions"`
+	// Evictions is a number of entries removed because there was no space left for new ones
+	Evictions int64 `json:"evictions"`
+	// LazyExpirations is a number of reads which found entries expired but not yet removed, counted with ExpireOnGet
+	LazyExpirations int64 `json:"lazy_expirations"`
+	// LockTimeouts is a number of Gets and Sets which returned ErrLockTimeout, see Config.LockTimeout
+	LockTimeouts int64 `json:"lock_timeouts"`
+	// Migrations is a number of entries of other value versions migrated by Config.ValueMigrator on Get
+	Migrations int64 `json:"migrations"`
+	// MigrationErrors is a number of entries removed because Config.ValueMigrator failed to migrate them
+	MigrationErrors int64 `json:"migration_errors"`
+	// Sets is a number of entries written, by Set as well as by other writes like Append or Update
+	Sets int64 `json:"sets"`
+	// BytesWritten is a number of bytes of values of written entries
+	BytesWritten int64 `json:"bytes_written"`
+	// BytesRead is a number of bytes of values returned for found keys
+	BytesRead int64 `json:"bytes_read"`
+	// QueueResizes is a number of times queues of shards grew or shrank
+	QueueResizes int64 `json:"queue_resizes"`
+	// ShedWrites is a number of low priority writes dropped with ErrWriteShed under overload
+	ShedWrites int64 `json:"shed_writes"`
+	// ExpiryOverflows is a number of expiry events dropped because the buffer of Config.ExpiryBufferSize was full
+	ExpiryOverflows int64 `json:"expiry_overflows"`
+	// DroppedCallbacks is a number of removal callbacks skipped because the queue of Config.OnRemoveWorkers was full
+	DroppedCallbacks int64 `json:"dropped_callbacks"`
+	// PrefetchDropped is a number of keys passed to Prefetch which were dropped because its queue was full
+	PrefetchDropped int64 `json:"prefetch_dropped"`
+	// PrefetchErrors is a number of keys passed to Prefetch which failed to load or to be saved
+	PrefetchErrors int64 `json:"prefetch_errors"`
+	// Spilled is a number of entries evicted for space which were written to Config.SpillStore
+	Spilled int64 `json:"spilled"`
+	// SpillHits is a number of missed keys which were read from Config.SpillStore and restored
+	SpillHits int64 `json:"spill_hits"`
+	// SpillDropped is a number of evicted entries not written to Config.SpillStore because its queue was full
+	SpillDropped int64 `json:"spill_dropped"`
+	// SpillErrors is a number of failed reads, writes and deletes of Config.SpillStore
+	SpillErrors int64 `json:"spill_errors"`
+	// CleanUps is a number of clean ups of shards, run every CleanWindow
+	CleanUps int64 `json:"clean_ups"`
+	// CleanUpYields is a number of clean ups of shards stopped by Config.MaxCleanupPause
+	CleanUpYields int64 `json:"clean_up_yields"`
+	// CleanUpTime is the total time clean ups held shard locks, MaxCleanUpTime the longest of them
+	CleanUpTime    time.Duration `json:"clean_up_time"`
+	MaxCleanUpTime time.Duration `json:"max_clean_up_time"`
+	// InitialSizeExceeded is a number of shards which queues grew to more than twice their initial size,
+	// it signals that InitialShardBytes or MaxEntriesInWindow and MaxEntrySize are set too low
+	InitialSizeExceeded int64 `json:"initial_size_exceeded"`
+	// KeyStoreBytes is an estimate of bytes taken by keys kept apart from entries with Config.SeparateKeyStore
+	KeyStoreBytes int64 `json:"key_store_bytes"`
+	// UsedBytes is a number of bytes taken by entries in queues of all shards
+	UsedBytes int64 `json:"used_bytes"`
+	// DeadBytes is a number of bytes taken by deleted and overwritten entries which are not reclaimed yet
+	DeadBytes int64 `json:"dead_bytes"`
+	// OverheadBytes is a number of bytes taken by headers of live entries and padding of queues
+	OverheadBytes int64 `json:"overhead_bytes"`
+	// Fragmentation is the fraction of used bytes not taken by keys and values of live entries.
+	// High fragmentation with many dead bytes signals that defragmentation would pay off.
+	Fragmentation float64 `json:"fragmentation"`
+	// ExpiringEntries estimates numbers of entries expiring within horizons of ExpiryForecastBuckets
+	// and ExpiringBytes their bytes, they are counted with Config.ExpiryForecast
+	ExpiringEntries [len(ExpiryForecastBuckets)]int64 `json:"expiring_entries"`
+	ExpiringBytes   [len(ExpiryForecastBuckets)]int64 `json:"expiring_bytes"`
+}
+
+// Sub returns the change of counters since prev, e.g. Stats() taken a minute earlier, to export rates
+// to logs or dashboards. Fields describing the current state are copied from s.
+func (s Stats) Sub(prev Stats) Stats {
+	s.Hits -= prev.Hits
+	s.Misses -= prev.Misses
+	s.DelHits -= prev.DelHits
+	s.DelMisses -= prev.DelMisses
+	s.Collisions -= prev.Collisions
+	s.Evictions -= prev.Evictions
+	s.LazyExpirations -= prev.LazyExpirations
+	s.LockTimeouts -= prev.LockTimeouts
+	s.Migrations -= prev.Migrations
+	s.MigrationErrors -= prev.MigrationErrors
+	s.Sets -= prev.Sets
+	s.BytesWritten -= prev.BytesWritten
+	s.BytesRead -= prev.BytesRead
+	s.QueueResizes -= prev.QueueResizes
+	s.ShedWrites -= prev.ShedWrites
+	s.ExpiryOverflows -= prev.ExpiryOverflows
+	s.DroppedCallbacks -= prev.DroppedCallbacks
+	s.PrefetchDropped -= prev.PrefetchDropped
+	s.PrefetchErrors -= prev.PrefetchErrors
+	s.Spilled -= prev.Spilled
+	s.SpillHits -= prev.SpillHits
+	s.SpillDropped -= prev.SpillDropped
+	s.SpillErrors -= prev.SpillErrors
+	s.CleanUps -= prev.CleanUps
+	s.CleanUpYields -= prev.CleanUpYields
+	s.CleanUpTime -= prev.CleanUpTime
+	return s
+}
+
+// ShardStats stores statistics of a single shard
+type ShardStats struct {
+	// Entries is a number of entries in the shard
+	Entries int `json:"entries"`
+	// Capacity is a number of bytes allocated for entries of the shard
+	Capacity int `json:"capacity"`
+	// UsedBytes is a number of bytes taken by entries in the queue of the shard
+	UsedBytes int `json:"used_bytes"`
+	// FreeBytes is a number of bytes new entries can take before the queue of the shard grows,
+	// with TimeSegments it and positions in the queue below describe the segment new entries are written to
+	FreeBytes int `json:"free_bytes"`
+	// RightMargin is the index entries end at before the queue wraps to its beginning
+	RightMargin int `json:"right_margin"`
+	// Head is the index of the oldest entry in the queue, entries are evicted from it
+	Head int `json:"head"`
+	// Tail is the index new entries are written at, when an entry does not fit after it the queue wraps or grows
+	Tail int `json:"tail"`
+	// Wraps is a number of times new entries started to be written at the beginning of the queue
+	Wraps int `json:"wraps"`
+	// DeadBytes is a number of bytes taken by deleted and overwritten entries which are not reclaimed yet
+	DeadBytes int `json:"dead_bytes"`
+	// OverheadBytes is a number of bytes taken by headers of live entries and padding of the queue
+	OverheadBytes int `json:"overhead_bytes"`
+	// Fragmentation is the fraction of used bytes not taken by keys and values of live entries
+	Fragmentation float64 `json:"fragmentation"`
+	// CleanUps is a number of clean ups of the shard, run every CleanWindow
+	CleanUps int64 `json:"clean_ups"`
+	// CleanUpTime is the total time clean ups held the shard lock, MaxCleanUpTime the longest of them
+	CleanUpTime    time.Duration `json:"clean_up_time"`
+	MaxCleanUpTime time.Duration `json:"max_clean_up_time"`
+	// CleanUpYields is a number of clean ups stopped before removing all expired entries by Config.MaxCleanupPause
+	CleanUpYields int64 `json:"clean_up_yields"`
+	// LockAcquisitions is a number of times the shard lock was acquired, counted with LockStatsEnabled
+	LockAcquisitions int64 `json:"lock_acquisitions"`
+	// LockWaitTime is the total time spent waiting for the shard lock, measured with LockStatsEnabled
+	LockWaitTime time.Duration `json:"lock_wait_time"`
+	// LockWaitHistogram counts lock acquisitions by their wait time in buckets bounded by LockWaitBuckets
+	LockWaitHistogram [len(LockWaitBuckets) + 1]int64 `json:"lock_wait_histogram"`
+}
+
+// SegmentStats stores statistics of segmented eviction policies.
+// For ARC the probation segment holds recently read entries and the protected one frequently read entries.
+type SegmentStats struct {
+	// ProbationEntries is a number of entries in the probation segment
+	ProbationEntries int64 `json:"probation_entries"`
+	// ProtectedEntries is a number of entries in the protected segment
+	ProtectedEntries int64 `json:"protected_entries"`
+	// GhostEntries is a number of remembered keys of evicted entries
+	GhostEntries int64 `json:"ghost_entries"`
+	// Promotions is a number of entries moved from probation to protected segment
+	Promotions int64 `json:"promotions"`
+	// Demotions is a number of entries moved from protected to probation segment
+	Demotions int64 `json:"demotions"`
+}
+
+// fragmentation returns the fraction of used bytes which are wasted
+func fragmentation(used, dead, overhead int64) float64 {
+	if used == 0 {
+		return 0
+	}
+	return float64(dead+overhead) / float64(used)
 }
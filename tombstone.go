@@ -0,0 +1,53 @@
+package bigcache
+
+const minimumTombstonesPrune = 64 // Number of tombstones from which they are pruned on soft delete
+
+func (s *cacheShard) softDelete(key string, hashedKey uint64) error {
+	currentTimestamp := uint64(s.clock.Epoch())
+
+	s.lock.Lock()
+	removed := false
+	if itemIndex := s.hashmap[hashedKey]; itemIndex != 0 {
+		if wrappedEntry, err := s.entries.Get(int(itemIndex)); err == nil && compareKeyFromEntry(wrappedEntry, key) {
+			s.delWithoutLock(hashedKey, wrappedEntry)
+			removed = true
+		}
+	}
+
+	if s.tombstones == nil {
+		s.tombstones = make(map[uint64]uint64)
+	}
+	s.tombstones[hashedKey] = currentTimestamp + s.tombstoneTTL
+	// without clean up tombstones are pruned every time their number doubles
+	if !s.cleanEnabled && len(s.tombstones) >= max(s.tombstonesPruneAt, minimumTombstonesPrune) {
+		s.pruneTombstones(currentTimestamp)
+		s.tombstonesPruneAt = 2 * len(s.tombstones)
+	}
+	s.lock.Unlock()
+
+	if removed {
+		s.delhit()
+	} else {
+		s.delmiss()
+	}
+	return nil
+}
+
+// isTombstoned reports whether the key was soft deleted and its tombstone did not expire yet.
+// It has to be called with the lock held.
+func (s *cacheShard) isTombstoned(hashedKey uint64) bool {
+	if s.tombstones == nil {
+		return false
+	}
+	expiresAt, ok := s.tombstones[hashedKey]
+	return ok && uint64(s.clock.Epoch()) < expiresAt
+}
+
+// pruneTombstones removes expired tombstones, it has to be called with the write lock held
+func (s *cacheShard) pruneTombstones(currentTimestamp uint64) {
+	for hashedKey, expiresAt := range s.tombstones {
+		if currentTimestamp >= expiresAt {
+			delete(s.tombstones, hashedKey)
+		}
+	}
+}
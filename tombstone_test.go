@@ -0,0 +1,97 @@
+package bigcache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSoftDelete(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		TombstoneTTL:       5 * time.Second,
+	}, &clock)
+	cache.Set("key", []byte("value"))
+
+	// when
+	err := cache.SoftDelete("key")
+
+	// then
+	noError(t, err)
+	assertEqual(t, 0, cache.Len())
+	_, err = cache.Get("key")
+	assertEqual(t, ErrEntryDeleted, err)
+	_, err = cache.Get("other")
+	assertEqual(t, ErrEntryNotFound, err)
+	assertEqual(t, ErrEntryDeleted, cache.Append("key", []byte("value")))
+	entries, err := cache.GetMulti([]string{"key"})
+	noError(t, err)
+	assertEqual(t, [][]byte{nil}, entries)
+
+	// when
+	clock.set(5)
+
+	// then
+	_, err = cache.Get("key")
+	assertEqual(t, ErrEntryNotFound, err)
+}
+
+func TestSetAfterSoftDelete(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+	})
+	cache.SoftDelete("key")
+
+	// when
+	cache.Set("key", []byte("value"))
+
+	// then
+	value, err := cache.Get("key")
+	noError(t, err)
+	assertEqual(t, []byte("value"), value)
+}
+
+func TestTombstonesArePruned(t *testing.T) {
+	t.Parallel()
+
+	// given
+	clock := mockedClock{value: 0}
+	cache, _ := newBigCache(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		TombstoneTTL:       time.Second,
+	}, &clock)
+	for i := 0; i < minimumTombstonesPrune-1; i++ {
+		cache.SoftDelete(fmt.Sprintf("key%d", i))
+	}
+
+	// when
+	clock.set(1)
+	cache.SoftDelete("last")
+
+	// then
+	assertEqual(t, 1, len(cache.shards[0].tombstones))
+
+	// when
+	clock.set(2)
+	cache.cleanUp(2)
+
+	// then
+	assertEqual(t, 0, len(cache.shards[0].tombstones))
+}
@@ -0,0 +1,238 @@
+// Package trace records cache operations in a compact binary trace and replays them,
+// to reproduce production-only performance anomalies in benchmarks. Traces keep hashes of keys
+// and sizes of values, never the keys or values themselves.
+package trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+// Op is a type of traced operation
+type Op byte
+
+const (
+	// Get reads an entry, size of a missed entry is zero
+	Get = Op(1)
+	// Set writes an entry
+	Set = Op(2)
+	// Delete removes an entry
+	Delete = Op(3)
+)
+
+const (
+	magic = "BCTRACE1"
+	// maxRecordSize is the size of the longest record: time delta, op, hash and size
+	maxRecordSize = binary.MaxVarintLen64 + 1 + 8 + binary.MaxVarintLen64
+)
+
+// ErrInvalidTrace is returned when the stream is not a trace or a record is malformed
+var ErrInvalidTrace = errors.New("invalid trace")
+
+// Record is a single traced operation
+type Record struct {
+	Time time.Time
+	Op   Op
+	Hash uint64
+	Size int
+}
+
+// Recorder writes records of operations to the writer. Records are buffered, Flush or Close writes them.
+// Every record takes about 12 bytes, as time is stored as a delta from the previous record in microseconds.
+type Recorder struct {
+	lock   sync.Mutex
+	writer *bufio.Writer
+	closer io.Closer
+	last   int64 // microseconds since the epoch of the latest record
+	buffer [maxRecordSize]byte
+	err    error
+	now    func() time.Time
+}
+
+// NewRecorder creates recorder writing to w, it is closed with the recorder when it is an io.Closer
+func NewRecorder(w io.Writer) (*Recorder, error) {
+	writer := bufio.NewWriter(w)
+	if _, err := writer.WriteString(magic); err != nil {
+		return nil, err
+	}
+	r := &Recorder{writer: writer, now: time.Now}
+	r.closer, _ = w.(io.Closer)
+	return r, nil
+}
+
+// Middleware records Gets, Sets and Deletes of the wrapped cache
+func (r *Recorder) Middleware() bigcache.Middleware {
+	return func(next bigcache.Interface) bigcache.Interface {
+		return &recordedCache{Interface: next, recorder: r}
+	}
+}
+
+// Record writes the operation of the key, it is safe for concurrent use.
+// Errors are remembered and returned by Flush and Close.
+func (r *Recorder) Record(op Op, key string, size int) {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+	now := r.now()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.err != nil {
+		return
+	}
+	// the first record holds microseconds since the epoch, concurrent records may arrive out of order
+	var delta uint64
+	if micros := now.UnixNano() / int64(time.Microsecond); micros > r.last {
+		delta = uint64(micros - r.last)
+		r.last = micros
+	}
+	n := binary.PutUvarint(r.buffer[:], delta)
+	r.buffer[n] = byte(op)
+	binary.LittleEndian.PutUint64(r.buffer[n+1:], hash.Sum64())
+	n += 9
+	n += binary.PutUvarint(r.buffer[n:], uint64(size))
+	_, r.err = r.writer.Write(r.buffer[:n])
+}
+
+// Flush writes buffered records
+func (r *Recorder) Flush() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.err = r.writer.Flush()
+	return r.err
+}
+
+// Close flushes records and closes the underlying writer
+func (r *Recorder) Close() error {
+	err := r.Flush()
+	if r.closer != nil {
+		if closeErr := r.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+type recordedCache struct {
+	bigcache.Interface
+	recorder *Recorder
+}
+
+func (c *recordedCache) Get(key string) ([]byte, error) {
+	entry, err := c.Interface.Get(key)
+	c.recorder.Record(Get, key, len(entry))
+	return entry, err
+}
+
+func (c *recordedCache) Set(key string, entry []byte) error {
+	c.recorder.Record(Set, key, len(entry))
+	return c.Interface.Set(key, entry)
+}
+
+func (c *recordedCache) Delete(key string) error {
+	c.recorder.Record(Delete, key, 0)
+	return c.Interface.Delete(key)
+}
+
+// Reader reads records of a trace
+type Reader struct {
+	reader *bufio.Reader
+	last   int64
+}
+
+// NewReader checks the header of the trace and returns reader of its records
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := bufio.NewReader(r)
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(reader, header); err != nil || string(header) != magic {
+		return nil, ErrInvalidTrace
+	}
+	return &Reader{reader: reader}, nil
+}
+
+// Next returns the next record, io.EOF is returned at the end of the trace
+func (r *Reader) Next() (Record, error) {
+	delta, err := binary.ReadUvarint(r.reader)
+	if err == io.EOF {
+		return Record{}, io.EOF
+	}
+	if err != nil {
+		return Record{}, ErrInvalidTrace
+	}
+	var fixed [9]byte
+	if _, err := io.ReadFull(r.reader, fixed[:]); err != nil {
+		return Record{}, ErrInvalidTrace
+	}
+	size, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return Record{}, ErrInvalidTrace
+	}
+	op := Op(fixed[0])
+	if op != Get && op != Set && op != Delete {
+		return Record{}, ErrInvalidTrace
+	}
+	r.last += int64(delta)
+	return Record{
+		Time: time.Unix(0, r.last*int64(time.Microsecond)),
+		Op:   op,
+		Hash: binary.LittleEndian.Uint64(fixed[1:]),
+		Size: int(size),
+	}, nil
+}
+
+// Result summarizes a replay
+type Result struct {
+	Gets     int
+	Hits     int
+	Sets     int
+	Deletes  int
+	Duration time.Duration
+}
+
+// Replay feeds records of the trace into the cache as fast as possible. Keys are made of hashes of original keys,
+// values are zeroed bytes of original sizes. Sets of entries bigger than maxSize are skipped when maxSize is positive.
+func Replay(reader *Reader, cache bigcache.Interface, maxSize int) (Result, error) {
+	var result Result
+	var value []byte
+	start := time.Now()
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			result.Duration = time.Since(start)
+			return result, nil
+		}
+		if err != nil {
+			return result, err
+		}
+		key := strconv.FormatUint(record.Hash, 16)
+		switch record.Op {
+		case Get:
+			result.Gets++
+			if _, err := cache.Get(key); err == nil {
+				result.Hits++
+			}
+		case Set:
+			if maxSize > 0 && record.Size > maxSize {
+				continue
+			}
+			result.Sets++
+			if record.Size > len(value) {
+				value = make([]byte, record.Size)
+			}
+			cache.Set(key, value[:record.Size])
+		case Delete:
+			result.Deletes++
+			cache.Delete(key)
+		}
+	}
+}
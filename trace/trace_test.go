@@ -0,0 +1,94 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	t.Parallel()
+	var buffer bytes.Buffer
+	recorder, _ := NewRecorder(&buffer)
+	start := time.Unix(1000, 0)
+	now := start
+	recorder.now = func() time.Time { return now }
+
+	recorder.Record(Set, "key", 5)
+	now = now.Add(time.Millisecond)
+	recorder.Record(Get, "key", 5)
+	now = now.Add(-time.Millisecond)
+	recorder.Record(Delete, "key", 0)
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewReader(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{Time: start, Op: Set, Size: 5},
+		{Time: start.Add(time.Millisecond), Op: Get, Size: 5},
+		{Time: start.Add(time.Millisecond), Op: Delete},
+	}
+	for i, w := range want {
+		record, err := reader.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !record.Time.Equal(w.Time) || record.Op != w.Op || record.Size != w.Size {
+			t.Errorf("record %d, want: %+v; got: %+v", i, w, record)
+		}
+		if record.Hash == 0 {
+			t.Errorf("record %d has no hash", i)
+		}
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("want: %v; got: %v", io.EOF, err)
+	}
+}
+
+func TestInvalidTrace(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewReader(bytes.NewBufferString("not a trace")); err != ErrInvalidTrace {
+		t.Errorf("want: %v; got: %v", ErrInvalidTrace, err)
+	}
+	reader, _ := NewReader(bytes.NewBufferString(magic + "\x01\x07"))
+	if _, err := reader.Next(); err != ErrInvalidTrace {
+		t.Errorf("want: %v; got: %v", ErrInvalidTrace, err)
+	}
+}
+
+func TestReplayRecordedTraffic(t *testing.T) {
+	t.Parallel()
+	var buffer bytes.Buffer
+	recorder, _ := NewRecorder(&buffer)
+	cache, _ := bigcache.New(context.Background(), bigcache.DefaultConfig(time.Hour))
+	recorded := bigcache.Wrap(cache, recorder.Middleware())
+
+	recorded.Get("key")
+	recorded.Set("key", []byte("value"))
+	recorded.Get("key")
+	recorded.Delete("key")
+	recorded.Set("big", make([]byte, 100))
+	recorder.Close()
+
+	replayed, _ := bigcache.New(context.Background(), bigcache.DefaultConfig(time.Hour))
+	reader, _ := NewReader(&buffer)
+	result, err := Replay(reader, replayed, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Gets != 2 || result.Hits != 1 || result.Sets != 1 || result.Deletes != 1 {
+		t.Errorf("want: 2 gets, 1 hit, 1 set, 1 delete; got: %+v", result)
+	}
+	if replayed.Len() != 0 {
+		t.Errorf("want empty cache; got: %d entries", replayed.Len())
+	}
+}
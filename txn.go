@@ -0,0 +1,117 @@
+package bigcache
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrKeyNotInTransaction is returned by Txn operations on keys which were not passed to DoAtomic
+var ErrKeyNotInTransaction = errors.New("key is not part of the transaction")
+
+// Txn reads and writes entries of keys passed to DoAtomic while their shards are locked
+type Txn interface {
+	// Get reads entry for the key, it returns an ErrEntryNotFound when no entry exists for the given key
+	Get(key string) ([]byte, error)
+	// Set saves entry under the key
+	Set(key string, entry []byte) error
+	// Delete removes the key, it returns an ErrEntryNotFound when no entry exists for the given key
+	Delete(key string) error
+}
+
+// DoAtomic locks shards of all keys in the order of their indices and calls fn, so other operations
+// observe either none or all of the changes made in fn, e.g. when a value is moved from one key to another.
+// Only the keys can be used in fn and the cache must not be called from fn, as its shards are locked.
+// Changes made before fn returns an error are kept, the error is returned.
+func (c *BigCache) DoAtomic(keys []string, fn func(tx Txn) error) error {
+	if err := c.writable(); err != nil {
+		return err
+	}
+	tx := &txn{cache: c, keys: make(map[string]uint64, len(keys))}
+	var shards []int
+	for _, key := range keys {
+		key = c.normalizeKey(key)
+		hashedKey := c.hash.Sum64(key)
+		tx.keys[key] = hashedKey
+		shards = append(shards, int(c.shardIndex(hashedKey)))
+	}
+	sort.Ints(shards)
+	locked := shards[:0]
+	for i, shardIndex := range shards {
+		if i == 0 || shardIndex != shards[i-1] {
+			locked = append(locked, shardIndex)
+		}
+	}
+
+	unlock := func() {
+		for i := len(locked) - 1; i >= 0; i-- {
+			c.shards[locked[i]].lock.Unlock()
+		}
+	}
+	for _, shardIndex := range locked {
+		c.shards[shardIndex].lock.Lock()
+	}
+	var err error
+	unlockOnPanic(unlock, func() { err = fn(tx) })
+	unlock()
+
+	for _, shardIndex := range locked {
+		if recoverErr := c.recoverShardIndex(uint64(shardIndex), nil); recoverErr != nil {
+			return recoverErr
+		}
+	}
+	return err
+}
+
+type txn struct {
+	cache *BigCache
+	keys  map[string]uint64
+}
+
+// shard returns shard of the key, the normalized key and its hash
+func (t *txn) shard(key string) (*cacheShard, string, uint64, error) {
+	key = t.cache.normalizeKey(key)
+	hashedKey, ok := t.keys[key]
+	if !ok {
+		return nil, key, 0, ErrKeyNotInTransaction
+	}
+	return t.cache.getShard(hashedKey), key, hashedKey, nil
+}
+
+func (t *txn) Get(key string) ([]byte, error) {
+	s, key, hashedKey, err := t.shard(key)
+	if err != nil {
+		return nil, err
+	}
+	wrappedEntry, err := s.getValidWrapEntry(key, hashedKey)
+	if err != nil {
+		return nil, err
+	}
+	return readEntry(wrappedEntry), nil
+}
+
+func (t *txn) Set(key string, entry []byte) error {
+	s, key, hashedKey, err := t.shard(key)
+	if err != nil {
+		return err
+	}
+	if err := t.cache.checkKeyLength(key); err != nil {
+		return err
+	}
+	return s.setWithoutLock(uint64(s.clock.Epoch()), key, hashedKey, entry)
+}
+
+func (t *txn) Delete(key string) error {
+	s, key, hashedKey, err := t.shard(key)
+	if err != nil {
+		return err
+	}
+	if itemIndex := s.hashmap[hashedKey]; itemIndex != 0 {
+		if wrappedEntry, err := s.entries.Get(int(itemIndex)); err == nil && compareKeyFromEntry(wrappedEntry, key) {
+			s.deleteEntry(wrappedEntry, hashedKey)
+			s.delhit()
+			return nil
+		}
+	}
+	s.delmiss()
+	return ErrEntryNotFound
+}
@@ -0,0 +1,144 @@
+package bigcache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDoAtomicMovesValue(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	cache.Set("a", []byte("value"))
+
+	// when
+	err := cache.DoAtomic([]string{"a", "b"}, func(tx Txn) error {
+		value, err := tx.Get("a")
+		if err != nil {
+			return err
+		}
+		if err := tx.Set("b", value); err != nil {
+			return err
+		}
+		return tx.Delete("a")
+	})
+
+	// then
+	noError(t, err)
+	_, err = cache.Get("a")
+	assertEqual(t, ErrEntryNotFound, err)
+	value, err := cache.Get("b")
+	noError(t, err)
+	assertEqual(t, []byte("value"), value)
+}
+
+func TestDoAtomicRejectsOtherKeys(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+
+	// when
+	err := cache.DoAtomic([]string{"a"}, func(tx Txn) error {
+		return tx.Set("b", []byte("value"))
+	})
+
+	// then
+	assertEqual(t, ErrKeyNotInTransaction, err)
+	assertEqual(t, 0, cache.Len())
+}
+
+func TestDoAtomicKeepsInvariant(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             16,
+		LifeWindow:         time.Minute,
+		MaxEntriesInWindow: 100,
+		MaxEntrySize:       16,
+	})
+	keys := []string{"account1", "account2", "account3"}
+	for _, key := range keys {
+		cache.Set(key, []byte("100"))
+	}
+	transfer := func(from, to string) error {
+		return cache.DoAtomic([]string{from, to}, func(tx Txn) error {
+			a, _ := tx.Get(from)
+			b, _ := tx.Get(to)
+			x, _ := strconv.Atoi(string(a))
+			y, _ := strconv.Atoi(string(b))
+			tx.Set(from, []byte(strconv.Itoa(x-1)))
+			return tx.Set(to, []byte(strconv.Itoa(y+1)))
+		})
+	}
+
+	// when
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				transfer(keys[i], keys[(i+1)%3])
+				transfer(keys[(i+2)%3], keys[i])
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// then
+	sum := 0
+	for _, key := range keys {
+		value, _ := cache.Get(key)
+		n, _ := strconv.Atoi(string(value))
+		sum += n
+	}
+	assertEqual(t, 300, sum)
+}
+
+func TestDoAtomicReturnsError(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+	failure := fmt.Errorf("failure")
+
+	// when
+	err := cache.DoAtomic([]string{"a", "a"}, func(tx Txn) error {
+		return failure
+	})
+
+	// then
+	assertEqual(t, failure, err)
+	noError(t, cache.Set("a", []byte("value")))
+}
+
+func TestDoAtomicReleasesLocksWhenFnPanics(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), DefaultConfig(time.Minute))
+	defer cache.Close()
+
+	// when
+	recovered := panicValue(func() {
+		cache.DoAtomic([]string{"a", "b"}, func(tx Txn) error {
+			tx.Set("a", []byte("value"))
+			panic("fn")
+		})
+	})
+
+	// then
+	assertEqual(t, "fn", recovered)
+	noError(t, cache.Set("a", []byte("other")))
+	noError(t, cache.Set("b", []byte("other")))
+}
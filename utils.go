@@ -7,6 +7,13 @@ func max(a, b int) int {
 	return b
 }
 
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 func convertMBToBytes(value int) int {
 	return value * 1024 * 1024
 }
@@ -14,3 +21,10 @@ func convertMBToBytes(value int) int {
 func isPowerOfTwo(number int) bool {
 	return (number != 0) && (number&(number-1)) == 0
 }
+
+func boolToInt32(value bool) int32 {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,63 @@
+package bigcache
+
+import "fmt"
+
+// Problem describes a broken internal invariant found by Verify
+type Problem struct {
+	Shard   int    // Index of the shard with the problem
+	Hash    uint64 // Hashed key of the broken entry, zero when the problem concerns the queue
+	Message string // Description of the problem
+}
+
+func (p Problem) String() string {
+	if p.Hash == 0 {
+		return fmt.Sprintf("shard %d: %s", p.Shard, p.Message)
+	}
+	return fmt.Sprintf("shard %d, hash %d: %s", p.Shard, p.Hash, p.Message)
+}
+
+// Verify checks internal invariants of all shards: consistency of queue pointers and that every
+// key of the hashmap points to a live and well-formed entry in the queue storing the same hash. It returns nil when
+// no problem was found. Every shard is read locked while its entries are walked, so it is meant
+// for debugging corrupted caches rather than for regular use.
+func (c *BigCache) Verify() []Problem {
+	var problems []Problem
+	for i, shard := range c.shards {
+		problems = shard.verify(i, problems)
+	}
+	return problems
+}
+
+// verify appends problems found in the shard to problems
+func (s *cacheShard) verify(id int, problems []Problem) []Problem {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if err := s.entries.Verify(); err != nil {
+		return append(problems, Problem{Shard: id, Message: err.Error()})
+	}
+	live := make(map[uint64]bool, s.entries.Len())
+	s.entries.Iterate(func(index int, data []byte) bool {
+		live[uint64(index)] = true
+		return true
+	})
+	for hash, index := range s.hashmap {
+		if !live[index] {
+			problems = append(problems, Problem{Shard: id, Hash: hash,
+				Message: fmt.Sprintf("index %d does not point to a live entry", index)})
+			continue
+		}
+		wrappedEntry, err := s.entries.Get(int(index))
+		switch {
+		case err != nil:
+			problems = append(problems, Problem{Shard: id, Hash: hash, Message: err.Error()})
+		case !isValidEntry(wrappedEntry):
+			problems = append(problems, Problem{Shard: id, Hash: hash,
+				Message: fmt.Sprintf("entry at index %d is malformed or has invalid checksum", index)})
+		case readHashFromEntry(wrappedEntry) != hash:
+			problems = append(problems, Problem{Shard: id, Hash: hash,
+				Message: fmt.Sprintf("entry at index %d stores hash %d", index, readHashFromEntry(wrappedEntry))})
+		}
+	}
+	return problems
+}
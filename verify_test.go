@@ -0,0 +1,66 @@
+package bigcache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             4,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       16,
+		HardMaxCacheSize:   1,
+	})
+	for i := 0; i < 10000; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)))
+		if i%3 == 0 {
+			cache.Delete(fmt.Sprintf("key%d", i/2))
+		}
+	}
+
+	// when
+	problems := cache.Verify()
+
+	// then
+	assertEqual(t, 0, len(problems))
+}
+
+func TestVerifyReportsCorruption(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache, _ := New(context.Background(), Config{
+		Shards:             1,
+		LifeWindow:         time.Second,
+		MaxEntriesInWindow: 10,
+		MaxEntrySize:       256,
+		Hasher:             hashStub(5),
+	})
+	cache.Set("key", []byte("value"))
+	shard := cache.shards[0]
+
+	// when
+	shard.hashmap[6] = shard.hashmap[5]
+	shard.hashmap[7] = shard.hashmap[5] + 1
+	problems := cache.Verify()
+
+	// then
+	assertEqual(t, 2, len(problems))
+	for _, problem := range problems {
+		switch problem.Hash {
+		case 6:
+			assertEqual(t, "shard 0, hash 6: entry at index 1 stores hash 5", problem.String())
+		case 7:
+			assertEqual(t, "shard 0, hash 7: index 2 does not point to a live entry", problem.String())
+		default:
+			t.Errorf("unexpected problem %v", problem)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package bigcache
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// xxh3 is the 64-bit XXH3 hash with seed 0 and the default secret, compatible with XXH3_64bits
+// of the reference implementation, used for value digests stored with Config.EntryDigest
+
+const (
+	xxhPrime32_1 = 0x9E3779B1
+	xxhPrime32_2 = 0x85EBCA77
+	xxhPrime32_3 = 0xC2B2AE3D
+	xxhPrime64_1 = 0x9E3779B185EBCA87
+	xxhPrime64_2 = 0xC2B2AE3D27D4EB4F
+	xxhPrime64_3 = 0x165667B19E3779F9
+	xxhPrime64_4 = 0x85EBCA77C2B2AE63
+	xxhPrime64_5 = 0x27D4EB2F165667C5
+	xxhPrimeMx1  = 0x165667919E3779F9
+	xxhPrimeMx2  = 0x9FB21C651E98DF25
+
+	xxhStripeLen        = 64
+	xxhSecretConsume    = 8
+	xxhStripesPerBlock  = (len(xxhSecret) - xxhStripeLen) / xxhSecretConsume
+	xxhBlockLen         = xxhStripeLen * xxhStripesPerBlock
+	xxhMidSizeOffset    = 3
+	xxhMidSizeLastStart = 136 - 17
+	xxhLastAccStart     = 7
+	xxhMergeAccsStart   = 11
+)
+
+var xxhSecret = [192]byte{
+	0xb8, 0xfe, 0x6c, 0x39, 0x23, 0xa4, 0x4b, 0xbe, 0x7c, 0x01, 0x81, 0x2c, 0xf7, 0x21, 0xad, 0x1c,
+	0xde, 0xd4, 0x6d, 0xe9, 0x83, 0x90, 0x97, 0xdb, 0x72, 0x40, 0xa4, 0xa4, 0xb7, 0xb3, 0x67, 0x1f,
+	0xcb, 0x79, 0xe6, 0x4e, 0xcc, 0xc0, 0xe5, 0x78, 0x82, 0x5a, 0xd0, 0x7d, 0xcc, 0xff, 0x72, 0x21,
+	0xb8, 0x08, 0x46, 0x74, 0xf7, 0x43, 0x24, 0x8e, 0xe0, 0x35, 0x90, 0xe6, 0x81, 0x3a, 0x26, 0x4c,
+	0x3c, 0x28, 0x52, 0xbb, 0x91, 0xc3, 0x00, 0xcb, 0x88, 0xd0, 0x65, 0x8b, 0x1b, 0x53, 0x2e, 0xa3,
+	0x71, 0x64, 0x48, 0x97, 0xa2, 0x0d, 0xf9, 0x4e, 0x38, 0x19, 0xef, 0x46, 0xa9, 0xde, 0xac, 0xd8,
+	0xa8, 0xfa, 0x76, 0x3f, 0xe3, 0x9c, 0x34, 0x3f, 0xf9, 0xdc, 0xbb, 0xc7, 0xc7, 0x0b, 0x4f, 0x1d,
+	0x8a, 0x51, 0xe0, 0x4b, 0xcd, 0xb4, 0x59, 0x31, 0xc8, 0x9f, 0x7e, 0xc9, 0xd9, 0x78, 0x73, 0x64,
+	0xea, 0xc5, 0xac, 0x83, 0x34, 0xd3, 0xeb, 0xc3, 0xc5, 0x81, 0xa0, 0xff, 0xfa, 0x13, 0x63, 0xeb,
+	0x17, 0x0d, 0xdd, 0x51, 0xb7, 0xf0, 0xda, 0x49, 0xd3, 0x16, 0x55, 0x26, 0x29, 0xd4, 0x68, 0x9e,
+	0x2b, 0x16, 0xbe, 0x58, 0x7d, 0x47, 0xa1, 0xfc, 0x8f, 0xf8, 0xb8, 0xd1, 0x7a, 0xd0, 0x31, 0xce,
+	0x45, 0xcb, 0x3a, 0x8f, 0x95, 0x16, 0x04, 0x28, 0xaf, 0xd7, 0xfb, 0xca, 0xbb, 0x4b, 0x40, 0x7e,
+}
+
+func xxh3(b []byte) uint64 {
+	n := len(b)
+	switch {
+	case n == 0:
+		return xxh64Avalanche(xxhSecret64(56) ^ xxhSecret64(64))
+	case n <= 3:
+		combined := uint32(b[0])<<16 | uint32(b[n>>1])<<24 | uint32(b[n-1]) | uint32(n)<<8
+		return xxh64Avalanche(uint64(combined) ^ uint64(xxhSecret32(0)^xxhSecret32(4)))
+	case n <= 8:
+		input := uint64(binary.LittleEndian.Uint32(b[n-4:])) + uint64(binary.LittleEndian.Uint32(b))<<32
+		return xxhRrmxmx(input^(xxhSecret64(8)^xxhSecret64(16)), uint64(n))
+	case n <= 16:
+		low := binary.LittleEndian.Uint64(b) ^ (xxhSecret64(24) ^ xxhSecret64(32))
+		high := binary.LittleEndian.Uint64(b[n-8:]) ^ (xxhSecret64(40) ^ xxhSecret64(48))
+		return xxh3Avalanche(uint64(n) + bits.ReverseBytes64(low) + high + xxhMulFold(low, high))
+	case n <= 128:
+		acc := uint64(n) * xxhPrime64_1
+		if n > 32 {
+			if n > 64 {
+				if n > 96 {
+					acc += xxhMix16(b[48:], 96) + xxhMix16(b[n-64:], 112)
+				}
+				acc += xxhMix16(b[32:], 64) + xxhMix16(b[n-48:], 80)
+			}
+			acc += xxhMix16(b[16:], 32) + xxhMix16(b[n-32:], 48)
+		}
+		acc += xxhMix16(b, 0) + xxhMix16(b[n-16:], 16)
+		return xxh3Avalanche(acc)
+	case n <= 240:
+		acc := uint64(n) * xxhPrime64_1
+		for i := 0; i < 8; i++ {
+			acc += xxhMix16(b[16*i:], 16*i)
+		}
+		acc = xxh3Avalanche(acc)
+		for i := 8; i < n/16; i++ {
+			acc += xxhMix16(b[16*i:], 16*(i-8)+xxhMidSizeOffset)
+		}
+		acc += xxhMix16(b[n-16:], xxhMidSizeLastStart)
+		return xxh3Avalanche(acc)
+	}
+	return xxh3Long(b)
+}
+
+// xxh3Long hashes inputs longer than 240 bytes in stripes accumulated in 8 lanes
+func xxh3Long(b []byte) uint64 {
+	acc := [8]uint64{
+		xxhPrime32_3, xxhPrime64_1, xxhPrime64_2, xxhPrime64_3,
+		xxhPrime64_4, xxhPrime32_2, xxhPrime64_5, xxhPrime32_1,
+	}
+	n := len(b)
+	blocks := (n - 1) / xxhBlockLen
+	for i := 0; i < blocks; i++ {
+		block := b[i*xxhBlockLen:]
+		for s := 0; s < xxhStripesPerBlock; s++ {
+			xxhAccumulate(&acc, block[s*xxhStripeLen:], s*xxhSecretConsume)
+		}
+		xxhScramble(&acc)
+	}
+	last := b[blocks*xxhBlockLen:]
+	for s := 0; s < (n-1-blocks*xxhBlockLen)/xxhStripeLen; s++ {
+		xxhAccumulate(&acc, last[s*xxhStripeLen:], s*xxhSecretConsume)
+	}
+	xxhAccumulate(&acc, b[n-xxhStripeLen:], len(xxhSecret)-xxhStripeLen-xxhLastAccStart)
+
+	result := uint64(n) * xxhPrime64_1
+	for i := 0; i < 4; i++ {
+		offset := xxhMergeAccsStart + 16*i
+		result += xxhMulFold(acc[2*i]^xxhSecret64(offset), acc[2*i+1]^xxhSecret64(offset+8))
+	}
+	return xxh3Avalanche(result)
+}
+
+func xxhAccumulate(acc *[8]uint64, stripe []byte, secretOffset int) {
+	for i := 0; i < 8; i++ {
+		value := binary.LittleEndian.Uint64(stripe[8*i:])
+		key := value ^ xxhSecret64(secretOffset+8*i)
+		acc[i^1] += value
+		acc[i] += (key & 0xFFFFFFFF) * (key >> 32)
+	}
+}
+
+func xxhScramble(acc *[8]uint64) {
+	for i := range acc {
+		a := acc[i]
+		a ^= a >> 47
+		a ^= xxhSecret64(len(xxhSecret) - xxhStripeLen + 8*i)
+		acc[i] = a * xxhPrime32_1
+	}
+}
+
+func xxhMix16(b []byte, secretOffset int) uint64 {
+	return xxhMulFold(
+		binary.LittleEndian.Uint64(b)^xxhSecret64(secretOffset),
+		binary.LittleEndian.Uint64(b[8:])^xxhSecret64(secretOffset+8),
+	)
+}
+
+func xxhMulFold(a, b uint64) uint64 {
+	high, low := bits.Mul64(a, b)
+	return high ^ low
+}
+
+func xxhSecret64(offset int) uint64 {
+	return binary.LittleEndian.Uint64(xxhSecret[offset:])
+}
+
+func xxhSecret32(offset int) uint32 {
+	return binary.LittleEndian.Uint32(xxhSecret[offset:])
+}
+
+func xxh64Avalanche(h uint64) uint64 {
+	h ^= h >> 33
+	h *= xxhPrime64_2
+	h ^= h >> 29
+	h *= xxhPrime64_3
+	return h ^ h>>32
+}
+
+func xxh3Avalanche(h uint64) uint64 {
+	h ^= h >> 37
+	h *= xxhPrimeMx1
+	return h ^ h>>32
+}
+
+func xxhRrmxmx(h uint64, n uint64) uint64 {
+	h ^= bits.RotateLeft64(h, 49) ^ bits.RotateLeft64(h, 24)
+	h *= xxhPrimeMx2
+	h ^= (h >> 35) + n
+	h *= xxhPrimeMx2
+	return h ^ h>>28
+}
@@ -0,0 +1,40 @@
+package bigcache
+
+import "testing"
+
+func TestXXH3(t *testing.T) {
+	t.Parallel()
+
+	// given
+	input := make([]byte, 5000)
+	for i := range input {
+		input[i] = byte(uint64(i) * 2654435761 >> 7)
+	}
+
+	// expected hashes computed with XXH3_64bits of the reference implementation,
+	// covering every length class: empty, 1-3, 4-8, 9-16, 17-128, 129-240 and long inputs
+	for _, testCase := range []struct {
+		length int
+		hash   uint64
+	}{
+		{0, 3244421341483603138},
+		{2, 531151228712552810},
+		{8, 11840631718339523579},
+		{16, 3391295554364514634},
+		{128, 7291663782006800334},
+		{240, 9991220364441358806},
+		{241, 15974593488783892587},
+		{511, 9815440649157954914},
+		{1025, 14208995566692071108},
+		{1089, 1920807308141612965},
+		{5000, 2754721523052029345},
+	} {
+		// when
+		hash := xxh3(input[:testCase.length])
+
+		// then
+		if hash != testCase.hash {
+			t.Errorf("xxh3 of %d bytes = %d want %d", testCase.length, hash, testCase.hash)
+		}
+	}
+}